@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Action responds to a detected anomaly
+type Action interface {
+	// Name identifies the action in errors and logs
+	Name() string
+	// Execute performs the action for one anomaly
+	Execute(ctx context.Context, anomaly Anomaly) error
+}
+
+// ActionFilter decides whether an action applies to an anomaly
+type ActionFilter func(anomaly Anomaly) bool
+
+// MinScore applies an action only to anomalies scoring above score
+func MinScore(score float64) ActionFilter {
+	return func(anomaly Anomaly) bool { return anomaly.Score > score }
+}
+
+// OfKind applies an action only to anomalies of the given kinds
+func OfKind(kinds ...AnomalyKind) ActionFilter {
+	return func(anomaly Anomaly) bool {
+		for _, kind := range kinds {
+			if anomaly.Type == kind {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ActionStep is an action with the filters that must all pass for it to run
+type ActionStep struct {
+	Action  Action
+	Filters []ActionFilter
+	// RunWhenSuppressed also runs the action for anomalies suppressed by a
+	// maintenance window, for actions that record rather than respond
+	RunWhenSuppressed bool
+}
+
+// applies reports whether every filter passes for the anomaly
+func (s ActionStep) applies(anomaly Anomaly) bool {
+	for _, filter := range s.Filters {
+		if !filter(anomaly) {
+			return false
+		}
+	}
+	return true
+}
+
+// ActionPipeline passes each anomaly through its steps in the order they
+// were configured. A failing action does not stop later ones.
+type ActionPipeline struct {
+	steps []ActionStep
+
+	// Maintenance suppresses actions for anomalies inside its windows (optional)
+	Maintenance *MaintenanceSchedule
+}
+
+// NewActionPipeline creates a pipeline running steps in order
+func NewActionPipeline(steps ...ActionStep) *ActionPipeline {
+	return &ActionPipeline{steps: steps}
+}
+
+// Process runs the applicable actions for each anomaly, returning the
+// errors of all failed actions joined together. Anomalies inside a
+// maintenance window are tagged as suppressed and passed only to steps with
+// RunWhenSuppressed set.
+func (p *ActionPipeline) Process(ctx context.Context, anomalies ...Anomaly) error {
+	var errs []error
+	for _, anomaly := range anomalies {
+		if p.Maintenance.Suppresses(anomaly) {
+			anomaly.Suppressed = true
+		}
+		for _, step := range p.steps {
+			if anomaly.Suppressed && !step.RunWhenSuppressed {
+				continue
+			}
+			if !step.applies(anomaly) {
+				continue
+			}
+			if err := step.Action.Execute(ctx, anomaly); err != nil {
+				errs = append(errs, fmt.Errorf("%s action for %s anomaly: %w", step.Action.Name(), anomaly.Type, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AlertAction notifies an alerting system of the anomaly. With no Notify
+// function the anomaly is logged.
+type AlertAction struct {
+	Notify func(ctx context.Context, anomaly Anomaly) error
+}
+
+// Name returns "alert"
+func (a AlertAction) Name() string { return "alert" }
+
+// Execute sends the alert
+func (a AlertAction) Execute(ctx context.Context, anomaly Anomaly) error {
+	if a.Notify == nil {
+		log.Printf("ALERT %s (score %.2f, threshold %.2f): %s", anomaly.Type, anomaly.Score, anomaly.Threshold, anomaly.Description)
+		return nil
+	}
+	return a.Notify(ctx, anomaly)
+}
+
+// QuarantineAction publishes anomalies to a quarantine topic for review,
+// keyed by RequestID
+type QuarantineAction struct {
+	kafkaEmitter
+}
+
+// NewQuarantineAction creates an action writing anomalies to topic. opts
+// configure its producer as they do for NewTelemetryProducer.
+func NewQuarantineAction(brokers []string, topic string, opts ...ProducerOption) *QuarantineAction {
+	return &QuarantineAction{newKafkaEmitter(brokers, topic, opts...)}
+}
+
+// Name returns "quarantine"
+func (a *QuarantineAction) Name() string { return "quarantine" }
+
+// Execute writes the anomaly to the quarantine topic
+func (a *QuarantineAction) Execute(ctx context.Context, anomaly Anomaly) error {
+	value, err := json.Marshal(anomaly)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly: %w", err)
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(anomaly.RequestID),
+		Value: value,
+		Time:  time.Now(),
+	}
+	if err := a.producer.sendRaw(ctx, msg); err != nil {
+		return fmt.Errorf("failed to quarantine anomaly: %w", err)
+	}
+	return nil
+}
+
+// RateLimitUserAction marks the anomaly's user as rate limited for a period.
+// Callers check Limited before serving the user's next request.
+type RateLimitUserAction struct {
+	duration time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	limited map[string]time.Time
+}
+
+// NewRateLimitUserAction creates an action limiting users for duration
+func NewRateLimitUserAction(duration time.Duration) *RateLimitUserAction {
+	return &RateLimitUserAction{
+		duration: duration,
+		now:      time.Now,
+		limited:  make(map[string]time.Time),
+	}
+}
+
+// Name returns "rate_limit_user"
+func (a *RateLimitUserAction) Name() string { return "rate_limit_user" }
+
+// Execute limits the anomaly's user, extending any existing limit
+func (a *RateLimitUserAction) Execute(ctx context.Context, anomaly Anomaly) error {
+	if anomaly.UserID == "" {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.limited[anomaly.UserID] = a.now().Add(a.duration)
+	return nil
+}
+
+// Limited reports whether the user is currently rate limited
+func (a *RateLimitUserAction) Limited(userID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	until, ok := a.limited[userID]
+	if ok && !a.now().Before(until) {
+		delete(a.limited, userID)
+		return false
+	}
+	return ok
+}
+
+// MetricAction counts anomalies per kind
+type MetricAction struct {
+	mu     sync.Mutex
+	counts map[AnomalyKind]int
+}
+
+// NewMetricAction creates an action with zeroed counters
+func NewMetricAction() *MetricAction {
+	return &MetricAction{counts: make(map[AnomalyKind]int)}
+}
+
+// Name returns "increment_metric"
+func (a *MetricAction) Name() string { return "increment_metric" }
+
+// Execute increments the counter for the anomaly's kind
+func (a *MetricAction) Execute(ctx context.Context, anomaly Anomaly) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.counts[anomaly.Type]++
+	return nil
+}
+
+// Counts returns a copy of the counters
+func (a *MetricAction) Counts() map[AnomalyKind]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	counts := make(map[AnomalyKind]int, len(a.counts))
+	for kind, n := range a.counts {
+		counts[kind] = n
+	}
+	return counts
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// recordingAction records the order actions run in
+type recordingAction struct {
+	name string
+	log  *[]string
+	err  error
+}
+
+func (a recordingAction) Name() string { return a.name }
+
+func (a recordingAction) Execute(ctx context.Context, anomaly Anomaly) error {
+	*a.log = append(*a.log, a.name+":"+anomaly.RequestID)
+	return a.err
+}
+
+func TestActionPipelineFiltersByScore(t *testing.T) {
+	w := &fakeWriter{}
+	quarantine := &QuarantineAction{kafkaEmitter{producer: newTestProducer(w)}}
+	rateLimit := NewRateLimitUserAction(time.Minute)
+	metric := NewMetricAction()
+
+	var alerts []Anomaly
+	alert := AlertAction{Notify: func(ctx context.Context, a Anomaly) error {
+		alerts = append(alerts, a)
+		return nil
+	}}
+
+	pipeline := NewActionPipeline(
+		ActionStep{Action: metric},
+		ActionStep{Action: alert, Filters: []ActionFilter{MinScore(0.8)}},
+		ActionStep{Action: quarantine, Filters: []ActionFilter{MinScore(0.8)}},
+		ActionStep{Action: rateLimit, Filters: []ActionFilter{MinScore(0.8), OfKind(AnomalySuspiciousPattern)}},
+	)
+
+	high := newAnomaly(AnomalySuspiciousPattern, testEvent("req-high"), 0.95, 0.8, "burst")
+	low := newAnomaly(AnomalySuspiciousPattern, testEvent("req-low"), 0.5, 0.8, "burst")
+	low.UserID = "user-2"
+
+	if err := pipeline.Process(context.Background(), high, low); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	if len(alerts) != 1 || alerts[0].RequestID != "req-high" {
+		t.Errorf("alerts = %+v, want only req-high", alerts)
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != 1 || string(msgs[0].Key) != "req-high" {
+		t.Fatalf("quarantined %d anomalies, want only req-high", len(msgs))
+	}
+	var quarantined Anomaly
+	if err := json.Unmarshal(msgs[0].Value, &quarantined); err != nil || quarantined.Type != AnomalySuspiciousPattern {
+		t.Errorf("quarantined = %+v, %v", quarantined, err)
+	}
+
+	if !rateLimit.Limited("user-1") || rateLimit.Limited("user-2") {
+		t.Error("want only user-1 rate limited")
+	}
+	if got := metric.Counts()[AnomalySuspiciousPattern]; got != 2 {
+		t.Errorf("metric count = %d, want 2 (unfiltered)", got)
+	}
+}
+
+func TestActionPipelineOrderAndErrors(t *testing.T) {
+	var order []string
+	errAlert := errors.New("pager unavailable")
+
+	pipeline := NewActionPipeline(
+		ActionStep{Action: recordingAction{name: "first", log: &order}},
+		ActionStep{Action: recordingAction{name: "second", log: &order, err: errAlert}},
+		ActionStep{Action: recordingAction{name: "third", log: &order}},
+	)
+
+	err := pipeline.Process(context.Background(),
+		newAnomaly(AnomalyHighCost, testEvent("req-1"), 1, 0.5, ""),
+		newAnomaly(AnomalyHighCost, testEvent("req-2"), 1, 0.5, ""))
+
+	if !errors.Is(err, errAlert) {
+		t.Errorf("Process = %v, want the failing action's error", err)
+	}
+	want := "first:req-1,second:req-1,third:req-1,first:req-2,second:req-2,third:req-2"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestRateLimitUserActionExpires(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	action := NewRateLimitUserAction(time.Minute)
+	action.now = func() time.Time { return now }
+
+	action.Execute(context.Background(), newAnomaly(AnomalySuspiciousPattern, testEvent("req-1"), 1, 0.5, ""))
+	if !action.Limited("user-1") {
+		t.Fatal("user-1 not limited")
+	}
+
+	now = now.Add(time.Minute)
+	if action.Limited("user-1") {
+		t.Error("user-1 still limited after the duration")
+	}
+}
+
+func TestQuarantineActionAppliesProducerOptions(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.LeaderNotAvailable}}
+	quarantine := NewQuarantineAction([]string{"localhost:9092"}, "llm-quarantine",
+		WithRetry(RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}))
+	quarantine.producer.writer.Close()
+	quarantine.producer.writer = w
+
+	anomaly := newAnomaly(AnomalySuspiciousPattern, testEvent("req-1"), 0.95, 0.8, "burst")
+	if err := quarantine.Execute(context.Background(), anomaly); err != nil {
+		t.Fatalf("Execute = %v, want the leader election retried", err)
+	}
+	if msgs := w.Messages(); len(msgs) != 1 || string(msgs[0].Key) != "req-1" {
+		t.Errorf("quarantined keys %v, want [req-1]", messageKeys(msgs))
+	}
+
+	if err := quarantine.Close(); err != nil || !w.closed {
+		t.Errorf("Close = %v (writer closed %v), want the producer shut down", err, w.closed)
+	}
+}
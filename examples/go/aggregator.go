@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// WindowSummary is the rollup of one model's events within a window, or of
+// one model and feature flag cohort when grouping by flag
+type WindowSummary struct {
+	WindowStart      string  `json:"window_start"`
+	WindowEnd        string  `json:"window_end"`
+	ModelName        string  `json:"model_name"`
+	Flag             string  `json:"flag,omitempty"`
+	Count            int     `json:"count"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUsd          float64 `json:"cost_usd"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	MaxLatencyMs     float64 `json:"max_latency_ms"`
+}
+
+// SummaryEmitter publishes finished window summaries
+type SummaryEmitter interface {
+	EmitSummaries(ctx context.Context, summaries []WindowSummary) error
+}
+
+// AggregatorConfig configures an Aggregator
+type AggregatorConfig struct {
+	// Window is the tumbling window length (default: 1m)
+	Window time.Duration
+	// Emitter receives each finished window's summaries (optional)
+	Emitter SummaryEmitter
+	// GroupByFlag summarizes each model per feature flag cohort. An event
+	// with several flags counts towards each of them; events without flags
+	// form the cohort with an empty Flag.
+	GroupByFlag bool
+	// EventTime buckets events by their Timestamp instead of by arrival
+	// time, so replayed and backfilled events land in the right window
+	EventTime bool
+	// AllowedLateness is how far, in event time, the newest event seen may
+	// pass a window's end before the window is finalized and emitted. Only
+	// used with EventTime.
+	AllowedLateness time.Duration
+	// OnLateEvent receives events whose window was already finalized, and
+	// events whose Timestamp cannot be parsed (optional). Only used with
+	// EventTime.
+	OnLateEvent func(event TelemetryEvent)
+}
+
+// Aggregator rolls events up per model over tumbling windows. By default
+// windows follow processing time and end on a timer; with EventTime they
+// follow event timestamps and end once the watermark, the newest event time
+// seen, passes their end plus AllowedLateness. Finished windows' summaries
+// are passed to the emitter; Close flushes the windows in progress so no
+// rollups are lost on shutdown.
+type Aggregator struct {
+	mu        sync.Mutex
+	config    AggregatorConfig
+	now       func() time.Time
+	windows   map[int64]*aggregateWindow
+	current   time.Time
+	watermark time.Time
+	late      int
+	invalid   int
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// aggregateWindow holds the groups of one open window
+type aggregateWindow struct {
+	start      time.Time
+	groups     map[string]*WindowSummary
+	latencySum map[string]float64
+}
+
+// NewAggregator creates an aggregator and, for processing-time windows,
+// starts its window timer
+func NewAggregator(config AggregatorConfig) *Aggregator {
+	a := newAggregator(config, time.Now)
+
+	if !a.config.EventTime {
+		a.wg.Add(1)
+		go a.run()
+	}
+
+	return a
+}
+
+// newAggregator creates an aggregator without starting its window timer
+func newAggregator(config AggregatorConfig, now func() time.Time) *Aggregator {
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.AllowedLateness < 0 {
+		config.AllowedLateness = 0
+	}
+
+	return &Aggregator{
+		config:  config,
+		now:     now,
+		windows: make(map[int64]*aggregateWindow),
+		current: now().Truncate(config.Window),
+		done:    make(chan struct{}),
+	}
+}
+
+// Observe adds the event to its window. In processing time this first
+// emits the previous window if it has ended; in event time it emits every
+// window the event's timestamp moves the watermark past.
+func (a *Aggregator) Observe(event TelemetryEvent) {
+	if a.config.EventTime {
+		a.observeEventTime(event)
+		return
+	}
+
+	a.mu.Lock()
+	finished := a.rotateLocked(a.now())
+	a.addLocked(a.current, event)
+	a.mu.Unlock()
+
+	a.emit(context.Background(), finished)
+}
+
+// observeEventTime adds the event to the window of its timestamp, or passes
+// it to OnLateEvent when that window has been finalized. An event whose
+// timestamp cannot be parsed is passed to OnLateEvent too, rather than
+// bucketed at the current time, which would move the watermark forward and
+// finalize windows early.
+func (a *Aggregator) observeEventTime(event TelemetryEvent) {
+	ts, err := time.Parse(time.RFC3339Nano, event.Timestamp)
+	if err != nil {
+		a.mu.Lock()
+		a.invalid++
+		a.mu.Unlock()
+
+		if a.config.OnLateEvent != nil {
+			a.config.OnLateEvent(event)
+		}
+		return
+	}
+	start := ts.Truncate(a.config.Window)
+
+	a.mu.Lock()
+	if a.finalizedLocked(start) {
+		a.late++
+		a.mu.Unlock()
+
+		if a.config.OnLateEvent != nil {
+			a.config.OnLateEvent(event)
+		}
+		return
+	}
+
+	a.addLocked(start, event)
+	if ts.After(a.watermark) {
+		a.watermark = ts
+	}
+	finished := a.finalizeLocked()
+	a.mu.Unlock()
+
+	a.emit(context.Background(), finished)
+}
+
+// addLocked adds the event to the window starting at start, once per flag cohort
+func (a *Aggregator) addLocked(start time.Time, event TelemetryEvent) {
+	window := a.windowLocked(start)
+	for _, flag := range a.flagCohorts(event) {
+		window.add(event, flag)
+	}
+}
+
+// add adds the event to the group for its model and flag cohort
+func (w *aggregateWindow) add(event TelemetryEvent, flag string) {
+	key := event.ModelName + "\x00" + flag
+	summary, ok := w.groups[key]
+	if !ok {
+		summary = &WindowSummary{ModelName: event.ModelName, Flag: flag}
+		w.groups[key] = summary
+	}
+
+	summary.Count++
+	if event.ErrorCode != "" {
+		summary.Errors++
+	}
+	summary.PromptTokens += event.PromptTokens
+	summary.CompletionTokens += event.CompletionTokens
+	summary.TotalTokens += event.TotalTokens
+	summary.CostUsd += event.CostUsd
+	if event.LatencyMs > summary.MaxLatencyMs {
+		summary.MaxLatencyMs = event.LatencyMs
+	}
+	w.latencySum[key] += event.LatencyMs
+}
+
+// flagCohorts returns the flag cohorts the event is summarized under
+func (a *Aggregator) flagCohorts(event TelemetryEvent) []string {
+	if !a.config.GroupByFlag || len(event.Flags) == 0 {
+		return []string{""}
+	}
+	return event.Flags
+}
+
+// Snapshot returns the in-progress summaries of every open window
+func (a *Aggregator) Snapshot() []WindowSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.summariesLocked(a.openStartsLocked()...)
+}
+
+// Late returns the number of events routed to OnLateEvent so far
+func (a *Aggregator) Late() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.late
+}
+
+// Invalid returns the number of events routed to OnLateEvent because their
+// Timestamp could not be parsed
+func (a *Aggregator) Invalid() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.invalid
+}
+
+// Flush emits every open window immediately. In processing time a new
+// window is started; in event time the watermark is kept, so events for
+// windows it has passed are still treated as late.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	starts := a.openStartsLocked()
+	finished := a.summariesLocked(starts...)
+	for _, start := range starts {
+		delete(a.windows, start.UnixNano())
+	}
+	a.current = a.now().Truncate(a.config.Window)
+	a.mu.Unlock()
+
+	return a.emit(ctx, finished)
+}
+
+// Close stops the window timer and flushes the windows in progress.
+// Closing a closed aggregator is a no-op.
+func (a *Aggregator) Close(ctx context.Context) error {
+	var err error
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.wg.Wait()
+
+		err = a.Flush(ctx)
+	})
+	return err
+}
+
+// run emits processing-time windows as they end, even when no new events arrive
+func (a *Aggregator) run() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.config.Window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			finished := a.rotateLocked(a.now())
+			a.mu.Unlock()
+			a.emit(context.Background(), finished)
+		}
+	}
+}
+
+// windowLocked returns the open window starting at start, creating it if needed
+func (a *Aggregator) windowLocked(start time.Time) *aggregateWindow {
+	window, ok := a.windows[start.UnixNano()]
+	if !ok {
+		window = &aggregateWindow{
+			start:      start,
+			groups:     make(map[string]*WindowSummary),
+			latencySum: make(map[string]float64),
+		}
+		a.windows[start.UnixNano()] = window
+	}
+	return window
+}
+
+// rotateLocked starts a new processing-time window if now is past the
+// current one, returning the finished window's summaries
+func (a *Aggregator) rotateLocked(now time.Time) []WindowSummary {
+	if now.Before(a.current.Add(a.config.Window)) {
+		return nil
+	}
+
+	finished := a.summariesLocked(a.current)
+	delete(a.windows, a.current.UnixNano())
+	a.current = now.Truncate(a.config.Window)
+	return finished
+}
+
+// finalizedLocked reports whether the event-time window starting at start
+// has been passed by the watermark
+func (a *Aggregator) finalizedLocked(start time.Time) bool {
+	end := start.Add(a.config.Window).Add(a.config.AllowedLateness)
+	return !a.watermark.Before(end)
+}
+
+// finalizeLocked removes the event-time windows the watermark has passed,
+// returning their summaries
+func (a *Aggregator) finalizeLocked() []WindowSummary {
+	var starts []time.Time
+	for _, start := range a.openStartsLocked() {
+		if a.finalizedLocked(start) {
+			starts = append(starts, start)
+		}
+	}
+
+	finished := a.summariesLocked(starts...)
+	for _, start := range starts {
+		delete(a.windows, start.UnixNano())
+	}
+	return finished
+}
+
+// openStartsLocked returns the start of every open window in time order
+func (a *Aggregator) openStartsLocked() []time.Time {
+	starts := make([]time.Time, 0, len(a.windows))
+	for _, window := range a.windows {
+		starts = append(starts, window.start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
+
+// summariesLocked returns the summaries of the windows starting at starts,
+// sorted by window, model and flag
+func (a *Aggregator) summariesLocked(starts ...time.Time) []WindowSummary {
+	var summaries []WindowSummary
+	for _, start := range starts {
+		window, ok := a.windows[start.UnixNano()]
+		if !ok {
+			continue
+		}
+
+		first := len(summaries)
+		for key, group := range window.groups {
+			summary := *group
+			summary.WindowStart = start.UTC().Format(time.RFC3339Nano)
+			summary.WindowEnd = start.Add(a.config.Window).UTC().Format(time.RFC3339Nano)
+			summary.AvgLatencyMs = window.latencySum[key] / float64(summary.Count)
+			summaries = append(summaries, summary)
+		}
+
+		group := summaries[first:]
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].ModelName != group[j].ModelName {
+				return group[i].ModelName < group[j].ModelName
+			}
+			return group[i].Flag < group[j].Flag
+		})
+	}
+	return summaries
+}
+
+// emit passes summaries to the emitter, logging failures
+func (a *Aggregator) emit(ctx context.Context, summaries []WindowSummary) error {
+	if len(summaries) == 0 || a.config.Emitter == nil {
+		return nil
+	}
+
+	if err := a.config.Emitter.EmitSummaries(ctx, summaries); err != nil {
+		log.Printf("Failed to emit %d window summaries: %v", len(summaries), err)
+		return err
+	}
+	return nil
+}
+
+// KafkaSummaryEmitter publishes window summaries to a Kafka topic using the
+// same writer settings (acks, retries, timeouts) as the telemetry producer
+type KafkaSummaryEmitter struct {
+	kafkaEmitter
+}
+
+// NewKafkaSummaryEmitter creates an emitter writing summaries to topic. opts
+// configure its producer as they do for NewTelemetryProducer.
+func NewKafkaSummaryEmitter(brokers []string, topic string, opts ...ProducerOption) *KafkaSummaryEmitter {
+	return &KafkaSummaryEmitter{newKafkaEmitter(brokers, topic, opts...)}
+}
+
+// EmitSummaries writes one message per summary, keyed by model name
+func (e *KafkaSummaryEmitter) EmitSummaries(ctx context.Context, summaries []WindowSummary) error {
+	msgs := make([]kafka.Message, 0, len(summaries))
+	for _, summary := range summaries {
+		value, err := json.Marshal(summary)
+		if err != nil {
+			return fmt.Errorf("failed to marshal summary: %w", err)
+		}
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(summary.ModelName),
+			Value: value,
+			Time:  time.Now(),
+		})
+	}
+
+	if err := e.producer.sendRaw(ctx, msgs...); err != nil {
+		return fmt.Errorf("failed to send summaries: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func decodeSummaries(t *testing.T, w *fakeWriter) []WindowSummary {
+	t.Helper()
+	var summaries []WindowSummary
+	for _, msg := range w.Messages() {
+		var summary WindowSummary
+		if err := json.Unmarshal(msg.Value, &summary); err != nil {
+			t.Fatalf("invalid summary %q: %v", msg.Value, err)
+		}
+		if string(msg.Key) != summary.ModelName {
+			t.Errorf("summary key = %q, want model %q", msg.Key, summary.ModelName)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestAggregatorSummariesReconcileWithInput(t *testing.T) {
+	w := &fakeWriter{}
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	aggregator := newAggregator(AggregatorConfig{
+		Window:  time.Minute,
+		Emitter: &KafkaSummaryEmitter{kafkaEmitter{producer: newTestProducer(w)}},
+	}, func() time.Time { return now })
+
+	rng := rand.New(rand.NewSource(1))
+	models := []string{"gpt-4", "claude-3-opus"}
+	var wantCount, wantTokens int
+	var wantCost float64
+
+	for i := 0; i < 300; i++ {
+		now = now.Add(time.Duration(rng.Intn(1000)) * time.Millisecond)
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		event.ModelName = models[rng.Intn(len(models))]
+		event.CostUsd = rng.Float64()
+		event.TotalTokens = rng.Intn(1000)
+		aggregator.Observe(event)
+
+		wantCount++
+		wantTokens += event.TotalTokens
+		wantCost += event.CostUsd
+	}
+
+	emittedBeforeClose := len(w.Messages())
+	if emittedBeforeClose == 0 {
+		t.Fatal("expected finished windows to be emitted before shutdown")
+	}
+
+	if err := aggregator.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(w.Messages()) <= emittedBeforeClose {
+		t.Error("expected Close to flush the window in progress")
+	}
+
+	var gotCount, gotTokens int
+	var gotCost float64
+	windows := make(map[string]bool)
+	for _, summary := range decodeSummaries(t, w) {
+		gotCount += summary.Count
+		gotTokens += summary.TotalTokens
+		gotCost += summary.CostUsd
+
+		key := summary.WindowStart + "/" + summary.ModelName
+		if windows[key] {
+			t.Errorf("window %s emitted twice", key)
+		}
+		windows[key] = true
+	}
+
+	if gotCount != wantCount || gotTokens != wantTokens || math.Abs(gotCost-wantCost) > 1e-9 {
+		t.Errorf("summaries total count=%d tokens=%d cost=%.6f, want count=%d tokens=%d cost=%.6f",
+			gotCount, gotTokens, gotCost, wantCount, wantTokens, wantCost)
+	}
+}
+
+func TestAggregatorCloseTwice(t *testing.T) {
+	w := &fakeWriter{}
+	aggregator := NewAggregator(AggregatorConfig{
+		Window:  time.Minute,
+		Emitter: &KafkaSummaryEmitter{kafkaEmitter{producer: newTestProducer(w)}},
+	})
+	aggregator.Observe(testEvent("req-1"))
+
+	if err := aggregator.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	emitted := len(w.Messages())
+	if err := aggregator.Close(context.Background()); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if got := len(w.Messages()); got != emitted {
+		t.Errorf("second Close emitted %d more summaries, want none", got-emitted)
+	}
+}
+
+func TestAggregatorSnapshot(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	aggregator := newAggregator(AggregatorConfig{Window: time.Minute}, func() time.Time { return now })
+
+	for i, latency := range []float64{100, 300} {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		event.LatencyMs = latency
+		aggregator.Observe(event)
+	}
+
+	snapshot := aggregator.Snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(snapshot))
+	}
+	summary := snapshot[0]
+	if summary.Count != 2 || summary.AvgLatencyMs != 200 || summary.MaxLatencyMs != 300 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.WindowStart != "2024-01-15T10:00:00Z" || summary.WindowEnd != "2024-01-15T10:01:00Z" {
+		t.Errorf("window = %s - %s", summary.WindowStart, summary.WindowEnd)
+	}
+}
+
+// summaryRecorder records each batch of emitted summaries
+type summaryRecorder struct {
+	batches [][]WindowSummary
+}
+
+func (r *summaryRecorder) EmitSummaries(ctx context.Context, summaries []WindowSummary) error {
+	r.batches = append(r.batches, summaries)
+	return nil
+}
+
+func TestAggregatorEventTimeWindows(t *testing.T) {
+	recorder := &summaryRecorder{}
+	var late []string
+	aggregator := newAggregator(AggregatorConfig{
+		Window:          time.Minute,
+		Emitter:         recorder,
+		EventTime:       true,
+		AllowedLateness: 30 * time.Second,
+		OnLateEvent:     func(event TelemetryEvent) { late = append(late, event.RequestID) },
+	}, func() time.Time { return time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC) })
+
+	observe := func(id, ts string) {
+		event := testEvent(id)
+		event.Timestamp = "2024-01-15T" + ts + "Z"
+		aggregator.Observe(event)
+	}
+
+	observe("a", "10:00:10")
+	observe("b", "10:01:05")
+	observe("c", "10:00:50") // out of order, but within the allowed lateness
+	if len(recorder.batches) != 0 {
+		t.Fatalf("emitted %v before any window was finalized", recorder.batches)
+	}
+
+	observe("d", "10:01:40") // watermark passes 10:01:30, finalizing 10:00
+	observe("e", "10:00:55") // too late for the finalized window
+	observe("f", "10:02:10")
+	observe("g", "10:02:31") // watermark passes 10:02:30, finalizing 10:01
+
+	if err := aggregator.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []struct {
+		start string
+		count int
+	}{
+		{"2024-01-15T10:00:00Z", 2},
+		{"2024-01-15T10:01:00Z", 2},
+		{"2024-01-15T10:02:00Z", 2},
+	}
+	if len(recorder.batches) != len(want) {
+		t.Fatalf("emitted %d batches, want %d: %+v", len(recorder.batches), len(want), recorder.batches)
+	}
+	for i, w := range want {
+		batch := recorder.batches[i]
+		if len(batch) != 1 || batch[0].WindowStart != w.start || batch[0].Count != w.count {
+			t.Errorf("batch %d = %+v, want one summary of %d events starting %s", i, batch, w.count, w.start)
+		}
+	}
+
+	if len(late) != 1 || late[0] != "e" || aggregator.Late() != 1 {
+		t.Errorf("late events = %v (Late() = %d), want [e]", late, aggregator.Late())
+	}
+}
+
+func TestAggregatorEventTimeBackfill(t *testing.T) {
+	// Replayed events from yesterday are bucketed by their own timestamps,
+	// not by when they are replayed
+	aggregator := newAggregator(AggregatorConfig{Window: time.Hour, EventTime: true}, time.Now)
+
+	for i, ts := range []string{"2024-01-14T09:15:00Z", "2024-01-14T09:45:00Z", "2024-01-14T11:05:00Z"} {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		event.Timestamp = ts
+		aggregator.Observe(event)
+	}
+
+	snapshot := aggregator.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].WindowStart != "2024-01-14T11:00:00Z" {
+		t.Fatalf("open windows = %+v, want only 11:00", snapshot)
+	}
+}
+
+func TestAggregatorEventTimeRejectsUnparsableTimestamps(t *testing.T) {
+	recorder := &summaryRecorder{}
+	var late []string
+	aggregator := newAggregator(AggregatorConfig{
+		Window:      time.Minute,
+		Emitter:     recorder,
+		EventTime:   true,
+		OnLateEvent: func(event TelemetryEvent) { late = append(late, event.RequestID) },
+	}, time.Now)
+
+	event := testEvent("a")
+	event.Timestamp = "2024-01-15T10:00:10Z"
+	aggregator.Observe(event)
+	bad := testEvent("b")
+	bad.Timestamp = "not a timestamp"
+	aggregator.Observe(bad)
+
+	if len(recorder.batches) != 0 {
+		t.Fatalf("emitted %v; an unparsable timestamp moved the watermark", recorder.batches)
+	}
+	if len(late) != 1 || late[0] != "b" || aggregator.Invalid() != 1 || aggregator.Late() != 0 {
+		t.Errorf("late events = %v (Invalid() = %d, Late() = %d), want [b] counted as invalid", late, aggregator.Invalid(), aggregator.Late())
+	}
+	if snapshot := aggregator.Snapshot(); len(snapshot) != 1 || snapshot[0].Count != 1 {
+		t.Errorf("open windows = %+v, want only the valid event", snapshot)
+	}
+}
+
+func TestKafkaSummaryEmitterAppliesWritePolicy(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.LeaderNotAvailable}}
+	emitter := NewKafkaSummaryEmitter([]string{"localhost:9092"}, "llm.summaries",
+		WithRetry(RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}))
+	emitter.producer.writer.Close()
+	emitter.producer.writer = w
+
+	summaries := []WindowSummary{{ModelName: "gpt-4", Count: 3}, {ModelName: "claude-3", Count: 1}}
+	if err := emitter.EmitSummaries(context.Background(), summaries); err != nil {
+		t.Fatalf("EmitSummaries = %v, want the leader election retried", err)
+	}
+	if got := decodeSummaries(t, &w.fakeWriter); len(got) != 2 {
+		t.Errorf("wrote %d summaries, want 2", len(got))
+	}
+	if report := emitter.producer.Report(); report.Sent != 2 || report.Failed != 0 {
+		t.Errorf("Report() = %+v, want 2 sent", report)
+	}
+
+	w.errs, w.calls = []error{kafka.TopicAuthorizationFailed}, 0
+	if err := emitter.EmitSummaries(context.Background(), summaries[:1]); err == nil {
+		t.Error("EmitSummaries succeeded through an authorization failure")
+	}
+	if report := emitter.producer.Report(); report.Failed != 1 {
+		t.Errorf("Failed = %d, want 1", report.Failed)
+	}
+
+	if err := emitter.Close(); err != nil || !w.closed {
+		t.Errorf("Close = %v (writer closed %v), want the producer shut down", err, w.closed)
+	}
+}
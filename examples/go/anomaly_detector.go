@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AnomalyDetectorConfig configures an AnomalyDetector
+type AnomalyDetectorConfig struct {
+	// WindowSize is the number of recent values per model the statistics are computed over (default: 500)
+	WindowSize int
+	// Threshold is the z-score above which a value is flagged (default: 3)
+	Threshold float64
+	// MinSamples is the number of events a model needs before it can be flagged (default: 30)
+	MinSamples int
+	// ScopeByRegion keeps separate windows per model and region, so a region
+	// that is slower or pricier by nature is not flagged against the others.
+	// Events without a region share their model's windows.
+	ScopeByRegion bool
+	// RegionKey is the metadata key holding the event's region (default: "region")
+	RegionKey string
+	// Thresholds are hard limits flagged from the first event, in addition
+	// to statistical outliers (default: unbounded)
+	Thresholds ThresholdConfig
+}
+
+// AnomalyDetector flags events whose latency, total tokens or cost is far
+// above its model's recent values. It keeps a sliding window of each metric
+// per model and flags a value whose z-score against the window's mean and
+// standard deviation exceeds Threshold. Flagged values are left out of the
+// window, so a run of anomalies does not raise the baseline that catches it.
+type AnomalyDetector struct {
+	warmupGate
+
+	mu     sync.Mutex
+	config AnomalyDetectorConfig
+	now    func() time.Time
+	models map[string]*modelStats
+}
+
+// modelStats holds the windows of one model, or of one model and region,
+// one per metric
+type modelStats struct {
+	latency rollingStats
+	tokens  rollingStats
+	cost    rollingStats
+	// touched is the processing time of the latest event, for EvictIdle
+	touched time.Time
+}
+
+// rollingStats is a fixed-size window of values with their running sums
+type rollingStats struct {
+	values []float64
+	next   int
+	sum    float64
+	sumSq  float64
+}
+
+// add appends a value, replacing the oldest once the window holds size values
+func (s *rollingStats) add(value float64, size int) {
+	if len(s.values) < size {
+		s.values = append(s.values, value)
+	} else {
+		old := s.values[s.next]
+		s.sum -= old
+		s.sumSq -= old * old
+		s.values[s.next] = value
+		s.next = (s.next + 1) % size
+	}
+	s.sum += value
+	s.sumSq += value * value
+}
+
+// meanStdDev returns the mean and population standard deviation of the window
+func (s *rollingStats) meanStdDev() (mean, stdDev float64) {
+	n := float64(len(s.values))
+	if n == 0 {
+		return 0, 0
+	}
+	mean = s.sum / n
+	// the running sums can leave a tiny negative variance through rounding
+	return mean, math.Sqrt(math.Max(0, s.sumSq/n-mean*mean))
+}
+
+// zScore returns how many standard deviations value lies above the mean,
+// or zero while the window has no spread
+func (s *rollingStats) zScore(value float64) float64 {
+	mean, stdDev := s.meanStdDev()
+	if stdDev == 0 {
+		return 0
+	}
+	return (value - mean) / stdDev
+}
+
+// NewAnomalyDetector creates a detector, applying defaults for zero config values
+func NewAnomalyDetector(config AnomalyDetectorConfig) *AnomalyDetector {
+	if config.WindowSize <= 0 {
+		config.WindowSize = 500
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 3
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = 30
+	}
+	if config.RegionKey == "" {
+		config.RegionKey = "region"
+	}
+
+	return &AnomalyDetector{
+		warmupGate: warmupGate{minSamples: config.MinSamples},
+		config:     config,
+		now:        time.Now,
+		models:     make(map[string]*modelStats),
+	}
+}
+
+// Evaluate scores the event against its model's windows, or those of its
+// model and region with ScopeByRegion, then adds its values that were not
+// flagged. It returns a high_latency, high_tokens or high_cost anomaly for
+// each metric over Threshold, scored by its z-score, and nothing while the
+// windows hold fewer than MinSamples events. A value over its hard limit in
+// Thresholds is flagged instead, even while warming up, scored by the value
+// and with the limit's name in Limit.
+func (d *AnomalyDetector) Evaluate(event TelemetryEvent) []Anomaly {
+	key, scope := event.ModelName, event.ModelName
+	if region := d.region(event); region != "" {
+		key = event.ModelName + "/" + region
+		scope = event.ModelName + " in " + region
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats, ok := d.models[key]
+	if !ok {
+		stats = &modelStats{}
+		d.models[key] = stats
+	}
+	stats.touched = d.now()
+	warm := d.observe(key)
+
+	metrics := []struct {
+		kind  AnomalyKind
+		name  string
+		stats *rollingStats
+		value float64
+	}{
+		{AnomalyHighLatency, "latency", &stats.latency, event.LatencyMs},
+		{AnomalyHighTokens, "total tokens", &stats.tokens, float64(event.TotalTokens)},
+		{AnomalyHighCost, "cost", &stats.cost, event.CostUsd},
+	}
+
+	var anomalies []Anomaly
+	for _, metric := range metrics {
+		if limit, name, ok := d.config.Thresholds.limit(metric.kind); ok && metric.value > limit {
+			anomaly := newAnomaly(metric.kind, event, metric.value, limit,
+				fmt.Sprintf("%s %s of %.4g exceeds %s of %.4g", scope, metric.name, metric.value, name, limit))
+			anomaly.Limit = name
+			anomalies = append(anomalies, anomaly)
+			continue
+		}
+		if warm {
+			if z := metric.stats.zScore(metric.value); z > d.config.Threshold {
+				mean, _ := metric.stats.meanStdDev()
+				anomalies = append(anomalies, newAnomaly(metric.kind, event, z, d.config.Threshold,
+					fmt.Sprintf("%s %s of %.4g is %.1f standard deviations above the mean of %.4g",
+						scope, metric.name, metric.value, z, mean)))
+				continue
+			}
+		}
+		metric.stats.add(metric.value, d.config.WindowSize)
+	}
+	return anomalies
+}
+
+// region returns the event's region when windows are scoped by region
+func (d *AnomalyDetector) region(event TelemetryEvent) string {
+	if !d.config.ScopeByRegion {
+		return ""
+	}
+	region, _ := event.Metadata[d.config.RegionKey].(string)
+	return region
+}
+
+// Observe evaluates the event, so the detector can run in a DetectorPipeline
+func (d *AnomalyDetector) Observe(event TelemetryEvent) []Anomaly {
+	return d.Evaluate(event)
+}
+
+// EvictIdle drops models, or models in a region, with no events processed
+// since cutoff
+func (d *AnomalyDetector) EvictIdle(cutoff time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted := 0
+	for model, stats := range d.models {
+		if stats.touched.Before(cutoff) {
+			delete(d.models, model)
+			d.forget(model)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// setThresholds replaces the z-score threshold and the hard limits; a zero
+// threshold restores the default of 3
+func (d *AnomalyDetector) setThresholds(threshold float64, limits ThresholdConfig) {
+	if threshold <= 0 {
+		threshold = 3
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.config.Threshold = threshold
+	d.config.Thresholds = limits
+}
+
+// thresholds returns the z-score threshold and the hard limits
+func (d *AnomalyDetector) thresholds() (float64, ThresholdConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.config.Threshold, d.config.Thresholds
+}
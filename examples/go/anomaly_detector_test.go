@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// simulatedTraffic returns normal gpt-4 traffic followed by anomalies of one kind
+func simulatedTraffic(t *testing.T, kind AnomalyKind, normal, anomalous int) (normalEvents, anomalousEvents []TelemetryEvent) {
+	t.Helper()
+	withoutSimulationPauses(t)
+
+	profile := DefaultTrafficProfile()
+	profile.Models = []string{"gpt-4"}
+	profile.Anomalies = map[AnomalyKind]TrafficShape{kind: profile.Anomalies[kind]}
+
+	sink := &MemorySink{}
+	producer := NewSinkProducer(sink)
+	profile.SimulateNormalTraffic(context.Background(), producer, normal)
+	profile.SimulateAnomalousTraffic(context.Background(), producer, anomalous)
+
+	events := sink.Events()
+	if len(events) != normal+anomalous {
+		t.Fatalf("simulated %d events, want %d", len(events), normal+anomalous)
+	}
+	return events[:normal], events[normal:]
+}
+
+func hasKind(anomalies []Anomaly, kind AnomalyKind) bool {
+	for _, anomaly := range anomalies {
+		if anomaly.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAnomalyDetectorFlagsSimulatedAnomalies(t *testing.T) {
+	for _, kind := range []AnomalyKind{AnomalyHighLatency, AnomalyHighTokens} {
+		t.Run(kind.String(), func(t *testing.T) {
+			normal, anomalous := simulatedTraffic(t, kind, 200, 10)
+			detector := NewAnomalyDetector(AnomalyDetectorConfig{})
+
+			// a small window just past warm-up can flag the tail of normal traffic
+			falsePositives := 0
+			for _, event := range normal {
+				if len(detector.Evaluate(event)) > 0 {
+					falsePositives++
+				}
+			}
+			if falsePositives > len(normal)/50 {
+				t.Fatalf("%d of %d normal events flagged, want at most 2%%", falsePositives, len(normal))
+			}
+			for _, event := range anomalous {
+				anomalies := detector.Evaluate(event)
+				if !hasKind(anomalies, kind) {
+					t.Fatalf("anomalous event %.0fms %d tokens = %v, want %s", event.LatencyMs, event.TotalTokens, anomalies, kind)
+				}
+				for _, anomaly := range anomalies {
+					if anomaly.Score <= anomaly.Threshold || anomaly.Threshold != 3 {
+						t.Errorf("%s z-score %.2f, threshold %.1f, want above the default 3", anomaly.Type, anomaly.Score, anomaly.Threshold)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAnomalyDetectorColdStart(t *testing.T) {
+	normal, anomalous := simulatedTraffic(t, AnomalyHighLatency, 9, 1)
+	detector := NewAnomalyDetector(AnomalyDetectorConfig{MinSamples: 20})
+
+	for _, event := range append(normal, anomalous...) {
+		if anomalies := detector.Evaluate(event); len(anomalies) != 0 {
+			t.Fatalf("event %s flagged during warm-up: %v", event.RequestID, anomalies)
+		}
+	}
+	if !detector.WarmingUp("gpt-4") {
+		t.Error("detector is not warming up after 10 of 20 samples")
+	}
+}
+
+func TestAnomalyDetectorThreshold(t *testing.T) {
+	detector := NewAnomalyDetector(AnomalyDetectorConfig{Threshold: 2, MinSamples: 4, WindowSize: 4})
+
+	for _, latency := range []float64{100, 200, 100, 200} {
+		event := testEvent("req-baseline")
+		event.LatencyMs = latency
+		detector.Evaluate(event)
+	}
+
+	// mean 150, standard deviation 50: 240 is 1.8 sigma, 260 is 2.2
+	event := testEvent("req-1")
+	event.LatencyMs = 240
+	if anomalies := detector.Evaluate(event); len(anomalies) != 0 {
+		t.Fatalf("1.8 sigma flagged: %v", anomalies)
+	}
+
+	// the window now holds 200, 100, 200, 240
+	event.LatencyMs = 300
+	anomalies := detector.Evaluate(event)
+	if len(anomalies) != 1 || anomalies[0].Type != AnomalyHighLatency {
+		t.Fatalf("anomalies = %v, want one high_latency", anomalies)
+	}
+}
+
+func regionalEvent(region string, latency float64) TelemetryEvent {
+	event := testEvent("req-" + region)
+	event.LatencyMs = latency
+	event.Metadata = map[string]interface{}{"region": region}
+	return event
+}
+
+func TestAnomalyDetectorScopesBaselinesByRegion(t *testing.T) {
+	config := AnomalyDetectorConfig{Threshold: 2, MinSamples: 10, ScopeByRegion: true}
+	scoped := NewAnomalyDetector(config)
+	config.ScopeByRegion = false
+	unscoped := NewAnomalyDetector(config)
+
+	// us-east-1 answers in about 100ms, the farther eu-west-1 in about 300ms
+	for i := 0; i < 40; i++ {
+		jitter := float64(i%2*20 - 10)
+		for _, d := range []*AnomalyDetector{scoped, unscoped} {
+			d.Evaluate(regionalEvent("us-east-1", 100+jitter))
+			if i%4 == 0 {
+				d.Evaluate(regionalEvent("eu-west-1", 300+2*jitter))
+			}
+		}
+	}
+
+	slowButNormal := regionalEvent("eu-west-1", 320)
+	if anomalies := unscoped.Evaluate(slowButNormal); !hasKind(anomalies, AnomalyHighLatency) {
+		t.Error("the unscoped baseline did not flag the slower region, so the test proves nothing")
+	}
+	if anomalies := scoped.Evaluate(slowButNormal); len(anomalies) != 0 {
+		t.Errorf("a normal eu-west-1 latency was flagged: %v", anomalies)
+	}
+
+	anomalies := scoped.Evaluate(regionalEvent("eu-west-1", 450))
+	if !hasKind(anomalies, AnomalyHighLatency) {
+		t.Fatalf("an eu-west-1 outlier was not flagged: %v", anomalies)
+	}
+	if want := "gpt-4 in eu-west-1 latency of 450"; !strings.HasPrefix(anomalies[0].Description, want) {
+		t.Errorf("description = %q, want it to name the region", anomalies[0].Description)
+	}
+	if anomalies := scoped.Evaluate(regionalEvent("us-east-1", 300)); !hasKind(anomalies, AnomalyHighLatency) {
+		t.Error("us-east-1 at the eu-west-1 latency was not flagged")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "fmt"
+
+// AnomalyKind identifies a type of anomaly
+type AnomalyKind int
+
+const (
+	// AnomalyHighLatency is a request that took far longer than usual
+	AnomalyHighLatency AnomalyKind = iota + 1
+	// AnomalyHighTokens is a request with an unusually high token count
+	AnomalyHighTokens
+	// AnomalyHighCost is a request with an abnormally high cost
+	AnomalyHighCost
+	// AnomalySuspiciousPattern is a suspicious usage pattern such as rapid repeated requests
+	AnomalySuspiciousPattern
+	// AnomalyDegenerateResponse is an empty response returned without an error code
+	AnomalyDegenerateResponse
+	// AnomalyMetadataPolicy is metadata with unexpected keys or values
+	AnomalyMetadataPolicy
+	// AnomalyDuplicateRequestID is a RequestID seen more than once
+	AnomalyDuplicateRequestID
+	// AnomalyLatencyBimodality is a model whose latency distribution has two distinct modes
+	AnomalyLatencyBimodality
+	// AnomalyCostEfficiency is a service whose cost per event or token has risen and stayed up
+	AnomalyCostEfficiency
+	// AnomalySLOBurn is a model burning its latency error budget too fast
+	AnomalySLOBurn
+	// AnomalyNoTraffic is a normally active service and model that stopped sending events
+	AnomalyNoTraffic
+	// AnomalyPipelineLatency is a canary that took longer than the SLA to pass through the pipeline
+	AnomalyPipelineLatency
+	// AnomalyCanaryLoss is a pipeline through which no canary has arrived for too long
+	AnomalyCanaryLoss
+)
+
+var anomalyKindNames = map[AnomalyKind]string{
+	AnomalyHighLatency:        "high_latency",
+	AnomalyHighTokens:         "high_tokens",
+	AnomalyHighCost:           "high_cost",
+	AnomalySuspiciousPattern:  "suspicious_pattern",
+	AnomalyDegenerateResponse: "degenerate_response",
+	AnomalyMetadataPolicy:     "metadata_policy",
+	AnomalyDuplicateRequestID: "duplicate_request_id",
+	AnomalyLatencyBimodality:  "latency_bimodality",
+	AnomalyCostEfficiency:     "cost_efficiency",
+	AnomalySLOBurn:            "slo_burn",
+	AnomalyNoTraffic:          "no_traffic",
+	AnomalyPipelineLatency:    "pipeline_latency",
+	AnomalyCanaryLoss:         "canary_loss",
+}
+
+// String returns the snake_case name of the kind
+func (k AnomalyKind) String() string {
+	if name, ok := anomalyKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("AnomalyKind(%d)", int(k))
+}
+
+// ParseAnomalyKind returns the kind with the given snake_case name
+func ParseAnomalyKind(name string) (AnomalyKind, error) {
+	for kind, kindName := range anomalyKindNames {
+		if kindName == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown anomaly kind %q", name)
+}
+
+// MarshalText encodes the kind as its name
+func (k AnomalyKind) MarshalText() ([]byte, error) {
+	if _, ok := anomalyKindNames[k]; !ok {
+		return nil, fmt.Errorf("unknown anomaly kind %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind from its name
+func (k *AnomalyKind) UnmarshalText(text []byte) error {
+	kind, err := ParseAnomalyKind(string(text))
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
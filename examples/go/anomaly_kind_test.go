@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAnomalyKindRoundTrip(t *testing.T) {
+	for kind, name := range anomalyKindNames {
+		if kind.String() != name {
+			t.Errorf("%d.String() = %q, want %q", int(kind), kind.String(), name)
+		}
+
+		parsed, err := ParseAnomalyKind(kind.String())
+		if err != nil {
+			t.Errorf("ParseAnomalyKind(%q): %v", name, err)
+			continue
+		}
+		if parsed != kind {
+			t.Errorf("ParseAnomalyKind(%q) = %v, want %v", name, parsed, kind)
+		}
+	}
+}
+
+func TestParseAnomalyKindRejectsUnknown(t *testing.T) {
+	for _, name := range []string{"", "HIGH_LATENCY", "latency", "unknown"} {
+		if _, err := ParseAnomalyKind(name); err == nil {
+			t.Errorf("ParseAnomalyKind(%q) succeeded, want error", name)
+		}
+	}
+}
+
+func TestAnomalyKindJSON(t *testing.T) {
+	data, err := json.Marshal(Anomaly{Type: AnomalyHighCost})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["type"] != "high_cost" {
+		t.Errorf("type = %v, want high_cost", raw["type"])
+	}
+
+	var decoded Anomaly
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.Type != AnomalyHighCost {
+		t.Errorf("decoded type = %v, want %v", decoded.Type, AnomalyHighCost)
+	}
+
+	if err := json.Unmarshal([]byte(`{"type":"bogus"}`), &decoded); err == nil {
+		t.Error("expected error decoding unknown kind")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressedReader transparently decompresses gzip and zstd data,
+// detected by magic bytes so archives need not be named correctly. A name
+// with a .gz or .zst extension whose content is not in that format is an
+// error rather than being read as plain NDJSON. Concatenated gzip members
+// and zstd frames are read as one stream.
+func decompressedReader(r io.Reader, name string) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".gz", ".gzip", ".zst", ".zstd":
+		if len(magic) > 0 {
+			return nil, fmt.Errorf("%s has a %s extension but is not compressed in that format", name, ext)
+		}
+	}
+	return io.NopCloser(br), nil
+}
+
+// fileSource is a BackfillSource over a single file
+type fileSource struct {
+	path string
+}
+
+// List returns the file's base name
+func (s fileSource) List(ctx context.Context) ([]string, error) {
+	return []string{filepath.Base(s.path)}, nil
+}
+
+// Open opens the file
+func (s fileSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(s.path)
+}
+
+// ReplayFromFile re-produces the events in one NDJSON archive, which may be
+// plain, gzip- or zstd-compressed; the format is detected automatically.
+// Options behave as for Backfill.
+func ReplayFromFile(ctx context.Context, path string, producer *TelemetryProducer, opts BackfillOptions) (BackfillResult, error) {
+	return Backfill(ctx, fileSource{path: path}, producer, opts)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func zstdCompressed(t *testing.T, data []byte) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+func TestReplayFromFileDetectsFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	// concatenated gzip members, as produced by appending to a .gz archive
+	concatenated := append(gzipped(t, ndjson(t, "req-1", "req-2")), gzipped(t, ndjson(t, "req-3"))...)
+
+	files := map[string][]byte{
+		"plain.ndjson":       ndjson(t, "req-1", "req-2", "req-3"),
+		"archive.ndjson.gz":  concatenated,
+		"archive.ndjson.zst": zstdCompressed(t, ndjson(t, "req-1", "req-2", "req-3")),
+		// detection uses magic bytes, not the name
+		"misnamed.ndjson": zstdCompressed(t, ndjson(t, "req-1", "req-2", "req-3")),
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		w := &fakeWriter{}
+		result, err := ReplayFromFile(context.Background(), path, newTestProducer(w), BackfillOptions{})
+		if err != nil {
+			t.Errorf("%s: ReplayFromFile: %v", name, err)
+			continue
+		}
+		if got := strings.Join(messageKeys(w.Messages()), ","); result.Sent != 3 || got != "req-1,req-2,req-3" {
+			t.Errorf("%s: replayed %s (sent %d), want req-1,req-2,req-3", name, got, result.Sent)
+		}
+	}
+}
+
+func TestReplayFromFileRejectsWrongExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.ndjson.gz")
+	if err := os.WriteFile(path, ndjson(t, "req-1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &fakeWriter{}
+	if _, err := ReplayFromFile(context.Background(), path, newTestProducer(w), BackfillOptions{}); err == nil {
+		t.Error("replayed plain data from a .gz file")
+	}
+	if len(w.Messages()) != 0 {
+		t.Errorf("sent %d events, want 0", len(w.Messages()))
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBufferFull is returned by Enqueue when the producer's buffer has no room
+var ErrBufferFull = errors.New("producer buffer is full")
+
+// ErrProducerClosed is returned by Enqueue after Close
+var ErrProducerClosed = errors.New("producer is closed")
+
+// maxAsyncBatch is the most buffered events a drain goroutine sends in one write
+const maxAsyncBatch = 100
+
+// bufferedEvent is an event waiting in the buffer, with the time after
+// which it is too stale to send (zero for no limit)
+type bufferedEvent struct {
+	event    TelemetryEvent
+	deadline time.Time
+}
+
+// asyncQueue is the buffer of an asynchronous producer and the state of
+// its drain goroutines
+type asyncQueue struct {
+	events chan bufferedEvent
+
+	mu     sync.Mutex
+	closed bool
+	// pending counts events enqueued but not yet sent; drained is closed
+	// when it falls to zero
+	pending int
+	drained chan struct{}
+
+	// done is closed once every drain goroutine has returned
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// NewAsyncTelemetryProducer creates a producer whose Enqueue buffers up to
+// bufferSize events and returns immediately. Background goroutines, one
+// unless set WithAsyncWorkers, drain the buffer into Kafka in batches.
+// Events that fail are logged and passed to OnPermanentFailure, since their
+// caller has already returned.
+func NewAsyncTelemetryProducer(brokers []string, topic string, bufferSize int, opts ...ProducerOption) *TelemetryProducer {
+	p := NewTelemetryProducer(brokers, topic, opts...)
+	p.startAsync(bufferSize)
+	return p
+}
+
+// startAsync creates the buffer and starts the drain goroutines
+func (p *TelemetryProducer) startAsync(bufferSize int) {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	workers := p.asyncWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	q := &asyncQueue{
+		events: make(chan bufferedEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+	p.async = q
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.drain()
+	}
+	go func() {
+		q.wg.Wait()
+		close(q.done)
+	}()
+}
+
+// Enqueue buffers the event for the background goroutines to send. It never
+// blocks: it returns ErrBufferFull when the buffer has no room and
+// ErrProducerClosed after Close. A producer created without a buffer sends
+// the event synchronously instead.
+func (p *TelemetryProducer) Enqueue(event TelemetryEvent) error {
+	return p.EnqueueWithMaxAge(event, p.MaxBufferAge)
+}
+
+// EnqueueWithMaxAge buffers the event like Enqueue, but drops it instead of
+// sending it if it is still buffered after maxAge, overriding the
+// producer's MaxBufferAge. A maxAge of zero or less sets no limit.
+func (p *TelemetryProducer) EnqueueWithMaxAge(event TelemetryEvent, maxAge time.Duration) error {
+	q := p.async
+	if q == nil {
+		return p.SendEvent(context.Background(), event)
+	}
+
+	buffered := bufferedEvent{event: event}
+	if maxAge > 0 {
+		buffered.deadline = time.Now().Add(maxAge)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrProducerClosed
+	}
+	select {
+	case q.events <- buffered:
+	default:
+		return ErrBufferFull
+	}
+
+	if q.pending == 0 {
+		q.drained = make(chan struct{})
+	}
+	q.pending++
+	return nil
+}
+
+// Flush blocks until every enqueued event has been sent (or has failed),
+// or until ctx ends
+func (p *TelemetryProducer) Flush(ctx context.Context) error {
+	q := p.async
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	if q.pending == 0 {
+		q.mu.Unlock()
+		return nil
+	}
+	drained := q.drained
+	q.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-drained:
+		return nil
+	}
+}
+
+// buffered returns the number of events enqueued but not yet sent
+func (p *TelemetryProducer) buffered() int {
+	q := p.async
+	if q == nil {
+		return 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// closeAsync stops accepting events and waits for the buffer to be drained
+func (p *TelemetryProducer) closeAsync() {
+	q := p.async
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	<-q.done
+}
+
+// drain sends buffered events, batching those already waiting, until the
+// buffer is closed and empty. Events past their deadline are dropped.
+// Events sent once Close has begun are counted as flushed on drain.
+func (p *TelemetryProducer) drain() {
+	q := p.async
+	defer q.wg.Done()
+
+	for buffered := range q.events {
+		batch := []bufferedEvent{buffered}
+	fill:
+		for len(batch) < maxAsyncBatch {
+			select {
+			case next, ok := <-q.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+
+		closing := q.isClosed()
+		if events := p.dropStale(batch, time.Now()); len(events) > 0 {
+			sent, err := p.sendEvents(context.Background(), events, p.Retry)
+			if closing {
+				p.counters.flushedOnDrain.Add(int64(sent))
+			}
+			if err != nil {
+				p.logger().Error("Error sending buffered events", "topic", p.topic, "error", err)
+			}
+		}
+
+		q.mu.Lock()
+		q.pending -= len(batch)
+		if q.pending == 0 {
+			close(q.drained)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// isClosed reports whether Close has begun
+func (q *asyncQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// dropStale returns the events of batch still within their deadline at
+// now, counting the others as stale
+func (p *TelemetryProducer) dropStale(batch []bufferedEvent, now time.Time) []TelemetryEvent {
+	events := make([]TelemetryEvent, 0, len(batch))
+	for _, buffered := range batch {
+		if !buffered.deadline.IsZero() && now.After(buffered.deadline) {
+			p.counters.stale.Add(1)
+			p.dropped(buffered.event, DropExpired)
+			p.logger().Warn("Dropped stale event", "request_id", buffered.event.RequestID,
+				"overdue", now.Sub(buffered.deadline))
+			continue
+		}
+		events = append(events, buffered.event)
+	}
+	return events
+}
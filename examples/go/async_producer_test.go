@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// gatedWriter blocks writes until open is closed, signalling each write on started
+type gatedWriter struct {
+	fakeWriter
+	started chan struct{}
+	open    chan struct{}
+}
+
+func (w *gatedWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.started <- struct{}{}
+	<-w.open
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func TestAsyncProducerWorkersWriteConcurrently(t *testing.T) {
+	w := &gatedWriter{started: make(chan struct{}, 10), open: make(chan struct{})}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry", asyncWorkers: 3}
+	producer.startAsync(10)
+	defer producer.Close()
+
+	// each worker takes one event and blocks writing it, so the next event
+	// is only written if another worker is free
+	for i := 0; i < 3; i++ {
+		if err := producer.Enqueue(testEvent(fmt.Sprintf("req-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-w.started:
+		case <-time.After(time.Second):
+			t.Fatalf("write %d did not start while %d writes were blocked", i, i)
+		}
+	}
+
+	close(w.open)
+	if err := producer.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := len(w.Messages()); got != 3 {
+		t.Errorf("wrote %d messages, want the 3 enqueued", got)
+	}
+}
+
+func TestAsyncProducerBufferOverflow(t *testing.T) {
+	w := &gatedWriter{started: make(chan struct{}, 10), open: make(chan struct{})}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+	producer.startAsync(3)
+
+	// the drain goroutine takes the first event and blocks writing it
+	if err := producer.Enqueue(testEvent("req-0")); err != nil {
+		t.Fatal(err)
+	}
+	<-w.started
+
+	for i := 1; i <= 3; i++ {
+		if err := producer.Enqueue(testEvent(fmt.Sprintf("req-%d", i))); err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+	}
+	if err := producer.Enqueue(testEvent("req-4")); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("Enqueue beyond bufferSize = %v, want ErrBufferFull", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := producer.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Flush while the writer is blocked = %v, want deadline exceeded", err)
+	}
+
+	close(w.open)
+	if err := producer.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := len(w.Messages()); got != 4 {
+		t.Errorf("wrote %d messages, want the 4 enqueued", got)
+	}
+}
+
+func TestAsyncProducerCloseDrainsBuffer(t *testing.T) {
+	w := &gatedWriter{started: make(chan struct{}, 100), open: make(chan struct{})}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+	producer.startAsync(10)
+
+	for i := 0; i < 10; i++ {
+		if err := producer.Enqueue(testEvent(fmt.Sprintf("req-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(w.open)
+
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(w.Messages()); got != 10 {
+		t.Errorf("wrote %d messages before closing, want 10", got)
+	}
+	if err := producer.Enqueue(testEvent("req-late")); !errors.Is(err, ErrProducerClosed) {
+		t.Errorf("Enqueue after Close = %v, want ErrProducerClosed", err)
+	}
+}
+
+func TestAsyncProducerDropsStaleEvents(t *testing.T) {
+	w := &gatedWriter{started: make(chan struct{}, 10), open: make(chan struct{})}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry", MaxBufferAge: 20 * time.Millisecond}
+	producer.startAsync(10)
+
+	// congestion: the first write blocks while more events wait in the buffer
+	if err := producer.Enqueue(testEvent("req-0")); err != nil {
+		t.Fatal(err)
+	}
+	<-w.started
+	if err := producer.Enqueue(testEvent("req-default")); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.EnqueueWithMaxAge(testEvent("req-patient"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.EnqueueWithMaxAge(testEvent("req-urgent"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(w.open)
+
+	if err := producer.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	var sent []string
+	for _, msg := range w.Messages() {
+		var event TelemetryEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, event.RequestID)
+	}
+	if len(sent) != 2 || sent[0] != "req-0" || sent[1] != "req-patient" {
+		t.Errorf("sent %v, want req-0 and req-patient", sent)
+	}
+	if stale := producer.Report().Dropped.Stale; stale != 2 {
+		t.Errorf("stale drops = %d, want 2", stale)
+	}
+}
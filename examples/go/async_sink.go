@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSinkClosed is returned by AsyncSink.Write after Close
+var ErrSinkClosed = errors.New("sink is closed")
+
+// PartialWriteError is returned by AsyncSink.Write when ctx ends after part
+// of a keyed batch was queued. The queued events are still written, so a
+// caller retrying should resend only Unqueued.
+type PartialWriteError struct {
+	Queued   int
+	Unqueued []TelemetryEvent
+	Err      error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("queued %d of %d events: %v", e.Queued, e.Queued+len(e.Unqueued), e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// AsyncSinkConfig configures an AsyncSink
+type AsyncSinkConfig struct {
+	// Workers is the number of goroutines writing to the sink (default: 1)
+	Workers int
+	// QueueSize is the number of batches each worker buffers before Write blocks (default: 100)
+	QueueSize int
+	// KeyFunc routes every event with the same key to the same worker, so
+	// they are written in order (optional; batches are spread round-robin without it)
+	KeyFunc KeyFunc
+	// OnError receives batches the sink failed to write (default: log them)
+	OnError func(events []TelemetryEvent, err error)
+	// Logger receives failed batches without OnError (default: slog.Default())
+	Logger *slog.Logger
+}
+
+// AsyncSinkStats is a point-in-time snapshot of an AsyncSink's workers
+type AsyncSinkStats struct {
+	Workers []AsyncWorkerStats `json:"workers"`
+}
+
+// AsyncWorkerStats reports one sink-writer goroutine
+type AsyncWorkerStats struct {
+	// Queued is the number of batches waiting for the worker
+	Queued int `json:"queued"`
+	// Written and Failed count the events the sink accepted and rejected
+	Written int64 `json:"written"`
+	Failed  int64 `json:"failed"`
+	// Utilization is the fraction of time since the sink started that the
+	// worker spent writing; workers near 1 are the bottleneck
+	Utilization float64 `json:"utilization"`
+}
+
+// AsyncSink drains batches to a slower sink from a pool of worker
+// goroutines, so Write only waits for queue space. The wrapped sink must be
+// safe for concurrent Writes when Workers is above 1. Errors are reported to
+// OnError, since the caller has already returned.
+type AsyncSink struct {
+	sink    Sink
+	config  AsyncSinkConfig
+	now     func() time.Time
+	started time.Time
+
+	// mu guards closed against concurrent sends on the queues
+	mu      sync.RWMutex
+	closed  bool
+	queues  []chan []TelemetryEvent
+	workers []asyncWorker
+	next    atomic.Uint64
+	wg      sync.WaitGroup
+}
+
+// asyncWorker holds the counters of one worker
+type asyncWorker struct {
+	written atomic.Int64
+	failed  atomic.Int64
+	busy    atomic.Int64
+}
+
+// NewAsyncSink wraps sink and starts its workers
+func NewAsyncSink(sink Sink, config AsyncSinkConfig) *AsyncSink {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	s := &AsyncSink{
+		sink:    sink,
+		config:  config,
+		now:     time.Now,
+		queues:  make([]chan []TelemetryEvent, config.Workers),
+		workers: make([]asyncWorker, config.Workers),
+	}
+	s.started = s.now()
+
+	for i := range s.queues {
+		s.queues[i] = make(chan []TelemetryEvent, config.QueueSize)
+		s.wg.Add(1)
+		go s.run(i)
+	}
+	return s
+}
+
+// Write queues the batch. With a KeyFunc the batch is split by key, keeping
+// the order of each key's events. Write blocks while a worker's queue is
+// full and gives up when ctx ends. If ctx ends after some of the split
+// batches were queued, those are still written and Write returns a
+// *PartialWriteError holding the events it did not queue.
+func (s *AsyncSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrSinkClosed
+	}
+
+	if s.config.KeyFunc == nil {
+		worker := int(s.next.Add(1)-1) % len(s.queues)
+		return s.enqueue(ctx, worker, events)
+	}
+
+	batches := make([][]TelemetryEvent, len(s.queues))
+	for _, event := range events {
+		h := fnv.New32a()
+		h.Write(s.config.KeyFunc(event))
+		worker := int(h.Sum32() % uint32(len(s.queues)))
+		batches[worker] = append(batches[worker], event)
+	}
+	queued := 0
+	for worker, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		if err := s.enqueue(ctx, worker, batch); err != nil {
+			if queued == 0 {
+				return err
+			}
+			var unqueued []TelemetryEvent
+			for _, rest := range batches[worker:] {
+				unqueued = append(unqueued, rest...)
+			}
+			return &PartialWriteError{Queued: queued, Unqueued: unqueued, Err: err}
+		}
+		queued += len(batch)
+	}
+	return nil
+}
+
+// enqueue hands a batch to a worker
+func (s *AsyncSink) enqueue(ctx context.Context, worker int, batch []TelemetryEvent) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.queues[worker] <- batch:
+		return nil
+	}
+}
+
+// Stats returns a snapshot of each worker's queue, counts and utilization
+func (s *AsyncSink) Stats() AsyncSinkStats {
+	elapsed := s.now().Sub(s.started)
+
+	stats := AsyncSinkStats{Workers: make([]AsyncWorkerStats, len(s.workers))}
+	for i := range s.workers {
+		w := &s.workers[i]
+		stats.Workers[i] = AsyncWorkerStats{
+			Queued:  len(s.queues[i]),
+			Written: w.written.Load(),
+			Failed:  w.failed.Load(),
+		}
+		if elapsed > 0 {
+			stats.Workers[i].Utilization = float64(w.busy.Load()) / float64(elapsed)
+		}
+	}
+	return stats
+}
+
+// Close stops accepting batches, waits for the queued ones to be written
+// and closes the wrapped sink
+func (s *AsyncSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return s.sink.Close()
+}
+
+// run writes the worker's batches until its queue is closed
+func (s *AsyncSink) run(worker int) {
+	defer s.wg.Done()
+
+	w := &s.workers[worker]
+	for batch := range s.queues[worker] {
+		start := s.now()
+		err := s.sink.Write(context.Background(), batch)
+		w.busy.Add(int64(s.now().Sub(start)))
+
+		if err != nil {
+			w.failed.Add(int64(len(batch)))
+			if s.config.OnError != nil {
+				s.config.OnError(batch, err)
+			} else {
+				s.config.Logger.Error("Async sink failed to write events", "worker", worker, "events", len(batch), "error", err)
+			}
+			continue
+		}
+		w.written.Add(int64(len(batch)))
+	}
+}
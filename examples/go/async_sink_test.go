@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowSink records events and takes delay per Write
+type slowSink struct {
+	MemorySink
+	delay time.Duration
+}
+
+func (s *slowSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	time.Sleep(s.delay)
+	return s.MemorySink.Write(ctx, events)
+}
+
+// drainAsync writes single-event batches spread over users, then closes the
+// sink and returns how long that took
+func drainAsync(t *testing.T, sink *AsyncSink, batches, users int) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for i := 0; i < batches; i++ {
+		event := testEvent(strconv.Itoa(i))
+		event.UserID = fmt.Sprintf("user-%d", i%users)
+		if err := sink.Write(context.Background(), []TelemetryEvent{event}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return time.Since(start)
+}
+
+func TestAsyncSinkThroughputScalesWithWorkers(t *testing.T) {
+	single := drainAsync(t, NewAsyncSink(&slowSink{delay: 5 * time.Millisecond}, AsyncSinkConfig{}), 40, 8)
+	pool := NewAsyncSink(&slowSink{delay: 5 * time.Millisecond}, AsyncSinkConfig{Workers: 4})
+	pooled := drainAsync(t, pool, 40, 8)
+
+	if pooled > single/2 {
+		t.Errorf("4 workers took %s, 1 worker %s; want at least twice as fast", pooled, single)
+	}
+
+	var written int64
+	for _, w := range pool.Stats().Workers {
+		written += w.Written
+		if w.Utilization <= 0 || w.Utilization > 1 {
+			t.Errorf("worker utilization = %.2f, want in (0, 1]", w.Utilization)
+		}
+	}
+	if written != 40 {
+		t.Errorf("workers wrote %d events, want 40", written)
+	}
+}
+
+func TestAsyncSinkPreservesPerKeyOrder(t *testing.T) {
+	inner := &slowSink{}
+	sink := NewAsyncSink(inner, AsyncSinkConfig{Workers: 4, KeyFunc: UserIDKey})
+
+	// batches mixing users are split between workers
+	for i := 0; i < 50; i++ {
+		var batch []TelemetryEvent
+		for u := 0; u < 5; u++ {
+			event := testEvent(strconv.Itoa(i))
+			event.UserID = fmt.Sprintf("user-%d", u)
+			batch = append(batch, event)
+		}
+		if err := sink.Write(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+
+	last := make(map[string]int)
+	events := inner.Events()
+	for _, event := range events {
+		seq, _ := strconv.Atoi(event.RequestID)
+		if prev, ok := last[event.UserID]; ok && seq < prev {
+			t.Fatalf("%s: event %d written after %d", event.UserID, seq, prev)
+		}
+		last[event.UserID] = seq
+	}
+	if len(events) != 250 {
+		t.Errorf("sink received %d events, want 250", len(events))
+	}
+}
+
+// gatedSink blocks writes until open is closed, signalling each write on started
+type gatedSink struct {
+	MemorySink
+	started chan struct{}
+	open    chan struct{}
+}
+
+func (s *gatedSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	s.started <- struct{}{}
+	<-s.open
+	return s.MemorySink.Write(ctx, events)
+}
+
+// userForWorker returns a UserID that UserIDKey routes to worker
+func userForWorker(workers, worker int) string {
+	for i := 0; ; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		h := fnv.New32a()
+		h.Write([]byte(user))
+		if int(h.Sum32()%uint32(workers)) == worker {
+			return user
+		}
+	}
+}
+
+func TestAsyncSinkReportsPartiallyQueuedWrites(t *testing.T) {
+	inner := &gatedSink{started: make(chan struct{}, 10), open: make(chan struct{})}
+	sink := NewAsyncSink(inner, AsyncSinkConfig{Workers: 2, QueueSize: 1, KeyFunc: UserIDKey})
+	free, busy := userForWorker(2, 0), userForWorker(2, 1)
+
+	// worker 1 blocks writing one event and has a second one queued
+	for i := 0; i < 2; i++ {
+		event := testEvent(fmt.Sprintf("busy-%d", i))
+		event.UserID = busy
+		if err := sink.Write(context.Background(), []TelemetryEvent{event}); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			<-inner.started
+		}
+	}
+
+	first, second := testEvent("req-1"), testEvent("req-2")
+	first.UserID, second.UserID = free, busy
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := sink.Write(ctx, []TelemetryEvent{first, second})
+
+	var partial *PartialWriteError
+	if !errors.As(err, &partial) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Write = %v, want a *PartialWriteError wrapping the deadline", err)
+	}
+	if partial.Queued != 1 || len(partial.Unqueued) != 1 || partial.Unqueued[0].RequestID != "req-2" {
+		t.Errorf("queued %d, unqueued %v; want req-1 queued and req-2 not", partial.Queued, partial.Unqueued)
+	}
+
+	close(inner.open)
+	sink.Close()
+	if got := len(inner.Events()); got != 3 {
+		t.Errorf("sink received %d events, want the 2 busy events and req-1", got)
+	}
+}
+
+// failingSink rejects every write
+type failingSink struct{ MemorySink }
+
+func (s *failingSink) Write(context.Context, []TelemetryEvent) error { return errTestBroker }
+
+func TestAsyncSinkReportsErrors(t *testing.T) {
+	var mu sync.Mutex
+	var failed []TelemetryEvent
+	sink := NewAsyncSink(&failingSink{}, AsyncSinkConfig{OnError: func(events []TelemetryEvent, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if errors.Is(err, errTestBroker) {
+			failed = append(failed, events...)
+		}
+	}})
+
+	sink.Write(context.Background(), []TelemetryEvent{testEvent("req-1"), testEvent("req-2")})
+	sink.Close()
+
+	if len(failed) != 2 || sink.Stats().Workers[0].Failed != 2 {
+		t.Errorf("OnError got %d events, Failed = %d; want 2", len(failed), sink.Stats().Workers[0].Failed)
+	}
+	if err := sink.Write(context.Background(), []TelemetryEvent{testEvent("req-3")}); !errors.Is(err, ErrSinkClosed) {
+		t.Errorf("Write after Close = %v, want ErrSinkClosed", err)
+	}
+}
+
+func TestAsyncSinkLogsErrorsWithoutOnError(t *testing.T) {
+	var logs bytes.Buffer
+	sink := NewAsyncSink(&failingSink{}, AsyncSinkConfig{Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+
+	sink.Write(context.Background(), []TelemetryEvent{testEvent("req-1")})
+	sink.Close()
+
+	if !strings.Contains(logs.String(), "Async sink failed to write events") || !strings.Contains(logs.String(), "events=1") {
+		t.Errorf("failed batch was not logged to the logger: %q", logs.String())
+	}
+}
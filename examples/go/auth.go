@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// defaultDialTimeout bounds connecting to a broker, including the TLS
+// handshake and SASL authentication
+const defaultDialTimeout = 5 * time.Second
+
+// WithSASL authenticates to the brokers with the mechanism
+func WithSASL(mechanism sasl.Mechanism) ProducerOption {
+	return func(c *writerConfig) {
+		c.sasl = mechanism
+	}
+}
+
+// WithTLS connects to the brokers over TLS with the config
+func WithTLS(config *tls.Config) ProducerOption {
+	return func(c *writerConfig) {
+		c.tls = config
+	}
+}
+
+// WithDialTimeout bounds connecting and authenticating to a broker, so a
+// misconfigured connection fails instead of waiting out the write timeout
+// (default: 5s)
+func WithDialTimeout(timeout time.Duration) ProducerOption {
+	return func(c *writerConfig) {
+		c.dialTimeout = timeout
+	}
+}
+
+// ParseSASLMechanism returns the SASL mechanism named PLAIN, SCRAM-SHA-256
+// or SCRAM-SHA-512 for the credentials. Names are case-insensitive.
+func ParseSASLMechanism(name, username, password string) (sasl.Mechanism, error) {
+	if username == "" {
+		return nil, errors.New("SASL requires a username")
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "PLAIN":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q (want PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512)", name)
+	}
+}
+
+// transport returns the writer transport for the config's authentication
+// settings, or nil when neither SASL nor TLS is configured
+func (c writerConfig) transport() *kafka.Transport {
+	if c.sasl == nil && c.tls == nil {
+		return nil
+	}
+	return &kafka.Transport{
+		SASL:        c.sasl,
+		TLS:         c.tls,
+		DialTimeout: c.dialTimeout,
+	}
+}
+
+// CheckBrokers connects and authenticates to each broker with the options'
+// SASL and TLS settings. Call it at startup so bad credentials or
+// certificates are reported by broker, rather than as failed writes.
+func CheckBrokers(ctx context.Context, brokers []string, opts ...ProducerOption) error {
+	config := defaultWriterConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	dialer := &kafka.Dialer{
+		Timeout:       config.dialTimeout,
+		TLS:           config.tls,
+		SASLMechanism: config.sasl,
+	}
+
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to connect to broker %s: %w", broker, err))
+			continue
+		}
+		_, err = conn.ApiVersions()
+		conn.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("broker %s did not respond: %w", broker, err))
+		}
+	}
+	return errors.Join(errs...)
+}
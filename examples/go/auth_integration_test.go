@@ -0,0 +1,70 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTLSBrokerIntegration sends an event to a TLS-enabled broker. It is
+// built with -tags integration and configured from the environment:
+//
+//	KAFKA_TLS_BROKERS       comma-separated broker addresses (required)
+//	KAFKA_TLS_CA            PEM file of the CA that signed the brokers' certificates
+//	KAFKA_SASL_MECHANISM    PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+//	KAFKA_SASL_USERNAME     SASL username
+//	KAFKA_SASL_PASSWORD     SASL password
+//	KAFKA_TOPIC             topic to write to (default: llm.telemetry)
+func TestTLSBrokerIntegration(t *testing.T) {
+	brokersEnv := os.Getenv("KAFKA_TLS_BROKERS")
+	if brokersEnv == "" {
+		t.Skip("KAFKA_TLS_BROKERS is not set")
+	}
+	brokers := strings.Split(brokersEnv, ",")
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv("KAFKA_TLS_CA"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			t.Fatalf("no certificates in %s", caFile)
+		}
+	}
+	opts := []ProducerOption{WithTLS(tlsConfig)}
+
+	if name := os.Getenv("KAFKA_SASL_MECHANISM"); name != "" {
+		mechanism, err := ParseSASLMechanism(name, os.Getenv("KAFKA_SASL_USERNAME"), os.Getenv("KAFKA_SASL_PASSWORD"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, WithSASL(mechanism))
+	}
+
+	topic := os.Getenv("KAFKA_TOPIC")
+	if topic == "" {
+		topic = "llm.telemetry"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := CheckBrokers(ctx, brokers, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	producer := NewTelemetryProducer(brokers, topic, opts...)
+	defer producer.Close()
+
+	if err := producer.SendEvent(ctx, testEvent("req-tls-integration")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+func TestParseSASLMechanism(t *testing.T) {
+	for name, want := range map[string]string{
+		"plain":         "PLAIN",
+		"SCRAM-SHA-256": "SCRAM-SHA-256",
+		"scram-sha-512": "SCRAM-SHA-512",
+	} {
+		mechanism, err := ParseSASLMechanism(name, "producer", "secret")
+		if err != nil {
+			t.Errorf("ParseSASLMechanism(%q): %v", name, err)
+			continue
+		}
+		if mechanism.Name() != want {
+			t.Errorf("ParseSASLMechanism(%q).Name() = %q, want %q", name, mechanism.Name(), want)
+		}
+	}
+
+	if _, err := ParseSASLMechanism("GSSAPI", "producer", "secret"); err == nil {
+		t.Error("ParseSASLMechanism(GSSAPI) succeeded, want an error")
+	}
+	if _, err := ParseSASLMechanism("PLAIN", "", "secret"); err == nil {
+		t.Error("ParseSASLMechanism without a username succeeded, want an error")
+	}
+}
+
+func TestAuthOptionsConfigureTransport(t *testing.T) {
+	if w := testWriter(t); w.Transport != nil {
+		t.Errorf("Transport = %v without authentication, want kafka-go's default", w.Transport)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	w := testWriter(t, WithSASL(plain.Mechanism{Username: "producer", Password: "secret"}), WithTLS(tlsConfig))
+
+	transport, ok := w.Transport.(*kafka.Transport)
+	if !ok {
+		t.Fatalf("Transport = %T, want *kafka.Transport", w.Transport)
+	}
+	if transport.SASL == nil || transport.SASL.Name() != "PLAIN" || transport.TLS != tlsConfig {
+		t.Errorf("Transport SASL = %v, TLS = %v", transport.SASL, transport.TLS)
+	}
+	if transport.DialTimeout != defaultDialTimeout {
+		t.Errorf("DialTimeout = %s, want %s", transport.DialTimeout, defaultDialTimeout)
+	}
+}
+
+func TestCheckBrokersFailsFastOnUnreachableBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	start := time.Now()
+	err = CheckBrokers(context.Background(), []string{addr},
+		WithTLS(&tls.Config{MinVersion: tls.VersionTLS12}), WithDialTimeout(time.Second))
+	if err == nil || !strings.Contains(err.Error(), addr) {
+		t.Fatalf("CheckBrokers() error = %v, want one naming broker %s", err, addr)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("CheckBrokers took %s, want it bounded by the dial timeout", elapsed)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// ContentTypeAvro is the content type of events sent by an AvroSerializer
+const ContentTypeAvro = "application/avro"
+
+// TelemetryEventAvroSchema is the Avro schema of TelemetryEvent. Metadata
+// is a map of string to a union of the JSON scalar types; nested arrays and
+// objects are carried as JSON-encoded strings.
+const TelemetryEventAvroSchema = `{
+  "type": "record",
+  "name": "TelemetryEvent",
+  "namespace": "llmsentinel.telemetry.v1",
+  "fields": [
+    {"name": "timestamp", "type": "string"},
+    {"name": "service_name", "type": "string"},
+    {"name": "model_name", "type": "string"},
+    {"name": "endpoint_type", "type": "string", "default": ""},
+    {"name": "latency_ms", "type": "double"},
+    {"name": "prompt_tokens", "type": "long"},
+    {"name": "completion_tokens", "type": "long"},
+    {"name": "total_tokens", "type": "long"},
+    {"name": "cost_usd", "type": "double"},
+    {"name": "user_id", "type": "string"},
+    {"name": "session_id", "type": "string"},
+    {"name": "request_id", "type": "string"},
+    {"name": "parent_request_id", "type": "string", "default": ""},
+    {"name": "idempotency_key", "type": "string", "default": ""},
+    {"name": "prompt_text", "type": "string", "default": ""},
+    {"name": "prompt_hash", "type": "string", "default": ""},
+    {"name": "response_text", "type": "string", "default": ""},
+    {"name": "error_code", "type": "string", "default": ""},
+    {"name": "flags", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "metadata", "type": {"type": "map", "values": ["null", "boolean", "double", "string"]}, "default": {}}
+  ]
+}`
+
+// telemetryAvroCodec encodes and decodes TelemetryEventAvroSchema
+var telemetryAvroCodec = mustAvroCodec(TelemetryEventAvroSchema)
+
+// mustAvroCodec compiles a schema known to be valid
+func mustAvroCodec(schema string) *goavro.Codec {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		panic(err)
+	}
+	return codec
+}
+
+// AvroSerializer encodes events with TelemetryEventAvroSchema in the
+// Confluent wire format: a zero magic byte and the schema's 4-byte
+// big-endian registry ID, followed by the Avro binary encoding. The schema
+// is registered under Subject on first use.
+type AvroSerializer struct {
+	// Registry registers the schema
+	Registry *SchemaRegistryClient
+	// Subject is the registry subject, by convention the topic followed by -value
+	Subject string
+}
+
+// NewAvroSerializer creates a serializer registering its schema with the
+// registry at registryURL under subject
+func NewAvroSerializer(registryURL, subject string) *AvroSerializer {
+	return &AvroSerializer{Registry: NewSchemaRegistryClient(registryURL), Subject: subject}
+}
+
+// WithSchemaRegistry encodes events as Avro, registering the schema with the
+// Confluent Schema Registry at url under the subject <topic>-value
+func WithSchemaRegistry(url string) ProducerOption {
+	return func(c *writerConfig) {
+		c.schemaRegistryURL = url
+	}
+}
+
+// Marshal registers the schema if needed and encodes the event
+func (s *AvroSerializer) Marshal(event TelemetryEvent) ([]byte, error) {
+	return s.MarshalContext(context.Background(), event)
+}
+
+// MarshalContext is Marshal with a context bounding the schema registration
+func (s *AvroSerializer) MarshalContext(ctx context.Context, event TelemetryEvent) ([]byte, error) {
+	id, err := s.Registry.Register(ctx, s.Subject, TelemetryEventAvroSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := telemetryAvroCodec.BinaryFromNative(nil, avroNative(event))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event as Avro: %w", err)
+	}
+	return FrameConfluent(id, payload), nil
+}
+
+// ContentType returns application/avro
+func (s *AvroSerializer) ContentType() string {
+	return ContentTypeAvro
+}
+
+// avroNative converts an event to goavro's native form of the schema
+func avroNative(event TelemetryEvent) map[string]interface{} {
+	flags := make([]interface{}, len(event.Flags))
+	for i, flag := range event.Flags {
+		flags[i] = flag
+	}
+	metadata := make(map[string]interface{}, len(event.Metadata))
+	for key, value := range event.Metadata {
+		metadata[key] = avroMetadataValue(value)
+	}
+
+	return map[string]interface{}{
+		"timestamp":         event.Timestamp,
+		"service_name":      event.ServiceName,
+		"model_name":        event.ModelName,
+		"endpoint_type":     string(event.EndpointType),
+		"latency_ms":        event.LatencyMs,
+		"prompt_tokens":     int64(event.PromptTokens),
+		"completion_tokens": int64(event.CompletionTokens),
+		"total_tokens":      int64(event.TotalTokens),
+		"cost_usd":          event.CostUsd,
+		"user_id":           event.UserID,
+		"session_id":        event.SessionID,
+		"request_id":        event.RequestID,
+		"parent_request_id": event.ParentRequestID,
+		"idempotency_key":   event.IdempotencyKey,
+		"prompt_text":       event.PromptText,
+		"prompt_hash":       event.PromptHash,
+		"response_text":     event.ResponseText,
+		"error_code":        event.ErrorCode,
+		"flags":             flags,
+		"metadata":          metadata,
+	}
+}
+
+// avroMetadataValue wraps a metadata value in its branch of the metadata
+// union. Numbers become doubles, as they would through JSON.
+func avroMetadataValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		return goavro.Union("boolean", v)
+	case string:
+		return goavro.Union("string", v)
+	case float64:
+		return goavro.Union("double", v)
+	case float32:
+		return goavro.Union("double", float64(v))
+	case int:
+		return goavro.Union("double", float64(v))
+	case int64:
+		return goavro.Union("double", float64(v))
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return goavro.Union("string", fmt.Sprint(value))
+	}
+	return goavro.Union("string", string(encoded))
+}
+
+// unmarshalEventAvro decodes the Avro binary encoding of an event, after
+// the Deserializer has stripped its Confluent framing
+func unmarshalEventAvro(data []byte) (TelemetryEvent, error) {
+	native, _, err := telemetryAvroCodec.NativeFromBinary(data)
+	if err != nil {
+		return TelemetryEvent{}, fmt.Errorf("failed to decode Avro event: %w", err)
+	}
+	record := native.(map[string]interface{})
+
+	str := func(name string) string { s, _ := record[name].(string); return s }
+	long := func(name string) int { n, _ := record[name].(int64); return int(n) }
+	double := func(name string) float64 { f, _ := record[name].(float64); return f }
+
+	event := TelemetryEvent{
+		Timestamp:        str("timestamp"),
+		ServiceName:      str("service_name"),
+		ModelName:        str("model_name"),
+		EndpointType:     EndpointType(str("endpoint_type")),
+		LatencyMs:        double("latency_ms"),
+		PromptTokens:     long("prompt_tokens"),
+		CompletionTokens: long("completion_tokens"),
+		TotalTokens:      long("total_tokens"),
+		CostUsd:          double("cost_usd"),
+		UserID:           str("user_id"),
+		SessionID:        str("session_id"),
+		RequestID:        str("request_id"),
+		ParentRequestID:  str("parent_request_id"),
+		IdempotencyKey:   str("idempotency_key"),
+		PromptText:       str("prompt_text"),
+		PromptHash:       str("prompt_hash"),
+		ResponseText:     str("response_text"),
+		ErrorCode:        str("error_code"),
+	}
+	if flags, _ := record["flags"].([]interface{}); len(flags) > 0 {
+		event.Flags = make([]string, len(flags))
+		for i, flag := range flags {
+			event.Flags[i], _ = flag.(string)
+		}
+	}
+	if metadata, _ := record["metadata"].(map[string]interface{}); len(metadata) > 0 {
+		event.Metadata = make(map[string]interface{}, len(metadata))
+		for key, value := range metadata {
+			// union values decode as a single-entry map of branch to value
+			if branch, ok := value.(map[string]interface{}); ok {
+				for _, v := range branch {
+					value = v
+				}
+			}
+			event.Metadata[key] = value
+		}
+	}
+	return event, nil
+}
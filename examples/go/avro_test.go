@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockSchemaRegistry assigns IDs from 41 to each new schema registered
+type mockSchemaRegistry struct {
+	mu       sync.Mutex
+	subjects []string
+	ids      map[string]int32
+}
+
+func (r *mockSchemaRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != schemaRegistryContentType ||
+		json.NewDecoder(req.Body).Decode(&body) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subjects = append(r.subjects, req.URL.Path)
+	id, ok := r.ids[body.Schema]
+	if !ok {
+		id = int32(41 + len(r.ids))
+		r.ids[body.Schema] = id
+	}
+	json.NewEncoder(w).Encode(map[string]int32{"id": id})
+}
+
+func TestAvroSerializerWireFormat(t *testing.T) {
+	registry := &mockSchemaRegistry{ids: make(map[string]int32)}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithSchemaRegistry(server.URL))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	event := testEvent("req-1")
+	event.IdempotencyKey = NewIdempotencyKey()
+	event.Flags = []string{"beta"}
+	event.Metadata = map[string]interface{}{
+		"region":  "us-east-1",
+		"retries": float64(2),
+		"cached":  true,
+		"trace":   nil,
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.SendEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(registry.subjects) != 1 || registry.subjects[0] != "/subjects/llm.telemetry-value/versions" {
+		t.Errorf("registry requests = %v, want one registration of llm.telemetry-value", registry.subjects)
+	}
+	msg := w.Messages()[0]
+	if msg.Value[0] != 0 || binary.BigEndian.Uint32(msg.Value[1:5]) != 41 {
+		t.Fatalf("header bytes = % x, want the zero magic byte and schema ID 41", msg.Value[:5])
+	}
+
+	got, err := NewDeserializer().Deserialize(msg)
+	if err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if !reflect.DeepEqual(got, event) {
+		t.Errorf("round trip = %+v, want %+v", got, event)
+	}
+}
+
+func TestSchemaRegistryClientCachesPerSubject(t *testing.T) {
+	registry := &mockSchemaRegistry{ids: make(map[string]int32)}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	client := NewSchemaRegistryClient(server.URL)
+
+	v1 := `{"type": "record", "name": "E", "fields": [{"name": "a", "type": "string"}]}`
+	v2 := `{"type": "record", "name": "E", "fields": [{"name": "a", "type": "string"}, {"name": "b", "type": "long", "default": 0}]}`
+	ids := make([]int32, 0, 3)
+	for _, schema := range []string{v1, v1, v2} {
+		id, err := client.Register(context.Background(), "events-value", schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if ids[0] != 41 || ids[1] != 41 || ids[2] != 42 {
+		t.Errorf("IDs = %v, want 41, 41 from the cache, then 42 for the evolved schema", ids)
+	}
+	if len(registry.subjects) != 2 {
+		t.Errorf("registry requests = %d, want 2", len(registry.subjects))
+	}
+}
+
+func TestSchemaRegistryClientDoesNotBlockOnSlowRegistration(t *testing.T) {
+	registry := &mockSchemaRegistry{ids: make(map[string]int32)}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "slow-value") {
+			<-release
+		}
+		registry.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+	defer close(release)
+	client := NewSchemaRegistryClient(server.URL)
+
+	if _, err := client.Register(context.Background(), "fast-value", TelemetryEventAvroSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	// a registration the caller gives up on ends with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	slow := make(chan error, 1)
+	go func() {
+		_, err := client.Register(ctx, "slow-value", TelemetryEventAvroSchema)
+		slow <- err
+	}()
+
+	cached := make(chan int32, 1)
+	go func() {
+		id, _ := client.Register(context.Background(), "fast-value", TelemetryEventAvroSchema)
+		cached <- id
+	}()
+	select {
+	case id := <-cached:
+		if id != 41 {
+			t.Errorf("cached ID = %d, want 41", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cached lookup blocked behind a slow registration")
+	}
+
+	if err := <-slow; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow Register = %v, want the caller's deadline", err)
+	}
+}
+
+func TestAvroSerializerRejectsSchemaTag(t *testing.T) {
+	registry := &mockSchemaRegistry{ids: make(map[string]int32)}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.Serializer = NewAvroSerializer(server.URL, "llm.telemetry-value")
+	p.SchemaTag = &SchemaTag{ID: 7, WireFormat: true}
+
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); !errors.Is(err, ErrSchemaTagWithAvro) {
+		t.Errorf("SendEvent = %v, want ErrSchemaTagWithAvro", err)
+	}
+	if len(w.Messages()) != 0 {
+		t.Error("sent a message framed twice")
+	}
+}
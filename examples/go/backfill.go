@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// BackfillSource lists and opens NDJSON objects holding buffered events
+type BackfillSource interface {
+	// List returns the object names to backfill
+	List(ctx context.Context) ([]string, error)
+	// Open returns a reader for the named object
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// DirSource reads NDJSON files (optionally gzip- or zstd-compressed) from a local directory
+type DirSource struct {
+	Dir string
+}
+
+// List returns the regular files in the directory
+func (s DirSource) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backfill directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Open opens a file in the directory
+func (s DirSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, name))
+}
+
+// BackfillOptions configures Backfill
+type BackfillOptions struct {
+	// RatePerSecond caps the number of events sent per second (0 = unlimited)
+	RatePerSecond float64
+	// CheckpointPath records progress so an interrupted backfill can resume (optional)
+	CheckpointPath string
+	// CheckpointInterval is the number of events between checkpoint writes (default: 100)
+	CheckpointInterval int
+}
+
+// BackfillResult summarizes a backfill run
+type BackfillResult struct {
+	Sent    int `json:"sent"`
+	Skipped int `json:"skipped"`
+}
+
+// backfillCheckpoint is the last fully processed line of the last object
+type backfillCheckpoint struct {
+	Object string `json:"object"`
+	Line   int    `json:"line"`
+}
+
+// Backfill re-produces buffered events from source in object-name order.
+// Events are sent unchanged, so their RequestIDs and message keys match the
+// originals. Malformed lines are logged and skipped. When a checkpoint path
+// is set, progress is recorded there and a later run resumes after the last
+// checkpointed line.
+func Backfill(ctx context.Context, source BackfillSource, producer *TelemetryProducer, opts BackfillOptions) (BackfillResult, error) {
+	var result BackfillResult
+
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = 100
+	}
+
+	checkpoint, err := loadBackfillCheckpoint(opts.CheckpointPath)
+	if err != nil {
+		return result, err
+	}
+
+	names, err := source.List(ctx)
+	if err != nil {
+		return result, err
+	}
+	sort.Strings(names)
+
+	var interval time.Duration
+	if opts.RatePerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / opts.RatePerSecond)
+	}
+
+	sinceCheckpoint := 0
+	for _, name := range names {
+		if name < checkpoint.Object {
+			continue
+		}
+
+		skipLines := 0
+		if name == checkpoint.Object {
+			skipLines = checkpoint.Line
+		}
+
+		line, err := backfillObject(ctx, source, producer, name, skipLines, interval, &result, func(line int) error {
+			sinceCheckpoint++
+			if sinceCheckpoint < opts.CheckpointInterval {
+				return nil
+			}
+			sinceCheckpoint = 0
+			return saveBackfillCheckpoint(opts.CheckpointPath, backfillCheckpoint{Object: name, Line: line})
+		})
+		if cpErr := saveBackfillCheckpoint(opts.CheckpointPath, backfillCheckpoint{Object: name, Line: line}); cpErr != nil && err == nil {
+			err = cpErr
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// backfillObject sends the events in one object, returning the last line
+// that was fully processed
+func backfillObject(
+	ctx context.Context,
+	source BackfillSource,
+	producer *TelemetryProducer,
+	name string,
+	skipLines int,
+	interval time.Duration,
+	result *BackfillResult,
+	onLine func(line int) error,
+) (int, error) {
+	rc, err := source.Open(ctx, name)
+	if err != nil {
+		return skipLines, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	reader, err := decompressedReader(rc, name)
+	if err != nil {
+		return skipLines, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if line <= skipLines {
+			continue
+		}
+
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var event TelemetryEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			log.Printf("Skipping malformed event at %s:%d: %v", name, line, err)
+			result.Skipped++
+			continue
+		}
+
+		if interval > 0 && result.Sent > 0 {
+			select {
+			case <-ctx.Done():
+				return line - 1, ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+
+		if err := producer.SendEvent(ctx, event); err != nil {
+			return line - 1, fmt.Errorf("failed to backfill %s:%d: %w", name, line, err)
+		}
+		result.Sent++
+
+		if err := onLine(line); err != nil {
+			return line, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return line, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return line, nil
+}
+
+// loadBackfillCheckpoint reads the checkpoint, returning the zero value when there is none
+func loadBackfillCheckpoint(path string) (backfillCheckpoint, error) {
+	var checkpoint backfillCheckpoint
+	if path == "" {
+		return checkpoint, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// saveBackfillCheckpoint atomically replaces the checkpoint file
+func saveBackfillCheckpoint(path string, checkpoint backfillCheckpoint) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// memorySource is an in-memory BackfillSource
+type memorySource map[string][]byte
+
+func (s memorySource) List(ctx context.Context) ([]string, error) {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s memorySource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, ok := s[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// limitWriter accepts a fixed number of messages and then fails
+type limitWriter struct {
+	fakeWriter
+	remaining int
+}
+
+func (w *limitWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.remaining < len(msgs) {
+		return errTestBroker
+	}
+	w.remaining -= len(msgs)
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func ndjson(t *testing.T, ids ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, id := range ids {
+		data, err := json.Marshal(testEvent(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func messageKeys(msgs []kafka.Message) []string {
+	keys := make([]string, len(msgs))
+	for i, msg := range msgs {
+		keys[i] = string(msg.Key)
+	}
+	return keys
+}
+
+func TestBackfillResumesFromCheckpoint(t *testing.T) {
+	source := memorySource{
+		"0001.ndjson":    ndjson(t, "req-1", "req-2", "req-3"),
+		"0002.ndjson.gz": gzipped(t, ndjson(t, "req-4", "req-5")),
+	}
+	checkpointPath := filepath.Join(t.TempDir(), "backfill.checkpoint")
+	opts := BackfillOptions{CheckpointPath: checkpointPath, CheckpointInterval: 1}
+
+	// The broker goes away after four events
+	first := &limitWriter{remaining: 4}
+	result, err := Backfill(context.Background(), source, &TelemetryProducer{writer: first}, opts)
+	if err == nil {
+		t.Fatal("expected backfill to fail when the broker goes away")
+	}
+	if result.Sent != 4 {
+		t.Errorf("first run sent %d events, want 4", result.Sent)
+	}
+
+	second := &fakeWriter{}
+	result, err = Backfill(context.Background(), source, &TelemetryProducer{writer: second}, opts)
+	if err != nil {
+		t.Fatalf("resumed backfill: %v", err)
+	}
+	if result.Sent != 1 {
+		t.Errorf("resumed run sent %d events, want 1", result.Sent)
+	}
+
+	got := append(messageKeys(first.Messages()), messageKeys(second.Messages())...)
+	want := []string{"req-1", "req-2", "req-3", "req-4", "req-5"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("backfilled keys = %v, want %v", got, want)
+	}
+
+	// A completed backfill has nothing left to send
+	third := &fakeWriter{}
+	result, err = Backfill(context.Background(), source, &TelemetryProducer{writer: third}, opts)
+	if err != nil || result.Sent != 0 {
+		t.Errorf("rerun after completion = %+v, %v; want nothing sent", result, err)
+	}
+}
+
+func TestBackfillSkipsMalformedLines(t *testing.T) {
+	data := append(ndjson(t, "req-1"), []byte("{not json\n\n")...)
+	data = append(data, ndjson(t, "req-2")...)
+	source := memorySource{"events.ndjson": data}
+
+	w := &fakeWriter{}
+	result, err := Backfill(context.Background(), source, &TelemetryProducer{writer: w}, BackfillOptions{})
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	if result.Sent != 2 || result.Skipped != 1 {
+		t.Errorf("result = %+v, want 2 sent and 1 skipped", result)
+	}
+}
+
+func TestBackfillDirSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "events.ndjson.gz"), gzipped(t, ndjson(t, "req-1", "req-2")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &fakeWriter{}
+	result, err := Backfill(context.Background(), DirSource{Dir: dir}, &TelemetryProducer{writer: w}, BackfillOptions{RatePerSecond: 1000})
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	if result.Sent != 2 {
+		t.Errorf("sent %d events, want 2", result.Sent)
+	}
+}
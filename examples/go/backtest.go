@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// BacktestScore counts a detector set's hits and misses for one label
+type BacktestScore struct {
+	TruePositives  int `json:"true_positives"`
+	FalsePositives int `json:"false_positives"`
+	FalseNegatives int `json:"false_negatives"`
+}
+
+// Precision returns the fraction of flags that were correct, or 0 with no flags
+func (s BacktestScore) Precision() float64 {
+	if s.TruePositives+s.FalsePositives == 0 {
+		return 0
+	}
+	return float64(s.TruePositives) / float64(s.TruePositives+s.FalsePositives)
+}
+
+// Recall returns the fraction of labeled events that were flagged, or 0 with none
+func (s BacktestScore) Recall() float64 {
+	if s.TruePositives+s.FalseNegatives == 0 {
+		return 0
+	}
+	return float64(s.TruePositives) / float64(s.TruePositives+s.FalseNegatives)
+}
+
+// BacktestResult is the outcome of a backtest
+type BacktestResult struct {
+	Events int `json:"events"`
+	// Scores holds a score per anomaly kind that was labeled or flagged
+	Scores map[string]*BacktestScore `json:"scores"`
+}
+
+// Backtest replays a labeled NDJSON dataset, such as one written by a
+// DatasetGenerator, through the detectors in order. An event counts as
+// flagged with a kind when any detector returns an anomaly of that kind
+// while observing it; aggregate anomalies count towards the event that
+// triggered them.
+func Backtest(r io.Reader, detectors ...Detector) (BacktestResult, error) {
+	result := BacktestResult{Scores: make(map[string]*BacktestScore)}
+	score := func(label string) *BacktestScore {
+		s, ok := result.Scores[label]
+		if !ok {
+			s = &BacktestScore{}
+			result.Scores[label] = s
+		}
+		return s
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var event LabeledEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return result, fmt.Errorf("invalid labeled event at line %d: %w", line, err)
+		}
+		if event.Label == "" {
+			return result, fmt.Errorf("event at line %d has no label", line)
+		}
+		result.Events++
+
+		flagged := make(map[string]bool)
+		for _, detector := range detectors {
+			for _, anomaly := range detector.Observe(event.TelemetryEvent) {
+				flagged[anomaly.Type.String()] = true
+			}
+		}
+
+		for kind := range flagged {
+			if kind == event.Label {
+				score(kind).TruePositives++
+			} else {
+				score(kind).FalsePositives++
+			}
+		}
+		if event.Label != LabelNormal && !flagged[event.Label] {
+			score(event.Label).FalseNegatives++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read dataset: %w", err)
+	}
+	return result, nil
+}
+
+// BacktestFile runs Backtest on the dataset at path
+func BacktestFile(path string, detectors ...Detector) (BacktestResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return BacktestResult{}, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer f.Close()
+
+	return Backtest(f, detectors...)
+}
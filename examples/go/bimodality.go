@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBimodalityConfig configures a LatencyBimodalityDetector
+type LatencyBimodalityConfig struct {
+	// WindowSize is the number of recent latencies per model that are analyzed (default: 500)
+	WindowSize int
+	// MinSamples is the number of latencies a model needs before it is analyzed (default: 100)
+	MinSamples int
+	// EvaluateEvery is the number of events per model between analyses (default: 100)
+	EvaluateEvery int
+	// CoefficientThreshold is the bimodality coefficient above which a distribution is bimodal (default: 0.555)
+	CoefficientThreshold float64
+	// MinSeparation is the minimum Ashman's D between the two modes (default: 3.0).
+	// Splitting a single normal distribution in half already yields about 2.6.
+	MinSeparation float64
+	// MinModeFraction is the smallest share of samples the minor mode must hold (default: 0.1)
+	MinModeFraction float64
+}
+
+// LatencyModes is the result of analyzing one model's latency distribution
+type LatencyModes struct {
+	// Coefficient is the bimodality coefficient of the log latencies; 0.555 is a uniform distribution
+	Coefficient float64
+	// Separation is Ashman's D between the two best-separated clusters
+	Separation float64
+	// LowMs and HighMs are the median latencies of the two clusters
+	LowMs  float64
+	HighMs float64
+	// HighFraction is the share of samples in the slower cluster
+	HighFraction float64
+	// Bimodal reports whether the distribution passed every threshold
+	Bimodal bool
+}
+
+// LatencyBimodalityDetector periodically analyzes each model's recent
+// latencies and flags distributions with two distinct modes, which can
+// indicate a partial outage or a cache split. It emits one aggregate
+// anomaly per model per analysis rather than one per event.
+type LatencyBimodalityDetector struct {
+	warmupGate
+
+	mu     sync.Mutex
+	config LatencyBimodalityConfig
+	now    func() time.Time
+	models map[string]*latencyWindow
+}
+
+// latencyWindow is a fixed-size ring of a model's recent latencies
+type latencyWindow struct {
+	latencies []float64
+	next      int
+	count     int
+	sinceEval int
+	last      LatencyModes
+	lastSeen  time.Time
+	// service is the service of the latest event, reported with anomalies
+	service string
+}
+
+// NewLatencyBimodalityDetector creates a detector, applying defaults for zero config values
+func NewLatencyBimodalityDetector(config LatencyBimodalityConfig) *LatencyBimodalityDetector {
+	if config.WindowSize <= 0 {
+		config.WindowSize = 500
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = 100
+	}
+	if config.EvaluateEvery <= 0 {
+		config.EvaluateEvery = 100
+	}
+	if config.CoefficientThreshold <= 0 {
+		config.CoefficientThreshold = 0.555
+	}
+	if config.MinSeparation <= 0 {
+		config.MinSeparation = 3.0
+	}
+	if config.MinModeFraction <= 0 {
+		config.MinModeFraction = 0.1
+	}
+
+	return &LatencyBimodalityDetector{
+		warmupGate: warmupGate{minSamples: config.MinSamples},
+		config:     config,
+		now:        time.Now,
+		models:     make(map[string]*latencyWindow),
+	}
+}
+
+// Observe records the event's latency and, every EvaluateEvery events for
+// its model, flags the model when its latency distribution is bimodal
+func (d *LatencyBimodalityDetector) Observe(event TelemetryEvent) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.models[event.ModelName]
+	if !ok {
+		window = &latencyWindow{latencies: make([]float64, d.config.WindowSize)}
+		d.models[event.ModelName] = window
+	}
+
+	window.lastSeen = d.now()
+	window.service = event.ServiceName
+	window.latencies[window.next] = event.LatencyMs
+	window.next = (window.next + 1) % len(window.latencies)
+	if window.count < len(window.latencies) {
+		window.count++
+	}
+	window.sinceEval++
+
+	if !d.observe(event.ModelName) || window.sinceEval < d.config.EvaluateEvery {
+		return nil
+	}
+	window.sinceEval = 0
+	return d.evaluate(event.ModelName, window)
+}
+
+// Flush analyzes every warmed-up model observed since its last analysis,
+// so the latencies of a final partial interval are not lost on shutdown
+func (d *LatencyBimodalityDetector) Flush() []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	models := make([]string, 0, len(d.models))
+	for model, window := range d.models {
+		if window.sinceEval > 0 && !d.WarmingUp(model) {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+
+	var anomalies []Anomaly
+	for _, model := range models {
+		window := d.models[model]
+		window.sinceEval = 0
+		anomalies = append(anomalies, d.evaluate(model, window)...)
+	}
+	return anomalies
+}
+
+// evaluate analyzes the model's window and flags it when it is bimodal
+func (d *LatencyBimodalityDetector) evaluate(model string, window *latencyWindow) []Anomaly {
+	window.last = d.analyze(window.latencies[:window.count])
+	if !window.last.Bimodal {
+		return nil
+	}
+
+	modes := window.last
+	return []Anomaly{{
+		Type:        AnomalyLatencyBimodality,
+		Score:       modes.Coefficient,
+		Threshold:   d.config.CoefficientThreshold,
+		ServiceName: window.service,
+		ModelName:   model,
+		Description: fmt.Sprintf("%s latency is bimodal: %.0f%% of the last %d requests near %.0fms, the rest near %.0fms",
+			model, modes.HighFraction*100, window.count, modes.HighMs, modes.LowMs),
+	}}
+}
+
+// Modes returns the most recent analysis for a model, if one has run
+func (d *LatencyBimodalityDetector) Modes(model string) (LatencyModes, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.models[model]
+	if !ok || d.WarmingUp(model) {
+		return LatencyModes{}, false
+	}
+	return d.analyze(window.latencies[:window.count]), true
+}
+
+// EvictIdle drops the state of models not observed since cutoff
+func (d *LatencyBimodalityDetector) EvictIdle(cutoff time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted := 0
+	for model, window := range d.models {
+		if window.lastSeen.Before(cutoff) {
+			delete(d.models, model)
+			d.forget(model)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// analyze computes the bimodality coefficient of the log latencies and the
+// best two-cluster split, which must both pass for the result to be bimodal.
+// Log scale keeps the long right tail of a healthy model from looking like
+// a second mode.
+func (d *LatencyBimodalityDetector) analyze(latencies []float64) LatencyModes {
+	values := make([]float64, len(latencies))
+	for i, latency := range latencies {
+		values[i] = math.Log1p(math.Max(latency, 0))
+	}
+	sort.Float64s(values)
+
+	modes := LatencyModes{Coefficient: bimodalityCoefficient(values)}
+
+	split, separation := bestSplit(values)
+	if split == 0 {
+		return modes
+	}
+	modes.Separation = separation
+	modes.LowMs = math.Expm1(median(values[:split]))
+	modes.HighMs = math.Expm1(median(values[split:]))
+	modes.HighFraction = float64(len(values)-split) / float64(len(values))
+
+	minor := math.Min(modes.HighFraction, 1-modes.HighFraction)
+	modes.Bimodal = modes.Coefficient > d.config.CoefficientThreshold &&
+		modes.Separation >= d.config.MinSeparation &&
+		minor >= d.config.MinModeFraction
+	return modes
+}
+
+// bimodalityCoefficient returns (skewness² + 1) / kurtosis, which is 1/3
+// for a normal distribution and approaches 1 for two well-separated modes
+func bimodalityCoefficient(values []float64) float64 {
+	n := float64(len(values))
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= n
+
+	var m2, m3, m4 float64
+	for _, v := range values {
+		dev := v - mean
+		m2 += dev * dev
+		m3 += dev * dev * dev
+		m4 += dev * dev * dev * dev
+	}
+	m2, m3, m4 = m2/n, m3/n, m4/n
+	if m2 == 0 {
+		return 0
+	}
+
+	skewness := m3 / math.Pow(m2, 1.5)
+	kurtosis := m4 / (m2 * m2)
+	return (skewness*skewness + 1) / kurtosis
+}
+
+// bestSplit finds the split of sorted values into two clusters that
+// minimizes the within-cluster variance, returning the index of the first
+// value in the upper cluster and Ashman's D between the clusters. It
+// returns 0 when no split is possible.
+func bestSplit(sorted []float64) (int, float64) {
+	n := len(sorted)
+	if n < 4 {
+		return 0, 0
+	}
+
+	prefix := make([]float64, n+1)
+	prefixSq := make([]float64, n+1)
+	for i, v := range sorted {
+		prefix[i+1] = prefix[i] + v
+		prefixSq[i+1] = prefixSq[i] + v*v
+	}
+
+	// sse returns the sum of squared deviations of sorted[i:j] from its mean
+	sse := func(i, j int) float64 {
+		sum, sumSq, count := prefix[j]-prefix[i], prefixSq[j]-prefixSq[i], float64(j-i)
+		return sumSq - sum*sum/count
+	}
+
+	best, bestCost := 0, math.Inf(1)
+	for split := 2; split <= n-2; split++ {
+		if cost := sse(0, split) + sse(split, n); cost < bestCost {
+			best, bestCost = split, cost
+		}
+	}
+
+	lowN, highN := float64(best), float64(n-best)
+	lowMean, highMean := prefix[best]/lowN, (prefix[n]-prefix[best])/highN
+	lowVar, highVar := sse(0, best)/lowN, sse(best, n)/highN
+	if lowVar+highVar == 0 {
+		return best, math.Inf(1)
+	}
+	return best, math.Sqrt2 * (highMean - lowMean) / math.Sqrt(lowVar+highVar)
+}
+
+// median returns the median of sorted values
+func median(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
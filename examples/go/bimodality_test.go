@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// feedLatencies observes each latency for gpt-4 and returns all anomalies raised
+func feedLatencies(d *LatencyBimodalityDetector, latencies []float64) []Anomaly {
+	var anomalies []Anomaly
+	for _, latency := range latencies {
+		event := testEvent("req")
+		event.LatencyMs = latency
+		anomalies = append(anomalies, d.Observe(event)...)
+	}
+	return anomalies
+}
+
+func TestLatencyBimodalityFlagsTwoModes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	latencies := make([]float64, 500)
+	for i := range latencies {
+		if i%3 == 0 {
+			latencies[i] = 2000 + rng.NormFloat64()*150 // cache misses
+		} else {
+			latencies[i] = 120 + rng.NormFloat64()*15 // cache hits
+		}
+	}
+
+	d := NewLatencyBimodalityDetector(LatencyBimodalityConfig{})
+	anomalies := feedLatencies(d, latencies)
+	if len(anomalies) == 0 {
+		t.Fatal("no anomaly for a bimodal distribution")
+	}
+
+	a := anomalies[len(anomalies)-1]
+	if a.Type != AnomalyLatencyBimodality || a.ModelName != "gpt-4" || a.RequestID != "" {
+		t.Errorf("anomaly = %+v, want aggregate latency_bimodality for gpt-4", a)
+	}
+
+	modes, ok := d.Modes("gpt-4")
+	if !ok || !modes.Bimodal {
+		t.Fatalf("Modes = %+v, %v, want bimodal", modes, ok)
+	}
+	if math.Abs(modes.LowMs-120) > 20 || math.Abs(modes.HighMs-2000) > 200 {
+		t.Errorf("modes = %.0fms / %.0fms, want ~120ms / ~2000ms", modes.LowMs, modes.HighMs)
+	}
+	if math.Abs(modes.HighFraction-1.0/3) > 0.05 {
+		t.Errorf("HighFraction = %.2f, want ~0.33", modes.HighFraction)
+	}
+}
+
+func TestLatencyBimodalityIgnoresUnimodal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	distributions := map[string]func() float64{
+		"normal":    func() float64 { return 500 + rng.NormFloat64()*50 },
+		"lognormal": func() float64 { return math.Exp(6 + rng.NormFloat64()*0.5) },
+	}
+
+	for name, sample := range distributions {
+		latencies := make([]float64, 1000)
+		for i := range latencies {
+			latencies[i] = sample()
+		}
+
+		d := NewLatencyBimodalityDetector(LatencyBimodalityConfig{})
+		if anomalies := feedLatencies(d, latencies); len(anomalies) != 0 {
+			t.Errorf("%s: got %d anomalies for a unimodal distribution: %+v", name, len(anomalies), anomalies[0])
+		}
+		if modes, _ := d.Modes("gpt-4"); modes.Bimodal {
+			t.Errorf("%s: Modes = %+v, want unimodal", name, modes)
+		}
+	}
+}
+
+func TestLatencyBimodalityWaitsForMinSamples(t *testing.T) {
+	d := NewLatencyBimodalityDetector(LatencyBimodalityConfig{MinSamples: 100, EvaluateEvery: 10})
+	latencies := make([]float64, 99)
+	for i := range latencies {
+		latencies[i] = []float64{100, 3000}[i%2]
+	}
+
+	if anomalies := feedLatencies(d, latencies); len(anomalies) != 0 {
+		t.Errorf("got %d anomalies before MinSamples", len(anomalies))
+	}
+	if _, ok := d.Modes("gpt-4"); ok {
+		t.Error("Modes reported before MinSamples")
+	}
+}
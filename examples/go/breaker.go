@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker for a model is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of a single circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets all sends through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails sends fast until the cooldown elapses
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial send through after the cooldown
+	BreakerHalfOpen
+)
+
+// String returns the lowercase name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the state as its name
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// circuitBreaker tracks consecutive failures for one key
+type circuitBreaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trialing bool
+}
+
+// KeyedCircuitBreaker keeps an independent circuit breaker per key, so a
+// failing model fails fast without blocking sends for other models.
+type KeyedCircuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	cooldown         time.Duration
+	now              func() time.Time
+	breakers         map[string]*circuitBreaker
+}
+
+// NewKeyedCircuitBreaker creates a breaker that opens a key after
+// failureThreshold consecutive failures and allows a trial send once
+// cooldown has elapsed.
+func NewKeyedCircuitBreaker(failureThreshold int, cooldown time.Duration) *KeyedCircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &KeyedCircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+		breakers:         make(map[string]*circuitBreaker),
+	}
+}
+
+// setLimits changes the threshold and cooldown, keeping per-key state
+func (b *KeyedCircuitBreaker) setLimits(failureThreshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failureThreshold = failureThreshold
+	b.cooldown = cooldown
+}
+
+// limits returns the threshold and cooldown
+func (b *KeyedCircuitBreaker) limits() (int, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failureThreshold, b.cooldown
+}
+
+// Allow returns ErrCircuitOpen if sends for key should fail fast
+func (b *KeyedCircuitBreaker) Allow(key string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cb, ok := b.breakers[key]
+	if !ok {
+		return nil
+	}
+
+	switch cb.state {
+	case BreakerOpen:
+		if b.now().Sub(cb.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		cb.state = BreakerHalfOpen
+		cb.trialing = true
+		return nil
+	case BreakerHalfOpen:
+		if cb.trialing {
+			return ErrCircuitOpen
+		}
+		cb.trialing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record updates the breaker for key with the outcome of a send
+func (b *KeyedCircuitBreaker) Record(key string, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cb, ok := b.breakers[key]
+	if !ok {
+		if err == nil {
+			return
+		}
+		cb = &circuitBreaker{}
+		b.breakers[key] = cb
+	}
+
+	cb.trialing = false
+	if err == nil {
+		cb.state = BreakerClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == BreakerHalfOpen || cb.failures >= b.failureThreshold {
+		cb.state = BreakerOpen
+		cb.openedAt = b.now()
+	}
+}
+
+// States returns a snapshot of the breaker state for every known key
+func (b *KeyedCircuitBreaker) States() map[string]BreakerState {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make(map[string]BreakerState, len(b.breakers))
+	for key, cb := range b.breakers {
+		states[key] = cb.state
+	}
+	return states
+}
+
+// ProducerStats is a point-in-time snapshot of producer state
+type ProducerStats struct {
+	Breakers map[string]BreakerState `json:"breakers,omitempty"`
+}
+
+// Stats returns a snapshot of the producer's runtime state
+func (p *TelemetryProducer) Stats() ProducerStats {
+	p.mu.RLock()
+	breaker := p.Breaker
+	p.mu.RUnlock()
+
+	return ProducerStats{
+		Breakers: breaker.States(),
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// modelFailingWriter fails writes for events of a single model
+type modelFailingWriter struct {
+	fakeWriter
+	failModel string
+}
+
+func (w *modelFailingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		if bytes.Contains(msg.Value, []byte(`"model_name":"`+w.failModel+`"`)) {
+			return errTestBroker
+		}
+	}
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func TestKeyedCircuitBreakerIsolatesModels(t *testing.T) {
+	breaker := NewKeyedCircuitBreaker(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Allow("gpt-4"); err != nil {
+			t.Fatalf("attempt %d: Allow = %v before threshold", i, err)
+		}
+		breaker.Record("gpt-4", errTestBroker)
+		breaker.Record("claude-3-opus", nil)
+	}
+
+	if err := breaker.Allow("gpt-4"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("gpt-4 Allow = %v, want ErrCircuitOpen", err)
+	}
+	if err := breaker.Allow("claude-3-opus"); err != nil {
+		t.Errorf("claude-3-opus Allow = %v, want nil", err)
+	}
+
+	states := breaker.States()
+	if states["gpt-4"] != BreakerOpen {
+		t.Errorf("gpt-4 state = %s, want open", states["gpt-4"])
+	}
+	if _, ok := states["claude-3-opus"]; ok {
+		t.Errorf("healthy model should not have breaker state, got %s", states["claude-3-opus"])
+	}
+}
+
+func TestKeyedCircuitBreakerHalfOpenTrial(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := NewKeyedCircuitBreaker(1, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Record("gpt-4", errTestBroker)
+	if err := breaker.Allow("gpt-4"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow during cooldown = %v, want ErrCircuitOpen", err)
+	}
+
+	now = now.Add(11 * time.Second)
+	if err := breaker.Allow("gpt-4"); err != nil {
+		t.Fatalf("trial Allow after cooldown = %v, want nil", err)
+	}
+	if err := breaker.Allow("gpt-4"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second Allow during trial = %v, want ErrCircuitOpen", err)
+	}
+
+	breaker.Record("gpt-4", nil)
+	if state := breaker.States()["gpt-4"]; state != BreakerClosed {
+		t.Errorf("state after successful trial = %s, want closed", state)
+	}
+}
+
+func TestProducerStatsReportsPerModelBreakers(t *testing.T) {
+	w := &modelFailingWriter{failModel: "gpt-4"}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+	producer.Breaker = NewKeyedCircuitBreaker(2, time.Minute)
+	ctx := context.Background()
+
+	gpt := testEvent("req-gpt")
+	claude := testEvent("req-claude")
+	claude.ModelName = "claude-3-opus"
+
+	for i := 0; i < 2; i++ {
+		if err := producer.SendEvent(ctx, gpt); err == nil {
+			t.Fatal("expected gpt-4 send to fail")
+		}
+	}
+
+	if err := producer.SendEvent(ctx, gpt); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("gpt-4 send with open breaker = %v, want ErrCircuitOpen", err)
+	}
+	if err := producer.SendEvent(ctx, claude); err != nil {
+		t.Errorf("claude send = %v, want nil", err)
+	}
+
+	stats := producer.Stats()
+	if stats.Breakers["gpt-4"] != BreakerOpen {
+		t.Errorf("gpt-4 breaker = %s, want open", stats.Breakers["gpt-4"])
+	}
+	if state, ok := stats.Breakers["claude-3-opus"]; ok && state != BreakerClosed {
+		t.Errorf("claude breaker = %s, want closed", state)
+	}
+}
+
+func TestSendEventsRecordsOneBreakerOutcomePerModel(t *testing.T) {
+	w := &modelFailingWriter{failModel: "gpt-4"}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+	producer.Breaker = NewKeyedCircuitBreaker(2, time.Minute)
+
+	batch := []TelemetryEvent{testEvent("req-1"), testEvent("req-2"), testEvent("req-3")}
+	if err := producer.SendEvents(context.Background(), batch); err == nil {
+		t.Fatal("expected gpt-4 batch to fail")
+	}
+
+	// One failed write is one failure, however many events it carried.
+	if state := producer.Stats().Breakers["gpt-4"]; state != BreakerClosed {
+		t.Errorf("gpt-4 breaker after one failed batch = %s, want closed", state)
+	}
+	if err := producer.Breaker.Allow("gpt-4"); err != nil {
+		t.Errorf("Allow after one failed batch = %v, want nil", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTokenBudgetExceeded is returned for events over their model's token budget
+var ErrTokenBudgetExceeded = errors.New("token budget exceeded")
+
+// TokenBudget rejects events whose TotalTokens exceed a per-model maximum,
+// turning the high_tokens anomaly into prevention rather than detection
+type TokenBudget struct {
+	// Limits maps model name to the maximum TotalTokens per request
+	Limits map[string]int
+	// Default applies to models without an entry in Limits (0 = unlimited)
+	Default int
+	// OnExceeded is called for each rejected event, e.g. to abort the LLM call (optional)
+	OnExceeded func(event TelemetryEvent, limit int)
+}
+
+// Limit returns the token limit for a model, or 0 if it is unlimited
+func (b *TokenBudget) Limit(model string) int {
+	if limit, ok := b.Limits[model]; ok {
+		return limit
+	}
+	return b.Default
+}
+
+// Check returns an error wrapping ErrTokenBudgetExceeded if the event is over budget
+func (b *TokenBudget) Check(event TelemetryEvent) error {
+	if b == nil {
+		return nil
+	}
+
+	limit := b.Limit(event.ModelName)
+	if limit <= 0 || event.TotalTokens <= limit {
+		return nil
+	}
+
+	if b.OnExceeded != nil {
+		b.OnExceeded(event, limit)
+	}
+	return fmt.Errorf("%w: event %s used %d tokens, %s limit is %d",
+		ErrTokenBudgetExceeded, event.RequestID, event.TotalTokens, event.ModelName, limit)
+}
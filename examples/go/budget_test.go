@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTokenBudgetLimits(t *testing.T) {
+	var exceeded []string
+	budget := &TokenBudget{
+		Limits:     map[string]int{"gpt-4": 8000},
+		Default:    4000,
+		OnExceeded: func(event TelemetryEvent, limit int) { exceeded = append(exceeded, event.RequestID) },
+	}
+
+	tests := []struct {
+		name    string
+		model   string
+		tokens  int
+		wantErr bool
+	}{
+		{"under model limit", "gpt-4", 7999, false},
+		{"at model limit", "gpt-4", 8000, false},
+		{"over model limit", "gpt-4", 8001, true},
+		{"under default", "claude-3-opus", 3999, false},
+		{"at default", "claude-3-opus", 4000, false},
+		{"over default", "claude-3-opus", 4001, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := testEvent(tt.name)
+			event.ModelName = tt.model
+			event.TotalTokens = tt.tokens
+
+			err := budget.Check(event)
+			if gotErr := errors.Is(err, ErrTokenBudgetExceeded); gotErr != tt.wantErr {
+				t.Errorf("Check = %v, want exceeded=%v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if len(exceeded) != 2 || exceeded[0] != "over model limit" || exceeded[1] != "over default" {
+		t.Errorf("OnExceeded called for %v", exceeded)
+	}
+}
+
+func TestTokenBudgetUnlimitedByDefault(t *testing.T) {
+	budget := &TokenBudget{Limits: map[string]int{"gpt-4": 100}}
+	event := testEvent("req-1")
+	event.ModelName = "claude-3-opus"
+	event.TotalTokens = 1000000
+
+	if err := budget.Check(event); err != nil {
+		t.Errorf("Check = %v, want nil for unlimited model", err)
+	}
+}
+
+func TestProducerRejectsOverBudgetEvents(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.TokenBudget = &TokenBudget{Limits: map[string]int{"gpt-4": 400}}
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-over")); !errors.Is(err, ErrTokenBudgetExceeded) {
+		t.Fatalf("SendEvent = %v, want ErrTokenBudgetExceeded", err)
+	}
+
+	under := testEvent("req-under")
+	under.TotalTokens = 400
+	if err := producer.SendEvent(context.Background(), under); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if keys := messageKeys(w.Messages()); len(keys) != 1 || keys[0] != "req-under" {
+		t.Errorf("sent %v, want only req-under", keys)
+	}
+}
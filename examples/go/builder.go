@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// maxTopicLength is the longest topic name Kafka accepts
+const maxTopicLength = 249
+
+// ProducerBuilder configures a TelemetryProducer step by step. Invalid
+// settings are collected and reported together by Build.
+type ProducerBuilder struct {
+	brokers  []string
+	topic    string
+	opts     []ProducerOption
+	keyFunc  KeyFunc
+	redactor Redactor
+	sampler  Sampler
+	retry    RetryPolicy
+	errs     []error
+}
+
+// NewProducerBuilder creates a builder with no brokers or topic set
+func NewProducerBuilder() *ProducerBuilder {
+	return &ProducerBuilder{}
+}
+
+// WithBrokers adds Kafka broker addresses
+func (b *ProducerBuilder) WithBrokers(brokers ...string) *ProducerBuilder {
+	b.brokers = append(b.brokers, brokers...)
+	return b
+}
+
+// WithTopic sets the topic events are sent to
+func (b *ProducerBuilder) WithTopic(topic string) *ProducerBuilder {
+	b.topic = topic
+	return b
+}
+
+// WithCompression compresses message batches with the codec
+func (b *ProducerBuilder) WithCompression(codec kafka.Compression) *ProducerBuilder {
+	if codec != 0 && codec.Codec() == nil {
+		b.errs = append(b.errs, fmt.Errorf("unknown compression codec %d", int(codec)))
+		return b
+	}
+	return b.WithOptions(WithCompression(codec))
+}
+
+// WithOptions applies writer options such as WithRequiredAcks
+func (b *ProducerBuilder) WithOptions(opts ...ProducerOption) *ProducerBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// WithKeyFunc sets how message keys are derived from events
+func (b *ProducerBuilder) WithKeyFunc(keyFunc KeyFunc) *ProducerBuilder {
+	if keyFunc == nil {
+		b.errs = append(b.errs, errors.New("key func is nil"))
+	}
+	b.keyFunc = keyFunc
+	return b
+}
+
+// WithRedactor scrubs prompt and response text before events are sent
+func (b *ProducerBuilder) WithRedactor(redactor Redactor) *ProducerBuilder {
+	if redactor == nil {
+		b.errs = append(b.errs, errors.New("redactor is nil"))
+	}
+	b.redactor = redactor
+	return b
+}
+
+// WithSampler drops the events the sampler does not keep
+func (b *ProducerBuilder) WithSampler(sampler Sampler) *ProducerBuilder {
+	if sampler == nil {
+		b.errs = append(b.errs, errors.New("sampler is nil"))
+	}
+	b.sampler = sampler
+	return b
+}
+
+// WithRetry retries transient write failures with the policy
+func (b *ProducerBuilder) WithRetry(policy RetryPolicy) *ProducerBuilder {
+	if policy.MaxRetries < 0 {
+		b.errs = append(b.errs, fmt.Errorf("retry policy has negative MaxRetries %d", policy.MaxRetries))
+	}
+	b.retry = policy
+	return b
+}
+
+// Build validates the settings and creates the producer. It returns every
+// invalid setting in one error.
+func (b *ProducerBuilder) Build() (*TelemetryProducer, error) {
+	errs := append([]error(nil), b.errs...)
+	if len(b.brokers) == 0 {
+		errs = append(errs, errors.New("no brokers set"))
+	}
+	for _, broker := range b.brokers {
+		if strings.TrimSpace(broker) == "" {
+			errs = append(errs, errors.New("broker address is empty"))
+			break
+		}
+	}
+	if err := validateTopic(b.topic); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid producer configuration: %w", err)
+	}
+
+	// builder settings come first, so options given WithOptions override them
+	var opts []ProducerOption
+	if b.keyFunc != nil {
+		opts = append(opts, WithKeyFunc(b.keyFunc))
+	}
+	if b.redactor != nil {
+		opts = append(opts, WithRedactor(b.redactor))
+	}
+	p := NewTelemetryProducer(b.brokers, b.topic, append(opts, b.opts...)...)
+	if b.sampler != nil {
+		p.Sampler = b.sampler
+	}
+	if b.retry != (RetryPolicy{}) {
+		p.Retry = b.retry
+	}
+	return p, nil
+}
+
+// validateTopic checks the topic against Kafka's naming rules
+func validateTopic(topic string) error {
+	switch {
+	case topic == "":
+		return errors.New("no topic set")
+	case len(topic) > maxTopicLength:
+		return fmt.Errorf("topic is longer than %d characters", maxTopicLength)
+	case topic == "." || topic == "..":
+		return fmt.Errorf("topic %q is not allowed", topic)
+	}
+	for _, r := range topic {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return fmt.Errorf("topic %q contains %q; only letters, digits, '.', '_' and '-' are allowed", topic, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestProducerBuilderFullyConfigured(t *testing.T) {
+	p, err := NewProducerBuilder().
+		WithBrokers("kafka-0:9092", "kafka-1:9092").
+		WithTopic("llm.telemetry").
+		WithCompression(kafka.Zstd).
+		WithOptions(WithRequiredAcks(kafka.RequireOne), WithWriteTimeout(time.Second)).
+		WithKeyFunc(UserIDKey).
+		WithRedactor(NewJSONRedactor()).
+		WithSampler(RateSampler{Rate: 1}).
+		WithRetry(RetryPolicy{MaxRetries: 2}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := p.writer.(*kafka.Writer)
+	defer w.Close()
+	if w.Addr.String() != "kafka-0:9092,kafka-1:9092" || w.Topic != "llm.telemetry" {
+		t.Errorf("writer for %s/%s", w.Addr, w.Topic)
+	}
+	if w.Compression != kafka.Zstd || w.RequiredAcks != kafka.RequireOne || w.WriteTimeout != time.Second {
+		t.Errorf("Compression = %v, RequiredAcks = %v, WriteTimeout = %s", w.Compression, w.RequiredAcks, w.WriteTimeout)
+	}
+	if w.MaxAttempts != 3 {
+		t.Errorf("MaxAttempts = %d, want the default 3", w.MaxAttempts)
+	}
+	if p.Retry.MaxRetries != 2 || p.Sampler == nil {
+		t.Errorf("Retry = %+v, Sampler = %v", p.Retry, p.Sampler)
+	}
+
+	// send through a fake writer to check the key func and redactor are applied
+	fw := &fakeWriter{}
+	p.writer = fw
+	event := testEvent("req-1")
+	event.PromptText = `{"user": "alice", "password": "hunter2"}`
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := fw.Messages()[0]
+	if string(msg.Key) != "user-1" {
+		t.Errorf("key = %q, want the user ID", msg.Key)
+	}
+	if strings.Contains(string(msg.Value), "hunter2") {
+		t.Errorf("password was not redacted: %s", msg.Value)
+	}
+}
+
+func TestProducerBuilderKeepsRedactorFromOptions(t *testing.T) {
+	p, err := NewProducerBuilder().
+		WithBrokers("kafka-0:9092").
+		WithTopic("llm.telemetry").
+		WithOptions(WithRedactor(NewPatternRedactor())).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.writer.Close()
+	fw := &fakeWriter{}
+	p.writer = fw
+
+	event := testEvent("req-1")
+	event.PromptText = "I'm jane@example.com"
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(fw.Messages()[0].Value), "jane@example.com") {
+		t.Errorf("email was not redacted: %s", fw.Messages()[0].Value)
+	}
+}
+
+func TestProducerBuilderReportsEveryError(t *testing.T) {
+	_, err := NewProducerBuilder().
+		WithBrokers("").
+		WithTopic("llm telemetry").
+		WithCompression(kafka.Compression(9)).
+		WithSampler(nil).
+		Build()
+	if err == nil {
+		t.Fatal("Build succeeded, want an error")
+	}
+
+	for _, want := range []string{"broker address is empty", `contains ' '`, "unknown compression codec 9", "sampler is nil"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestProducerBuilderRequiresBrokersAndTopic(t *testing.T) {
+	_, err := NewProducerBuilder().Build()
+	if err == nil || !strings.Contains(err.Error(), "no brokers set") || !strings.Contains(err.Error(), "no topic set") {
+		t.Errorf("Build() error = %v, want missing brokers and topic", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BurstConfig configures a BurstDetector
+type BurstConfig struct {
+	// Window is the sliding window requests are counted over (default: 10s)
+	Window time.Duration
+	// MaxRequests is the number of requests a session may make within Window (default: 10)
+	MaxRequests int
+	// ExitRequests is the count a flagged session's requests within Window
+	// must fall to before it stops being flagged (default: MaxRequests)
+	ExitRequests int
+	// IdleTTL evicts sessions with no requests for this long (default: 5 * Window)
+	IdleTTL time.Duration
+	// MinSamples is the number of requests a session needs before it can be flagged (default: 0)
+	MinSamples int
+}
+
+// BurstDetector flags sessions sending requests faster than a configured
+// rate, such as a client rapidly retrying the same prompt. Request times are
+// taken from the event timestamps, so replayed traffic is judged by when it
+// originally happened.
+type BurstDetector struct {
+	warmupGate
+	hysteresis
+
+	mu        sync.Mutex
+	config    BurstConfig
+	now       func() time.Time
+	sessions  map[string]*sessionRequests
+	lastSweep time.Time
+}
+
+// sessionRequests holds the request times of one session within the window
+type sessionRequests struct {
+	times    []time.Time
+	lastSeen time.Time
+	// touched is the processing time of the latest request, for EvictIdle
+	touched time.Time
+}
+
+// NewBurstDetector creates a detector, applying defaults for zero config values
+func NewBurstDetector(config BurstConfig) *BurstDetector {
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.MaxRequests <= 0 {
+		config.MaxRequests = 10
+	}
+	if config.IdleTTL <= 0 {
+		config.IdleTTL = 5 * config.Window
+	}
+
+	return &BurstDetector{
+		warmupGate: warmupGate{minSamples: config.MinSamples},
+		hysteresis: newHysteresis(float64(config.MaxRequests), float64(config.ExitRequests)),
+		config:     config,
+		now:        time.Now,
+		sessions:   make(map[string]*sessionRequests),
+	}
+}
+
+// Observe records the request and flags it while its session is flagged:
+// it has exceeded MaxRequests within the window and not since fallen to
+// ExitRequests. The anomaly score is the observed rate in requests per
+// second.
+func (d *BurstDetector) Observe(event TelemetryEvent) []Anomaly {
+	if event.SessionID == "" {
+		return nil
+	}
+
+	now := eventTime(event)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.evictIdle(now)
+
+	session, ok := d.sessions[event.SessionID]
+	if !ok {
+		session = &sessionRequests{}
+		d.sessions[event.SessionID] = session
+	}
+
+	session.touched = d.now()
+	session.times = append(trimBefore(session.times, now.Add(-d.config.Window)), now)
+	if now.After(session.lastSeen) {
+		session.lastSeen = now
+	}
+
+	warm := d.observe(event.SessionID)
+
+	count := len(session.times)
+	if !warm || !d.update(event.SessionID, float64(count)) {
+		return nil
+	}
+
+	seconds := d.config.Window.Seconds()
+	rate := float64(count) / seconds
+	threshold := float64(d.config.MaxRequests) / seconds
+
+	return []Anomaly{newAnomaly(AnomalySuspiciousPattern, event, rate, threshold,
+		fmt.Sprintf("session %s made %d requests in %s (%.2f/s)", event.SessionID, count, d.config.Window, rate))}
+}
+
+// Rate returns the session's current request rate per second and the window it covers
+func (d *BurstDetector) Rate(sessionID string) (float64, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session, ok := d.sessions[sessionID]
+	if !ok {
+		return 0, d.config.Window
+	}
+
+	count := len(trimBefore(session.times, session.lastSeen.Add(-d.config.Window)))
+	return float64(count) / d.config.Window.Seconds(), d.config.Window
+}
+
+// Sessions returns the number of sessions currently tracked
+func (d *BurstDetector) Sessions() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.sessions)
+}
+
+// EvictIdle drops sessions with no requests processed since cutoff
+func (d *BurstDetector) EvictIdle(cutoff time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted := 0
+	for id, session := range d.sessions {
+		if session.touched.Before(cutoff) {
+			delete(d.sessions, id)
+			d.forget(id)
+			d.unflag(id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// evictIdle drops sessions idle for longer than IdleTTL, at most once per window
+func (d *BurstDetector) evictIdle(now time.Time) {
+	if now.Sub(d.lastSweep) < d.config.Window {
+		return
+	}
+	d.lastSweep = now
+
+	for id, session := range d.sessions {
+		if now.Sub(session.lastSeen) > d.config.IdleTTL {
+			delete(d.sessions, id)
+			d.forget(id)
+			d.unflag(id)
+		}
+	}
+}
+
+// trimBefore drops the leading times (in ascending order) that fall before cutoff
+func trimBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func eventAt(requestID, sessionID string, ts time.Time) TelemetryEvent {
+	event := testEvent(requestID)
+	event.SessionID = sessionID
+	event.Timestamp = ts.UTC().Format(time.RFC3339Nano)
+	return event
+}
+
+func TestBurstDetectorFlagsBurstingSession(t *testing.T) {
+	detector := NewBurstDetector(BurstConfig{Window: time.Second, MaxRequests: 5})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	var burst, steady []Anomaly
+	for i := 0; i < 20; i++ {
+		ts := start.Add(time.Duration(i) * 40 * time.Millisecond)
+		// 20 requests within one second from one session
+		burst = append(burst, detector.Observe(eventAt(fmt.Sprintf("burst-%d", i), "session-burst", ts))...)
+		// One request every 200ms from another
+		if i%5 == 0 {
+			steady = append(steady, detector.Observe(eventAt(fmt.Sprintf("steady-%d", i), "session-steady", ts))...)
+		}
+	}
+
+	if len(steady) != 0 {
+		t.Errorf("steady session flagged %d times", len(steady))
+	}
+	if len(burst) == 0 {
+		t.Fatal("expected bursting session to be flagged")
+	}
+
+	anomaly := burst[len(burst)-1]
+	if anomaly.Type != AnomalySuspiciousPattern || anomaly.SessionID != "session-burst" {
+		t.Errorf("unexpected anomaly %+v", anomaly)
+	}
+	if anomaly.Score <= anomaly.Threshold {
+		t.Errorf("score %v not above threshold %v", anomaly.Score, anomaly.Threshold)
+	}
+
+	rate, window := detector.Rate("session-burst")
+	if window != time.Second || rate <= 5 {
+		t.Errorf("Rate = %v over %s, want > 5 over 1s", rate, window)
+	}
+}
+
+func TestBurstDetectorEvictsIdleSessions(t *testing.T) {
+	detector := NewBurstDetector(BurstConfig{Window: time.Second, MaxRequests: 5, IdleTTL: 2 * time.Second})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	detector.Observe(eventAt("req-1", "session-idle", start))
+	detector.Observe(eventAt("req-2", "session-active", start.Add(2*time.Second)))
+	detector.Observe(eventAt("req-3", "session-active", start.Add(4*time.Second)))
+
+	if n := detector.Sessions(); n != 1 {
+		t.Errorf("tracking %d sessions, want 1 after idle eviction", n)
+	}
+	if rate, _ := detector.Rate("session-idle"); rate != 0 {
+		t.Errorf("evicted session rate = %v, want 0", rate)
+	}
+}
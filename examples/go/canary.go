@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CanaryKey is the metadata key marking an event as a canary
+const CanaryKey = "_canary"
+
+// CanaryConfig configures a CanaryMonitor
+type CanaryConfig struct {
+	// Interval is how often Run sends a canary (default: 10s)
+	Interval time.Duration
+	// SLA is the produce-to-consume latency above which a canary raises a
+	// pipeline_latency anomaly (default: 5s)
+	SLA time.Duration
+	// LossWindow is how long Check waits for a canary before it raises a
+	// canary_loss anomaly (default: 3 * Interval)
+	LossWindow time.Duration
+	// ServiceName and ModelName identify canary events (default:
+	// "llm-sentinel-canary" and "canary")
+	ServiceName string
+	ModelName   string
+	// Metrics registers the canary_pipeline_latency_seconds histogram
+	// (optional)
+	Metrics *prometheus.Registry
+}
+
+// CanaryMonitor measures the end-to-end latency of the telemetry pipeline.
+// The producing side sends synthetic canary events with Send or Run; the
+// consuming side passes every event to Observe, which times the canaries
+// from their timestamp to their arrival and flags those slower than the
+// SLA. Check, called periodically, flags canary loss. Producer and consumer
+// may run in different processes, so their clocks should be synchronized.
+type CanaryMonitor struct {
+	producer *TelemetryProducer
+	config   CanaryConfig
+	now      func() time.Time
+	latency  prometheus.Observer
+	sent     atomic.Int64
+
+	mu           sync.Mutex
+	started      time.Time
+	lastReceived time.Time
+	lastLatency  time.Duration
+	lost         bool
+}
+
+// NewCanaryMonitor creates a monitor sending canaries with producer, which
+// may be nil on the consuming side, applying defaults for zero config values
+func NewCanaryMonitor(producer *TelemetryProducer, config CanaryConfig) (*CanaryMonitor, error) {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.SLA <= 0 {
+		config.SLA = 5 * time.Second
+	}
+	if config.LossWindow <= 0 {
+		config.LossWindow = 3 * config.Interval
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = "llm-sentinel-canary"
+	}
+	if config.ModelName == "" {
+		config.ModelName = "canary"
+	}
+
+	m := &CanaryMonitor{producer: producer, config: config, now: time.Now}
+	m.started = m.now()
+	if config.Metrics != nil {
+		histogram, err := registerCollector(config.Metrics, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "canary_pipeline_latency_seconds",
+			Help:    "Produce-to-consume latency of canary events.",
+			Buckets: prometheus.DefBuckets,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		m.latency = histogram
+	}
+	return m, nil
+}
+
+// IsCanary reports whether the event is a canary, so handlers can skip it
+func IsCanary(event TelemetryEvent) bool {
+	canary, _ := event.Metadata[CanaryKey].(bool)
+	return canary
+}
+
+// Send sends one canary, timestamped now
+func (m *CanaryMonitor) Send(ctx context.Context) error {
+	n := m.sent.Add(1)
+	event := TelemetryEvent{
+		Timestamp:   m.now().UTC().Format(time.RFC3339Nano),
+		ServiceName: m.config.ServiceName,
+		ModelName:   m.config.ModelName,
+		RequestID:   fmt.Sprintf("canary-%d-%d", m.started.UnixMilli(), n),
+		Metadata:    map[string]interface{}{CanaryKey: true},
+	}
+	if err := m.producer.SendEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to send canary: %w", err)
+	}
+	return nil
+}
+
+// Run sends a canary every Interval until ctx is cancelled. Failed sends
+// are logged; they show up as canary loss.
+func (m *CanaryMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Send(ctx); err != nil && ctx.Err() == nil {
+			m.producer.logger().Warn("Canary send failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Observe records the pipeline latency of a canary and returns a
+// pipeline_latency anomaly when it exceeds the SLA, scored in seconds.
+// Other events are ignored, so the monitor can run in a DetectorPipeline.
+func (m *CanaryMonitor) Observe(event TelemetryEvent) []Anomaly {
+	if !IsCanary(event) {
+		return nil
+	}
+
+	now := m.now()
+	latency := now.Sub(eventTime(event))
+	if m.latency != nil {
+		m.latency.Observe(latency.Seconds())
+	}
+
+	m.mu.Lock()
+	m.lastReceived = now
+	m.lastLatency = latency
+	m.lost = false
+	m.mu.Unlock()
+
+	if latency <= m.config.SLA {
+		return nil
+	}
+	return []Anomaly{newAnomaly(AnomalyPipelineLatency, event, latency.Seconds(), m.config.SLA.Seconds(),
+		fmt.Sprintf("canary %s took %s from producer to consumer (SLA %s)",
+			event.RequestID, latency.Round(time.Millisecond), m.config.SLA))}
+}
+
+// Check returns a canary_loss anomaly when no canary has arrived for
+// LossWindow, counted from the monitor's creation until the first one. It
+// is raised once per loss; the next canary clears it.
+func (m *CanaryMonitor) Check() []Anomaly {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since := m.lastReceived
+	if since.IsZero() {
+		since = m.started
+	}
+	silence := m.now().Sub(since)
+	if m.lost || silence <= m.config.LossWindow {
+		return nil
+	}
+	m.lost = true
+
+	event := TelemetryEvent{ServiceName: m.config.ServiceName, ModelName: m.config.ModelName}
+	return []Anomaly{newAnomaly(AnomalyCanaryLoss, event, silence.Seconds(), m.config.LossWindow.Seconds(),
+		fmt.Sprintf("no canary received for %s (window %s)", silence.Round(time.Second), m.config.LossWindow))}
+}
+
+// LastLatency returns the pipeline latency of the latest canary, and false
+// before the first one arrives
+func (m *CanaryMonitor) LastLatency() (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lastLatency, !m.lastReceived.IsZero()
+}
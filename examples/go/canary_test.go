@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// chanSink delivers written events to a channel, standing in for a topic
+type chanSink chan TelemetryEvent
+
+func (s chanSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	for _, event := range events {
+		s <- event
+	}
+	return nil
+}
+
+func (s chanSink) Close() error { return nil }
+
+func TestCanaryMeasuresRoundTrip(t *testing.T) {
+	topic := make(chanSink, 10)
+	reg := prometheus.NewRegistry()
+	monitor, err := NewCanaryMonitor(NewSinkProducer(topic), CanaryConfig{SLA: time.Second, Metrics: reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []Anomaly)
+	go func() {
+		// the consumer, passing every event to the monitor
+		var anomalies []Anomaly
+		for event := range topic {
+			anomalies = append(anomalies, monitor.Observe(event)...)
+		}
+		done <- anomalies
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := monitor.Send(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(topic)
+	if anomalies := <-done; len(anomalies) != 0 {
+		t.Errorf("in-memory round trips breached the SLA: %v", anomalies)
+	}
+
+	latency, ok := monitor.LastLatency()
+	if !ok || latency < 0 || latency > time.Second {
+		t.Errorf("LastLatency() = %s, %v, want a measured sub-second latency", latency, ok)
+	}
+	if count := testutil.CollectAndCount(reg, "canary_pipeline_latency_seconds"); count != 1 {
+		t.Fatalf("canary_pipeline_latency_seconds has %d series, want 1", count)
+	}
+	families, _ := reg.Gather()
+	if n := families[0].GetMetric()[0].GetHistogram().GetSampleCount(); n != 3 {
+		t.Errorf("histogram observed %d canaries, want 3", n)
+	}
+}
+
+func TestCanaryFlagsSlowPipelineAndLoss(t *testing.T) {
+	sink := &MemorySink{}
+	monitor, err := NewCanaryMonitor(NewSinkProducer(sink), CanaryConfig{Interval: 10 * time.Second, SLA: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+	monitor.started = now
+
+	if err := monitor.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	canary := sink.Events()[0]
+	if !IsCanary(canary) || IsCanary(testEvent("req-1")) {
+		t.Fatal("IsCanary does not tell canaries from other events")
+	}
+	if anomalies := monitor.Observe(testEvent("req-1")); len(anomalies) != 0 {
+		t.Errorf("a regular event was flagged: %v", anomalies)
+	}
+
+	now = now.Add(8 * time.Second)
+	anomalies := monitor.Observe(canary)
+	if len(anomalies) != 1 || anomalies[0].Type != AnomalyPipelineLatency || anomalies[0].Score != 8 {
+		t.Fatalf("anomalies = %v, want pipeline_latency scored 8s", anomalies)
+	}
+
+	// the loss window defaults to 3 intervals after the latest canary
+	now = now.Add(30 * time.Second)
+	if anomalies := monitor.Check(); len(anomalies) != 0 {
+		t.Fatalf("loss flagged within the window: %v", anomalies)
+	}
+	now = now.Add(time.Second)
+	anomalies = monitor.Check()
+	if len(anomalies) != 1 || anomalies[0].Type != AnomalyCanaryLoss {
+		t.Fatalf("anomalies = %v, want canary_loss", anomalies)
+	}
+	if anomalies := monitor.Check(); len(anomalies) != 0 {
+		t.Errorf("loss flagged twice: %v", anomalies)
+	}
+
+	monitor.Send(context.Background())
+	monitor.Observe(sink.Events()[1])
+	now = now.Add(31 * time.Second)
+	if anomalies := monitor.Check(); len(anomalies) != 1 {
+		t.Errorf("anomalies = %v, want a new loss after the canaries resumed and stopped", anomalies)
+	}
+}
+
+func TestCanaryBypassesTrafficFilters(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.CostFilter = &CostFilter{MinCostUsd: 0.01}
+	producer.Sampler = RateSampler{Rate: 0}
+	monitor, err := NewCanaryMonitor(producer, CanaryConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := monitor.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Messages()) != 1 {
+		t.Errorf("sent %d canaries, want the free canary kept by the cost filter and sampler", len(w.Messages()))
+	}
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Messages()) != 1 {
+		t.Error("the sampler kept a regular event")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CoalescedCountKey is the metadata key a coalesced event records the
+// number of requests it stands for under
+const CoalescedCountKey = "coalesced_count"
+
+// CoalescerConfig configures a Coalescer
+type CoalescerConfig struct {
+	// Window is how long identical requests are collected after the first
+	// before they are released as one event (default: 1s)
+	Window time.Duration
+}
+
+// Coalescer collapses bursts of identical requests, such as a user
+// resubmitting the same prompt in a loop, into one event, cutting volume
+// while keeping the signal. Requests are identical when they share a
+// UserID, ServiceName, ModelName and prompt, compared by PromptHash or by
+// a hash of PromptText. The first request of a burst is held for Window;
+// the ones arriving in that time are folded into it. Events without a
+// UserID or prompt pass straight through.
+type Coalescer struct {
+	mu      sync.Mutex
+	config  CoalescerConfig
+	now     func() time.Time
+	pending map[coalesceKey]*coalesceGroup
+}
+
+// coalesceKey identifies identical requests
+type coalesceKey struct {
+	userID      string
+	serviceName string
+	modelName   string
+	prompt      string
+}
+
+// coalesceGroup is a burst of identical requests collected so far
+type coalesceGroup struct {
+	event     TelemetryEvent
+	count     int
+	firstSeen time.Time
+}
+
+// NewCoalescer creates a coalescer, applying defaults for zero config values
+func NewCoalescer(config CoalescerConfig) *Coalescer {
+	if config.Window <= 0 {
+		config.Window = time.Second
+	}
+	return &Coalescer{config: config, now: time.Now, pending: make(map[coalesceKey]*coalesceGroup)}
+}
+
+// Add folds the event into the burst of identical requests it belongs to
+// and returns the events that are now ready: the event itself if it cannot
+// be coalesced, or an earlier burst whose window has closed
+func (c *Coalescer) Add(event TelemetryEvent) []TelemetryEvent {
+	if event.UserID == "" || (event.PromptHash == "" && event.PromptText == "") {
+		return []TelemetryEvent{event}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	key := coalesceKey{
+		userID:      event.UserID,
+		serviceName: event.ServiceName,
+		modelName:   event.ModelName,
+		prompt:      promptDigest(event),
+	}
+	var ready []TelemetryEvent
+	if group, ok := c.pending[key]; ok {
+		if now.Sub(group.firstSeen) < c.config.Window {
+			group.add(event)
+			return nil
+		}
+		ready = append(ready, group.release())
+	}
+	c.pending[key] = &coalesceGroup{event: event, count: 1, firstSeen: now}
+	return ready
+}
+
+// Expire releases bursts whose window has closed. Call it periodically.
+func (c *Coalescer) Expire() []TelemetryEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := c.now().Add(-c.config.Window)
+	var ready []TelemetryEvent
+	for key, group := range c.pending {
+		if group.firstSeen.After(deadline) {
+			continue
+		}
+		delete(c.pending, key)
+		ready = append(ready, group.release())
+	}
+	return ready
+}
+
+// Flush releases every held burst
+func (c *Coalescer) Flush() []TelemetryEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ready []TelemetryEvent
+	for key, group := range c.pending {
+		delete(c.pending, key)
+		ready = append(ready, group.release())
+	}
+	return ready
+}
+
+// Pending returns the number of bursts being collected
+func (c *Coalescer) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.pending)
+}
+
+// add folds a repeat into the burst. Counts and cost are summed and latency
+// is the slowest request's, so coalescing hides neither spend nor spikes.
+func (g *coalesceGroup) add(event TelemetryEvent) {
+	g.count++
+	g.event.PromptTokens += event.PromptTokens
+	g.event.CompletionTokens += event.CompletionTokens
+	g.event.TotalTokens += event.TotalTokens
+	g.event.CostUsd += event.CostUsd
+	g.event.LatencyMs = max(g.event.LatencyMs, event.LatencyMs)
+	if event.ErrorCode != "" {
+		g.event.ErrorCode = event.ErrorCode
+	}
+}
+
+// release returns the burst as one event, keeping the first request's id
+// and timestamp. A request without repeats is returned unchanged.
+func (g *coalesceGroup) release() TelemetryEvent {
+	event := g.event
+	if g.count == 1 {
+		return event
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata)+1)
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+	metadata[CoalescedCountKey] = g.count
+	event.Metadata = metadata
+	return event
+}
+
+// WithCoalescing makes the producer collapse bursts of identical requests
+// with a Coalescer. Sends fold each event into its burst and send only the
+// bursts that are ready; a background goroutine sends bursts whose window
+// has closed every Window, and Close sends the bursts still held.
+func WithCoalescing(config CoalescerConfig) ProducerOption {
+	return func(c *writerConfig) {
+		c.coalescer = NewCoalescer(config)
+	}
+}
+
+// producerCoalescing is a producer's coalescer and its expiry goroutine
+type producerCoalescing struct {
+	coalescer *Coalescer
+	done      chan struct{}
+	wg        sync.WaitGroup
+
+	// mu orders adds against stopping; once stopped, events pass through
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// startCoalescing coalesces the producer's sends with c and starts sending
+// its expired bursts
+func (p *TelemetryProducer) startCoalescing(c *Coalescer) {
+	p.coalescing = &producerCoalescing{coalescer: c, done: make(chan struct{})}
+	p.coalescing.wg.Add(1)
+	go p.expireBursts()
+}
+
+// add folds the events into their bursts and returns those ready to send.
+// After stopCoalescing, nothing flushes the coalescer again, so the events
+// are returned as they are.
+func (pc *producerCoalescing) add(events []TelemetryEvent) []TelemetryEvent {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	if pc.stopped {
+		return events
+	}
+	var ready []TelemetryEvent
+	for _, event := range events {
+		ready = append(ready, pc.coalescer.Add(event)...)
+	}
+	return ready
+}
+
+// expireBursts sends the bursts whose window has closed every Window until
+// stopCoalescing
+func (p *TelemetryProducer) expireBursts() {
+	pc := p.coalescing
+	defer pc.wg.Done()
+
+	ticker := time.NewTicker(pc.coalescer.config.Window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pc.done:
+			return
+		case <-ticker.C:
+			p.sendBursts(pc.coalescer.Expire())
+		}
+	}
+}
+
+// stopCoalescing stops the expiry goroutine and sends every burst still
+// held. It does nothing for a producer without coalescing.
+func (p *TelemetryProducer) stopCoalescing() {
+	pc := p.coalescing
+	if pc == nil {
+		return
+	}
+
+	close(pc.done)
+	pc.wg.Wait()
+
+	pc.mu.Lock()
+	pc.stopped = true
+	pc.mu.Unlock()
+	p.sendBursts(pc.coalescer.Flush())
+}
+
+// sendBursts sends released bursts, logging a failure since no caller is
+// waiting for them
+func (p *TelemetryProducer) sendBursts(events []TelemetryEvent) {
+	if len(events) == 0 {
+		return
+	}
+	if _, err := p.sendBatch(context.Background(), events, p.Retry); err != nil {
+		p.logger().Error("Error sending coalesced events", "topic", p.topic, "error", err)
+	}
+}
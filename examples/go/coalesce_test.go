@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func repeatedRequest(id string, latency float64) TelemetryEvent {
+	event := testEvent(id)
+	event.PromptHash = "prompt-1"
+	event.CostUsd = 0.01
+	event.LatencyMs = latency
+	return event
+}
+
+func TestCoalescerCoalescesRapidIdenticalRequests(t *testing.T) {
+	c := NewCoalescer(CoalescerConfig{Window: time.Second})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		if released := c.Add(repeatedRequest(fmt.Sprintf("req-%d", i), float64(100+i*100))); len(released) != 0 {
+			t.Fatalf("request %d released %d events inside the window", i, len(released))
+		}
+		now = now.Add(100 * time.Millisecond)
+	}
+	if c.Pending() != 1 {
+		t.Fatalf("Pending() = %d, want 1", c.Pending())
+	}
+	if released := c.Expire(); len(released) != 0 {
+		t.Fatalf("Expire released %d events before the window closed", len(released))
+	}
+
+	now = now.Add(time.Second)
+	released := c.Expire()
+	if len(released) != 1 {
+		t.Fatalf("Expire released %d events, want 1", len(released))
+	}
+	event := released[0]
+
+	if got := event.Metadata[CoalescedCountKey]; got != 5 {
+		t.Errorf("%s = %v, want 5", CoalescedCountKey, got)
+	}
+	if event.RequestID != "req-0" {
+		t.Errorf("RequestID = %q, want the first request's", event.RequestID)
+	}
+	if event.PromptTokens != 750 || event.CompletionTokens != 1500 || event.TotalTokens != 2250 {
+		t.Errorf("tokens = %d/%d/%d, want 750/1500/2250", event.PromptTokens, event.CompletionTokens, event.TotalTokens)
+	}
+	if math.Abs(event.CostUsd-0.05) > 1e-9 {
+		t.Errorf("cost = %v, want 0.05", event.CostUsd)
+	}
+	if event.LatencyMs != 500 {
+		t.Errorf("latency = %v, want the slowest request's 500", event.LatencyMs)
+	}
+	if c.Pending() != 0 {
+		t.Errorf("Pending() = %d after Expire, want 0", c.Pending())
+	}
+}
+
+func TestCoalescerKeysByUserModelAndPrompt(t *testing.T) {
+	c := NewCoalescer(CoalescerConfig{})
+
+	other := repeatedRequest("req-2", 100)
+	other.UserID = "user-2"
+	different := repeatedRequest("req-3", 100)
+	different.PromptHash = "prompt-2"
+	otherModel := repeatedRequest("req-6", 100)
+	otherModel.ModelName = "claude-3-opus"
+	otherService := repeatedRequest("req-7", 100)
+	otherService.ServiceName = "search-api"
+	byText := repeatedRequest("req-4", 100)
+	byText.PromptHash = ""
+	byText.PromptText = "hello"
+	sameText := repeatedRequest("req-5", 100)
+	sameText.PromptHash = ""
+	sameText.PromptText = "hello"
+
+	for _, event := range []TelemetryEvent{repeatedRequest("req-1", 100), other, different, otherModel, otherService, byText, sameText} {
+		c.Add(event)
+	}
+	if c.Pending() != 6 {
+		t.Fatalf("Pending() = %d, want 6 bursts", c.Pending())
+	}
+
+	counts := make(map[string]interface{})
+	for _, event := range c.Flush() {
+		counts[event.RequestID] = event.Metadata[CoalescedCountKey]
+	}
+	if counts["req-4"] != 2 {
+		t.Errorf("requests with the same prompt text coalesced to %v, want 2", counts["req-4"])
+	}
+	for _, id := range []string{"req-1", "req-2", "req-3", "req-6", "req-7"} {
+		if counts[id] != nil {
+			t.Errorf("lone request %s has %s %v, want none", id, CoalescedCountKey, counts[id])
+		}
+	}
+}
+
+func TestCoalescerStartsNewBurstAfterWindow(t *testing.T) {
+	c := NewCoalescer(CoalescerConfig{Window: time.Second})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Add(repeatedRequest("req-1", 100))
+	c.Add(repeatedRequest("req-2", 100))
+	now = now.Add(2 * time.Second)
+
+	released := c.Add(repeatedRequest("req-3", 100))
+	if len(released) != 1 || released[0].RequestID != "req-1" || released[0].Metadata[CoalescedCountKey] != 2 {
+		t.Fatalf("Add after the window released %+v, want the closed burst of 2", released)
+	}
+	if c.Pending() != 1 {
+		t.Errorf("Pending() = %d, want the new burst", c.Pending())
+	}
+}
+
+func TestCoalescerPassesThroughEventsWithoutPrompt(t *testing.T) {
+	c := NewCoalescer(CoalescerConfig{})
+
+	if released := c.Add(testEvent("req-1")); len(released) != 1 || released[0].RequestID != "req-1" {
+		t.Fatalf("Add without a prompt released %+v, want the event", released)
+	}
+	if c.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", c.Pending())
+	}
+}
+
+// coalescingProducer returns a producer coalescing with the window, writing to w
+func coalescingProducer(window time.Duration, w *fakeWriter) *TelemetryProducer {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithCoalescing(CoalescerConfig{Window: window}))
+	p.writer.Close()
+	p.writer = w
+	return p
+}
+
+func TestProducerCoalescingSendsExpiredBursts(t *testing.T) {
+	w := &fakeWriter{}
+	p := coalescingProducer(20*time.Millisecond, w)
+	defer p.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := p.SendEvent(context.Background(), repeatedRequest(fmt.Sprintf("req-%d", i), 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(w.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	msgs := w.Messages()
+	if len(msgs) != 1 || string(msgs[0].Key) != "req-0" {
+		t.Fatalf("sent keys %v, want the burst as req-0", messageKeys(msgs))
+	}
+}
+
+func TestProducerCoalescingFlushesOnClose(t *testing.T) {
+	w := &fakeWriter{}
+	p := coalescingProducer(time.Hour, w)
+
+	for i := 0; i < 3; i++ {
+		if err := p.SendEvent(context.Background(), repeatedRequest(fmt.Sprintf("req-%d", i), 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.Messages()) != 0 {
+		t.Fatalf("sent %d messages inside the window, want 0", len(w.Messages()))
+	}
+
+	report, err := p.Shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Messages()) != 1 || report.Sent != 1 {
+		t.Errorf("sent %d messages (report %+v) on close, want the held burst", len(w.Messages()), report)
+	}
+}
+
+func TestAsyncProducerCoalescingFlushesQueueOnClose(t *testing.T) {
+	w := &fakeWriter{}
+	p := NewAsyncTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", 10, WithCoalescing(CoalescerConfig{Window: time.Hour}))
+	p.writer.Close()
+	p.writer = w
+
+	if err := p.Enqueue(repeatedRequest("req-1", 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := w.Messages(); len(msgs) != 1 || string(msgs[0].Key) != "req-1" {
+		t.Errorf("sent keys %v on close, want the queued event", messageKeys(msgs))
+	}
+	if pending := p.coalescing.coalescer.Pending(); pending != 0 {
+		t.Errorf("Pending() = %d after Close, want 0", pending)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+)
+
+// CodecHeader is the Kafka header naming the registered codec a message
+// value was compressed with
+const CodecHeader = "content-encoding"
+
+// CodecRegistry maps names to compression codecs, so producers and
+// consumers can agree on custom codecs, such as zstd with a domain-specific
+// dictionary, beyond the ones built into kafka-go. Kafka's batch format only
+// has codes for the built-in codecs, so a producer compresses each message
+// value with a registered codec itself and names it in the CodecHeader.
+// A nil registry knows only the built-in codecs.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]compress.Codec
+}
+
+// NewCodecRegistry creates an empty registry
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{codecs: make(map[string]compress.Codec)}
+}
+
+// Register adds or replaces the codec for a name, compared case-insensitively
+func (r *CodecRegistry) Register(name string, codec compress.Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codecs[codecName(name)] = codec
+}
+
+// Lookup returns the codec registered for name, falling back to the
+// built-in gzip, snappy, lz4 and zstd codecs
+func (r *CodecRegistry) Lookup(name string) (compress.Codec, bool) {
+	if r != nil {
+		r.mu.RLock()
+		codec, ok := r.codecs[codecName(name)]
+		r.mu.RUnlock()
+		if ok {
+			return codec, true
+		}
+	}
+
+	builtin, err := ParseCompression(name)
+	if err != nil || builtin == 0 {
+		return nil, false
+	}
+	return builtin.Codec(), true
+}
+
+// Compression returns the producer option compressing with the codec
+// named name. A registered codec compresses each message value and is
+// named in its CodecHeader; otherwise name must be a built-in codec,
+// which compresses whole batches as WithCompression does.
+func (r *CodecRegistry) Compression(name string) (ProducerOption, error) {
+	if r != nil {
+		r.mu.RLock()
+		codec, ok := r.codecs[codecName(name)]
+		r.mu.RUnlock()
+		if ok {
+			vc := &valueCodec{name: codecName(name), codec: codec}
+			return func(c *writerConfig) {
+				c.valueCodec = vc
+			}, nil
+		}
+	}
+
+	builtin, err := ParseCompression(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w, and no codec %q is registered", err, name)
+	}
+	return WithCompression(builtin), nil
+}
+
+// codecName normalizes a codec name
+func codecName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// valueCodec compresses message values with a registered codec. A nil
+// *valueCodec leaves them uncompressed.
+type valueCodec struct {
+	name  string
+	codec compress.Codec
+}
+
+// compress returns the compressed value
+func (v *valueCodec) compress(value []byte) ([]byte, error) {
+	if v == nil {
+		return value, nil
+	}
+
+	var buf bytes.Buffer
+	w := v.codec.NewWriter(&buf)
+	if _, err := w.Write(value); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to compress with %s: %w", v.name, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress with %s: %w", v.name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// headers returns the header naming the codec, if any
+func (v *valueCodec) headers() []kafka.Header {
+	if v == nil {
+		return nil
+	}
+	return []kafka.Header{{Key: CodecHeader, Value: []byte(v.name)}}
+}
+
+// decompressMessage returns the message value decompressed with the codec
+// named in its CodecHeader, resolved from codecs. Values without the header
+// are returned unchanged.
+func decompressMessage(msg kafka.Message, codecs *CodecRegistry) ([]byte, error) {
+	name, ok := messageHeader(msg, CodecHeader)
+	if !ok || name == "" {
+		return msg.Value, nil
+	}
+
+	codec, ok := codecs.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q", name)
+	}
+	r := codec.NewReader(bytes.NewReader(msg.Value))
+	defer r.Close()
+
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress with %s: %w", name, err)
+	}
+	return value, nil
+}
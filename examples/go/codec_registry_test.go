@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// dictCodec is a custom codec: deflate primed with a dictionary of the
+// strings every event repeats
+type dictCodec struct {
+	dict []byte
+}
+
+func (c dictCodec) Code() int8   { return 0 }
+func (c dictCodec) Name() string { return "dict-deflate" }
+
+func (c dictCodec) NewReader(r io.Reader) io.ReadCloser {
+	return flate.NewReaderDict(r, c.dict)
+}
+
+func (c dictCodec) NewWriter(w io.Writer) io.WriteCloser {
+	fw, err := flate.NewWriterDict(w, flate.BestCompression, c.dict)
+	if err != nil {
+		panic(err)
+	}
+	return fw
+}
+
+func TestCustomCodecRoundTrip(t *testing.T) {
+	codecs := NewCodecRegistry()
+	codecs.Register("dict-deflate", dictCodec{dict: []byte(`"service_name":"chat-api","model_name":"gpt-4","prompt_tokens":`)})
+
+	opt, err := codecs.Compression("dict-deflate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", opt)
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+	if p.valueCodec == nil {
+		t.Fatal("the registered codec was not applied to the producer")
+	}
+
+	event := testEvent("req-1")
+	event.PromptText = strings.Repeat("Summarize the quarterly report. ", 50)
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	msg := w.Messages()[0]
+	if encoding, _ := messageHeader(msg, CodecHeader); encoding != "dict-deflate" {
+		t.Errorf("%s header = %q, want dict-deflate", CodecHeader, encoding)
+	}
+	if json.Valid(msg.Value) {
+		t.Error("message value was sent uncompressed")
+	}
+
+	d := NewDeserializer()
+	if _, err := d.Deserialize(msg); err == nil {
+		t.Error("Deserialize without the registry succeeded for an unknown codec")
+	}
+	d.UseCodecs(codecs)
+	got, err := d.Deserialize(msg)
+	if err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if got.RequestID != event.RequestID || got.PromptText != event.PromptText {
+		t.Errorf("read back %+v, want the sent event", got)
+	}
+}
+
+func TestCodecRegistryFallsBackToBuiltins(t *testing.T) {
+	codecs := NewCodecRegistry()
+
+	opt, err := codecs.Compression("zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writer := testWriter(t, opt); writer.Compression != kafka.Zstd {
+		t.Errorf("Compression = %v, want batch compression with zstd", writer.Compression)
+	}
+	if _, err := codecs.Compression("brotli"); err == nil {
+		t.Error("Compression(brotli) succeeded, want an error")
+	}
+
+	// a consumer decodes values compressed with a built-in codec named in the header
+	var buf bytes.Buffer
+	gw := kafka.Gzip.Codec().NewWriter(&buf)
+	gw.Write([]byte(`{"request_id":"req-1"}`))
+	gw.Close()
+	msg := kafka.Message{Value: buf.Bytes(), Headers: []kafka.Header{{Key: CodecHeader, Value: []byte("gzip")}}}
+	if event, err := NewDeserializer().Deserialize(msg); err != nil || event.RequestID != "req-1" {
+		t.Errorf("Deserialize = %+v, %v, want req-1", event, err)
+	}
+}
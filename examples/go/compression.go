@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// WithCompression compresses message batches with the codec. Producers are
+// uncompressed by default.
+func WithCompression(codec kafka.Compression) ProducerOption {
+	return func(c *writerConfig) {
+		c.compression = codec
+	}
+}
+
+// ParseCompression returns the codec named gzip, snappy, lz4 or zstd. An
+// empty name or "none" means no compression.
+func ParseCompression(name string) (kafka.Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression codec %q (want none, gzip, snappy, lz4 or zstd)", name)
+	}
+}
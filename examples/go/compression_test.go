@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestParseCompression(t *testing.T) {
+	cases := map[string]kafka.Compression{
+		"":       0,
+		"none":   0,
+		"gzip":   kafka.Gzip,
+		"snappy": kafka.Snappy,
+		"LZ4":    kafka.Lz4,
+		"zstd":   kafka.Zstd,
+	}
+	for name, want := range cases {
+		got, err := ParseCompression(name)
+		if err != nil {
+			t.Errorf("ParseCompression(%q): %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseCompression(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	if _, err := ParseCompression("brotli"); err == nil {
+		t.Error("ParseCompression(brotli) succeeded, want an error")
+	}
+}
+
+func TestProducerCompressionDefaultsToNone(t *testing.T) {
+	if got := testWriter(t).Compression; got != 0 {
+		t.Errorf("Compression = %v, want uncompressed", got)
+	}
+}
+
+func TestCompressedMessageRoundTrip(t *testing.T) {
+	event := testEvent("req-1")
+	event.PromptText = string(bytes.Repeat([]byte("Summarize the quarterly report. "), 200))
+
+	for _, name := range []string{"gzip", "snappy", "lz4", "zstd"} {
+		codec, err := ParseCompression(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithCompression(codec))
+		writer := p.writer.(*kafka.Writer)
+		writer.Close()
+		if writer.Compression != codec {
+			t.Fatalf("%s: Compression = %v, want %v", name, writer.Compression, codec)
+		}
+		w := &fakeWriter{}
+		p.writer = w
+		if err := p.SendEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+		p.Close()
+		msg := w.Messages()[0]
+
+		// compress the value as the writer does with its batches
+		var compressed bytes.Buffer
+		cw := writer.Compression.Codec().NewWriter(&compressed)
+		if _, err := cw.Write(msg.Value); err != nil {
+			t.Fatal(err)
+		}
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if compressed.Len() >= len(msg.Value) {
+			t.Errorf("%s: compressed %d bytes to %d", name, len(msg.Value), compressed.Len())
+		}
+
+		cr := codec.Codec().NewReader(&compressed)
+		msg.Value, err = io.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		got, err := NewDeserializer().Deserialize(msg)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.RequestID != event.RequestID || got.PromptText != event.PromptText {
+			t.Errorf("%s: read back %+v, want the sent event", name, got)
+		}
+	}
+}
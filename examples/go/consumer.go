@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// messageReader is the subset of *kafka.Reader used by the consumer
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// ReconnectPolicy controls how the consumer reconnects after losing the brokers
+type ReconnectPolicy struct {
+	// BaseDelay is the wait before the first reconnect, doubled for each attempt after (default: 500ms)
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between reconnects (default: 30s)
+	MaxDelay time.Duration
+	// MaxRetryWindow is how long the consumer keeps reconnecting before Run gives up (default: 5m)
+	MaxRetryWindow time.Duration
+}
+
+// backoff returns the delay before the given reconnect attempt (0-based)
+func (r ReconnectPolicy) backoff(attempt int) time.Duration {
+	return exponentialBackoff(r.BaseDelay, 500*time.Millisecond, r.MaxDelay, 30*time.Second, attempt)
+}
+
+// retryWindow returns MaxRetryWindow or its default
+func (r ReconnectPolicy) retryWindow() time.Duration {
+	if r.MaxRetryWindow <= 0 {
+		return 5 * time.Minute
+	}
+	return r.MaxRetryWindow
+}
+
+// EventHandler processes one consumed telemetry event
+type EventHandler func(ctx context.Context, event TelemetryEvent) error
+
+// TelemetryConsumer reads telemetry events from Kafka as part of a consumer
+// group, committing each event once it has been handled
+type TelemetryConsumer struct {
+	// Reconnect controls reconnection after the brokers become unreachable
+	Reconnect ReconnectPolicy
+
+	// Deserializer decodes each message by its content-type header (default: JSON, Protobuf and Avro)
+	Deserializer *Deserializer
+
+	// OnDecodeError is called with messages that cannot be decoded, which
+	// are then skipped and committed (default: log them)
+	OnDecodeError func(msg kafka.Message, err error)
+
+	newReader func() messageReader
+	sleep     func(ctx context.Context, d time.Duration) error
+	now       func() time.Time
+
+	// reader is the reader used by ReadEvent, opened on first use
+	reader messageReader
+}
+
+// NewTelemetryConsumer creates a consumer for topic in consumer group groupID
+func NewTelemetryConsumer(brokers []string, topic, groupID string) *TelemetryConsumer {
+	return &TelemetryConsumer{
+		newReader: func() messageReader {
+			return kafka.NewReader(kafka.ReaderConfig{
+				Brokers:  brokers,
+				GroupID:  groupID,
+				Topic:    topic,
+				MinBytes: 1,
+				MaxBytes: 10e6,
+			})
+		},
+		sleep: sleepContext,
+		now:   time.Now,
+	}
+}
+
+// Run consumes events until ctx is cancelled, calling handle for each and
+// committing its offset afterwards. When fetching fails the reader is
+// closed and reopened with capped exponential backoff; offsets are
+// committed to the consumer group, so a new reader resumes after the last
+// handled event. Run returns an error if reconnecting fails for longer than
+// MaxRetryWindow or if handle fails; the failed event is not committed.
+func (c *TelemetryConsumer) Run(ctx context.Context, handle EventHandler) error {
+	return c.consume(ctx, messageLoop{
+		process: func(ctx context.Context, reader messageReader, msg kafka.Message) error {
+			event, err := c.Deserializer.Deserialize(msg)
+			if err != nil {
+				c.decodeError(msg, err)
+			} else if err := handle(ctx, event); err != nil {
+				return fmt.Errorf("failed to handle event at offset %d: %w", msg.Offset, err)
+			}
+
+			if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to commit offset %d: %v", msg.Offset, err)
+			}
+			return nil
+		},
+	})
+}
+
+// Consume calls handler for each event until ctx is cancelled, committing
+// each event once handler returns nil. It is Run for handlers that do not
+// need the context.
+func (c *TelemetryConsumer) Consume(ctx context.Context, handler func(event TelemetryEvent) error) error {
+	return c.Run(ctx, func(ctx context.Context, event TelemetryEvent) error {
+		return handler(event)
+	})
+}
+
+// ReadEvent reads and commits the next event. A message that cannot be
+// decoded is committed too, so the next call moves past it, and its error
+// is returned. ReadEvent does not reconnect; use Run or Consume for a
+// long-running consumer.
+func (c *TelemetryConsumer) ReadEvent(ctx context.Context) (TelemetryEvent, error) {
+	if c.reader == nil {
+		c.reader = c.newReader()
+	}
+
+	msg, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return TelemetryEvent{}, fmt.Errorf("failed to read event: %w", err)
+	}
+
+	event, decodeErr := c.Deserializer.Deserialize(msg)
+	if err := c.reader.CommitMessages(ctx, msg); err != nil {
+		return event, fmt.Errorf("failed to commit offset %d: %w", msg.Offset, err)
+	}
+	if decodeErr != nil {
+		return event, fmt.Errorf("failed to decode event at offset %d: %w", msg.Offset, decodeErr)
+	}
+	return event, nil
+}
+
+// Close closes the reader opened by ReadEvent
+func (c *TelemetryConsumer) Close() error {
+	if c.reader == nil {
+		return nil
+	}
+	err := c.reader.Close()
+	c.reader = nil
+	return err
+}
+
+// decodeError reports an undecodable message to OnDecodeError, or logs it
+func (c *TelemetryConsumer) decodeError(msg kafka.Message, err error) {
+	if c.OnDecodeError != nil {
+		c.OnDecodeError(msg, err)
+		return
+	}
+	log.Printf("Skipping undecodable message at offset %d: %v", msg.Offset, err)
+}
+
+// messageLoop processes the raw messages fetched by consume
+type messageLoop struct {
+	// process handles a message; it is responsible for committing it
+	process func(ctx context.Context, reader messageReader, msg kafka.Message) error
+	// flush, if set, is called when no message arrives within flushAfter
+	// and before the reader is closed to reconnect
+	flush      func(ctx context.Context, reader messageReader) error
+	flushAfter time.Duration
+}
+
+// consume fetches messages until ctx is cancelled and passes them to loop,
+// reconnecting with backoff as described on Run
+func (c *TelemetryConsumer) consume(ctx context.Context, loop messageLoop) error {
+	reader := c.newReader()
+	defer func() {
+		if reader != nil {
+			reader.Close()
+		}
+	}()
+
+	var disconnectedAt time.Time
+	attempts := 0
+
+	for {
+		msg, err := c.fetch(ctx, reader, loop.flushAfter)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if loop.flush != nil && errors.Is(err, context.DeadlineExceeded) {
+				if err := loop.flush(ctx, reader); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if attempts == 0 {
+				disconnectedAt = c.now()
+				log.Printf("Consumer disconnected: %v", err)
+				if loop.flush != nil {
+					if err := loop.flush(ctx, reader); err != nil {
+						return err
+					}
+				}
+			}
+			if c.now().Sub(disconnectedAt) >= c.Reconnect.retryWindow() {
+				return fmt.Errorf("consumer could not reconnect within %s: %w", c.Reconnect.retryWindow(), err)
+			}
+
+			delay := c.Reconnect.backoff(attempts)
+			attempts++
+			log.Printf("Reconnecting consumer in %s (attempt %d)", delay, attempts)
+
+			reader.Close()
+			reader = nil
+			if c.sleep(ctx, delay) != nil {
+				return nil
+			}
+			reader = c.newReader()
+			continue
+		}
+
+		if attempts > 0 {
+			log.Printf("Consumer reconnected after %d attempts", attempts)
+			attempts = 0
+		}
+
+		if err := loop.process(ctx, reader, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// fetch reads the next message, waiting at most timeout when it is positive
+func (c *TelemetryConsumer) fetch(ctx context.Context, reader messageReader, timeout time.Duration) (kafka.Message, error) {
+	if timeout <= 0 {
+		return reader.FetchMessage(ctx)
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return reader.FetchMessage(fetchCtx)
+}
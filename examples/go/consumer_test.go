@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeGroup is a partition with a consumer group's committed offset
+type fakeGroup struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed int64
+}
+
+// fakeReader reads from a fakeGroup, starting at the committed offset, and
+// fails every fetch after failAfter successful ones
+type fakeReader struct {
+	group     *fakeGroup
+	offset    int64
+	fetched   int
+	failAfter int
+	closed    bool
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return kafka.Message{}, err
+	}
+	if r.fetched >= r.failAfter {
+		return kafka.Message{}, io.ErrUnexpectedEOF
+	}
+
+	r.group.mu.Lock()
+	defer r.group.mu.Unlock()
+	if r.offset >= int64(len(r.group.messages)) {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := r.group.messages[r.offset]
+	r.offset++
+	r.fetched++
+	return msg, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.group.mu.Lock()
+	defer r.group.mu.Unlock()
+	for _, msg := range msgs {
+		r.group.committed = msg.Offset + 1
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+// newFakeGroup returns a group holding one message per request ID
+func newFakeGroup(t *testing.T, requestIDs ...string) *fakeGroup {
+	t.Helper()
+	group := &fakeGroup{}
+	for i, id := range requestIDs {
+		value, err := json.Marshal(testEvent(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		group.messages = append(group.messages, kafka.Message{Offset: int64(i), Value: value})
+	}
+	return group
+}
+
+// newTestConsumer returns a consumer whose readers fail after the given
+// numbers of fetches in turn, and which records its reconnect delays
+func newTestConsumer(group *fakeGroup, failAfter []int, now *time.Time, delays *[]time.Duration) (*TelemetryConsumer, *[]*fakeReader) {
+	var readers []*fakeReader
+	consumer := &TelemetryConsumer{
+		newReader: func() messageReader {
+			limit := 1 << 30
+			if len(readers) < len(failAfter) {
+				limit = failAfter[len(readers)]
+			}
+			group.mu.Lock()
+			reader := &fakeReader{group: group, offset: group.committed, failAfter: limit}
+			group.mu.Unlock()
+			readers = append(readers, reader)
+			return reader
+		},
+		sleep: func(ctx context.Context, d time.Duration) error {
+			*delays = append(*delays, d)
+			*now = now.Add(d)
+			return nil
+		},
+		now: func() time.Time { return *now },
+	}
+	return consumer, &readers
+}
+
+func TestConsumerReconnectsWithBackoffAndResumes(t *testing.T) {
+	group := newFakeGroup(t, "req-1", "req-2", "req-3", "req-4", "req-5")
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var delays []time.Duration
+
+	// the first reader handles three events, then the brokers are down for
+	// two more readers before the connection recovers
+	consumer, readers := newTestConsumer(group, []int{3, 0, 0}, &now, &delays)
+	consumer.Reconnect = ReconnectPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled []string
+	err := consumer.Run(ctx, func(ctx context.Context, event TelemetryEvent) error {
+		handled = append(handled, event.RequestID)
+		if len(handled) == 5 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run = %v, want nil after cancel", err)
+	}
+
+	if got := strings.Join(handled, ","); got != "req-1,req-2,req-3,req-4,req-5" {
+		t.Errorf("handled %s, want each event once in order", got)
+	}
+	wantDelays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	if len(delays) != len(wantDelays) {
+		t.Fatalf("delays = %v, want %v", delays, wantDelays)
+	}
+	for i := range wantDelays {
+		if delays[i] != wantDelays[i] {
+			t.Errorf("delay %d = %s, want %s", i, delays[i], wantDelays[i])
+		}
+	}
+	if len(*readers) != 4 {
+		t.Errorf("opened %d readers, want 4", len(*readers))
+	}
+	for i, reader := range *readers {
+		if !reader.closed {
+			t.Errorf("reader %d not closed", i)
+		}
+	}
+	if group.committed != 5 {
+		t.Errorf("committed offset = %d, want 5", group.committed)
+	}
+}
+
+func TestConsumerGivesUpAfterRetryWindow(t *testing.T) {
+	group := newFakeGroup(t, "req-1")
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var delays []time.Duration
+
+	failures := make([]int, 100)
+	consumer, _ := newTestConsumer(group, failures, &now, &delays)
+	consumer.Reconnect = ReconnectPolicy{BaseDelay: time.Second, MaxDelay: 4 * time.Second, MaxRetryWindow: 10 * time.Second}
+
+	err := consumer.Run(context.Background(), func(context.Context, TelemetryEvent) error { return nil })
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Run = %v, want reconnect failure", err)
+	}
+
+	// 1s + 2s + 4s + 4s reaches the 10s window
+	if len(delays) != 4 || delays[3] != 4*time.Second {
+		t.Errorf("delays = %v, want [1s 2s 4s 4s]", delays)
+	}
+}
+
+func TestConsumerDoesNotCommitFailedEvent(t *testing.T) {
+	group := newFakeGroup(t, "req-1", "req-2")
+	now := time.Now()
+	var delays []time.Duration
+	consumer, _ := newTestConsumer(group, nil, &now, &delays)
+
+	errHandler := errors.New("downstream unavailable")
+	err := consumer.Run(context.Background(), func(ctx context.Context, event TelemetryEvent) error {
+		if event.RequestID == "req-2" {
+			return errHandler
+		}
+		return nil
+	})
+
+	if !errors.Is(err, errHandler) {
+		t.Errorf("Run = %v, want handler error", err)
+	}
+	if group.committed != 1 {
+		t.Errorf("committed offset = %d, want 1 so req-2 is redelivered", group.committed)
+	}
+}
+
+func TestConsumerReadEvent(t *testing.T) {
+	group := newFakeGroup(t, "req-1")
+	group.messages = append(group.messages,
+		kafka.Message{Offset: 1, Value: []byte(`{"request_id": "req-2", "service_name": "chat-api", "model_name": "gpt-4"}`)},
+		kafka.Message{Offset: 2, Value: []byte(`{not json`)},
+		kafka.Message{Offset: 3, Value: []byte(`{"request_id": "req-4"}`)},
+	)
+	now := time.Now()
+	var delays []time.Duration
+	consumer, readers := newTestConsumer(group, nil, &now, &delays)
+
+	ctx := context.Background()
+	for _, want := range []string{"req-1", "req-2"} {
+		event, err := consumer.ReadEvent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.RequestID != want {
+			t.Errorf("ReadEvent() = %s, want %s", event.RequestID, want)
+		}
+	}
+
+	if _, err := consumer.ReadEvent(ctx); err == nil || !strings.Contains(err.Error(), "offset 2") {
+		t.Errorf("ReadEvent() error = %v, want a decode error at offset 2", err)
+	}
+	if event, err := consumer.ReadEvent(ctx); err != nil || event.RequestID != "req-4" {
+		t.Errorf("ReadEvent() = %s, %v; want req-4 after the malformed message", event.RequestID, err)
+	}
+
+	if group.committed != 4 {
+		t.Errorf("committed offset = %d, want 4", group.committed)
+	}
+	if err := consumer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*readers) != 1 || !(*readers)[0].closed {
+		t.Errorf("opened %d readers, want one that Close closed", len(*readers))
+	}
+}
+
+func TestConsumerConsumeSurfacesDecodeErrors(t *testing.T) {
+	group := newFakeGroup(t, "req-1")
+	group.messages = append(group.messages,
+		kafka.Message{Offset: 1, Value: []byte(`{not json`)},
+		kafka.Message{Offset: 2, Value: []byte(`{"request_id": "req-3"}`)},
+	)
+	now := time.Now()
+	var delays []time.Duration
+	consumer, _ := newTestConsumer(group, nil, &now, &delays)
+
+	var decodeErrors []int64
+	consumer.OnDecodeError = func(msg kafka.Message, err error) {
+		decodeErrors = append(decodeErrors, msg.Offset)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled []string
+	err := consumer.Consume(ctx, func(event TelemetryEvent) error {
+		handled = append(handled, event.RequestID)
+		if len(handled) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(handled, ",") != "req-1,req-3" {
+		t.Errorf("handled %v, want req-1 and req-3", handled)
+	}
+	if len(decodeErrors) != 1 || decodeErrors[0] != 1 {
+		t.Errorf("decode errors at offsets %v, want [1]", decodeErrors)
+	}
+}
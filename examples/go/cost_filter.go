@@ -0,0 +1,25 @@
+package main
+
+// CostFilter keeps only events costing at least MinCostUsd, for analytics
+// that only care about expensive calls. Set it on the producer to drop cheap
+// events, or use Route with a TopicRouter to send them to a separate topic.
+type CostFilter struct {
+	// MinCostUsd is the cost below which an event is filtered
+	MinCostUsd float64
+}
+
+// Keep returns true if the event costs at least MinCostUsd. A nil filter keeps every event.
+func (f *CostFilter) Keep(event TelemetryEvent) bool {
+	return f == nil || event.CostUsd >= f.MinCostUsd
+}
+
+// Route returns a RouteFunc sending events the filter keeps to topic and
+// the rest to cheapTopic
+func (f *CostFilter) Route(topic, cheapTopic string) RouteFunc {
+	return func(event TelemetryEvent) string {
+		if f.Keep(event) {
+			return topic
+		}
+		return cheapTopic
+	}
+}
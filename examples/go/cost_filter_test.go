@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestProducerCostFilterComposesWithOtherFilters(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.CostFilter = &CostFilter{MinCostUsd: 0.01}
+	producer.Sampler = NewHashSampler(0.5, nil)
+	if err := producer.Reconfigure(RuntimeConfig{DeniedModels: []string{"claude-3-opus"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := 0; i < 100; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		event.CostUsd = 0.001
+		if i%2 == 0 {
+			event.CostUsd = 0.05
+		}
+		if i%10 == 0 {
+			event.ModelName = "claude-3-opus"
+		}
+		if event.ModelName != "claude-3-opus" && event.CostUsd >= 0.01 && producer.Sampler.Sample(event) {
+			want = append(want, event.RequestID)
+		}
+		if err := producer.SendEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != len(want) {
+		t.Fatalf("sent %d events, want %d", len(msgs), len(want))
+	}
+	for i, msg := range msgs {
+		if string(msg.Key) != want[i] {
+			t.Errorf("message %d is %s, want %s", i, msg.Key, want[i])
+		}
+	}
+
+	dropped := producer.Report().Dropped
+	if dropped.Denied != 10 || dropped.BelowCost != 50 || dropped.Sampled != int64(40-len(want)) {
+		t.Errorf("dropped = %+v, want 10 denied, 50 below cost, %d sampled", dropped, 40-len(want))
+	}
+}
+
+func TestCostFilterRoutesCheapEvents(t *testing.T) {
+	expensive, cheap := &fakeWriter{}, &fakeWriter{}
+	filter := &CostFilter{MinCostUsd: 0.01}
+	router, err := NewTopicRouter(filter.Route("llm.telemetry", "llm.telemetry.cheap"), "llm.telemetry",
+		newTestProducer(expensive), &TelemetryProducer{writer: cheap, topic: "llm.telemetry.cheap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cost := range []float64{0.001, 0.01, 0.5, 0.009} {
+		event := testEvent(fmt.Sprintf("req-%v", cost))
+		event.CostUsd = cost
+		if err := router.SendEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(expensive.Messages()) != 2 || len(cheap.Messages()) != 2 {
+		t.Errorf("routed %d expensive and %d cheap events, want 2 and 2", len(expensive.Messages()), len(cheap.Messages()))
+	}
+}
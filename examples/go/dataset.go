@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+)
+
+// LabelNormal is the ground-truth label of events that are not anomalous
+const LabelNormal = "normal"
+
+// TrafficShape is the value distributions of one kind of traffic. Token
+// counts are truncated to non-negative integers and latencies are clamped at zero.
+type TrafficShape struct {
+	LatencyMs        Distribution
+	PromptTokens     Distribution
+	CompletionTokens Distribution
+}
+
+// validate reports a shape missing a distribution
+func (s TrafficShape) validate() error {
+	if s.LatencyMs == nil || s.PromptTokens == nil || s.CompletionTokens == nil {
+		return errors.New("traffic shape needs latency and token count distributions")
+	}
+	return nil
+}
+
+// sample draws an event's latency and token counts
+func (s TrafficShape) sample(rng *rand.Rand) (latencyMs float64, promptTokens, completionTokens int) {
+	latencyMs = math.Max(0, s.LatencyMs.Sample(rng))
+	return latencyMs, sampleCount(s.PromptTokens, rng), sampleCount(s.CompletionTokens, rng)
+}
+
+// TrafficProfile describes the synthetic traffic the simulators and
+// DatasetGenerator produce
+type TrafficProfile struct {
+	Models   []string
+	Services []string
+	// Regions are recorded in the metadata of simulated normal events
+	Regions []string
+	// Users and Sessions are the number of distinct normal users and sessions
+	Users    int
+	Sessions int
+	// Normal is the shape of normal traffic
+	Normal TrafficShape
+	// Anomalies is the shape of each anomaly kind that can be generated
+	Anomalies map[AnomalyKind]TrafficShape
+	// Pricing prices each event (default: DefaultPricingTable)
+	Pricing *PricingTable
+}
+
+// DefaultTrafficProfile returns the traffic the simulators produce
+func DefaultTrafficProfile() TrafficProfile {
+	return TrafficProfile{
+		Models:   []string{"gpt-4", "gpt-3.5-turbo", "claude-3-opus", "claude-3-sonnet"},
+		Services: []string{"chat-api", "completion-api", "assistant-api"},
+		Regions:  []string{"us-east-1", "us-west-2", "eu-west-1"},
+		Users:    100,
+		Sessions: 50,
+		Normal: TrafficShape{
+			LatencyMs:        Uniform{500, 3000},
+			PromptTokens:     Uniform{50, 500},
+			CompletionTokens: Uniform{100, 800},
+		},
+		Anomalies: map[AnomalyKind]TrafficShape{
+			AnomalyHighLatency: {
+				LatencyMs:        Uniform{20000, 60000},
+				PromptTokens:     Uniform{100, 500},
+				CompletionTokens: Uniform{200, 800},
+			},
+			AnomalyHighTokens: {
+				LatencyMs:        Uniform{5000, 15000},
+				PromptTokens:     Uniform{5000, 15000},
+				CompletionTokens: Uniform{8000, 20000},
+			},
+			AnomalyHighCost: {
+				LatencyMs:        Uniform{8000, 20000},
+				PromptTokens:     Uniform{8000, 15000},
+				CompletionTokens: Uniform{10000, 25000},
+			},
+			AnomalySuspiciousPattern: {
+				LatencyMs:        Uniform{1000, 3000},
+				PromptTokens:     Uniform{50, 200},
+				CompletionTokens: Uniform{50, 200},
+			},
+		},
+	}
+}
+
+// LabeledEvent is an event with its ground-truth label: LabelNormal or the
+// name of an anomaly kind. It serializes as the event's fields plus "label",
+// so a dataset can also be replayed with ReplayFromFile.
+type LabeledEvent struct {
+	TelemetryEvent
+	Label string `json:"label"`
+}
+
+// DatasetConfig configures a DatasetGenerator
+type DatasetConfig struct {
+	// Events is the number of events generated (default: 1000)
+	Events int
+	// Mix is the fraction of events of each anomaly kind; the rest are
+	// normal. Each kind must have a shape in the profile.
+	Mix map[AnomalyKind]float64
+	// Profile is the traffic generated (default: DefaultTrafficProfile)
+	Profile *TrafficProfile
+	// Seed makes the dataset reproducible: equal configs and seeds produce identical datasets
+	Seed int64
+	// Start is the first event's timestamp (default: 2024-01-01T00:00:00Z)
+	Start time.Time
+	// Interval is the time between consecutive events (default: 100ms)
+	Interval time.Duration
+}
+
+// DatasetGenerator produces labeled synthetic datasets for benchmarking
+// detectors with Backtest
+type DatasetGenerator struct {
+	config  DatasetConfig
+	profile TrafficProfile
+}
+
+// NewDatasetGenerator creates a generator, applying defaults for zero config values
+func NewDatasetGenerator(config DatasetConfig) (*DatasetGenerator, error) {
+	if config.Events <= 0 {
+		config.Events = 1000
+	}
+	if config.Start.IsZero() {
+		config.Start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if config.Interval <= 0 {
+		config.Interval = 100 * time.Millisecond
+	}
+
+	profile := DefaultTrafficProfile()
+	if config.Profile != nil {
+		profile = *config.Profile
+	}
+	if profile.Pricing == nil {
+		profile.Pricing = DefaultPricingTable()
+	}
+	if len(profile.Models) == 0 || len(profile.Services) == 0 {
+		return nil, fmt.Errorf("traffic profile needs at least one model and service")
+	}
+	if profile.Users <= 0 || profile.Sessions <= 0 {
+		return nil, fmt.Errorf("traffic profile needs at least one user and session")
+	}
+	if err := profile.Normal.validate(); err != nil {
+		return nil, fmt.Errorf("normal %w", err)
+	}
+
+	var total float64
+	for kind, fraction := range config.Mix {
+		shape, ok := profile.Anomalies[kind]
+		if !ok {
+			return nil, fmt.Errorf("traffic profile has no shape for %s", kind)
+		}
+		if err := shape.validate(); err != nil {
+			return nil, fmt.Errorf("%s %w", kind, err)
+		}
+		if fraction < 0 {
+			return nil, fmt.Errorf("negative fraction %v for %s", fraction, kind)
+		}
+		total += fraction
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("anomaly fractions sum to %v, more than 1", total)
+	}
+
+	return &DatasetGenerator{config: config, profile: profile}, nil
+}
+
+// Generate returns the dataset. The number of events of each anomaly kind
+// is its fraction of Events, rounded; their positions are shuffled.
+func (g *DatasetGenerator) Generate() []LabeledEvent {
+	rng := rand.New(rand.NewSource(g.config.Seed))
+
+	// Kinds are sorted so map iteration order cannot change the dataset
+	kinds := make([]AnomalyKind, 0, len(g.config.Mix))
+	for kind := range g.config.Mix {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	labels := make([]AnomalyKind, 0, g.config.Events)
+	for _, kind := range kinds {
+		n := int(math.Round(g.config.Mix[kind] * float64(g.config.Events)))
+		for i := 0; i < n && len(labels) < g.config.Events; i++ {
+			labels = append(labels, kind)
+		}
+	}
+	for len(labels) < g.config.Events {
+		labels = append(labels, 0)
+	}
+	rng.Shuffle(len(labels), func(i, j int) { labels[i], labels[j] = labels[j], labels[i] })
+
+	events := make([]LabeledEvent, len(labels))
+	for i, kind := range labels {
+		events[i] = g.event(rng, i, kind)
+	}
+	return events
+}
+
+// event generates the i-th event of the given kind; kind 0 is normal
+func (g *DatasetGenerator) event(rng *rand.Rand, i int, kind AnomalyKind) LabeledEvent {
+	p := g.profile
+	shape, label := p.Normal, LabelNormal
+	user := fmt.Sprintf("user-%d", rng.Intn(p.Users))
+	session := fmt.Sprintf("session-%d", rng.Intn(p.Sessions))
+	if kind != 0 {
+		shape, label = p.Anomalies[kind], kind.String()
+	}
+	if kind == AnomalySuspiciousPattern {
+		// Rapid repeated requests from one user and session
+		user, session = "user-suspicious", "session-suspicious"
+	}
+
+	latencyMs, promptTokens, completionTokens := shape.sample(rng)
+	event := TelemetryEvent{
+		Timestamp:        g.config.Start.Add(time.Duration(i) * g.config.Interval).UTC().Format(time.RFC3339Nano),
+		ServiceName:      p.Services[rng.Intn(len(p.Services))],
+		ModelName:        p.Models[rng.Intn(len(p.Models))],
+		LatencyMs:        latencyMs,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		UserID:           user,
+		SessionID:        session,
+		RequestID:        fmt.Sprintf("req-%d", i),
+	}
+	event.TotalTokens = event.PromptTokens + event.CompletionTokens
+	event.CostUsd, _ = p.Pricing.CalculateCost(event)
+
+	return LabeledEvent{TelemetryEvent: event, Label: label}
+}
+
+// WriteNDJSON writes the dataset as one labeled event per line
+func (g *DatasetGenerator) WriteNDJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for _, event := range g.Generate() {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write dataset: %w", err)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the dataset as NDJSON to path
+func (g *DatasetGenerator) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create dataset: %w", err)
+	}
+	if err := g.WriteNDJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDatasetLabelDistributionMatchesMix(t *testing.T) {
+	g, err := NewDatasetGenerator(DatasetConfig{
+		Events: 2000,
+		Mix: map[AnomalyKind]float64{
+			AnomalyHighLatency:       0.05,
+			AnomalyHighTokens:        0.02,
+			AnomalyHighCost:          0.01,
+			AnomalySuspiciousPattern: 0.025,
+		},
+		Seed: 42,
+	})
+	if err != nil {
+		t.Fatalf("NewDatasetGenerator: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, event := range g.Generate() {
+		counts[event.Label]++
+	}
+
+	want := map[string]int{
+		"normal":             1790,
+		"high_latency":       100,
+		"high_tokens":        40,
+		"high_cost":          20,
+		"suspicious_pattern": 50,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("label counts = %v, want %v", counts, want)
+	}
+}
+
+func TestDatasetIsReproducible(t *testing.T) {
+	config := DatasetConfig{Events: 200, Mix: map[AnomalyKind]float64{AnomalyHighCost: 0.1}, Seed: 7}
+
+	var a, b bytes.Buffer
+	for _, buf := range []*bytes.Buffer{&a, &b} {
+		g, err := NewDatasetGenerator(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.WriteNDJSON(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("same seed produced different datasets")
+	}
+
+	config.Seed = 8
+	g, _ := NewDatasetGenerator(config)
+	var c bytes.Buffer
+	g.WriteNDJSON(&c)
+	if bytes.Equal(a.Bytes(), c.Bytes()) {
+		t.Error("different seeds produced identical datasets")
+	}
+}
+
+func TestDatasetRejectsInvalidMix(t *testing.T) {
+	for name, mix := range map[string]map[AnomalyKind]float64{
+		"over 1":        {AnomalyHighCost: 0.6, AnomalyHighLatency: 0.5},
+		"negative":      {AnomalyHighCost: -0.1},
+		"missing shape": {AnomalyDegenerateResponse: 0.1},
+	} {
+		if _, err := NewDatasetGenerator(DatasetConfig{Mix: mix}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// thresholdDetector flags events with latency above a fixed threshold
+type thresholdDetector struct{ latencyMs float64 }
+
+func (d thresholdDetector) Observe(event TelemetryEvent) []Anomaly {
+	if event.LatencyMs <= d.latencyMs {
+		return nil
+	}
+	return []Anomaly{newAnomaly(AnomalyHighLatency, event, event.LatencyMs, d.latencyMs, "slow")}
+}
+
+func TestBacktestScoresDataset(t *testing.T) {
+	g, err := NewDatasetGenerator(DatasetConfig{
+		Events: 500,
+		Mix:    map[AnomalyKind]float64{AnomalyHighLatency: 0.1, AnomalyHighCost: 0.1},
+		Seed:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.ndjson")
+	if err := g.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// High-cost events are slow too, so a latency threshold catches some of them
+	result, err := BacktestFile(path, thresholdDetector{latencyMs: 15000})
+	if err != nil {
+		t.Fatalf("BacktestFile: %v", err)
+	}
+
+	if result.Events != 500 {
+		t.Errorf("Events = %d, want 500", result.Events)
+	}
+	latency := result.Scores["high_latency"]
+	if latency == nil || latency.Recall() != 1 || latency.FalsePositives == 0 || latency.Precision() >= 1 {
+		t.Errorf("high_latency score = %+v, want full recall with some false positives", latency)
+	}
+	if cost := result.Scores["high_cost"]; cost == nil || cost.FalseNegatives != 50 || cost.Recall() != 0 {
+		t.Errorf("high_cost score = %+v, want all 50 missed", cost)
+	}
+}
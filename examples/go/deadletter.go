@@ -0,0 +1,17 @@
+package main
+
+// DeadLetterSink persists events the producer could not deliver, so they
+// are kept for inspection or replay instead of being lost. Write must be
+// safe for concurrent use.
+type DeadLetterSink interface {
+	Write(event TelemetryEvent, cause error) error
+}
+
+// WithDeadLetter writes events that still fail after all retries, or are
+// refused by an open circuit breaker, to sink (default: such events are
+// only logged). A FailedEventSpooler is a file-backed DeadLetterSink.
+func WithDeadLetter(sink DeadLetterSink) ProducerOption {
+	return func(c *writerConfig) {
+		c.deadLetter = sink
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFailedSendIsDeadLettered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.ndjson")
+	spooler, err := NewFailedEventSpooler(SpoolerConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spooler.Close()
+
+	producer := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithDeadLetter(spooler))
+	producer.writer.Close()
+	producer.writer = &fakeWriter{writeErr: errTestBroker}
+	producer.Retry = RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-lost")); !errors.Is(err, errTestBroker) {
+		t.Fatalf("SendEvent = %v, want broker error", err)
+	}
+
+	records := readSpool(t, path)
+	if len(records) != 1 || records[0].RequestID != "req-lost" {
+		t.Fatalf("dead-lettered %+v, want req-lost", records)
+	}
+	if !strings.Contains(records[0].FailureCause, errTestBroker.Error()) {
+		t.Errorf("failure_cause = %q, want it to name %q", records[0].FailureCause, errTestBroker)
+	}
+}
+
+func TestFailedEventSpoolerConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.ndjson")
+	spooler, err := NewFailedEventSpooler(SpoolerConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sink DeadLetterSink = spooler
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := sink.Write(testEvent(fmt.Sprintf("req-%d", i)), errTestBroker); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	spooler.Close()
+
+	seen := make(map[string]bool)
+	for _, record := range readSpool(t, path) {
+		seen[record.RequestID] = true
+	}
+	if len(seen) != 50 {
+		t.Errorf("dead-lettered %d distinct events, want 50", len(seen))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate is returned for events whose RequestID the producer's
+// Deduper has already sent
+var ErrDuplicate = errors.New("duplicate request_id")
+
+// Deduper remembers the RequestIDs of recently sent events, so replaying
+// telemetry from a backup does not send them twice. Memory is bounded by
+// an LRU of capacity RequestIDs and by the TTL after which each is
+// forgotten. It is safe for concurrent use.
+type Deduper struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+	entries  map[string]*list.Element
+	// lru orders the entries from most to least recently seen
+	lru *list.List
+}
+
+// dedupEntry is a remembered RequestID and when it was sent
+type dedupEntry struct {
+	id     string
+	sentAt time.Time
+}
+
+// NewDeduper creates a deduper remembering up to capacity RequestIDs
+// (default: 10000) for ttl each (0 = until evicted)
+func NewDeduper(capacity int, ttl time.Duration) *Deduper {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+
+	return &Deduper{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// WithDedup skips events whose RequestID the producer sent within ttl,
+// remembering up to capacity RequestIDs (default: no deduplication)
+func WithDedup(capacity int, ttl time.Duration) ProducerOption {
+	return func(c *writerConfig) {
+		c.deduper = NewDeduper(capacity, ttl)
+	}
+}
+
+// Reserve records id as sent and reports whether it is new. It returns
+// false if id was reserved within the TTL and not released since. Events
+// without a RequestID are never duplicates.
+func (d *Deduper) Reserve(id string) bool {
+	if d == nil || id == "" {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if elem, ok := d.entries[id]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if d.ttl <= 0 || now.Sub(entry.sentAt) < d.ttl {
+			d.lru.MoveToFront(elem)
+			return false
+		}
+		entry.sentAt = now
+		d.lru.MoveToFront(elem)
+		return true
+	}
+
+	d.entries[id] = d.lru.PushFront(&dedupEntry{id: id, sentAt: now})
+	for d.lru.Len() > d.capacity {
+		d.removeLocked(d.lru.Back())
+	}
+	return true
+}
+
+// Release forgets id, e.g. because its event could not be sent after all,
+// so a later send of it is not a duplicate
+func (d *Deduper) Release(id string) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.entries[id]; ok {
+		d.removeLocked(elem)
+	}
+}
+
+// Len returns the number of RequestIDs remembered, including expired ones
+// not yet evicted
+func (d *Deduper) Len() int {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.lru.Len()
+}
+
+// removeLocked forgets the entry of elem
+func (d *Deduper) removeLocked(elem *list.Element) {
+	d.lru.Remove(elem)
+	delete(d.entries, elem.Value.(*dedupEntry).id)
+}
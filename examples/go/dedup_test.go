@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupSkipsEventsAlreadySent(t *testing.T) {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithDedup(100, time.Hour))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	event := testEvent("req-1")
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	if err := p.SendEvent(context.Background(), event); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("second send returned %v, want ErrDuplicate", err)
+	}
+	if n := len(w.Messages()); n != 1 {
+		t.Errorf("wrote %d messages, want the duplicate skipped", n)
+	}
+	if got := p.Report().Dropped.Duplicate; got != 1 {
+		t.Errorf("Dropped.Duplicate = %d, want 1", got)
+	}
+}
+
+func TestDedupForgetsEventsThatFailed(t *testing.T) {
+	w := &fakeWriter{writeErr: errTestBroker}
+	p := newTestProducer(w)
+	p.Dedup = NewDeduper(100, time.Hour)
+
+	event := testEvent("req-1")
+	if err := p.SendEvent(context.Background(), event); !errors.Is(err, errTestBroker) {
+		t.Fatalf("failed send returned %v", err)
+	}
+	w.writeErr = nil
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Errorf("resending an event that failed returned %v", err)
+	}
+}
+
+func TestDeduperEvictsLeastRecentlySeenAndExpired(t *testing.T) {
+	d := NewDeduper(2, time.Minute)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	d.Reserve("req-1")
+	d.Reserve("req-2")
+	d.Reserve("req-1") // req-2 is now the least recently seen
+	d.Reserve("req-3")
+	if d.Len() != 2 {
+		t.Fatalf("Len() = %d, want capacity 2", d.Len())
+	}
+	if !d.Reserve("req-2") {
+		t.Error("req-2 was not evicted")
+	}
+	if d.Reserve("req-3") {
+		t.Error("req-3 was evicted before the least recently seen ID")
+	}
+
+	now = now.Add(time.Minute)
+	if !d.Reserve("req-3") {
+		t.Error("req-3 was still a duplicate after its TTL")
+	}
+}
+
+func TestDedupConcurrentSends(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.Dedup = NewDeduper(1000, 0)
+
+	var wg sync.WaitGroup
+	var duplicates atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				err := p.SendEvent(context.Background(), testEvent(fmt.Sprintf("req-%d", j)))
+				if errors.Is(err, ErrDuplicate) {
+					duplicates.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(w.Messages()); n != 50 || duplicates.Load() != 7*50 {
+		t.Errorf("wrote %d messages with %d duplicates, want 50 and %d", n, duplicates.Load(), 7*50)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DegenerateResponseConfig configures a DegenerateResponseDetector
+type DegenerateResponseConfig struct {
+	// WindowSize is the number of recent events per model used to compute the rate (default: 100)
+	WindowSize int
+	// RateThreshold is the degenerate fraction (0.0-1.0) above which events are flagged (default: 0.1)
+	RateThreshold float64
+	// ExitRateThreshold is the fraction a flagged model's rate must fall to
+	// before it stops being flagged (default: RateThreshold)
+	ExitRateThreshold float64
+	// MinSamples is the number of events a model needs before it can be flagged (default: 20)
+	MinSamples int
+	// ExpectResponseText treats an empty ResponseText as degenerate
+	ExpectResponseText bool
+}
+
+// DegenerateResponseDetector flags models returning an unusual rate of
+// empty responses without an error code, which usually indicates a broken
+// integration rather than a model failure.
+type DegenerateResponseDetector struct {
+	warmupGate
+	hysteresis
+
+	mu     sync.Mutex
+	config DegenerateResponseConfig
+	now    func() time.Time
+	models map[string]*outcomeWindow
+}
+
+// outcomeWindow is a fixed-size ring of recent degenerate/healthy outcomes
+type outcomeWindow struct {
+	outcomes   []bool
+	next       int
+	count      int
+	degenerate int
+	lastSeen   time.Time
+}
+
+// add records an outcome, evicting the oldest once the window is full
+func (w *outcomeWindow) add(degenerate bool) {
+	if w.count == len(w.outcomes) {
+		if w.outcomes[w.next] {
+			w.degenerate--
+		}
+	} else {
+		w.count++
+	}
+
+	w.outcomes[w.next] = degenerate
+	if degenerate {
+		w.degenerate++
+	}
+	w.next = (w.next + 1) % len(w.outcomes)
+}
+
+// rate returns the degenerate fraction of the window
+func (w *outcomeWindow) rate() float64 {
+	if w.count == 0 {
+		return 0
+	}
+	return float64(w.degenerate) / float64(w.count)
+}
+
+// NewDegenerateResponseDetector creates a detector, applying defaults for zero config values
+func NewDegenerateResponseDetector(config DegenerateResponseConfig) *DegenerateResponseDetector {
+	if config.WindowSize <= 0 {
+		config.WindowSize = 100
+	}
+	if config.RateThreshold <= 0 {
+		config.RateThreshold = 0.1
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = 20
+	}
+
+	return &DegenerateResponseDetector{
+		warmupGate: warmupGate{minSamples: config.MinSamples},
+		hysteresis: newHysteresis(config.RateThreshold, config.ExitRateThreshold),
+		config:     config,
+		now:        time.Now,
+		models:     make(map[string]*outcomeWindow),
+	}
+}
+
+// isDegenerate reports whether the event looks like a silently broken response
+func (d *DegenerateResponseDetector) isDegenerate(event TelemetryEvent) bool {
+	if event.ErrorCode != "" {
+		return false
+	}
+	if event.CompletionTokens == 0 {
+		return true
+	}
+	return d.config.ExpectResponseText && event.ResponseText == ""
+}
+
+// Observe records the event and flags it when it is degenerate and its
+// model is flagged: the model's degenerate rate has exceeded RateThreshold
+// and not since fallen to ExitRateThreshold
+func (d *DegenerateResponseDetector) Observe(event TelemetryEvent) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.models[event.ModelName]
+	if !ok {
+		window = &outcomeWindow{outcomes: make([]bool, d.config.WindowSize)}
+		d.models[event.ModelName] = window
+	}
+
+	window.lastSeen = d.now()
+
+	degenerate := d.isDegenerate(event)
+	window.add(degenerate)
+	warm := d.observe(event.ModelName)
+
+	rate := window.rate()
+	flagged := warm && d.update(event.ModelName, rate)
+	if !degenerate || !flagged {
+		return nil
+	}
+
+	return []Anomaly{newAnomaly(AnomalyDegenerateResponse, event, rate, d.config.RateThreshold,
+		fmt.Sprintf("%.0f%% of the last %d %s responses were empty without an error code",
+			rate*100, window.count, event.ModelName))}
+}
+
+// Rate returns the current degenerate response rate for a model
+func (d *DegenerateResponseDetector) Rate(model string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if window, ok := d.models[model]; ok {
+		return window.rate()
+	}
+	return 0
+}
+
+// EvictIdle drops the state of models not observed since cutoff
+func (d *DegenerateResponseDetector) EvictIdle(cutoff time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted := 0
+	for model, window := range d.models {
+		if window.lastSeen.Before(cutoff) {
+			delete(d.models, model)
+			d.forget(model)
+			d.unflag(model)
+			evicted++
+		}
+	}
+	return evicted
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDegenerateResponseDetectorHealthyTraffic(t *testing.T) {
+	detector := NewDegenerateResponseDetector(DegenerateResponseConfig{WindowSize: 50, RateThreshold: 0.1, MinSamples: 10})
+
+	for i := 0; i < 100; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		// An occasional refusal with an error code is not degenerate
+		if i%10 == 0 {
+			event.CompletionTokens = 0
+			event.ErrorCode = "content_filter"
+		}
+		if anomalies := detector.Observe(event); len(anomalies) != 0 {
+			t.Fatalf("event %d flagged on healthy traffic: %+v", i, anomalies)
+		}
+	}
+
+	if rate := detector.Rate("gpt-4"); rate != 0 {
+		t.Errorf("Rate = %v, want 0", rate)
+	}
+}
+
+func TestDegenerateResponseDetectorFlagsBrokenModel(t *testing.T) {
+	detector := NewDegenerateResponseDetector(DegenerateResponseConfig{WindowSize: 50, RateThreshold: 0.1, MinSamples: 10})
+
+	var flagged []Anomaly
+	for i := 0; i < 40; i++ {
+		broken := testEvent(fmt.Sprintf("broken-%d", i))
+		if i%2 == 0 {
+			broken.CompletionTokens = 0
+		}
+		flagged = append(flagged, detector.Observe(broken)...)
+
+		healthy := testEvent(fmt.Sprintf("healthy-%d", i))
+		healthy.ModelName = "claude-3-opus"
+		if anomalies := detector.Observe(healthy); len(anomalies) != 0 {
+			t.Fatalf("healthy model flagged: %+v", anomalies)
+		}
+	}
+
+	if len(flagged) == 0 {
+		t.Fatal("expected degenerate gpt-4 responses to be flagged")
+	}
+	for _, anomaly := range flagged {
+		if anomaly.Type != AnomalyDegenerateResponse || anomaly.ModelName != "gpt-4" {
+			t.Errorf("unexpected anomaly %+v", anomaly)
+		}
+		if anomaly.Score <= anomaly.Threshold {
+			t.Errorf("score %v not above threshold %v", anomaly.Score, anomaly.Threshold)
+		}
+	}
+
+	if rate := detector.Rate("gpt-4"); rate != 0.5 {
+		t.Errorf("Rate = %v, want 0.5", rate)
+	}
+}
+
+func TestDegenerateResponseDetectorExpectResponseText(t *testing.T) {
+	detector := NewDegenerateResponseDetector(DegenerateResponseConfig{MinSamples: 1, RateThreshold: 0.5, ExpectResponseText: true})
+
+	event := testEvent("req-1")
+	if anomalies := detector.Observe(event); len(anomalies) != 1 {
+		t.Errorf("empty response text: got %d anomalies, want 1", len(anomalies))
+	}
+}
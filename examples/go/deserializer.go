@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ContentTypeHeader is the Kafka header naming a message's encoding
+const ContentTypeHeader = "content-type"
+
+// Content types understood by the default Deserializer
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// DecodeFunc decodes a message value into an event
+type DecodeFunc func(data []byte) (TelemetryEvent, error)
+
+// Deserializer decodes consumed messages, choosing the decoder from each
+// message's content-type header. Messages without the header are decoded
+// as JSON, which is what producers send by default.
+type Deserializer struct {
+	mu       sync.RWMutex
+	decoders map[string]DecodeFunc
+	codecs   *CodecRegistry
+}
+
+// NewDeserializer creates a deserializer for JSON, Protobuf and Avro messages
+func NewDeserializer() *Deserializer {
+	return &Deserializer{
+		decoders: map[string]DecodeFunc{
+			ContentTypeJSON:     decodeEventJSON,
+			ContentTypeProtobuf: unmarshalEventProto,
+			ContentTypeAvro:     unmarshalEventAvro,
+		},
+	}
+}
+
+// defaultDeserializer is used by nil Deserializers
+var defaultDeserializer = NewDeserializer()
+
+// Register adds or replaces the decoder for a content type
+func (d *Deserializer) Register(contentType string, decode DecodeFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.decoders[strings.ToLower(contentType)] = decode
+}
+
+// UseCodecs resolves the codec named in each message's content-encoding
+// header from codecs. Without a registry, only the built-in codecs are known.
+func (d *Deserializer) UseCodecs(codecs *CodecRegistry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.codecs = codecs
+}
+
+// Deserialize decodes the message with the decoder for its content type.
+// Media type parameters such as charset are ignored, a value compressed
+// with a registered codec is decompressed, and the Confluent wire format
+// framing is stripped. An event without an idempotency key takes it from
+// the message header. A nil Deserializer behaves like NewDeserializer().
+func (d *Deserializer) Deserialize(msg kafka.Message) (TelemetryEvent, error) {
+	if d == nil {
+		d = defaultDeserializer
+	}
+
+	contentType := ContentTypeJSON
+	if value, ok := messageHeader(msg, ContentTypeHeader); ok && value != "" {
+		mediaType, _, err := mime.ParseMediaType(value)
+		if err != nil {
+			return TelemetryEvent{}, fmt.Errorf("invalid content type %q: %w", value, err)
+		}
+		contentType = mediaType
+	}
+
+	d.mu.RLock()
+	decode, ok := d.decoders[contentType]
+	codecs := d.codecs
+	d.mu.RUnlock()
+	if !ok {
+		return TelemetryEvent{}, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	value, err := decompressMessage(msg, codecs)
+	if err != nil {
+		return TelemetryEvent{}, err
+	}
+	msg.Value = value
+	value, err = unframeMessage(msg)
+	if err != nil {
+		return TelemetryEvent{}, err
+	}
+	event, err := decode(value)
+	if err != nil {
+		return event, err
+	}
+	if event.IdempotencyKey == "" {
+		event.IdempotencyKey, _ = messageHeader(msg, IdempotencyKeyHeader)
+	}
+	return event, nil
+}
+
+// decodeEventJSON decodes a JSON event
+func decodeEventJSON(data []byte) (TelemetryEvent, error) {
+	var event TelemetryEvent
+	err := json.Unmarshal(data, &event)
+	return event, err
+}
+
+// messageHeader returns the value of the first header with the given key,
+// compared case-insensitively
+func messageHeader(msg kafka.Message, key string) (string, bool) {
+	for _, header := range msg.Headers {
+		if strings.EqualFold(header.Key, key) {
+			return string(header.Value), true
+		}
+	}
+	return "", false
+}
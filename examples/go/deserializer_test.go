@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	event := testEvent("req-1")
+	event.EndpointType = EndpointChat
+	event.PromptHash = "abc123"
+	event.IdempotencyKey = NewIdempotencyKey()
+	event.Flags = []string{"new-router", "beta"}
+	event.Metadata = map[string]interface{}{
+		"region":  "us-east-1",
+		"retries": float64(2),
+		"tags":    []interface{}{"a", "b"},
+	}
+
+	data, err := ProtobufSerializer{}.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	got, err := unmarshalEventProto(data)
+	if err != nil {
+		t.Fatalf("unmarshalEventProto: %v", err)
+	}
+	if !reflect.DeepEqual(got, event) {
+		t.Errorf("round trip = %+v, want %+v", got, event)
+	}
+}
+
+func TestConsumerDecodesMixedFormats(t *testing.T) {
+	protoValue, err := ProtobufSerializer{}.Marshal(testEvent("req-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonValue := func(id string) []byte {
+		data, err := json.Marshal(testEvent(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	header := func(contentType string) []kafka.Header {
+		return []kafka.Header{{Key: ContentTypeHeader, Value: []byte(contentType)}}
+	}
+
+	group := &fakeGroup{messages: []kafka.Message{
+		{Offset: 0, Value: jsonValue("req-1")},
+		{Offset: 1, Value: protoValue, Headers: header(ContentTypeProtobuf)},
+		{Offset: 2, Value: []byte("<event/>"), Headers: header("application/xml")},
+		{Offset: 3, Value: jsonValue("req-3"), Headers: []kafka.Header{{Key: "Content-Type", Value: []byte("application/json; charset=utf-8")}}},
+	}}
+	now := time.Now()
+	var delays []time.Duration
+	consumer, _ := newTestConsumer(group, nil, &now, &delays)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []TelemetryEvent
+	err = consumer.Run(ctx, func(ctx context.Context, event TelemetryEvent) error {
+		got = append(got, event)
+		if len(got) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("handled %d events, want 3", len(got))
+	}
+	for i, id := range []string{"req-1", "req-2", "req-3"} {
+		if !reflect.DeepEqual(got[i], testEvent(id)) {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], testEvent(id))
+		}
+	}
+}
+
+func TestDeserializerRegister(t *testing.T) {
+	d := NewDeserializer()
+	d.Register("Application/X-Test", func(data []byte) (TelemetryEvent, error) {
+		return testEvent(string(data)), nil
+	})
+
+	msg := kafka.Message{Value: []byte("req-9"), Headers: []kafka.Header{{Key: ContentTypeHeader, Value: []byte("application/x-test")}}}
+	event, err := d.Deserialize(msg)
+	if err != nil || event.RequestID != "req-9" {
+		t.Errorf("Deserialize = %+v, %v; want req-9", event, err)
+	}
+
+	msg.Headers[0].Value = []byte("text/csv")
+	if _, err := d.Deserialize(msg); err == nil {
+		t.Error("expected error for unregistered content type")
+	}
+}
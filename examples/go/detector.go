@@ -0,0 +1,51 @@
+package main
+
+import "time"
+
+// Anomaly describes an anomaly flagged by a detector
+type Anomaly struct {
+	Type        AnomalyKind `json:"type"`
+	Score       float64     `json:"score"`
+	Threshold   float64     `json:"threshold"`
+	ServiceName string      `json:"service_name,omitempty"`
+	ModelName   string      `json:"model_name,omitempty"`
+	UserID      string      `json:"user_id,omitempty"`
+	SessionID   string      `json:"session_id,omitempty"`
+	RequestID   string      `json:"request_id,omitempty"`
+	Description string      `json:"description"`
+	// Limit names the hard threshold crossed, e.g. max_latency_ms; it is
+	// empty for statistical outliers
+	Limit string `json:"limit,omitempty"`
+	// Suppressed is set on anomalies detected inside a maintenance window
+	Suppressed bool `json:"suppressed,omitempty"`
+}
+
+// Detector observes telemetry events and flags anomalies
+type Detector interface {
+	// Observe records the event and returns any anomalies it triggers
+	Observe(event TelemetryEvent) []Anomaly
+}
+
+// newAnomaly creates an anomaly populated with the event's identifying fields
+func newAnomaly(kind AnomalyKind, event TelemetryEvent, score, threshold float64, description string) Anomaly {
+	return Anomaly{
+		Type:        kind,
+		Score:       score,
+		Threshold:   threshold,
+		ServiceName: event.ServiceName,
+		ModelName:   event.ModelName,
+		UserID:      event.UserID,
+		SessionID:   event.SessionID,
+		RequestID:   event.RequestID,
+		Description: description,
+	}
+}
+
+// eventTime returns the event's timestamp, falling back to the current time
+// when it is missing or malformed
+func eventTime(event TelemetryEvent) time.Time {
+	if ts, err := time.Parse(time.RFC3339Nano, event.Timestamp); err == nil {
+		return ts
+	}
+	return time.Now()
+}
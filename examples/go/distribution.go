@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Distribution draws the values of one field of synthetic traffic
+type Distribution interface {
+	Sample(rng *rand.Rand) float64
+}
+
+// Uniform draws values uniformly from [Min, Max)
+type Uniform struct {
+	Min float64
+	Max float64
+}
+
+// Sample draws a value from the distribution
+func (d Uniform) Sample(rng *rand.Rand) float64 {
+	return d.Min + rng.Float64()*(d.Max-d.Min)
+}
+
+// Normal draws values from a normal distribution
+type Normal struct {
+	Mean   float64
+	StdDev float64
+}
+
+// Sample draws a value from the distribution
+func (d Normal) Sample(rng *rand.Rand) float64 {
+	return d.Mean + rng.NormFloat64()*d.StdDev
+}
+
+// LogNormal draws values whose logarithm is normal with mean Mu and
+// standard deviation Sigma. It suits latencies, which have a long right tail.
+type LogNormal struct {
+	Mu    float64
+	Sigma float64
+}
+
+// LogNormalFromMedian returns the log-normal distribution with the given
+// median whose 99th percentile is p99
+func LogNormalFromMedian(median, p99 float64) LogNormal {
+	// 2.326 is the standard normal's 99th percentile
+	return LogNormal{Mu: math.Log(median), Sigma: math.Log(p99/median) / 2.326}
+}
+
+// Sample draws a value from the distribution
+func (d LogNormal) Sample(rng *rand.Rand) float64 {
+	return math.Exp(d.Mu + rng.NormFloat64()*d.Sigma)
+}
+
+// Exponential draws values from an exponential distribution with the given mean
+type Exponential struct {
+	Mean float64
+}
+
+// Sample draws a value from the distribution
+func (d Exponential) Sample(rng *rand.Rand) float64 {
+	return rng.ExpFloat64() * d.Mean
+}
+
+// sampleCount draws a non-negative count, so distributions with negative
+// support such as Normal can describe token counts
+func sampleCount(d Distribution, rng *rand.Rand) int {
+	return int(math.Max(0, d.Sample(rng)))
+}
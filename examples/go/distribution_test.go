@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDistributionMoments(t *testing.T) {
+	tests := []struct {
+		name     string
+		dist     Distribution
+		mean     float64
+		variance float64
+	}{
+		{"uniform", Uniform{Min: 100, Max: 500}, 300, 400 * 400 / 12.0},
+		{"normal", Normal{Mean: 1000, StdDev: 200}, 1000, 200 * 200},
+		// mean exp(mu+sigma²/2), variance (exp(sigma²)-1)exp(2mu+sigma²)
+		{"lognormal", LogNormal{Mu: 6, Sigma: 0.5}, math.Exp(6.125), (math.Exp(0.25) - 1) * math.Exp(12.25)},
+		{"exponential", Exponential{Mean: 250}, 250, 250 * 250},
+	}
+
+	for _, tt := range tests {
+		rng := rand.New(rand.NewSource(1))
+		const n = 200000
+		var sum, sumSquares float64
+		for i := 0; i < n; i++ {
+			v := tt.dist.Sample(rng)
+			sum += v
+			sumSquares += v * v
+		}
+		mean := sum / n
+		variance := sumSquares/n - mean*mean
+
+		if math.Abs(mean-tt.mean) > 0.01*tt.mean {
+			t.Errorf("%s: mean = %.1f, want ~%.1f", tt.name, mean, tt.mean)
+		}
+		if math.Abs(variance-tt.variance) > 0.05*tt.variance {
+			t.Errorf("%s: variance = %.1f, want ~%.1f", tt.name, variance, tt.variance)
+		}
+	}
+}
+
+func TestLogNormalFromMedian(t *testing.T) {
+	d := LogNormalFromMedian(800, 5000)
+	rng := rand.New(rand.NewSource(1))
+
+	var below, above int
+	const n = 100000
+	for i := 0; i < n; i++ {
+		v := d.Sample(rng)
+		if v < 800 {
+			below++
+		}
+		if v > 5000 {
+			above++
+		}
+	}
+	if share := float64(below) / n; math.Abs(share-0.5) > 0.01 {
+		t.Errorf("%.3f of samples below the median, want ~0.5", share)
+	}
+	if share := float64(above) / n; math.Abs(share-0.01) > 0.002 {
+		t.Errorf("%.3f of samples above p99, want ~0.01", share)
+	}
+}
+
+func TestSimulatorsUseProfileDistributions(t *testing.T) {
+	withoutSimulationPauses(t)
+	profile := DefaultTrafficProfile()
+	profile.Normal = TrafficShape{
+		LatencyMs:        Uniform{Min: 750, Max: 750},
+		PromptTokens:     Normal{Mean: -100, StdDev: 1},
+		CompletionTokens: Uniform{Min: 40, Max: 40},
+	}
+	profile.Anomalies = map[AnomalyKind]TrafficShape{
+		AnomalyHighLatency: {
+			LatencyMs:        Uniform{Min: 90000, Max: 90000},
+			PromptTokens:     Uniform{Min: 10, Max: 10},
+			CompletionTokens: Uniform{Min: 20, Max: 20},
+		},
+	}
+
+	sink := &MemorySink{}
+	producer := NewSinkProducer(sink)
+	profile.SimulateNormalTraffic(context.Background(), producer, 5)
+	profile.SimulateAnomalousTraffic(context.Background(), producer, 5)
+
+	events := sink.Events()
+	if len(events) != 10 {
+		t.Fatalf("sink received %d events, want 10", len(events))
+	}
+	for _, event := range events[:5] {
+		// negative draws are clamped to zero tokens
+		if event.LatencyMs != 750 || event.PromptTokens != 0 || event.CompletionTokens != 40 {
+			t.Errorf("normal event = %.0fms %d/%d tokens, want 750ms 0/40", event.LatencyMs, event.PromptTokens, event.CompletionTokens)
+		}
+	}
+	for _, event := range events[5:] {
+		if event.LatencyMs != 90000 || event.Metadata["anomaly_type"] != AnomalyHighLatency.String() {
+			t.Errorf("anomalous event = %.0fms %v, want 90000ms high_latency", event.LatencyMs, event.Metadata["anomaly_type"])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import "fmt"
+
+// DropReason is why the producer dropped an event instead of sending it
+type DropReason int
+
+const (
+	// DropSampled events were not kept by the sampler
+	DropSampled DropReason = iota + 1
+	// DropFiltered events were for a denied model, invalid, timestamped in
+	// the future or below the cost filter's threshold
+	DropFiltered
+	// DropBudget events exceeded their model's token budget
+	DropBudget
+	// DropRateLimited events were from a user the producer's RateLimit limits
+	DropRateLimited
+	// DropExpired events waited in the buffer longer than their maximum age
+	DropExpired
+	// DropPaused events were sent while the producer was paused
+	DropPaused
+	// DropDuplicate events had a RequestID the producer's Dedup had
+	// already sent
+	DropDuplicate
+)
+
+// numDropReasons sizes per-reason counters
+const numDropReasons = int(DropDuplicate) + 1
+
+var dropReasonNames = map[DropReason]string{
+	DropSampled:     "sampled",
+	DropFiltered:    "filtered",
+	DropBudget:      "budget",
+	DropRateLimited: "rate_limited",
+	DropExpired:     "expired",
+	DropPaused:      "paused",
+	DropDuplicate:   "duplicate",
+}
+
+// String returns the snake_case name of the reason
+func (r DropReason) String() string {
+	if name, ok := dropReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("DropReason(%d)", int(r))
+}
+
+// MarshalText encodes the reason as its name
+func (r DropReason) MarshalText() ([]byte, error) {
+	if _, ok := dropReasonNames[r]; !ok {
+		return nil, fmt.Errorf("unknown drop reason %d", int(r))
+	}
+	return []byte(r.String()), nil
+}
+
+// dropped counts an event dropped for reason and passes it to the OnDrop hook
+func (p *TelemetryProducer) dropped(event TelemetryEvent, reason DropReason) {
+	p.counters.byReason[reason].Add(1)
+	if p.OnDrop != nil {
+		p.OnDrop(event, reason)
+	}
+}
+
+// DropsByReason returns the number of events dropped for each reason so far
+func (p *TelemetryProducer) DropsByReason() map[DropReason]int64 {
+	drops := make(map[DropReason]int64, len(dropReasonNames))
+	for reason := range dropReasonNames {
+		drops[reason] = p.counters.byReason[reason].Load()
+	}
+	return drops
+}
+
+// Pause makes the producer drop every event it is given until Resume, e.g.
+// while a downstream is in maintenance. Dropped events are reported with
+// DropPaused.
+func (p *TelemetryProducer) Pause() {
+	p.paused.Store(true)
+}
+
+// Resume sends events again after Pause
+func (p *TelemetryProducer) Resume() {
+	p.paused.Store(false)
+}
+
+// Paused reports whether the producer is paused
+func (p *TelemetryProducer) Paused() bool {
+	return p.paused.Load()
+}
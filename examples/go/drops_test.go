@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDropPathsReportTheirReason(t *testing.T) {
+	limits := NewRateLimitUserAction(time.Hour)
+	limits.Execute(context.Background(), Anomaly{UserID: "user-limited"})
+
+	tests := []struct {
+		name   string
+		setup  func(p *TelemetryProducer, event *TelemetryEvent)
+		reason DropReason
+	}{
+		{"sampler", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.Sampler = modelSampler(event.ModelName)
+		}, DropSampled},
+		{"denied model", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.Reconfigure(RuntimeConfig{DeniedModels: []string{event.ModelName}})
+		}, DropFiltered},
+		{"invalid", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.ValidateBeforeSend = true
+			event.ServiceName = ""
+		}, DropFiltered},
+		{"future timestamp", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.FutureTimestamps = &FutureTimestampCheck{MaxSkew: time.Minute}
+			event.Timestamp = time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+		}, DropFiltered},
+		{"cost filter", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.CostFilter = &CostFilter{MinCostUsd: 1}
+		}, DropFiltered},
+		{"token budget", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.TokenBudget = &TokenBudget{Default: 100}
+		}, DropBudget},
+		{"rate limit", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.RateLimit = limits
+			event.UserID = "user-limited"
+		}, DropRateLimited},
+		{"paused", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.Pause()
+		}, DropPaused},
+		{"duplicate", func(p *TelemetryProducer, event *TelemetryEvent) {
+			p.Dedup = NewDeduper(10, time.Hour)
+			p.Dedup.Reserve(event.RequestID)
+		}, DropDuplicate},
+	}
+
+	for _, tt := range tests {
+		w := &fakeWriter{}
+		p := newTestProducer(w)
+		var reasons []DropReason
+		p.OnDrop = func(event TelemetryEvent, reason DropReason) { reasons = append(reasons, reason) }
+
+		event := testEvent("req-1")
+		tt.setup(p, &event)
+		p.SendEvent(context.Background(), event)
+
+		if len(reasons) != 1 || reasons[0] != tt.reason {
+			t.Errorf("%s: OnDrop reasons = %v, want [%s]", tt.name, reasons, tt.reason)
+		}
+		if got := p.DropsByReason()[tt.reason]; got != 1 {
+			t.Errorf("%s: DropsByReason()[%s] = %d, want 1", tt.name, tt.reason, got)
+		}
+		if len(w.Messages()) != 0 {
+			t.Errorf("%s: the dropped event was sent", tt.name)
+		}
+	}
+}
+
+func TestExpiredBufferedEventsReportTheirReason(t *testing.T) {
+	p := newTestProducer(&fakeWriter{})
+	var reasons []DropReason
+	p.OnDrop = func(event TelemetryEvent, reason DropReason) { reasons = append(reasons, reason) }
+
+	now := time.Now()
+	kept := p.dropStale([]bufferedEvent{
+		{event: testEvent("req-fresh"), deadline: now.Add(time.Second)},
+		{event: testEvent("req-stale"), deadline: now.Add(-time.Second)},
+		{event: testEvent("req-unlimited")},
+	}, now)
+
+	if len(kept) != 2 || len(reasons) != 1 || reasons[0] != DropExpired {
+		t.Errorf("kept %d events with reasons %v, want 2 kept and [expired]", len(kept), reasons)
+	}
+	if got := p.DropsByReason()[DropExpired]; got != 1 {
+		t.Errorf("DropsByReason()[expired] = %d, want 1", got)
+	}
+}
+
+func TestResumeSendsAgain(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+
+	p.Pause()
+	p.SendEvent(context.Background(), testEvent("req-1"))
+	if !p.Paused() || p.Report().Dropped.Paused != 1 {
+		t.Fatalf("Paused() = %v with %d paused drops, want true and 1", p.Paused(), p.Report().Dropped.Paused)
+	}
+	p.Resume()
+	if err := p.SendEvent(context.Background(), testEvent("req-2")); err != nil || len(w.Messages()) != 1 {
+		t.Errorf("SendEvent after Resume = %v with %d messages, want 1 sent", err, len(w.Messages()))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DuplicateIDConfig configures a DuplicateIDDetector
+type DuplicateIDConfig struct {
+	// Window is how long a RequestID is remembered after it is first seen (default: 10m)
+	Window time.Duration
+	// MaxEntries bounds the remembered RequestIDs; the oldest are forgotten first (default: 100000)
+	MaxEntries int
+	// Drop makes Process reject duplicates instead of only flagging them
+	Drop bool
+}
+
+// DuplicateIDDetector flags events whose RequestID was already seen within
+// a time window, which indicates a client bug or a replay. Memory is bounded
+// by both the window and MaxEntries.
+type DuplicateIDDetector struct {
+	mu         sync.Mutex
+	config     DuplicateIDConfig
+	now        func() time.Time
+	seen       map[string]time.Time
+	order      []seenID
+	duplicates int
+}
+
+// seenID records when a RequestID was first seen, in arrival order
+type seenID struct {
+	id string
+	at time.Time
+}
+
+// NewDuplicateIDDetector creates a detector, applying defaults for zero config values
+func NewDuplicateIDDetector(config DuplicateIDConfig) *DuplicateIDDetector {
+	if config.Window <= 0 {
+		config.Window = 10 * time.Minute
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 100000
+	}
+
+	return &DuplicateIDDetector{
+		config: config,
+		now:    time.Now,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Observe flags the event if its RequestID was seen within the window
+func (d *DuplicateIDDetector) Observe(event TelemetryEvent) []Anomaly {
+	_, anomalies := d.Process(event)
+	return anomalies
+}
+
+// Process flags duplicates and reports whether the event should be kept,
+// which is false only for duplicates when Drop is set
+func (d *DuplicateIDDetector) Process(event TelemetryEvent) (bool, []Anomaly) {
+	if event.RequestID == "" {
+		return true, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.expireLocked(now)
+
+	if firstSeen, ok := d.seen[event.RequestID]; ok {
+		d.duplicates++
+		age := now.Sub(firstSeen)
+		anomaly := newAnomaly(AnomalyDuplicateRequestID, event, age.Seconds(), d.config.Window.Seconds(),
+			fmt.Sprintf("request_id %s was already seen %s ago", event.RequestID, age.Round(time.Millisecond)))
+		return !d.config.Drop, []Anomaly{anomaly}
+	}
+
+	d.seen[event.RequestID] = now
+	d.order = append(d.order, seenID{id: event.RequestID, at: now})
+	for len(d.seen) > d.config.MaxEntries {
+		d.forgetOldestLocked()
+	}
+
+	return true, nil
+}
+
+// Duplicates returns the number of duplicate events observed
+func (d *DuplicateIDDetector) Duplicates() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.duplicates
+}
+
+// expireLocked forgets RequestIDs first seen longer than Window ago
+func (d *DuplicateIDDetector) expireLocked(now time.Time) {
+	cutoff := now.Add(-d.config.Window)
+	for len(d.order) > 0 && !d.order[0].at.After(cutoff) {
+		d.forgetOldestLocked()
+	}
+}
+
+// forgetOldestLocked removes the oldest remembered RequestID
+func (d *DuplicateIDDetector) forgetOldestLocked() {
+	oldest := d.order[0]
+	d.order = d.order[1:]
+	if at, ok := d.seen[oldest.id]; ok && at.Equal(oldest.at) {
+		delete(d.seen, oldest.id)
+	}
+}
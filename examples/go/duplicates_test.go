@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDuplicateIDDetectorWithinAndAfterWindow(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	detector := NewDuplicateIDDetector(DuplicateIDConfig{Window: time.Minute})
+	detector.now = func() time.Time { return now }
+
+	event := testEvent("req-replayed")
+	if anomalies := detector.Observe(event); len(anomalies) != 0 {
+		t.Fatalf("first sighting flagged: %+v", anomalies)
+	}
+
+	now = now.Add(30 * time.Second)
+	anomalies := detector.Observe(event)
+	if len(anomalies) != 1 || anomalies[0].Type != AnomalyDuplicateRequestID || anomalies[0].RequestID != "req-replayed" {
+		t.Fatalf("replay within window = %+v, want duplicate anomaly", anomalies)
+	}
+	if anomalies[0].Score != 30 {
+		t.Errorf("score = %v, want age of 30s", anomalies[0].Score)
+	}
+
+	now = now.Add(time.Minute)
+	if anomalies := detector.Observe(event); len(anomalies) != 0 {
+		t.Errorf("replay after window flagged: %+v", anomalies)
+	}
+
+	if n := detector.Duplicates(); n != 1 {
+		t.Errorf("Duplicates = %d, want 1", n)
+	}
+}
+
+func TestDuplicateIDDetectorDrop(t *testing.T) {
+	detector := NewDuplicateIDDetector(DuplicateIDConfig{Drop: true})
+
+	keep, _ := detector.Process(testEvent("req-1"))
+	if !keep {
+		t.Fatal("first event dropped")
+	}
+	keep, anomalies := detector.Process(testEvent("req-1"))
+	if keep || len(anomalies) != 1 {
+		t.Errorf("duplicate kept=%v anomalies=%d, want dropped and flagged", keep, len(anomalies))
+	}
+}
+
+func TestDuplicateIDDetectorBoundedEntries(t *testing.T) {
+	detector := NewDuplicateIDDetector(DuplicateIDConfig{Window: time.Hour, MaxEntries: 10})
+
+	for i := 0; i < 20; i++ {
+		detector.Observe(testEvent(fmt.Sprintf("req-%d", i)))
+	}
+
+	if n := len(detector.seen); n != 10 {
+		t.Errorf("remembering %d ids, want 10", n)
+	}
+	if anomalies := detector.Observe(testEvent("req-0")); len(anomalies) != 0 {
+		t.Error("evicted id still flagged as duplicate")
+	}
+	if anomalies := detector.Observe(testEvent("req-19")); len(anomalies) != 1 {
+		t.Error("recent id not flagged as duplicate")
+	}
+}
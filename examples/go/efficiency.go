@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EfficiencyMetric is the cost ratio a CostEfficiencyDetector tracks
+type EfficiencyMetric string
+
+const (
+	// CostPerEvent is the mean cost of a successful event
+	CostPerEvent EfficiencyMetric = "cost_per_event"
+	// CostPerCompletionToken is total cost over total completion tokens, which
+	// rises when prompts grow while answers stay the same length
+	CostPerCompletionToken EfficiencyMetric = "cost_per_completion_token"
+)
+
+// CostEfficiencyConfig configures a CostEfficiencyDetector
+type CostEfficiencyConfig struct {
+	// Metric is the ratio tracked (default: cost per event)
+	Metric EfficiencyMetric
+	// WindowSize is the number of successful events in each of the baseline
+	// and recent windows (default: 200)
+	WindowSize int
+	// EvaluateEvery is the number of events per service between comparisons (default: 50)
+	EvaluateEvery int
+	// Threshold is the relative increase of the recent window over the
+	// baseline that counts as a regression (default: 0.2, i.e. 20% worse)
+	Threshold float64
+	// ExitThreshold is the relative increase a flagged service must fall to
+	// before the regression is over and can be flagged again (default: Threshold)
+	ExitThreshold float64
+	// SustainedEvaluations is the number of consecutive comparisons that must
+	// exceed Threshold before the regression is flagged (default: 3)
+	SustainedEvaluations int
+}
+
+// CostEfficiency compares a service's baseline and recent efficiency
+type CostEfficiency struct {
+	// Before is the metric over the older window
+	Before float64
+	// After is the metric over the most recent window
+	After float64
+	// Change is the relative increase from Before to After
+	Change float64
+}
+
+// CostEfficiencyDetector tracks cost per successful event, or per completion
+// token, for each service and flags sustained increases, which indicate
+// inefficiency creep such as steadily growing prompts. It compares the most
+// recent WindowSize events against the WindowSize events before them and
+// emits one aggregate anomaly per regression, once it has persisted for
+// SustainedEvaluations comparisons. A regression lasts until the increase
+// falls to ExitThreshold. Failed events are ignored.
+type CostEfficiencyDetector struct {
+	warmupGate
+	hysteresis
+
+	mu       sync.Mutex
+	config   CostEfficiencyConfig
+	now      func() time.Time
+	services map[string]*efficiencyWindow
+}
+
+// efficiencySample is one successful event's cost and completion tokens
+type efficiencySample struct {
+	cost   float64
+	tokens int
+}
+
+// efficiencyWindow is a ring of a service's last 2*WindowSize samples
+type efficiencyWindow struct {
+	samples   []efficiencySample
+	next      int
+	count     int
+	sinceEval int
+	streak    int
+	lastSeen  time.Time
+}
+
+// NewCostEfficiencyDetector creates a detector, applying defaults for zero config values
+func NewCostEfficiencyDetector(config CostEfficiencyConfig) (*CostEfficiencyDetector, error) {
+	if config.Metric == "" {
+		config.Metric = CostPerEvent
+	}
+	if config.WindowSize <= 0 {
+		config.WindowSize = 200
+	}
+	if config.EvaluateEvery <= 0 {
+		config.EvaluateEvery = 50
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 0.2
+	}
+	if config.SustainedEvaluations <= 0 {
+		config.SustainedEvaluations = 3
+	}
+
+	switch config.Metric {
+	case CostPerEvent, CostPerCompletionToken:
+	default:
+		return nil, fmt.Errorf("unknown efficiency metric %q", config.Metric)
+	}
+
+	return &CostEfficiencyDetector{
+		warmupGate: warmupGate{minSamples: 2 * config.WindowSize},
+		hysteresis: newHysteresis(config.Threshold, config.ExitThreshold),
+		config:     config,
+		now:        time.Now,
+		services:   make(map[string]*efficiencyWindow),
+	}, nil
+}
+
+// Observe records a successful event's cost and, every EvaluateEvery events
+// for its service, compares the recent window against the baseline
+func (d *CostEfficiencyDetector) Observe(event TelemetryEvent) []Anomaly {
+	if event.ErrorCode != "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.services[event.ServiceName]
+	if !ok {
+		window = &efficiencyWindow{samples: make([]efficiencySample, 2*d.config.WindowSize)}
+		d.services[event.ServiceName] = window
+	}
+
+	window.lastSeen = d.now()
+	window.samples[window.next] = efficiencySample{cost: event.CostUsd, tokens: event.CompletionTokens}
+	window.next = (window.next + 1) % len(window.samples)
+	if window.count < len(window.samples) {
+		window.count++
+	}
+	window.sinceEval++
+
+	if !d.observe(event.ServiceName) || window.sinceEval < d.config.EvaluateEvery {
+		return nil
+	}
+	window.sinceEval = 0
+
+	efficiency, ok := d.compare(window)
+	if !ok || !d.update(event.ServiceName, efficiency.Change) {
+		window.streak = 0
+		return nil
+	}
+
+	window.streak++
+	if window.streak != d.config.SustainedEvaluations {
+		return nil
+	}
+
+	return []Anomaly{{
+		Type:        AnomalyCostEfficiency,
+		Score:       efficiency.Change,
+		Threshold:   d.config.Threshold,
+		ServiceName: event.ServiceName,
+		Description: fmt.Sprintf("%s %s rose %.0f%% from %.6g to %.6g over the last %d events",
+			event.ServiceName, d.config.Metric, efficiency.Change*100, efficiency.Before, efficiency.After, d.config.WindowSize),
+	}}
+}
+
+// Efficiency returns a service's current baseline and recent efficiency,
+// once it has observed enough events to fill both windows
+func (d *CostEfficiencyDetector) Efficiency(service string) (CostEfficiency, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window, ok := d.services[service]
+	if !ok || d.WarmingUp(service) {
+		return CostEfficiency{}, false
+	}
+	return d.compare(window)
+}
+
+// EvictIdle drops the state of services not observed since cutoff
+func (d *CostEfficiencyDetector) EvictIdle(cutoff time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted := 0
+	for service, window := range d.services {
+		if window.lastSeen.Before(cutoff) {
+			delete(d.services, service)
+			d.forget(service)
+			d.unflag(service)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// compare computes the metric over the baseline and recent halves of a
+// full window. It fails when the baseline is zero, e.g. for free models.
+func (d *CostEfficiencyDetector) compare(window *efficiencyWindow) (CostEfficiency, bool) {
+	if window.count < len(window.samples) {
+		return CostEfficiency{}, false
+	}
+
+	// window.next is the oldest sample once the ring is full
+	size := d.config.WindowSize
+	var halves [2]struct {
+		cost   float64
+		tokens int
+	}
+	for i := 0; i < len(window.samples); i++ {
+		sample := window.samples[(window.next+i)%len(window.samples)]
+		half := &halves[i/size]
+		half.cost += sample.cost
+		half.tokens += sample.tokens
+	}
+
+	metric := func(cost float64, tokens int) float64 {
+		if d.config.Metric == CostPerCompletionToken {
+			if tokens == 0 {
+				return 0
+			}
+			return cost / float64(tokens)
+		}
+		return cost / float64(size)
+	}
+
+	efficiency := CostEfficiency{
+		Before: metric(halves[0].cost, halves[0].tokens),
+		After:  metric(halves[1].cost, halves[1].tokens),
+	}
+	if efficiency.Before <= 0 {
+		return efficiency, false
+	}
+	efficiency.Change = efficiency.After/efficiency.Before - 1
+	return efficiency, true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// promptEvent is a successful call whose cost grows with its prompt
+func promptEvent(i, promptTokens int) TelemetryEvent {
+	event := testEvent(fmt.Sprintf("req-%d", i))
+	event.PromptTokens = promptTokens
+	event.CompletionTokens = 100
+	event.TotalTokens = promptTokens + 100
+	event.CostUsd = float64(promptTokens)*0.00003 + 100*0.00006
+	return event
+}
+
+func TestCostEfficiencyFlagsGrowingPrompts(t *testing.T) {
+	for _, metric := range []EfficiencyMetric{CostPerEvent, CostPerCompletionToken} {
+		detector, err := NewCostEfficiencyDetector(CostEfficiencyConfig{Metric: metric, WindowSize: 100, EvaluateEvery: 20})
+		if err != nil {
+			t.Fatalf("NewCostEfficiencyDetector: %v", err)
+		}
+
+		// A stable baseline with a little jitter raises nothing
+		i := 0
+		for ; i < 400; i++ {
+			if anomalies := detector.Observe(promptEvent(i, 500+i%7*10)); len(anomalies) != 0 {
+				t.Fatalf("%s: stable prompts flagged at event %d: %+v", metric, i, anomalies)
+			}
+		}
+
+		// Prompts then grow by a few tokens per call
+		var flagged []Anomaly
+		for prompt := 500; i < 800; i, prompt = i+1, prompt+3 {
+			flagged = append(flagged, detector.Observe(promptEvent(i, prompt))...)
+		}
+
+		if len(flagged) != 1 {
+			t.Fatalf("%s: flagged %d anomalies, want 1 per regression: %+v", metric, len(flagged), flagged)
+		}
+		anomaly := flagged[0]
+		if anomaly.Type != AnomalyCostEfficiency || anomaly.ServiceName != "chat-api" || anomaly.RequestID != "" {
+			t.Errorf("%s: anomaly = %+v, want an aggregate for chat-api", metric, anomaly)
+		}
+		if anomaly.Score <= 0.2 {
+			t.Errorf("%s: score = %.3f, want above the 0.2 threshold", metric, anomaly.Score)
+		}
+
+		efficiency, ok := detector.Efficiency("chat-api")
+		if !ok || efficiency.After <= efficiency.Before {
+			t.Errorf("%s: Efficiency = %+v, %v; want After above Before", metric, efficiency, ok)
+		}
+	}
+}
+
+func TestCostEfficiencyIgnoresFailedEvents(t *testing.T) {
+	detector, err := NewCostEfficiencyDetector(CostEfficiencyConfig{WindowSize: 10, EvaluateEvery: 5, SustainedEvaluations: 1})
+	if err != nil {
+		t.Fatalf("NewCostEfficiencyDetector: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		detector.Observe(promptEvent(i, 500))
+	}
+	for i := 20; i < 40; i++ {
+		event := promptEvent(i, 5000)
+		event.ErrorCode = "timeout"
+		if anomalies := detector.Observe(event); len(anomalies) != 0 {
+			t.Fatalf("failed event flagged: %+v", anomalies)
+		}
+	}
+
+	if efficiency, _ := detector.Efficiency("chat-api"); efficiency.Change != 0 {
+		t.Errorf("Change = %.3f after only failed events, want 0", efficiency.Change)
+	}
+}
+
+func TestNewCostEfficiencyDetectorRejectsUnknownMetric(t *testing.T) {
+	if _, err := NewCostEfficiencyDetector(CostEfficiencyConfig{Metric: "cost_per_vibe"}); err == nil {
+		t.Error("expected error for unknown metric")
+	}
+}
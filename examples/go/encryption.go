@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// EncryptionKeyIDKey is the metadata key naming the key an event's text fields are encrypted with
+const EncryptionKeyIDKey = "_encryption_key_id"
+
+// encryptedPrefix marks an encrypted field value
+const encryptedPrefix = "enc:v1:"
+
+// ErrUnknownKey is returned by a KeyProvider for a key id it does not have
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider returns the AES key (16, 24 or 32 bytes) for a key id. Keeping
+// retired keys available lets events encrypted before a rotation be read.
+type KeyProvider interface {
+	Key(keyID string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider backed by a map of key id to key
+type StaticKeys map[string][]byte
+
+// Key returns the key for keyID, or an error wrapping ErrUnknownKey
+func (k StaticKeys) Key(keyID string) ([]byte, error) {
+	key, ok := k[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return key, nil
+}
+
+// EncryptFields returns the event with PromptText and ResponseText encrypted
+// with AES-GCM under key, and keyID recorded in its metadata. The metadata
+// map is copied, so the caller's event is not modified.
+func EncryptFields(event TelemetryEvent, keyID string, key []byte) (TelemetryEvent, error) {
+	aead, err := newFieldCipher(key)
+	if err != nil {
+		return event, err
+	}
+
+	for _, field := range encryptedFields(&event) {
+		if *field.value == "" {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return event, fmt.Errorf("failed to encrypt %s: %w", field.name, err)
+		}
+		sealed := aead.Seal(nonce, nonce, []byte(*field.value), []byte(field.name))
+		*field.value = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata)+1)
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+	metadata[EncryptionKeyIDKey] = keyID
+	event.Metadata = metadata
+	return event, nil
+}
+
+// DecryptFields returns the event with its encrypted text fields decrypted.
+// Events without a key id in their metadata are returned unchanged.
+func DecryptFields(event TelemetryEvent, keys KeyProvider) (TelemetryEvent, error) {
+	keyID, ok := event.Metadata[EncryptionKeyIDKey].(string)
+	if !ok {
+		return event, nil
+	}
+
+	key, err := keys.Key(keyID)
+	if err != nil {
+		return event, err
+	}
+	aead, err := newFieldCipher(key)
+	if err != nil {
+		return event, err
+	}
+
+	for _, field := range encryptedFields(&event) {
+		if !strings.HasPrefix(*field.value, encryptedPrefix) {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*field.value, encryptedPrefix))
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return event, fmt.Errorf("malformed encrypted %s", field.name)
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(field.name))
+		if err != nil {
+			return event, fmt.Errorf("failed to decrypt %s with key %q: %w", field.name, keyID, err)
+		}
+		*field.value = string(plaintext)
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata))
+	for k, v := range event.Metadata {
+		if k != EncryptionKeyIDKey {
+			metadata[k] = v
+		}
+	}
+	event.Metadata = metadata
+	return event, nil
+}
+
+// DecryptingHandler returns a consumer handler that decrypts each event's
+// text fields before calling next; unencrypted events pass through. Events
+// that cannot be decrypted, e.g. because their key is missing or was
+// rotated away, are passed still encrypted to quarantine instead. Without
+// a quarantine handler they are logged to slog.Default() and skipped.
+func DecryptingHandler(keys KeyProvider, quarantine, next EventHandler) EventHandler {
+	return func(ctx context.Context, event TelemetryEvent) error {
+		decrypted, err := DecryptFields(event, keys)
+		if err != nil {
+			if quarantine == nil {
+				slog.Default().Warn("Skipping event that could not be decrypted", "request_id", event.RequestID, "error", err)
+				return nil
+			}
+			return quarantine(ctx, event)
+		}
+		return next(ctx, decrypted)
+	}
+}
+
+// encryptedField is a text field that is encrypted, named for authentication
+type encryptedField struct {
+	name  string
+	value *string
+}
+
+// encryptedFields returns the event's encrypted text fields
+func encryptedFields(event *TelemetryEvent) []encryptedField {
+	return []encryptedField{
+		{"prompt_text", &event.PromptText},
+		{"response_text", &event.ResponseText},
+	}
+}
+
+// newFieldCipher returns an AES-GCM cipher for key
+func newFieldCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyV1 = []byte("0123456789abcdef0123456789abcdef")
+	testKeyV2 = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	event := testEvent("req-1")
+	event.PromptText = "What is my account balance?"
+	event.ResponseText = "Your balance is $42."
+	event.Metadata = map[string]interface{}{"region": "us-east-1"}
+
+	encrypted, err := EncryptFields(event, "v1", testKeyV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted.PromptText, "balance") || strings.Contains(encrypted.ResponseText, "$42") {
+		t.Fatalf("text fields not encrypted: %q / %q", encrypted.PromptText, encrypted.ResponseText)
+	}
+	if _, ok := event.Metadata[EncryptionKeyIDKey]; ok {
+		t.Error("EncryptFields modified the caller's metadata")
+	}
+
+	// the event crosses Kafka as JSON
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var consumed TelemetryEvent
+	if err := json.Unmarshal(data, &consumed); err != nil {
+		t.Fatal(err)
+	}
+
+	var handled TelemetryEvent
+	handler := DecryptingHandler(StaticKeys{"v1": testKeyV1, "v2": testKeyV2}, nil, func(ctx context.Context, e TelemetryEvent) error {
+		handled = e
+		return nil
+	})
+	if err := handler(context.Background(), consumed); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled.PromptText != event.PromptText || handled.ResponseText != event.ResponseText {
+		t.Errorf("decrypted %q / %q, want the original text", handled.PromptText, handled.ResponseText)
+	}
+	if _, ok := handled.Metadata[EncryptionKeyIDKey]; ok || handled.Metadata["region"] != "us-east-1" {
+		t.Errorf("metadata = %v, want the original metadata", handled.Metadata)
+	}
+}
+
+func TestDecryptingHandlerPassesThroughPlainEvents(t *testing.T) {
+	event := testEvent("req-1")
+	event.PromptText = "hello"
+
+	var handled TelemetryEvent
+	handler := DecryptingHandler(StaticKeys{}, nil, func(ctx context.Context, e TelemetryEvent) error {
+		handled = e
+		return nil
+	})
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if handled.PromptText != "hello" {
+		t.Errorf("PromptText = %q, want it unchanged", handled.PromptText)
+	}
+}
+
+func TestDecryptingHandlerQuarantinesUndecryptableEvents(t *testing.T) {
+	event := testEvent("req-1")
+	event.PromptText = "secret"
+	rotatedAway, err := EncryptFields(event, "v1", testKeyV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := EncryptFields(event, "v2", testKeyV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := StaticKeys{"v2": testKeyV2}
+	var quarantined []TelemetryEvent
+	handler := DecryptingHandler(keys,
+		func(ctx context.Context, e TelemetryEvent) error {
+			quarantined = append(quarantined, e)
+			return nil
+		},
+		func(ctx context.Context, e TelemetryEvent) error {
+			t.Errorf("next called for undecryptable event %s", e.RequestID)
+			return nil
+		})
+
+	for _, e := range []TelemetryEvent{rotatedAway, wrongKey} {
+		if err := handler(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(quarantined) != 2 || quarantined[0].PromptText != rotatedAway.PromptText {
+		t.Errorf("quarantined %d events, want both still encrypted", len(quarantined))
+	}
+
+	if _, err := DecryptFields(rotatedAway, keys); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("DecryptFields with a missing key = %v, want ErrUnknownKey", err)
+	}
+}
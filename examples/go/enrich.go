@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned by a LookupSource for a key it has no entry for
+var ErrKeyNotFound = errors.New("lookup key not found")
+
+// LookupSource returns the fields to add to events for a key, such as the
+// plan tier and department of a user. Remote sources such as a CRM or a
+// user service implement it directly.
+type LookupSource interface {
+	Lookup(ctx context.Context, key string) (map[string]interface{}, error)
+}
+
+// StaticLookup is a LookupSource backed by a map of key to fields
+type StaticLookup map[string]map[string]interface{}
+
+// Lookup returns the fields for key, or an error wrapping ErrKeyNotFound
+func (s StaticLookup) Lookup(ctx context.Context, key string) (map[string]interface{}, error) {
+	fields, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	return fields, nil
+}
+
+// LoadLookupTable reads a StaticLookup from a JSON file mapping each key
+// to its fields:
+//
+//	{"user-1": {"plan": "enterprise", "department": "sales"}}
+func LoadLookupTable(path string) (StaticLookup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup table: %w", err)
+	}
+
+	var table StaticLookup
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse lookup table: %w", err)
+	}
+	return table, nil
+}
+
+// LookupEnricherConfig configures a LookupEnricher
+type LookupEnricherConfig struct {
+	// Source supplies the fields for each key
+	Source LookupSource
+	// KeyFunc derives the lookup key from an event (default: its UserID)
+	KeyFunc func(event TelemetryEvent) string
+	// CacheTTL is how long lookups, including misses, are cached; zero
+	// disables caching, which suits a StaticLookup (default: 0)
+	CacheTTL time.Duration
+}
+
+// LookupEnricher adds fields from a lookup table to each event's metadata,
+// e.g. to report by plan tier or department. Keys the source has no entry
+// for leave the event unchanged, and metadata the event already carries is
+// never overwritten.
+type LookupEnricher struct {
+	config LookupEnricherConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	cache     map[string]lookupEntry
+	lastSweep time.Time
+}
+
+// lookupEntry is a cached lookup; nil fields record a miss
+type lookupEntry struct {
+	fields  map[string]interface{}
+	expires time.Time
+}
+
+// NewLookupEnricher creates an enricher, applying defaults for zero config values
+func NewLookupEnricher(config LookupEnricherConfig) (*LookupEnricher, error) {
+	if config.Source == nil {
+		return nil, errors.New("lookup enricher requires a source")
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = func(event TelemetryEvent) string { return event.UserID }
+	}
+	return &LookupEnricher{config: config, now: time.Now, cache: make(map[string]lookupEntry)}, nil
+}
+
+// Enrich returns the event with its key's fields added to a copy of its
+// metadata. Events without a key, or whose key is missing from the source,
+// are returned unchanged; other lookup errors are returned with the event
+// unchanged, so the caller can decide whether to send it anyway.
+func (e *LookupEnricher) Enrich(ctx context.Context, event TelemetryEvent) (TelemetryEvent, error) {
+	if e == nil {
+		return event, nil
+	}
+	key := e.config.KeyFunc(event)
+	if key == "" {
+		return event, nil
+	}
+
+	fields, err := e.lookup(ctx, key)
+	if err != nil || len(fields) == 0 {
+		return event, err
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata)+len(fields))
+	for k, v := range fields {
+		metadata[k] = v
+	}
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+	event.Metadata = metadata
+	return event, nil
+}
+
+// lookup returns the fields for key from the cache or the source. A miss
+// returns nil fields and no error.
+func (e *LookupEnricher) lookup(ctx context.Context, key string) (map[string]interface{}, error) {
+	if e.config.CacheTTL > 0 {
+		e.mu.Lock()
+		entry, ok := e.cache[key]
+		e.mu.Unlock()
+		if ok && e.now().Before(entry.expires) {
+			return entry.fields, nil
+		}
+	}
+
+	fields, err := e.config.Source.Lookup(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		fields, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %q: %w", key, err)
+	}
+
+	if e.config.CacheTTL > 0 {
+		now := e.now()
+		e.mu.Lock()
+		// drop expired entries once per TTL so keys seen once do not accumulate
+		if now.Sub(e.lastSweep) >= e.config.CacheTTL {
+			e.lastSweep = now
+			for k, entry := range e.cache {
+				if !now.Before(entry.expires) {
+					delete(e.cache, k)
+				}
+			}
+		}
+		e.cache[key] = lookupEntry{fields: fields, expires: now.Add(e.config.CacheTTL)}
+		e.mu.Unlock()
+	}
+	return fields, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookupEnricherStaticTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	table := `{"user-1": {"plan": "enterprise", "department": "sales", "region": "eu-west-1"}}`
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := LoadLookupTable(path)
+	if err != nil {
+		t.Fatalf("LoadLookupTable: %v", err)
+	}
+	enricher, err := NewLookupEnricher(LookupEnricherConfig{Source: source})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"region": "us-east-1"}
+	enriched, err := enricher.Enrich(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Enrich: %v", err)
+	}
+	if enriched.Metadata["plan"] != "enterprise" || enriched.Metadata["department"] != "sales" {
+		t.Errorf("metadata = %v, want plan and department from the table", enriched.Metadata)
+	}
+	if enriched.Metadata["region"] != "us-east-1" {
+		t.Errorf("region = %v, want the event's own value kept", enriched.Metadata["region"])
+	}
+	if _, ok := event.Metadata["plan"]; ok {
+		t.Error("Enrich modified the caller's metadata")
+	}
+
+	unknown := testEvent("req-2")
+	unknown.UserID = "user-404"
+	enriched, err = enricher.Enrich(context.Background(), unknown)
+	if err != nil || len(enriched.Metadata) != 0 {
+		t.Errorf("Enrich(unknown user) = %v, %v, want the event unchanged", enriched.Metadata, err)
+	}
+}
+
+// countingSource counts lookups, answering from table
+type countingSource struct {
+	table   StaticLookup
+	lookups int
+	err     error
+}
+
+func (s *countingSource) Lookup(ctx context.Context, key string) (map[string]interface{}, error) {
+	s.lookups++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.table.Lookup(ctx, key)
+}
+
+func TestLookupEnricherCacheExpiry(t *testing.T) {
+	source := &countingSource{table: StaticLookup{"user-1": {"plan": "free"}}}
+	enricher, err := NewLookupEnricher(LookupEnricherConfig{Source: source, CacheTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	enricher.now = func() time.Time { return now }
+
+	enrich := func(userID string) TelemetryEvent {
+		t.Helper()
+		event := testEvent("req-1")
+		event.UserID = userID
+		enriched, err := enricher.Enrich(context.Background(), event)
+		if err != nil {
+			t.Fatalf("Enrich: %v", err)
+		}
+		return enriched
+	}
+
+	enrich("user-1")
+	enrich("user-404")
+	source.table["user-1"] = map[string]interface{}{"plan": "pro"}
+	now = now.Add(59 * time.Second)
+	if got := enrich("user-1").Metadata["plan"]; got != "free" {
+		t.Errorf("plan = %v, want the cached free", got)
+	}
+	enrich("user-404")
+	if source.lookups != 2 {
+		t.Fatalf("%d lookups, want 2 with hits and misses cached", source.lookups)
+	}
+
+	now = now.Add(time.Second)
+	if got := enrich("user-1").Metadata["plan"]; got != "pro" {
+		t.Errorf("plan = %v after the TTL, want the refreshed pro", got)
+	}
+	if source.lookups != 3 {
+		t.Errorf("%d lookups, want 3 after the entry expired", source.lookups)
+	}
+}
+
+func TestProducerSendsEventUnenrichedOnLookupError(t *testing.T) {
+	source := &countingSource{err: errTestBroker}
+	enricher, err := NewLookupEnricher(LookupEnricherConfig{Source: source, CacheTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.Enricher = enricher
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+	if _, err := enricher.Enrich(context.Background(), testEvent("req-2")); !errors.Is(err, errTestBroker) {
+		t.Errorf("Enrich = %v, want the source error, not a cached miss", err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.RequestID != "req-1" || len(sent.Metadata) != 0 {
+		t.Errorf("sent %s with metadata %v, want req-1 unenriched", sent.RequestID, sent.Metadata)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "sort"
+
+// SetFlag tags the event with an active feature flag, ignoring duplicates
+func (e *TelemetryEvent) SetFlag(flag string) {
+	if !e.HasFlag(flag) {
+		e.Flags = append(e.Flags, flag)
+	}
+}
+
+// ClearFlag removes a feature flag from the event
+func (e *TelemetryEvent) ClearFlag(flag string) {
+	for i, f := range e.Flags {
+		if f == flag {
+			e.Flags = append(e.Flags[:i:i], e.Flags[i+1:]...)
+			return
+		}
+	}
+}
+
+// HasFlag reports whether the event is tagged with the feature flag
+func (e TelemetryEvent) HasFlag(flag string) bool {
+	for _, f := range e.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// FlagMetrics summarizes the events tagged with one feature flag
+type FlagMetrics struct {
+	Flag         string  `json:"flag"`
+	Count        int     `json:"count"`
+	Errors       int     `json:"errors"`
+	TotalTokens  int     `json:"total_tokens"`
+	CostUsd      float64 `json:"cost_usd"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	AvgCostUsd   float64 `json:"avg_cost_usd"`
+	ErrorRate    float64 `json:"error_rate"`
+}
+
+// GroupByFlag computes per-flag metrics for comparing cohorts during a
+// rollout, sorted by flag. An event with several flags counts towards each
+// of them; events without flags are grouped under the empty flag as the
+// control cohort.
+func GroupByFlag(events []TelemetryEvent) []FlagMetrics {
+	groups := make(map[string]*FlagMetrics)
+	latencySum := make(map[string]float64)
+
+	add := func(flag string, event TelemetryEvent) {
+		m, ok := groups[flag]
+		if !ok {
+			m = &FlagMetrics{Flag: flag}
+			groups[flag] = m
+		}
+		m.Count++
+		if event.ErrorCode != "" {
+			m.Errors++
+		}
+		m.TotalTokens += event.TotalTokens
+		m.CostUsd += event.CostUsd
+		latencySum[flag] += event.LatencyMs
+	}
+
+	for _, event := range events {
+		if len(event.Flags) == 0 {
+			add("", event)
+		}
+		for _, flag := range event.Flags {
+			add(flag, event)
+		}
+	}
+
+	metrics := make([]FlagMetrics, 0, len(groups))
+	for flag, m := range groups {
+		count := float64(m.Count)
+		m.AvgLatencyMs = latencySum[flag] / count
+		m.AvgCostUsd = m.CostUsd / count
+		m.ErrorRate = float64(m.Errors) / count
+		metrics = append(metrics, *m)
+	}
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Flag < metrics[j].Flag })
+	return metrics
+}
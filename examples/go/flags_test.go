@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlagsSerialization(t *testing.T) {
+	event := testEvent("req-1")
+	data, _ := json.Marshal(event)
+	if strings.Contains(string(data), `"flags"`) {
+		t.Errorf("flags present for an untagged event: %s", data)
+	}
+
+	event.SetFlag("new-router")
+	event.SetFlag("streaming")
+	event.SetFlag("new-router")
+	data, _ = json.Marshal(event)
+	if !strings.Contains(string(data), `"flags":["new-router","streaming"]`) {
+		t.Errorf("flags not serialized once each: %s", data)
+	}
+
+	var decoded TelemetryEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !decoded.HasFlag("new-router") || !decoded.HasFlag("streaming") || decoded.HasFlag("other") {
+		t.Errorf("decoded flags = %v", decoded.Flags)
+	}
+
+	decoded.ClearFlag("new-router")
+	if decoded.HasFlag("new-router") || len(decoded.Flags) != 1 {
+		t.Errorf("flags after ClearFlag = %v, want [streaming]", decoded.Flags)
+	}
+}
+
+func TestGroupByFlag(t *testing.T) {
+	flagged := func(latency, cost float64, errorCode string, flags ...string) TelemetryEvent {
+		event := testEvent("req")
+		event.LatencyMs, event.CostUsd, event.ErrorCode, event.Flags = latency, cost, errorCode, flags
+		return event
+	}
+
+	metrics := GroupByFlag([]TelemetryEvent{
+		flagged(100, 0.01, ""),
+		flagged(300, 0.03, "timeout"),
+		flagged(50, 0.02, "", "new-router"),
+		flagged(70, 0.04, "", "new-router", "streaming"),
+	})
+
+	if len(metrics) != 3 {
+		t.Fatalf("got %d cohorts, want 3: %+v", len(metrics), metrics)
+	}
+
+	want := []FlagMetrics{
+		{Flag: "", Count: 2, Errors: 1, AvgLatencyMs: 200, AvgCostUsd: 0.02, ErrorRate: 0.5},
+		{Flag: "new-router", Count: 2, AvgLatencyMs: 60, AvgCostUsd: 0.03},
+		{Flag: "streaming", Count: 1, AvgLatencyMs: 70, AvgCostUsd: 0.04},
+	}
+	for i, w := range want {
+		got := metrics[i]
+		if got.Flag != w.Flag || got.Count != w.Count || got.Errors != w.Errors ||
+			math.Abs(got.AvgLatencyMs-w.AvgLatencyMs) > 1e-9 ||
+			math.Abs(got.AvgCostUsd-w.AvgCostUsd) > 1e-9 ||
+			got.ErrorRate != w.ErrorRate {
+			t.Errorf("cohort %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestAggregatorGroupByFlag(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	aggregator := newAggregator(AggregatorConfig{Window: time.Minute, GroupByFlag: true},
+		func() time.Time { return now })
+
+	control := testEvent("req-1")
+	treatment := testEvent("req-2")
+	treatment.SetFlag("new-router")
+	treatment.LatencyMs = 500
+	aggregator.Observe(control)
+	aggregator.Observe(treatment)
+	aggregator.Observe(treatment)
+
+	summaries := aggregator.Snapshot()
+	if len(summaries) != 2 {
+		t.Fatalf("got %d summaries, want 2: %+v", len(summaries), summaries)
+	}
+	if summaries[0].Flag != "" || summaries[0].Count != 1 || summaries[0].AvgLatencyMs != control.LatencyMs {
+		t.Errorf("control = %+v", summaries[0])
+	}
+	if summaries[1].Flag != "new-router" || summaries[1].Count != 2 || summaries[1].AvgLatencyMs != 500 {
+		t.Errorf("treatment = %+v", summaries[1])
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxIngestBodyBytes caps the size of a single ingestion request body;
+// larger bodies are answered with 413 Request Entity Too Large
+const maxIngestBodyBytes = 10 << 20
+
+// IngestResult reports the outcome for one element of a batched ingestion request
+type IngestResult struct {
+	Index    int    `json:"index"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// IngestResponse is the 207 Multi-Status body returned for batched ingestion
+type IngestResponse struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Results  []IngestResult `json:"results"`
+}
+
+// IngestHandler accepts telemetry events over HTTP and forwards them to Kafka
+type IngestHandler struct {
+	producer *TelemetryProducer
+
+	// TrackLineage appends the gateway stage to each accepted event's lineage trail (optional)
+	TrackLineage bool
+}
+
+// NewIngestHandler creates an HTTP handler that forwards events to the producer
+func NewIngestHandler(producer *TelemetryProducer) *IngestHandler {
+	return &IngestHandler{producer: producer}
+}
+
+// ServeHTTP accepts either a single event object or an array of events.
+// Arrays are answered with 207 Multi-Status and a per-element result so
+// clients can retry only the events that were rejected.
+func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		h.serveBatch(w, r, body)
+		return
+	}
+
+	var event TelemetryEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, fmt.Sprintf("invalid event: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := event.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.producer.SendEvent(r.Context(), h.stamp(event)); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, ErrFutureTimestamp) || errors.Is(err, ErrInvalidEvent) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveBatch validates and forwards each element of a JSON array independently
+func (h *IngestHandler) serveBatch(w http.ResponseWriter, r *http.Request, body []byte) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		http.Error(w, fmt.Sprintf("invalid batch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	resp := IngestResponse{Results: make([]IngestResult, len(raw))}
+	for i, element := range raw {
+		result := IngestResult{Index: i}
+
+		var event TelemetryEvent
+		if err := json.Unmarshal(element, &event); err != nil {
+			result.Error = fmt.Sprintf("invalid event: %v", err)
+		} else if err := event.Validate(); err != nil {
+			result.Error = err.Error()
+		} else if err := h.producer.SendEvent(r.Context(), h.stamp(event)); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Accepted = true
+		}
+
+		if result.Accepted {
+			resp.Accepted++
+		} else {
+			resp.Rejected++
+		}
+		resp.Results[i] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// stamp appends the gateway stage to the event's lineage when tracking is enabled
+func (h *IngestHandler) stamp(event TelemetryEvent) TelemetryEvent {
+	if !h.TrackLineage {
+		return event
+	}
+	return AppendLineage(event, LineageGateway, time.Now())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gatewayProducer returns a producer with NewTelemetryProducer's defaults,
+// including ValidateBeforeSend, writing to w
+func gatewayProducer(w *fakeWriter) *TelemetryProducer {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry")
+	p.writer.Close()
+	p.writer = w
+	return p
+}
+
+func TestIngestHandlerMixedBatch(t *testing.T) {
+	w := &fakeWriter{}
+	handler := NewIngestHandler(gatewayProducer(w))
+
+	body := `[
+		{"service_name":"chat-api","model_name":"gpt-4","request_id":"req-1","timestamp":"2024-01-15T10:00:00Z","prompt_tokens":10,"completion_tokens":20,"total_tokens":30},
+		{"service_name":"","model_name":"gpt-4","request_id":"req-2","timestamp":"2024-01-15T10:00:00Z"},
+		"not an event",
+		{"service_name":"chat-api","model_name":"claude-3-opus","request_id":"req-4","timestamp":"2024-01-15T10:00:01Z"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusMultiStatus)
+	}
+
+	var resp IngestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if resp.Accepted != 2 || resp.Rejected != 2 {
+		t.Errorf("accepted/rejected = %d/%d, want 2/2", resp.Accepted, resp.Rejected)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("got %d results, want 4", len(resp.Results))
+	}
+
+	wantAccepted := []bool{true, false, false, true}
+	for i, result := range resp.Results {
+		if result.Index != i {
+			t.Errorf("results[%d].Index = %d", i, result.Index)
+		}
+		if result.Accepted != wantAccepted[i] {
+			t.Errorf("results[%d].Accepted = %v, want %v", i, result.Accepted, wantAccepted[i])
+		}
+		if result.Accepted && result.Error != "" {
+			t.Errorf("results[%d] accepted with error %q", i, result.Error)
+		}
+		if !result.Accepted && result.Error == "" {
+			t.Errorf("results[%d] rejected without error", i)
+		}
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("forwarded %d messages, want 2", len(msgs))
+	}
+	if string(msgs[0].Key) != "req-1" || string(msgs[1].Key) != "req-4" {
+		t.Errorf("forwarded keys = %q, %q", msgs[0].Key, msgs[1].Key)
+	}
+}
+
+func TestIngestHandlerBatchSendFailure(t *testing.T) {
+	w := &fakeWriter{writeErr: errTestBroker}
+	handler := NewIngestHandler(gatewayProducer(w))
+
+	body := `[{"service_name":"chat-api","model_name":"gpt-4","request_id":"req-1","timestamp":"2024-01-15T10:00:00Z"}]`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body)))
+
+	var resp IngestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Results[0].Accepted || !strings.Contains(resp.Results[0].Error, "broker unavailable") {
+		t.Errorf("result = %+v, want rejection carrying the send error", resp.Results[0])
+	}
+}
+
+func TestIngestHandlerSingleEvent(t *testing.T) {
+	w := &fakeWriter{}
+	handler := NewIngestHandler(gatewayProducer(w))
+
+	body := `{"service_name":"chat-api","model_name":"gpt-4","request_id":"req-1","timestamp":"2024-01-15T10:00:00Z","prompt_tokens":10,"completion_tokens":20,"total_tokens":30}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body)))
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if len(w.Messages()) != 1 {
+		t.Errorf("forwarded %d messages, want 1", len(w.Messages()))
+	}
+}
+
+func TestIngestHandlerRejectsNonPost(t *testing.T) {
+	handler := NewIngestHandler(gatewayProducer(&fakeWriter{}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/events", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestIngestHandlerRejectsInvalidEvent(t *testing.T) {
+	w := &fakeWriter{}
+	handler := NewIngestHandler(gatewayProducer(w))
+
+	body := `{"service_name":"chat-api","model_name":"gpt-4","request_id":"req-1","timestamp":"2024-01-15T10:00:00Z","prompt_tokens":10}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body)))
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "total_tokens") {
+		t.Errorf("status = %d (%q), want %d naming total_tokens", rec.Code, rec.Body.String(), http.StatusBadRequest)
+	}
+	if len(w.Messages()) != 0 {
+		t.Errorf("forwarded %d messages, want none", len(w.Messages()))
+	}
+}
+
+func TestIngestHandlerRejectsOversizedBody(t *testing.T) {
+	w := &fakeWriter{}
+	handler := NewIngestHandler(gatewayProducer(w))
+
+	body := `[` + strings.Repeat(`{"service_name":"chat-api"},`, maxIngestBodyBytes/20) + `{}]`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body)))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if len(w.Messages()) != 0 {
+		t.Errorf("forwarded %d messages, want none", len(w.Messages()))
+	}
+}
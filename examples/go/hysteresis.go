@@ -0,0 +1,58 @@
+package main
+
+import "sync"
+
+// hysteresis keeps a key flagged from when its value rises above the enter
+// threshold until it falls to or below the lower exit threshold, so a value
+// oscillating between the two does not flap. Detectors embed it and pass
+// each new value to update; its Flagged method is promoted onto the detector.
+// With exit equal to enter it reduces to a single threshold.
+type hysteresis struct {
+	hystMu  sync.Mutex
+	enter   float64
+	exit    float64
+	flagged map[string]bool
+}
+
+// newHysteresis returns hysteresis between enter and exit. An exit of zero
+// or above enter is replaced by enter.
+func newHysteresis(enter, exit float64) hysteresis {
+	if exit <= 0 || exit > enter {
+		exit = enter
+	}
+	return hysteresis{enter: enter, exit: exit}
+}
+
+// update records key's latest value and reports whether it is flagged
+func (h *hysteresis) update(key string, value float64) bool {
+	h.hystMu.Lock()
+	defer h.hystMu.Unlock()
+
+	if h.flagged == nil {
+		h.flagged = make(map[string]bool)
+	}
+
+	switch {
+	case h.flagged[key] && value <= h.exit:
+		delete(h.flagged, key)
+	case !h.flagged[key] && value > h.enter:
+		h.flagged[key] = true
+	}
+	return h.flagged[key]
+}
+
+// unflag clears a key's state, for detectors that evict idle keys
+func (h *hysteresis) unflag(key string) {
+	h.hystMu.Lock()
+	defer h.hystMu.Unlock()
+
+	delete(h.flagged, key)
+}
+
+// Flagged reports whether key is currently flagged
+func (h *hysteresis) Flagged(key string) bool {
+	h.hystMu.Lock()
+	defer h.hystMu.Unlock()
+
+	return h.flagged[key]
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// transitions counts how often a sequence of flagged states changes
+func transitions(states []bool) int {
+	n := 0
+	for i := 1; i < len(states); i++ {
+		if states[i] != states[i-1] {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHysteresisHoldsBetweenThresholds(t *testing.T) {
+	h := newHysteresis(0.5, 0.2)
+	values := []float64{0.1, 0.6, 0.4, 0.55, 0.3, 0.45, 0.2, 0.4, 0.51}
+	want := []bool{false, true, true, true, true, true, false, false, true}
+
+	for i, value := range values {
+		if got := h.update("key", value); got != want[i] {
+			t.Errorf("update(%.2f) = %v, want %v", value, got, want[i])
+		}
+	}
+}
+
+func TestHysteresisDefaultsExitToEnter(t *testing.T) {
+	for _, exit := range []float64{0, 0.8} {
+		if h := newHysteresis(0.5, exit); h.exit != 0.5 {
+			t.Errorf("newHysteresis(0.5, %v).exit = %v, want 0.5", exit, h.exit)
+		}
+	}
+}
+
+func TestDegenerateDetectorDoesNotFlap(t *testing.T) {
+	// Four then two degenerate responses in every 10 and 20 events keep the
+	// rate oscillating between 0.2 and 0.4 around the 0.3 threshold
+	pattern := []bool{true, true, true, true, false, false, false, false, false, false,
+		true, true, false, false, false, false, false, false, false, false}
+
+	run := func(exit float64) []bool {
+		d := NewDegenerateResponseDetector(DegenerateResponseConfig{
+			WindowSize:        10,
+			MinSamples:        10,
+			RateThreshold:     0.3,
+			ExitRateThreshold: exit,
+		})
+
+		var states []bool
+		for i := 0; i < 100; i++ {
+			event := testEvent(fmt.Sprintf("req-%d", i))
+			if pattern[i%len(pattern)] {
+				event.CompletionTokens = 0
+			}
+			d.Observe(event)
+			if i >= 9 {
+				states = append(states, d.Flagged("gpt-4"))
+			}
+		}
+		return states
+	}
+
+	if n := transitions(run(0)); n < 4 {
+		t.Fatalf("single threshold changed state %d times, want the scenario to flap", n)
+	}
+
+	states := run(0.1)
+	if !states[0] || transitions(states) != 0 {
+		t.Errorf("with exit threshold 0.1 flagged states = %v, want flagged throughout", states)
+	}
+}
+
+func TestBurstDetectorDoesNotFlap(t *testing.T) {
+	d := NewBurstDetector(BurstConfig{Window: 10 * time.Second, MaxRequests: 5, ExitRequests: 2})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	// Six quick requests cross MaxRequests
+	ts := start
+	for i := 0; i < 6; i++ {
+		d.Observe(eventAt(fmt.Sprintf("req-%d", i), "session-1", ts))
+		ts = ts.Add(time.Second)
+	}
+	if !d.Flagged("session-1") {
+		t.Fatal("session not flagged after exceeding MaxRequests")
+	}
+
+	// One request every 2.5s keeps 4 in the window: between the thresholds
+	for i := 6; i < 20; i++ {
+		ts = ts.Add(2500 * time.Millisecond)
+		if anomalies := d.Observe(eventAt(fmt.Sprintf("req-%d", i), "session-1", ts)); len(anomalies) != 1 {
+			t.Fatalf("request %d: got %d anomalies, want the session to stay flagged", i, len(anomalies))
+		}
+	}
+
+	// One request every 6s leaves 2 in the window, ending the burst
+	for i := 20; i < 23; i++ {
+		ts = ts.Add(6 * time.Second)
+		d.Observe(eventAt(fmt.Sprintf("req-%d", i), "session-1", ts))
+	}
+	if d.Flagged("session-1") {
+		t.Error("session still flagged after falling to ExitRequests")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// IdempotencyKeyHeader is the Kafka header carrying an event's idempotency key
+const IdempotencyKeyHeader = "idempotency-key"
+
+// NewIdempotencyKey returns a random 128-bit key in hex
+func NewIdempotencyKey() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// withIdempotencyKey assigns the event a key unless it already has one.
+// Keys are kept once set, so every retry of the event, by the producer or
+// by a caller resending it, carries the same key and consumers can drop
+// the duplicates a partially acknowledged write leaves behind.
+func withIdempotencyKey(event TelemetryEvent) TelemetryEvent {
+	if event.IdempotencyKey == "" {
+		event.IdempotencyKey = NewIdempotencyKey()
+	}
+	return event
+}
+
+// idempotencyHeaders returns the headers identifying the event's logical send
+func idempotencyHeaders(event TelemetryEvent) []kafka.Header {
+	return []kafka.Header{{Key: IdempotencyKeyHeader, Value: []byte(event.IdempotencyKey)}}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// attemptWriter records the messages of every write attempt and fails the first failures
+type attemptWriter struct {
+	fakeWriter
+	failures int
+	attempts [][]kafka.Message
+}
+
+func (w *attemptWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.attempts = append(w.attempts, msgs)
+	if len(w.attempts) <= w.failures {
+		return kafka.NotLeaderForPartition
+	}
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func idempotencyKey(t *testing.T, msg kafka.Message) string {
+	t.Helper()
+	key, ok := messageHeader(msg, IdempotencyKeyHeader)
+	if !ok || key == "" {
+		t.Fatalf("message has no %s header", IdempotencyKeyHeader)
+	}
+	return key
+}
+
+func TestIdempotencyKeyStableAcrossRetries(t *testing.T) {
+	w := &attemptWriter{failures: 2}
+	producer := &TelemetryProducer{writer: w, Retry: RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}}
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if len(w.attempts) != 3 {
+		t.Fatalf("made %d attempts, want 3", len(w.attempts))
+	}
+	key := idempotencyKey(t, w.attempts[0][0])
+	for i, attempt := range w.attempts[1:] {
+		if got := idempotencyKey(t, attempt[0]); got != key {
+			t.Errorf("attempt %d key = %q, want %q", i+2, got, key)
+		}
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.IdempotencyKey != key || sent.RequestID != "req-1" {
+		t.Errorf("event idempotency_key = %q, want the header's %q", sent.IdempotencyKey, key)
+	}
+}
+
+func TestIdempotencyKeyKeptWhenResendingFailedEvent(t *testing.T) {
+	w := &attemptWriter{failures: 1}
+	producer := &TelemetryProducer{writer: w}
+
+	var failed TelemetryEvent
+	producer.OnPermanentFailure = func(event TelemetryEvent, err error) { failed = event }
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err == nil {
+		t.Fatal("expected first send to fail")
+	}
+	if err := producer.SendEvent(context.Background(), failed); err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+
+	if first, second := idempotencyKey(t, w.attempts[0][0]), idempotencyKey(t, w.attempts[1][0]); first != second {
+		t.Errorf("resent key = %q, want %q", second, first)
+	}
+}
+
+func TestIdempotencyKeyDistinctPerEvent(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+
+	// Same RequestID, different logical sends
+	for i := 0; i < 2; i++ {
+		if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := w.Messages()
+	if idempotencyKey(t, msgs[0]) == idempotencyKey(t, msgs[1]) {
+		t.Error("separate events share an idempotency key")
+	}
+}
+
+func TestDeserializerTakesIdempotencyKeyFromHeader(t *testing.T) {
+	value, err := json.Marshal(testEvent("req-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := kafka.Message{Value: value, Headers: []kafka.Header{{Key: IdempotencyKeyHeader, Value: []byte("abc")}}}
+
+	event, err := NewDeserializer().Deserialize(msg)
+	if err != nil || event.IdempotencyKey != "abc" {
+		t.Errorf("Deserialize = %q, %v; want key abc", event.IdempotencyKey, err)
+	}
+}
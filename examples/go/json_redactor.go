@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// redactedValue replaces the values of sensitive JSON keys
+const redactedValue = `"[REDACTED]"`
+
+// defaultSensitiveKeys are redacted when a JSONRedactor is created without keys
+var defaultSensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "access_token", "refresh_token",
+	"api_key", "authorization", "ssn", "credit_card", "card_number", "cvv",
+}
+
+// JSONRedactor redacts the values of sensitive keys in JSON found in prompt
+// and response text, preserving the surrounding structure. Text that is not
+// JSON, or only partly JSON, is also passed through Fallback, typically a
+// pattern-based redactor.
+type JSONRedactor struct {
+	keys map[string]struct{}
+	// Fallback redacts text that does not parse entirely as JSON (optional)
+	Fallback func(text string) string
+}
+
+// NewJSONRedactor creates a redactor for the given keys, which are matched
+// case-insensitively ignoring '_' and '-', so "api_key" also covers
+// "apiKey" and "API-Key". With no keys the defaults are used.
+func NewJSONRedactor(keys ...string) *JSONRedactor {
+	if len(keys) == 0 {
+		keys = defaultSensitiveKeys
+	}
+
+	r := &JSONRedactor{keys: make(map[string]struct{}, len(keys))}
+	for _, key := range keys {
+		r.keys[normalizeKey(key)] = struct{}{}
+	}
+	return r
+}
+
+// normalizeKey lowercases key and drops '_' and '-'
+func normalizeKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// RedactEvent returns the event with its prompt and response text redacted
+func (r *JSONRedactor) RedactEvent(event TelemetryEvent) TelemetryEvent {
+	event.PromptText = r.Redact(event.PromptText)
+	event.ResponseText = r.Redact(event.ResponseText)
+	return event
+}
+
+// Redact redacts sensitive values in text. If the whole text is JSON only
+// its sensitive values are replaced. Otherwise each JSON object embedded in
+// the text is redacted and the result is passed through Fallback.
+func (r *JSONRedactor) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+
+	data := []byte(text)
+	if redacted, n, ok := r.redactValue(data); ok && len(bytes.TrimSpace(data[n:])) == 0 {
+		return string(redacted) + string(data[n:])
+	}
+
+	var out bytes.Buffer
+	for len(data) > 0 {
+		start := bytes.IndexByte(data, '{')
+		if start < 0 {
+			out.Write(data)
+			break
+		}
+		out.Write(data[:start])
+
+		if redacted, n, ok := r.redactValue(data[start:]); ok {
+			out.Write(redacted)
+			data = data[start+n:]
+		} else {
+			out.WriteByte('{')
+			data = data[start+1:]
+		}
+	}
+
+	if r.Fallback != nil {
+		return r.Fallback(out.String())
+	}
+	return out.String()
+}
+
+// jsonFrame tracks the position within one JSON object or array
+type jsonFrame struct {
+	object    bool
+	expectKey bool
+}
+
+// redactValue parses the JSON object or array at the start of data and replaces the
+// values of sensitive keys. It returns the redacted value, the number of
+// bytes of data it spanned and whether data started with a valid value.
+func (r *JSONRedactor) redactValue(data []byte) ([]byte, int, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	type span struct{ start, end int64 }
+	var spans []span
+	var stack []jsonFrame
+
+	// valueDone marks the end of a value in the enclosing object, if any
+	valueDone := func() {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, 0, false
+		}
+		// only objects and arrays are treated as structured JSON
+		if _, ok := tok.(json.Delim); !ok && len(stack) == 0 {
+			return nil, 0, false
+		}
+
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				if n := len(stack); n > 0 && stack[n-1].object {
+					stack[n-1].expectKey = false
+				}
+				stack = append(stack, jsonFrame{object: delim == '{', expectKey: delim == '{'})
+			default:
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+		} else if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+			if _, sensitive := r.keys[normalizeKey(tok.(string))]; sensitive {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return nil, 0, false
+				}
+				end := dec.InputOffset()
+				spans = append(spans, span{end - int64(len(raw)), end})
+			} else {
+				stack[n-1].expectKey = false
+			}
+		} else {
+			valueDone()
+		}
+
+		if len(stack) == 0 {
+			break
+		}
+	}
+
+	end := int(dec.InputOffset())
+	var out bytes.Buffer
+	prev := int64(0)
+	for _, s := range spans {
+		out.Write(data[prev:s.start])
+		out.WriteString(redactedValue)
+		prev = s.end
+	}
+	out.Write(data[prev:end])
+	return out.Bytes(), end, true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONRedactorPreservesStructure(t *testing.T) {
+	r := NewJSONRedactor("password", "ssn", "api_key")
+
+	text := `{"user": "alice", "password": "hunter2", "profile": {"SSN": "123-45-6789", "age": 42,
+		"keys": [{"apiKey": {"id": 1}}, {"name": "ok"}]}, "note": "password"}`
+	got := r.Redact(text)
+
+	for _, secret := range []string{"hunter2", "123-45-6789", `"id"`} {
+		if strings.Contains(got, secret) {
+			t.Errorf("%s not redacted: %s", secret, got)
+		}
+	}
+
+	var decoded struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+		Profile  struct {
+			SSN  string `json:"SSN"`
+			Age  int    `json:"age"`
+			Keys []map[string]interface{}
+		} `json:"profile"`
+		Note string `json:"note"`
+	}
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("redacted text is not valid JSON: %v\n%s", err, got)
+	}
+	if decoded.User != "alice" || decoded.Profile.Age != 42 || decoded.Note != "password" {
+		t.Errorf("non-sensitive values changed: %s", got)
+	}
+	if decoded.Password != "[REDACTED]" || decoded.Profile.SSN != "[REDACTED]" || decoded.Profile.Keys[0]["apiKey"] != "[REDACTED]" {
+		t.Errorf("sensitive values = %+v", decoded)
+	}
+	if decoded.Profile.Keys[1]["name"] != "ok" {
+		t.Errorf("array elements changed: %s", got)
+	}
+}
+
+func TestJSONRedactorEmbeddedJSON(t *testing.T) {
+	r := NewJSONRedactor()
+	text := `Please log in with {"username": "bob", "password": "s3cret"} and reply {ok}.`
+
+	got := r.Redact(text)
+	want := `Please log in with {"username": "bob", "password": "[REDACTED]"} and reply {ok}.`
+	if got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+}
+
+func TestJSONRedactorFallsBackForNonJSON(t *testing.T) {
+	r := NewJSONRedactor()
+	r.Fallback = func(text string) string { return strings.ReplaceAll(text, "555-0100", "[PHONE]") }
+
+	if got := r.Redact("call me at 555-0100"); got != "call me at [PHONE]" {
+		t.Errorf("Redact = %q, want fallback applied", got)
+	}
+	if got := r.Redact(`"a quoted password: hunter2"`); got != `"a quoted password: hunter2"` {
+		t.Errorf("Redact = %q, want JSON string left to the fallback", got)
+	}
+
+	pure := `{"phone": "555-0100"}`
+	if got := r.Redact(pure); got != pure {
+		t.Errorf("Redact = %q, want pure JSON to skip the fallback", got)
+	}
+}
+
+func TestJSONRedactorRedactEvent(t *testing.T) {
+	event := testEvent("req-1")
+	event.PromptText = `{"token": "abc"}`
+	event.ResponseText = "plain text"
+
+	got := NewJSONRedactor().RedactEvent(event)
+	if got.PromptText != `{"token": "[REDACTED]"}` || got.ResponseText != "plain text" {
+		t.Errorf("RedactEvent = %q / %q", got.PromptText, got.ResponseText)
+	}
+}
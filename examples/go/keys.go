@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KeyFunc derives the Kafka message key for an event
+type KeyFunc func(event TelemetryEvent) []byte
+
+// RequestIDKey keys each message by its RequestID. This is the default and
+// spreads events evenly across partitions.
+func RequestIDKey(event TelemetryEvent) []byte {
+	return []byte(event.RequestID)
+}
+
+// UserIDKey keys each message by its UserID, keeping each user's events in
+// order on one partition. Heavy users can hotspot a partition; see KeySalter.
+func UserIDKey(event TelemetryEvent) []byte {
+	return []byte(event.UserID)
+}
+
+// CompactionKey keys each message by user and session. On a log-compacted
+// topic Kafka retains only the latest event per key, so the topic holds the
+// most recent state of every user session. A tombstone for the same key
+// removes that session's state entirely.
+func CompactionKey(event TelemetryEvent) []byte {
+	return []byte(event.UserID + "/" + event.SessionID)
+}
+
+// ContentKey keys each message by a hash of the prompt, model and user, so
+// retries of the same logical call share a key even when they carry a new
+// RequestID. On a log-compacted topic Kafka then retains only the latest
+// attempt of each call. Identical prompts sent deliberately by the same user
+// to the same model also share a key and compact away, so only use this
+// when that is acceptable. The prompt is identified by PromptHash, or by a
+// hash of PromptText when PromptHash is empty.
+func ContentKey(event TelemetryEvent) []byte {
+	h := sha256.New()
+	for _, part := range []string{promptDigest(event), event.ModelName, event.UserID} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil)))
+}
+
+// promptDigest identifies the event's prompt by its PromptHash, or by a
+// hash of its PromptText when PromptHash is empty
+func promptDigest(event TelemetryEvent) string {
+	if event.PromptHash != "" {
+		return event.PromptHash
+	}
+	sum := sha256.Sum256([]byte(event.PromptText))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionIDKey keys each message by its SessionID, keeping each session's
+// events in order on one partition
+func SessionIDKey(event TelemetryEvent) []byte {
+	return []byte(event.SessionID)
+}
+
+// WithKeyFunc keys messages with keyFunc instead of RequestIDKey and
+// partitions them by a hash of the key, unless WithBalancer is also given.
+// Keying by UserIDKey then keeps each user's events in order on one
+// partition.
+func WithKeyFunc(keyFunc KeyFunc) ProducerOption {
+	return func(c *writerConfig) {
+		c.keyFunc = keyFunc
+	}
+}
+
+// messageKey returns the key for an event using the producer's KeyFunc
+func (p *TelemetryProducer) messageKey(event TelemetryEvent) []byte {
+	if p.KeyFunc == nil {
+		return RequestIDKey(event)
+	}
+	return p.KeyFunc(event)
+}
+
+// SendTombstone writes a message with a nil value for key. On a
+// log-compacted topic this deletes all retained state for the key. The
+// tombstone is written under the producer's write policy, like an event:
+// Retry, PerEventTimeout, the circuit breaker and the sent and failed
+// counters and metrics all apply.
+func (p *TelemetryProducer) SendTombstone(ctx context.Context, key []byte) error {
+	if len(key) == 0 {
+		return errors.New("tombstone requires a non-empty key")
+	}
+
+	msg := kafka.Message{
+		Key:   key,
+		Value: nil,
+		Time:  time.Now(),
+	}
+
+	if err := p.sendRaw(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send tombstone: %w", err)
+	}
+
+	return nil
+}
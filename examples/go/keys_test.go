@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestSendEventUsesKeyFunc(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.KeyFunc = CompactionKey
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	msgs := w.Messages()
+	if got := string(msgs[0].Key); got != "user-1/session-1" {
+		t.Errorf("key = %q, want %q", got, "user-1/session-1")
+	}
+}
+
+func TestWithKeyFuncKeysByUser(t *testing.T) {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithKeyFunc(UserIDKey))
+	if _, ok := p.writer.(*kafka.Writer).Balancer.(*kafka.Hash); !ok {
+		t.Errorf("Balancer = %T, want *kafka.Hash to partition by key", p.writer.(*kafka.Writer).Balancer)
+	}
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	first, second := testEvent("req-1"), testEvent("req-2")
+	second.SessionID = "session-2"
+	if err := p.SendEvents(context.Background(), []TelemetryEvent{first, second}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := w.Messages()
+	if string(msgs[0].Key) != "user-1" || !bytes.Equal(msgs[0].Key, msgs[1].Key) {
+		t.Errorf("keys = %q and %q, want both user-1", msgs[0].Key, msgs[1].Key)
+	}
+}
+
+func TestSendEventDefaultsToRequestIDKey(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if got := string(w.Messages()[0].Key); got != "req-1" {
+		t.Errorf("key = %q, want %q", got, "req-1")
+	}
+}
+
+func TestContentKeyIdenticalForRetries(t *testing.T) {
+	first := testEvent("req-1")
+	first.PromptText = "Summarize this document"
+	retry := first
+	retry.RequestID = "req-2"
+	retry.Timestamp = "2024-01-15T10:30:47Z"
+	retry.LatencyMs = 2345.6
+
+	if a, b := string(ContentKey(first)), string(ContentKey(retry)); a != b {
+		t.Errorf("retry key = %q, want %q", b, a)
+	}
+
+	for name, change := range map[string]func(*TelemetryEvent){
+		"prompt":      func(e *TelemetryEvent) { e.PromptText = "Translate this document" },
+		"model":       func(e *TelemetryEvent) { e.ModelName = "gpt-3.5-turbo" },
+		"user":        func(e *TelemetryEvent) { e.UserID = "user-2" },
+		"prompt hash": func(e *TelemetryEvent) { e.PromptHash = "abc123" },
+	} {
+		other := first
+		change(&other)
+		if string(ContentKey(other)) == string(ContentKey(first)) {
+			t.Errorf("changing %s did not change the key", name)
+		}
+	}
+}
+
+func TestSendTombstone(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	key := CompactionKey(testEvent("req-1"))
+
+	if err := producer.SendTombstone(context.Background(), key); err != nil {
+		t.Fatalf("SendTombstone: %v", err)
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("wrote %d messages, want 1", len(msgs))
+	}
+	if string(msgs[0].Key) != string(key) {
+		t.Errorf("key = %q, want %q", msgs[0].Key, key)
+	}
+	if msgs[0].Value != nil {
+		t.Errorf("value = %q, want nil", msgs[0].Value)
+	}
+}
+
+func TestSendTombstoneAppliesWritePolicy(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.LeaderNotAvailable}}
+	producer := &TelemetryProducer{writer: w, Retry: RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}}
+	producer.valueCodec = &valueCodec{name: "dict-deflate", codec: dictCodec{dict: []byte(`"user_id":`)}}
+
+	if err := producer.SendTombstone(context.Background(), []byte("user-1")); err != nil {
+		t.Fatalf("SendTombstone = %v, want the leader election retried", err)
+	}
+	if msgs := w.Messages(); len(msgs) != 1 || msgs[0].Value != nil {
+		t.Fatalf("wrote %+v, want one tombstone with a nil value", msgs)
+	}
+	if report := producer.Report(); report.Sent != 1 {
+		t.Errorf("Report() = %+v, want the tombstone counted as sent", report)
+	}
+
+	w.errs, w.calls = []error{kafka.TopicAuthorizationFailed}, 0
+	if err := producer.SendTombstone(context.Background(), []byte("user-2")); !errors.Is(err, kafka.TopicAuthorizationFailed) {
+		t.Errorf("SendTombstone = %v, want the authorization failure", err)
+	}
+	if report := producer.Report(); report.Failed != 1 {
+		t.Errorf("Failed = %d, want 1", report.Failed)
+	}
+}
+
+func TestSendTombstoneRequiresKey(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	if err := producer.SendTombstone(context.Background(), nil); err == nil {
+		t.Error("expected error for empty key")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Leaderboard ranks the top spenders of one window by cost
+type Leaderboard struct {
+	WindowStart string `json:"window_start"`
+	WindowEnd   string `json:"window_end"`
+	// Final is set once the window has ended; live snapshots of the
+	// current window leave it unset
+	Final   bool        `json:"final"`
+	Entries []TopNEntry `json:"entries"`
+}
+
+// LeaderboardEmitter publishes leaderboards
+type LeaderboardEmitter interface {
+	EmitLeaderboard(ctx context.Context, leaderboard Leaderboard) error
+}
+
+// LeaderboardEmitterFunc adapts a callback to a LeaderboardEmitter
+type LeaderboardEmitterFunc func(ctx context.Context, leaderboard Leaderboard) error
+
+// EmitLeaderboard calls f
+func (f LeaderboardEmitterFunc) EmitLeaderboard(ctx context.Context, leaderboard Leaderboard) error {
+	return f(ctx, leaderboard)
+}
+
+// LeaderboardConfig configures a LeaderboardSink
+type LeaderboardConfig struct {
+	// N is the number of top spenders ranked (default: 10)
+	N int
+	// Capacity is the number of counters kept (default: 10 * N)
+	Capacity int
+	// Window is the tumbling window each leaderboard covers (default: 1h)
+	Window time.Duration
+	// Dimension is who is ranked (default: user)
+	Dimension TopNDimension
+	// Emitter receives each finished window's leaderboard
+	Emitter LeaderboardEmitter
+	// Interval also emits a live snapshot of the current window this often
+	// (optional)
+	Interval time.Duration
+}
+
+// LeaderboardSink is a Sink maintaining a rolling leaderboard of the top
+// spenders per window, for a live view of cost drivers. It ranks with a
+// TopNTracker, so windows follow event timestamps and ties are broken by
+// key. When an event starts a new window, the finished window's leaderboard
+// is emitted; Close emits the window in progress.
+type LeaderboardSink struct {
+	// mu serializes Writes, so a finished window is ranked before the
+	// tracker moves on to the next
+	mu      sync.Mutex
+	config  LeaderboardConfig
+	tracker *TopNTracker
+	closed  bool
+
+	// emitMu serializes emits; lastFinal is the start of the latest window
+	// emitted as final, so a snapshot of it taken earlier is dropped
+	emitMu    sync.Mutex
+	lastFinal time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewLeaderboardSink creates a sink, applying defaults for zero config
+// values, and starts its snapshot ticker when Interval is set
+func NewLeaderboardSink(config LeaderboardConfig) (*LeaderboardSink, error) {
+	if config.Emitter == nil {
+		return nil, errors.New("leaderboard sink requires an emitter")
+	}
+	if config.Window <= 0 {
+		config.Window = time.Hour
+	}
+
+	tracker, err := NewTopNTracker(TopNConfig{
+		N:         config.N,
+		Capacity:  config.Capacity,
+		Window:    config.Window,
+		Dimension: config.Dimension,
+		Metric:    MetricCost,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &LeaderboardSink{config: config, tracker: tracker, done: make(chan struct{})}
+	if config.Interval > 0 {
+		s.wg.Add(1)
+		go s.run()
+	}
+	return s, nil
+}
+
+// Write adds the events' cost to the leaderboard, emitting the leaderboard
+// of each window the events move past
+func (s *LeaderboardSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSinkClosed
+	}
+
+	var finished []Leaderboard
+	for _, event := range events {
+		current := s.tracker.WindowStart()
+		if !current.IsZero() && eventTime(event).Truncate(s.config.Window).After(current) {
+			finished = append(finished, s.leaderboardLocked(true))
+		}
+		s.tracker.Observe(event)
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, leaderboard := range finished {
+		errs = append(errs, s.emit(ctx, leaderboard))
+	}
+	return errors.Join(errs...)
+}
+
+// Leaderboard returns a live snapshot of the current window
+func (s *LeaderboardSink) Leaderboard() Leaderboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.leaderboardLocked(false)
+}
+
+// Close stops the snapshot ticker and emits the window in progress
+func (s *LeaderboardSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	leaderboard := s.leaderboardLocked(true)
+	s.mu.Unlock()
+
+	if len(leaderboard.Entries) == 0 {
+		return nil
+	}
+	return s.emit(context.Background(), leaderboard)
+}
+
+// run emits a snapshot of the current window every Interval until Close
+func (s *LeaderboardSink) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if leaderboard := s.Leaderboard(); len(leaderboard.Entries) > 0 {
+				s.emit(context.Background(), leaderboard)
+			}
+		}
+	}
+}
+
+// leaderboardLocked ranks the tracker's current window
+func (s *LeaderboardSink) leaderboardLocked(final bool) Leaderboard {
+	leaderboard := Leaderboard{Final: final, Entries: s.tracker.TopN()}
+	if start := s.tracker.WindowStart(); !start.IsZero() {
+		leaderboard.WindowStart = start.Format(time.RFC3339)
+		leaderboard.WindowEnd = start.Add(s.config.Window).Format(time.RFC3339)
+	}
+	return leaderboard
+}
+
+// emit passes the leaderboard to the emitter, logging failures. A live
+// snapshot of a window no newer than the last finalized one is stale, as
+// the ticker may rank a window just before Write or Close finishes it, and
+// is dropped.
+func (s *LeaderboardSink) emit(ctx context.Context, leaderboard Leaderboard) error {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+
+	start, _ := time.Parse(time.RFC3339, leaderboard.WindowStart)
+	if !leaderboard.Final && !s.lastFinal.IsZero() && !start.After(s.lastFinal) {
+		return nil
+	}
+	if leaderboard.Final && start.After(s.lastFinal) {
+		s.lastFinal = start
+	}
+
+	if err := s.config.Emitter.EmitLeaderboard(ctx, leaderboard); err != nil {
+		log.Printf("Failed to emit leaderboard for window %s: %v", leaderboard.WindowStart, err)
+		return err
+	}
+	return nil
+}
+
+// KafkaLeaderboardEmitter publishes leaderboards to a Kafka topic, keyed by
+// window start so a compacted topic keeps the latest snapshot of each window
+type KafkaLeaderboardEmitter struct {
+	kafkaEmitter
+}
+
+// NewKafkaLeaderboardEmitter creates an emitter writing leaderboards to
+// topic. opts configure its producer as they do for NewTelemetryProducer.
+func NewKafkaLeaderboardEmitter(brokers []string, topic string, opts ...ProducerOption) *KafkaLeaderboardEmitter {
+	return &KafkaLeaderboardEmitter{newKafkaEmitter(brokers, topic, opts...)}
+}
+
+// EmitLeaderboard writes the leaderboard as one JSON message
+func (e *KafkaLeaderboardEmitter) EmitLeaderboard(ctx context.Context, leaderboard Leaderboard) error {
+	value, err := json.Marshal(leaderboard)
+	if err != nil {
+		return fmt.Errorf("failed to marshal leaderboard: %w", err)
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(leaderboard.WindowStart),
+		Value: value,
+		Time:  time.Now(),
+	}
+	if err := e.producer.sendRaw(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send leaderboard: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// recordingEmitter keeps the leaderboards it is given
+type recordingEmitter struct {
+	mu           sync.Mutex
+	leaderboards []Leaderboard
+}
+
+func (e *recordingEmitter) EmitLeaderboard(ctx context.Context, leaderboard Leaderboard) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leaderboards = append(e.leaderboards, leaderboard)
+	return nil
+}
+
+func (e *recordingEmitter) Leaderboards() []Leaderboard {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Leaderboard(nil), e.leaderboards...)
+}
+
+func spendAt(userID string, cost float64, ts time.Time) TelemetryEvent {
+	event := testEvent("req-" + userID)
+	event.UserID = userID
+	event.CostUsd = cost
+	event.Timestamp = ts.Format(time.RFC3339Nano)
+	return event
+}
+
+func leaderboardKeys(leaderboard Leaderboard) []string {
+	keys := make([]string, len(leaderboard.Entries))
+	for i, entry := range leaderboard.Entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+func TestLeaderboardSinkRanksSpendAcrossWindows(t *testing.T) {
+	emitter := &recordingEmitter{}
+	sink, err := NewLeaderboardSink(LeaderboardConfig{N: 2, Window: time.Hour, Emitter: emitter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	err = sink.Write(context.Background(), []TelemetryEvent{
+		spendAt("user-a", 1.00, start),
+		spendAt("user-b", 3.00, start.Add(time.Minute)),
+		spendAt("user-c", 0.50, start.Add(2*time.Minute)),
+		spendAt("user-a", 1.50, start.Add(3*time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	live := sink.Leaderboard()
+	if got := leaderboardKeys(live); len(got) != 2 || got[0] != "user-b" || got[1] != "user-a" {
+		t.Fatalf("live leaderboard = %v, want user-b then user-a", got)
+	}
+	if live.Final || live.Entries[1].Value != 2.50 || len(emitter.Leaderboards()) != 0 {
+		t.Errorf("live leaderboard = %+v with %d emitted, want user-a at 2.50 and nothing emitted yet",
+			live, len(emitter.Leaderboards()))
+	}
+
+	// the next hour's spend finishes the first window
+	next := start.Add(time.Hour)
+	if err := sink.Write(context.Background(), []TelemetryEvent{spendAt("user-c", 5.00, next)}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	emitted := emitter.Leaderboards()
+	if len(emitted) != 1 || !emitted[0].Final || emitted[0].WindowStart != "2024-01-15T10:00:00Z" || emitted[0].WindowEnd != "2024-01-15T11:00:00Z" {
+		t.Fatalf("emitted %+v, want the final 10:00-11:00 leaderboard", emitted)
+	}
+	if got := leaderboardKeys(emitted[0]); got[0] != "user-b" || got[1] != "user-a" {
+		t.Errorf("first window = %v, want user-b then user-a", got)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	emitted = emitter.Leaderboards()
+	if len(emitted) != 2 || !emitted[1].Final || emitted[1].WindowStart != "2024-01-15T11:00:00Z" {
+		t.Fatalf("emitted %+v, want the second window flushed on Close", emitted)
+	}
+	if got := leaderboardKeys(emitted[1]); len(got) != 1 || got[0] != "user-c" {
+		t.Errorf("second window = %v, want only user-c", got)
+	}
+	if err := sink.Write(context.Background(), []TelemetryEvent{spendAt("user-a", 1, next)}); err != ErrSinkClosed {
+		t.Errorf("Write after Close = %v, want ErrSinkClosed", err)
+	}
+}
+
+func TestLeaderboardSinkBreaksTiesByKey(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	for _, order := range [][]string{{"user-c", "user-a", "user-b"}, {"user-b", "user-c", "user-a"}} {
+		sink, err := NewLeaderboardSink(LeaderboardConfig{N: 3, Emitter: &recordingEmitter{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range order {
+			sink.Write(context.Background(), []TelemetryEvent{spendAt(user, 2.00, start)})
+		}
+
+		if got := leaderboardKeys(sink.Leaderboard()); got[0] != "user-a" || got[1] != "user-b" || got[2] != "user-c" {
+			t.Errorf("leaderboard for arrival order %v = %v, want ties ranked by key", order, got)
+		}
+		sink.Close()
+	}
+}
+
+func TestLeaderboardSinkEmitsLiveSnapshots(t *testing.T) {
+	snapshots := make(chan Leaderboard, 10)
+	sink, err := NewLeaderboardSink(LeaderboardConfig{
+		Interval: 10 * time.Millisecond,
+		Emitter: LeaderboardEmitterFunc(func(ctx context.Context, leaderboard Leaderboard) error {
+			snapshots <- leaderboard
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	sink.Write(context.Background(), []TelemetryEvent{spendAt("user-a", 1.00, time.Now())})
+
+	select {
+	case snapshot := <-snapshots:
+		if snapshot.Final || len(snapshot.Entries) != 1 || snapshot.Entries[0].Key != "user-a" {
+			t.Errorf("snapshot = %+v, want a live ranking of user-a", snapshot)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no snapshot emitted")
+	}
+}
+
+func TestLeaderboardSinkDropsSnapshotsOfFinishedWindows(t *testing.T) {
+	emitter := &recordingEmitter{}
+	sink, err := NewLeaderboardSink(LeaderboardConfig{Emitter: emitter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	sink.Write(context.Background(), []TelemetryEvent{spendAt("user-a", 1.00, start)})
+	stale := sink.Leaderboard()
+	sink.Write(context.Background(), []TelemetryEvent{spendAt("user-a", 1.00, start.Add(time.Hour))})
+	live := sink.Leaderboard()
+
+	// the ticker ranked the first window before Write finished it
+	sink.emit(context.Background(), stale)
+	sink.emit(context.Background(), live)
+
+	got := emitter.Leaderboards()
+	if len(got) != 2 || !got[0].Final || got[1].Final || got[1].WindowStart != live.WindowStart {
+		t.Errorf("emitted %+v, want the final first window and the live second one", got)
+	}
+	sink.Close()
+}
+
+func TestKafkaLeaderboardEmitterAppliesProducerOptions(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.LeaderNotAvailable}}
+	emitter := NewKafkaLeaderboardEmitter([]string{"localhost:9092"}, "llm.leaderboard",
+		WithRetry(RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}))
+	emitter.producer.writer.Close()
+	emitter.producer.writer = w
+
+	leaderboard := Leaderboard{WindowStart: "2024-01-15T10:00:00Z", Final: true}
+	if err := emitter.EmitLeaderboard(context.Background(), leaderboard); err != nil {
+		t.Fatalf("EmitLeaderboard = %v, want the leader election retried", err)
+	}
+	msgs := w.Messages()
+	if len(msgs) != 1 || string(msgs[0].Key) != leaderboard.WindowStart {
+		t.Fatalf("sent keys %v, want the window start", messageKeys(msgs))
+	}
+	var got Leaderboard
+	if err := json.Unmarshal(msgs[0].Value, &got); err != nil || !got.Final {
+		t.Errorf("sent %s (%v), want the final leaderboard", msgs[0].Value, err)
+	}
+
+	if err := emitter.Close(); err != nil || !w.closed {
+		t.Errorf("Close = %v (writer closed %v), want the producer shut down", err, w.closed)
+	}
+}
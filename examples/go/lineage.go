@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LineageKey is the metadata key holding an event's lineage trail
+const LineageKey = "_lineage"
+
+// Lineage stages recorded by this package; other stages, such as an
+// enricher, may append their own names
+const (
+	LineageGateway  = "gateway"
+	LineageProducer = "producer"
+)
+
+// LineageEntry records that an event passed through a stage
+type LineageEntry struct {
+	Stage string    `json:"stage"`
+	At    time.Time `json:"at"`
+}
+
+// StageDuration is the time an event took to reach a stage from the stage before it
+type StageDuration struct {
+	Stage    string        `json:"stage"`
+	Duration time.Duration `json:"duration"`
+}
+
+// AppendLineage returns the event with stage appended to metadata["_lineage"].
+// The metadata map is copied, so the caller's event is not modified. A
+// trail that cannot be read is replaced by a new one.
+func AppendLineage(event TelemetryEvent, stage string, at time.Time) TelemetryEvent {
+	trail, _ := Lineage(event)
+	trail = append(trail, LineageEntry{Stage: stage, At: at.UTC()})
+
+	metadata := make(map[string]interface{}, len(event.Metadata)+1)
+	for key, value := range event.Metadata {
+		metadata[key] = value
+	}
+	metadata[LineageKey] = trail
+	event.Metadata = metadata
+	return event
+}
+
+// Lineage returns the event's lineage trail in the order stages were
+// appended, or nil when it has none. It reads the trail whether it was
+// appended in this process or decoded from JSON.
+func Lineage(event TelemetryEvent) ([]LineageEntry, error) {
+	value, ok := event.Metadata[LineageKey]
+	if !ok {
+		return nil, nil
+	}
+	if trail, ok := value.([]LineageEntry); ok {
+		return append([]LineageEntry(nil), trail...), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lineage: %w", err)
+	}
+	var trail []LineageEntry
+	if err := json.Unmarshal(data, &trail); err != nil {
+		return nil, fmt.Errorf("invalid lineage: %w", err)
+	}
+	return trail, nil
+}
+
+// LineageDurations returns the time between each stage and the one before
+// it. The first stage has no predecessor and is omitted.
+func LineageDurations(trail []LineageEntry) []StageDuration {
+	if len(trail) < 2 {
+		return nil
+	}
+
+	durations := make([]StageDuration, 0, len(trail)-1)
+	for i := 1; i < len(trail); i++ {
+		durations = append(durations, StageDuration{
+			Stage:    trail[i].Stage,
+			Duration: trail[i].At.Sub(trail[i-1].At),
+		})
+	}
+	return durations
+}
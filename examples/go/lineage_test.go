@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeMessage decodes the i-th message written to w
+func decodeMessage(t *testing.T, w *fakeWriter, i int) TelemetryEvent {
+	t.Helper()
+	msgs := w.Messages()
+	if len(msgs) <= i {
+		t.Fatalf("got %d messages, want more than %d", len(msgs), i)
+	}
+	var event TelemetryEvent
+	if err := json.Unmarshal(msgs[i].Value, &event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestLineageAppendsStagesInOrder(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+	event := testEvent("req-1")
+	event = AppendLineage(event, LineageGateway, start)
+
+	// the enricher runs in another process, so the trail crosses JSON
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hop TelemetryEvent
+	if err := json.Unmarshal(data, &hop); err != nil {
+		t.Fatal(err)
+	}
+	hop = AppendLineage(hop, "enricher", start.Add(40*time.Millisecond))
+
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.TrackLineage = true
+	if err := producer.SendEvent(context.Background(), hop); err != nil {
+		t.Fatal(err)
+	}
+
+	trail, err := Lineage(decodeMessage(t, w, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stages []string
+	for _, entry := range trail {
+		stages = append(stages, entry.Stage)
+	}
+	if got := strings.Join(stages, ","); got != "gateway,enricher,producer" {
+		t.Fatalf("stages = %s, want gateway,enricher,producer", got)
+	}
+
+	durations := LineageDurations(trail)
+	if len(durations) != 2 || durations[0].Stage != "enricher" || durations[0].Duration != 40*time.Millisecond {
+		t.Errorf("durations = %+v, want enricher after 40ms, then producer", durations)
+	}
+	if _, ok := event.Metadata[LineageKey]; !ok || len(hop.Metadata[LineageKey].([]LineageEntry)) != 2 {
+		t.Errorf("earlier copies were modified by later stages")
+	}
+}
+
+func TestIngestHandlerTracksLineage(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.TrackLineage = true
+	handler := NewIngestHandler(producer)
+	handler.TrackLineage = true
+
+	body := `{"service_name":"chat-api","model_name":"gpt-4","request_id":"req-1","timestamp":"2024-01-15T10:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	trail, err := Lineage(decodeMessage(t, w, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 2 || trail[0].Stage != LineageGateway || trail[1].Stage != LineageProducer {
+		t.Fatalf("lineage = %+v, want gateway then producer", trail)
+	}
+	if trail[1].At.Before(trail[0].At) {
+		t.Errorf("producer stamped at %s, before gateway at %s", trail[1].At, trail[0].At)
+	}
+}
+
+func TestLineageIsOptIn(t *testing.T) {
+	w := &fakeWriter{}
+	if err := newTestProducer(w).SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decodeMessage(t, w, 0).Metadata[LineageKey]; ok {
+		t.Error("lineage recorded without TrackLineage")
+	}
+}
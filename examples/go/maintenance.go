@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MaintenanceWindow is a period, such as planned maintenance or a load test,
+// during which anomalies are still detected but not actioned
+type MaintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Services limits the window to anomalies of these services (default: all)
+	Services []string `json:"services,omitempty"`
+	// Models limits the window to anomalies of these models (default: all)
+	Models []string `json:"models,omitempty"`
+	// Reason is a note for operators, e.g. a change ticket
+	Reason string `json:"reason,omitempty"`
+}
+
+// covers reports whether the window is open at the given time and matches
+// the anomaly's service and model
+func (w MaintenanceWindow) covers(anomaly Anomaly, at time.Time) bool {
+	if at.Before(w.Start) || !at.Before(w.End) {
+		return false
+	}
+	return matchesAny(w.Services, anomaly.ServiceName) && matchesAny(w.Models, anomaly.ModelName)
+}
+
+// matchesAny reports whether value is in values, or values is empty
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceSchedule holds maintenance windows. Assign it to an
+// ActionPipeline to suppress actions for anomalies inside a window.
+type MaintenanceSchedule struct {
+	Windows []MaintenanceWindow `json:"windows"`
+
+	now func() time.Time
+}
+
+// NewMaintenanceSchedule creates a schedule of the windows
+func NewMaintenanceSchedule(windows ...MaintenanceWindow) *MaintenanceSchedule {
+	return &MaintenanceSchedule{Windows: windows, now: time.Now}
+}
+
+// LoadMaintenanceSchedule reads a MaintenanceSchedule from a JSON file
+func LoadMaintenanceSchedule(path string) (*MaintenanceSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maintenance schedule: %w", err)
+	}
+
+	schedule := NewMaintenanceSchedule()
+	if err := json.Unmarshal(data, schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse maintenance schedule: %w", err)
+	}
+	for i, w := range schedule.Windows {
+		if !w.End.After(w.Start) {
+			return nil, fmt.Errorf("maintenance window %d ends before it starts", i)
+		}
+	}
+	return schedule, nil
+}
+
+// Suppresses reports whether a window covers the anomaly now. A nil
+// schedule suppresses nothing; a schedule built as a struct literal uses
+// the wall clock.
+func (s *MaintenanceSchedule) Suppresses(anomaly Anomaly) bool {
+	if s == nil {
+		return false
+	}
+
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+	for _, w := range s.Windows {
+		if w.covers(anomaly, now) {
+			return true
+		}
+	}
+	return false
+}
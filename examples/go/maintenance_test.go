@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowSuppressesActions(t *testing.T) {
+	start := time.Date(2024, 1, 15, 2, 0, 0, 0, time.UTC)
+	schedule := NewMaintenanceSchedule(MaintenanceWindow{
+		Start:    start,
+		End:      start.Add(2 * time.Hour),
+		Services: []string{"chat-api"},
+		Reason:   "load test",
+	})
+
+	var recorded []Anomaly
+	record := AlertAction{Notify: func(ctx context.Context, a Anomaly) error {
+		recorded = append(recorded, a)
+		return nil
+	}}
+	var alerted []string
+	alert := recordingAction{name: "alert", log: &alerted}
+
+	pipeline := NewActionPipeline(
+		ActionStep{Action: record, RunWhenSuppressed: true},
+		ActionStep{Action: alert},
+	)
+	pipeline.Maintenance = schedule
+
+	inScope := newAnomaly(AnomalyHighLatency, testEvent("req-chat"), 5, 2, "slow")
+	otherEvent := testEvent("req-search")
+	otherEvent.ServiceName = "search-api"
+	outOfScope := newAnomaly(AnomalyHighLatency, otherEvent, 5, 2, "slow")
+
+	// during the window only the chat-api anomaly is suppressed
+	schedule.now = func() time.Time { return start.Add(time.Hour) }
+	if err := pipeline.Process(context.Background(), inScope, outOfScope); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 2 || !recorded[0].Suppressed || recorded[1].Suppressed {
+		t.Errorf("recorded %+v, want both with only req-chat suppressed", recorded)
+	}
+	if len(alerted) != 1 || alerted[0] != "alert:req-search" {
+		t.Errorf("alerted %v, want only req-search", alerted)
+	}
+
+	// after the window both are actioned
+	recorded, alerted = nil, nil
+	schedule.now = func() time.Time { return start.Add(2 * time.Hour) }
+	if err := pipeline.Process(context.Background(), inScope, outOfScope); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerted) != 2 || recorded[0].Suppressed {
+		t.Errorf("alerted %v, want both anomalies actioned after the window", alerted)
+	}
+}
+
+func TestMaintenanceWindowMatchesModels(t *testing.T) {
+	start := time.Date(2024, 1, 15, 2, 0, 0, 0, time.UTC)
+	schedule := NewMaintenanceSchedule(MaintenanceWindow{Start: start, End: start.Add(time.Hour), Models: []string{"gpt-4"}})
+	schedule.now = func() time.Time { return start }
+
+	anomaly := newAnomaly(AnomalyHighCost, testEvent("req-1"), 1, 0.5, "cost")
+	if !schedule.Suppresses(anomaly) {
+		t.Error("gpt-4 anomaly not suppressed")
+	}
+	anomaly.ModelName = "claude-3"
+	if schedule.Suppresses(anomaly) {
+		t.Error("claude-3 anomaly suppressed by a gpt-4 window")
+	}
+
+	var nilSchedule *MaintenanceSchedule
+	if nilSchedule.Suppresses(anomaly) {
+		t.Error("nil schedule suppressed an anomaly")
+	}
+}
+
+func TestMaintenanceScheduleLiteralUsesWallClock(t *testing.T) {
+	now := time.Now()
+	schedule := &MaintenanceSchedule{Windows: []MaintenanceWindow{{Start: now.Add(-time.Minute), End: now.Add(time.Hour)}}}
+
+	if !schedule.Suppresses(newAnomaly(AnomalyHighCost, testEvent("req-1"), 1, 0.5, "cost")) {
+		t.Error("open window in a struct literal schedule did not suppress the anomaly")
+	}
+}
+
+func TestLoadMaintenanceSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.json")
+	data := `{"windows": [{"start": "2024-01-15T02:00:00Z", "end": "2024-01-15T04:00:00Z", "services": ["chat-api"], "reason": "CHG-1234"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := LoadMaintenanceSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule.Windows) != 1 || schedule.Windows[0].Reason != "CHG-1234" || schedule.Windows[0].End.Hour() != 4 {
+		t.Errorf("windows = %+v", schedule.Windows)
+	}
+
+	inverted := `{"windows": [{"start": "2024-01-15T04:00:00Z", "end": "2024-01-15T02:00:00Z"}]}`
+	if err := os.WriteFile(path, []byte(inverted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMaintenanceSchedule(path); err == nil {
+		t.Error("loaded a window ending before it starts, want an error")
+	}
+}
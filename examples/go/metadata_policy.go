@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// MetadataPolicy describes the metadata events are expected to carry
+type MetadataPolicy struct {
+	// AllowedKeys lists the permitted metadata keys; keys listed in
+	// AllowedValues are implicitly permitted. Empty allows any key.
+	AllowedKeys []string `json:"allowed_keys,omitempty"`
+	// AllowedValues restricts the values of specific keys to an enum
+	AllowedValues map[string][]string `json:"allowed_values,omitempty"`
+}
+
+// LoadMetadataPolicy reads a MetadataPolicy from a JSON file
+func LoadMetadataPolicy(path string) (MetadataPolicy, error) {
+	var policy MetadataPolicy
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read metadata policy: %w", err)
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("failed to parse metadata policy: %w", err)
+	}
+	return policy, nil
+}
+
+// MetadataPolicyDetector flags events whose metadata violates a policy, such
+// as an api_version regression or an unknown region, which usually points
+// to a misconfigured client.
+type MetadataPolicyDetector struct {
+	allowedKeys   map[string]struct{}
+	allowedValues map[string]map[string]struct{}
+}
+
+// NewMetadataPolicyDetector creates a detector enforcing policy
+func NewMetadataPolicyDetector(policy MetadataPolicy) *MetadataPolicyDetector {
+	d := &MetadataPolicyDetector{
+		allowedValues: make(map[string]map[string]struct{}, len(policy.AllowedValues)),
+	}
+
+	if len(policy.AllowedKeys) > 0 {
+		d.allowedKeys = make(map[string]struct{}, len(policy.AllowedKeys)+len(policy.AllowedValues))
+		for _, key := range policy.AllowedKeys {
+			d.allowedKeys[key] = struct{}{}
+		}
+	}
+
+	for key, values := range policy.AllowedValues {
+		if d.allowedKeys != nil {
+			d.allowedKeys[key] = struct{}{}
+		}
+		set := make(map[string]struct{}, len(values))
+		for _, value := range values {
+			set[value] = struct{}{}
+		}
+		d.allowedValues[key] = set
+	}
+
+	return d
+}
+
+// Observe returns one anomaly per metadata key that violates the policy
+func (d *MetadataPolicyDetector) Observe(event TelemetryEvent) []Anomaly {
+	keys := make([]string, 0, len(event.Metadata))
+	for key := range event.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var anomalies []Anomaly
+	for _, key := range keys {
+		if d.allowedKeys != nil {
+			if _, ok := d.allowedKeys[key]; !ok {
+				anomalies = append(anomalies, newAnomaly(AnomalyMetadataPolicy, event, 1, 0,
+					fmt.Sprintf("unexpected metadata key %q", key)))
+				continue
+			}
+		}
+
+		allowed, ok := d.allowedValues[key]
+		if !ok {
+			continue
+		}
+		value := fmt.Sprint(event.Metadata[key])
+		if _, ok := allowed[value]; !ok {
+			anomalies = append(anomalies, newAnomaly(AnomalyMetadataPolicy, event, 1, 0,
+				fmt.Sprintf("unexpected value %q for metadata key %q", value, key)))
+		}
+	}
+
+	return anomalies
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMetadataPolicy = `{
+	"allowed_keys": ["simulated"],
+	"allowed_values": {
+		"region": ["us-east-1", "us-west-2", "eu-west-1"],
+		"api_version": ["v1"]
+	}
+}`
+
+func loadTestMetadataPolicy(t *testing.T) *MetadataPolicyDetector {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(testMetadataPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadMetadataPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadMetadataPolicy: %v", err)
+	}
+	return NewMetadataPolicyDetector(policy)
+}
+
+func TestMetadataPolicyDetectorAllowsConformingEvent(t *testing.T) {
+	detector := loadTestMetadataPolicy(t)
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"region": "us-east-1", "api_version": "v1", "simulated": true}
+
+	if anomalies := detector.Observe(event); len(anomalies) != 0 {
+		t.Errorf("conforming event flagged: %+v", anomalies)
+	}
+}
+
+func TestMetadataPolicyDetectorFlagsUnexpectedAPIVersion(t *testing.T) {
+	detector := loadTestMetadataPolicy(t)
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"region": "us-east-1", "api_version": "v0"}
+
+	anomalies := detector.Observe(event)
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1: %+v", len(anomalies), anomalies)
+	}
+	if anomalies[0].Type != AnomalyMetadataPolicy || !strings.Contains(anomalies[0].Description, "api_version") {
+		t.Errorf("unexpected anomaly %+v", anomalies[0])
+	}
+}
+
+func TestMetadataPolicyDetectorFlagsUnknownRegionAndKey(t *testing.T) {
+	detector := loadTestMetadataPolicy(t)
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"region": "mars-north-1", "debug": "1"}
+
+	anomalies := detector.Observe(event)
+	if len(anomalies) != 2 {
+		t.Fatalf("got %d anomalies, want 2: %+v", len(anomalies), anomalies)
+	}
+	if !strings.Contains(anomalies[0].Description, `"debug"`) {
+		t.Errorf("first anomaly = %q, want unexpected debug key", anomalies[0].Description)
+	}
+	if !strings.Contains(anomalies[1].Description, "mars-north-1") {
+		t.Errorf("second anomaly = %q, want unknown region", anomalies[1].Description)
+	}
+}
+
+func TestMetadataPolicyWithoutAllowedKeysPermitsAnyKey(t *testing.T) {
+	detector := NewMetadataPolicyDetector(MetadataPolicy{
+		AllowedValues: map[string][]string{"region": {"us-east-1"}},
+	})
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"region": "us-east-1", "anything": 42}
+
+	if anomalies := detector.Observe(event); len(anomalies) != 0 {
+		t.Errorf("unexpected anomalies %+v", anomalies)
+	}
+}
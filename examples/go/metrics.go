@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// producerMetrics holds the Prometheus collectors of a producer created
+// WithMetrics. A nil *producerMetrics records nothing.
+type producerMetrics struct {
+	sent         prometheus.Counter
+	failed       prometheus.Counter
+	sendDuration prometheus.Observer
+}
+
+// newProducerMetrics registers the producer collectors with reg, labeled
+// with the topic. Producers sharing a registry and topic share collectors.
+func newProducerMetrics(reg *prometheus.Registry, topic string) (*producerMetrics, error) {
+	labels := prometheus.Labels{"topic": topic}
+
+	sent, err := registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "events_sent_total",
+		Help:        "Telemetry events written to Kafka.",
+		ConstLabels: labels,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	failed, err := registerCollector(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "events_failed_total",
+		Help:        "Telemetry events that could not be marshaled or written.",
+		ConstLabels: labels,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	sendDuration, err := registerCollector(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        "send_duration_seconds",
+		Help:        "Duration of a send, from marshaling its events to the end of the write.",
+		ConstLabels: labels,
+		Buckets:     prometheus.DefBuckets,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &producerMetrics{sent: sent, failed: failed, sendDuration: sendDuration}, nil
+}
+
+// metricsFor returns the collectors labeled with topic: the producer's own
+// for its topic, otherwise ones registered with the producer's registry on
+// first use. Only SendAtomic names other topics, so the label set stays as
+// small as the set of destination topics.
+func (p *TelemetryProducer) metricsFor(topic string) *producerMetrics {
+	if p.metrics == nil || topic == p.topic {
+		return p.metrics
+	}
+	if m, ok := p.topicMetrics.Load(topic); ok {
+		return m.(*producerMetrics)
+	}
+	m, err := newProducerMetrics(p.metricsRegistry, topic)
+	if err != nil {
+		p.logger().Warn("Producer metrics disabled", "topic", topic, "error", err)
+		return nil
+	}
+	actual, _ := p.topicMetrics.LoadOrStore(topic, m)
+	return actual.(*producerMetrics)
+}
+
+// registerCollector registers c, or returns the equal collector already registered
+func registerCollector[C prometheus.Collector](reg *prometheus.Registry, c C) (C, error) {
+	if err := reg.Register(c); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, err
+	}
+	return c, nil
+}
+
+// recordSent counts n events written to Kafka
+func (m *producerMetrics) recordSent(n int) {
+	if m != nil {
+		m.sent.Add(float64(n))
+	}
+}
+
+// recordFailed counts n events that failed
+func (m *producerMetrics) recordFailed(n int) {
+	if m != nil {
+		m.failed.Add(float64(n))
+	}
+}
+
+// observeSend records the duration of a send that started at start
+func (m *producerMetrics) observeSend(start time.Time) {
+	if m != nil {
+		m.sendDuration.Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProducerMetricsCountSendOutcomes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithMetrics(reg))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+	w.writeErr = errTestBroker
+	if err := p.SendEvent(context.Background(), testEvent("req-2")); err == nil {
+		t.Fatal("expected the failed write to return an error")
+	}
+
+	expected := `
+# HELP events_failed_total Telemetry events that could not be marshaled or written.
+# TYPE events_failed_total counter
+events_failed_total{topic="llm.telemetry"} 1
+# HELP events_sent_total Telemetry events written to Kafka.
+# TYPE events_sent_total counter
+events_sent_total{topic="llm.telemetry"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "events_sent_total", "events_failed_total"); err != nil {
+		t.Error(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "send_duration_seconds" {
+			if count := family.GetMetric()[0].GetHistogram().GetSampleCount(); count != 2 {
+				t.Errorf("send_duration_seconds observed %d sends, want 2", count)
+			}
+			return
+		}
+	}
+	t.Error("send_duration_seconds was not registered")
+}
+
+func TestProducersShareMetricsPerTopic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithMetrics(reg))
+	second := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithMetrics(reg))
+	other := NewTelemetryProducer([]string{"localhost:9092"}, "llm.audit", WithMetrics(reg))
+	for _, p := range []*TelemetryProducer{first, second, other} {
+		p.writer.Close()
+		p.writer = &fakeWriter{}
+		if p.metrics == nil {
+			t.Fatalf("producer for %s has no metrics", p.topic)
+		}
+		if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := testutil.ToFloat64(first.metrics.sent); got != 2 {
+		t.Errorf("events_sent_total{topic=llm.telemetry} = %v, want 2 from both producers", got)
+	}
+	if got := testutil.ToFloat64(other.metrics.sent); got != 1 {
+		t.Errorf("events_sent_total{topic=llm.audit} = %v, want 1", got)
+	}
+}
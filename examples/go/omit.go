@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldOmitter serializes events without a fixed set of JSON fields,
+// regardless of their values. Unlike omitempty it also drops fields that
+// are set, for downstreams that must never receive them (e.g. cost_usd).
+type FieldOmitter struct {
+	fields map[string]struct{}
+}
+
+// NewFieldOmitter creates an omitter for the given JSON field names. Names
+// that are not TelemetryEvent fields are rejected so typos don't silently
+// let a field through.
+func NewFieldOmitter(fields ...string) (*FieldOmitter, error) {
+	known := telemetryEventFields()
+	omit := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		if _, ok := known[field]; !ok {
+			return nil, fmt.Errorf("unknown telemetry event field %q", field)
+		}
+		omit[field] = struct{}{}
+	}
+	return &FieldOmitter{fields: omit}, nil
+}
+
+// Marshal encodes event as JSON without the omitted fields, keeping the
+// remaining fields in their usual order. A nil omitter omits nothing.
+func (o *FieldOmitter) Marshal(event TelemetryEvent) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil || o == nil || len(o.fields) == 0 {
+		return data, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		name := tok.(string)
+		if _, ok := o.fields[name]; ok {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// telemetryEventFields returns the JSON field names of TelemetryEvent
+func telemetryEventFields() map[string]struct{} {
+	t := reflect.TypeOf(TelemetryEvent{})
+	fields := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = struct{}{}
+	}
+	return fields
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestFieldOmitterRemovesNamedFields(t *testing.T) {
+	omitter, err := NewFieldOmitter("cost_usd", "user_id")
+	if err != nil {
+		t.Fatalf("NewFieldOmitter: %v", err)
+	}
+
+	event := testEvent("req-1")
+	event.CostUsd = 0
+	data, err := omitter.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, data)
+	}
+	for _, omitted := range []string{"cost_usd", "user_id"} {
+		if _, ok := fields[omitted]; ok {
+			t.Errorf("%s present in output: %s", omitted, data)
+		}
+	}
+	for _, kept := range []string{"timestamp", "service_name", "model_name", "total_tokens", "session_id", "request_id"} {
+		if _, ok := fields[kept]; !ok {
+			t.Errorf("%s missing from output: %s", kept, data)
+		}
+	}
+
+	var decoded TelemetryEvent
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.RequestID != "req-1" || decoded.TotalTokens != 450 {
+		t.Errorf("decoded = %+v, %v", decoded, err)
+	}
+}
+
+func TestFieldOmitterRejectsUnknownField(t *testing.T) {
+	if _, err := NewFieldOmitter("cost"); err == nil {
+		t.Error("NewFieldOmitter(\"cost\") succeeded, want error")
+	}
+}
+
+func TestNilFieldOmitterMatchesJSONMarshal(t *testing.T) {
+	var omitter *FieldOmitter
+	event := testEvent("req-1")
+
+	got, err := omitter.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want, _ := json.Marshal(event)
+	if string(got) != string(want) {
+		t.Errorf("Marshal = %s, want %s", got, want)
+	}
+}
+
+func TestSendEventOmitsFields(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.OmitFields, _ = NewFieldOmitter("cost_usd")
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	var fields map[string]interface{}
+	json.Unmarshal(w.Messages()[0].Value, &fields)
+	if _, ok := fields["cost_usd"]; ok {
+		t.Errorf("cost_usd present in sent message: %s", w.Messages()[0].Value)
+	}
+}
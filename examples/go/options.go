@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+)
+
+// writerConfig holds the settings of a producer's Kafka writer, and the
+// producer stages that are set by option
+type writerConfig struct {
+	requiredAcks kafka.RequiredAcks
+	maxAttempts  int
+	balancer     kafka.Balancer
+	writeTimeout time.Duration
+	readTimeout  time.Duration
+	batchSize    int
+	compression  kafka.Compression
+	sasl         sasl.Mechanism
+	tls          *tls.Config
+	dialTimeout  time.Duration
+
+	redactor   Redactor
+	metrics    *prometheus.Registry
+	deadLetter DeadLetterSink
+	valueCodec *valueCodec
+	serializer Serializer
+	deduper    *Deduper
+	keyFunc    KeyFunc
+
+	textSampler     *TextSampler
+	logger          *slog.Logger
+	perEventTimeout time.Duration
+
+	schemaRegistryURL string
+	coalescer         *Coalescer
+
+	retry   RetryPolicy
+	breaker *KeyedCircuitBreaker
+
+	asyncWorkers int
+}
+
+// ProducerOption configures the Kafka writer of a producer
+type ProducerOption func(*writerConfig)
+
+// defaultWriterConfig returns the writer settings used when no options are given
+func defaultWriterConfig() writerConfig {
+	return writerConfig{
+		requiredAcks: kafka.RequireAll,
+		maxAttempts:  3,
+		writeTimeout: 10 * time.Second,
+		readTimeout:  10 * time.Second,
+		dialTimeout:  defaultDialTimeout,
+	}
+}
+
+// newWriter creates a writer for the topic from the config
+func (c writerConfig) newWriter(brokers []string, topic string) *kafka.Writer {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     c.partitionBalancer(),
+		RequiredAcks: c.requiredAcks,
+		MaxAttempts:  c.maxAttempts,
+		BatchSize:    c.batchSize,
+		WriteTimeout: c.writeTimeout,
+		ReadTimeout:  c.readTimeout,
+		Compression:  c.compression,
+	}
+	// leave Transport unset without authentication so kafka-go uses its default
+	if transport := c.transport(); transport != nil {
+		w.Transport = transport
+	}
+	return w
+}
+
+// partitionBalancer returns the balancer set WithBalancer. It defaults to
+// kafka.Hash for producers keyed WithKeyFunc, so events with equal keys
+// share a partition, and to kafka.LeastBytes otherwise.
+func (c writerConfig) partitionBalancer() kafka.Balancer {
+	switch {
+	case c.balancer != nil:
+		return c.balancer
+	case c.keyFunc != nil:
+		return &kafka.Hash{}
+	default:
+		return &kafka.LeastBytes{}
+	}
+}
+
+// WithRequiredAcks sets the acknowledgements a write waits for (default: kafka.RequireAll)
+func WithRequiredAcks(acks kafka.RequiredAcks) ProducerOption {
+	return func(c *writerConfig) {
+		c.requiredAcks = acks
+	}
+}
+
+// WithMaxAttempts sets how many times kafka-go tries a write before failing it (default: 3)
+func WithMaxAttempts(attempts int) ProducerOption {
+	return func(c *writerConfig) {
+		c.maxAttempts = attempts
+	}
+}
+
+// WithBalancer sets how messages are spread over partitions (default:
+// kafka.LeastBytes, or kafka.Hash WithKeyFunc)
+func WithBalancer(balancer kafka.Balancer) ProducerOption {
+	return func(c *writerConfig) {
+		c.balancer = balancer
+	}
+}
+
+// WithWriteTimeout sets the timeout of a write to a broker (default: 10s)
+func WithWriteTimeout(timeout time.Duration) ProducerOption {
+	return func(c *writerConfig) {
+		c.writeTimeout = timeout
+	}
+}
+
+// WithPerEventTimeout bounds each write of the producer's events to Kafka
+// with a deadline derived from the caller's context, so one slow write fails
+// fast without shortening a long-lived parent context (default: no limit
+// beyond the caller's context)
+func WithPerEventTimeout(d time.Duration) ProducerOption {
+	return func(c *writerConfig) {
+		c.perEventTimeout = d
+	}
+}
+
+// WithRedactor runs prompt and response text through the redactor before
+// each event is serialized (default: no redaction)
+func WithRedactor(r Redactor) ProducerOption {
+	return func(c *writerConfig) {
+		c.redactor = r
+	}
+}
+
+// WithMetrics registers the producer's events_sent_total and
+// events_failed_total counters and send_duration_seconds histogram with reg,
+// labeled with its topic (default: no Prometheus metrics)
+func WithMetrics(reg *prometheus.Registry) ProducerOption {
+	return func(c *writerConfig) {
+		c.metrics = reg
+	}
+}
+
+// WithBatchSize sets the most messages kafka-go sends to a partition in one
+// request (default: kafka-go's 100)
+func WithBatchSize(size int) ProducerOption {
+	return func(c *writerConfig) {
+		c.batchSize = size
+	}
+}
+
+// WithLogger sets the logger of the producer (default: slog.Default())
+func WithLogger(l *slog.Logger) ProducerOption {
+	return func(c *writerConfig) {
+		c.logger = l
+	}
+}
+
+// WithRetry sets the producer's Retry policy for transient write failures
+// such as leader elections (default: no retries)
+func WithRetry(policy RetryPolicy) ProducerOption {
+	return func(c *writerConfig) {
+		c.retry = policy
+	}
+}
+
+// WithBreaker sets the producer's circuit Breaker (default: none)
+func WithBreaker(breaker *KeyedCircuitBreaker) ProducerOption {
+	return func(c *writerConfig) {
+		c.breaker = breaker
+	}
+}
+
+// WithAsyncWorkers sets the number of goroutines draining the buffer of a
+// producer created with NewAsyncTelemetryProducer (default: 1). With more
+// than one, batches are written concurrently and events may reach Kafka out
+// of the order they were enqueued.
+func WithAsyncWorkers(n int) ProducerOption {
+	return func(c *writerConfig) {
+		c.asyncWorkers = n
+	}
+}
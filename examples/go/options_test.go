@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// testWriter creates a producer with the options and returns its Kafka writer
+func testWriter(t *testing.T, opts ...ProducerOption) *kafka.Writer {
+	t.Helper()
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", opts...)
+	w := p.writer.(*kafka.Writer)
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestProducerWriterDefaults(t *testing.T) {
+	w := testWriter(t)
+
+	if _, ok := w.Balancer.(*kafka.LeastBytes); !ok {
+		t.Errorf("Balancer = %T, want *kafka.LeastBytes", w.Balancer)
+	}
+	if w.RequiredAcks != kafka.RequireAll || w.MaxAttempts != 3 {
+		t.Errorf("RequiredAcks = %v, MaxAttempts = %d; want RequireAll, 3", w.RequiredAcks, w.MaxAttempts)
+	}
+	if w.WriteTimeout != 10*time.Second || w.ReadTimeout != 10*time.Second {
+		t.Errorf("timeouts = %s/%s, want 10s", w.WriteTimeout, w.ReadTimeout)
+	}
+}
+
+func TestProducerOptionsOverrideDefaults(t *testing.T) {
+	w := testWriter(t,
+		WithRequiredAcks(kafka.RequireOne),
+		WithMaxAttempts(5),
+		WithBalancer(&kafka.Hash{}),
+		WithWriteTimeout(time.Second),
+		WithBatchSize(500),
+	)
+
+	if w.RequiredAcks != kafka.RequireOne {
+		t.Errorf("RequiredAcks = %v, want RequireOne", w.RequiredAcks)
+	}
+	if w.MaxAttempts != 5 || w.WriteTimeout != time.Second || w.BatchSize != 500 {
+		t.Errorf("MaxAttempts = %d, WriteTimeout = %s, BatchSize = %d", w.MaxAttempts, w.WriteTimeout, w.BatchSize)
+	}
+	if _, ok := w.Balancer.(*kafka.Hash); !ok {
+		t.Errorf("Balancer = %T, want *kafka.Hash", w.Balancer)
+	}
+	if w.ReadTimeout != 10*time.Second {
+		t.Errorf("ReadTimeout = %s, want the 10s default", w.ReadTimeout)
+	}
+}
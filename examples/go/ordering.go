@@ -0,0 +1,156 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// OrderingBufferConfig configures an OrderingBuffer
+type OrderingBufferConfig struct {
+	// Delay is how far behind the newest event timestamp the buffer waits
+	// before releasing, and the longest an event is held (default: 2s)
+	Delay time.Duration
+	// OnLate receives events older than one already released (optional side output)
+	OnLate func(event TelemetryEvent)
+}
+
+// OrderingBuffer re-orders events arriving out of event-time order, such as
+// from several producers feeding one gateway. Events are held until the
+// newest timestamp seen is Delay past them (or they have waited Delay) and
+// are then released sorted by Timestamp. Events older than something already
+// released are late and go to the side output instead.
+type OrderingBuffer struct {
+	mu           sync.Mutex
+	config       OrderingBufferConfig
+	now          func() time.Time
+	pending      orderingHeap
+	seq          uint64
+	maxSeen      time.Time
+	lastReleased time.Time
+	late         int
+}
+
+// orderingItem is a buffered event with its parsed timestamp and arrival time
+type orderingItem struct {
+	event   TelemetryEvent
+	ts      time.Time
+	arrival time.Time
+	seq     uint64
+}
+
+// orderingHeap is a min-heap by timestamp, then arrival order
+type orderingHeap []orderingItem
+
+func (h orderingHeap) Len() int { return len(h) }
+func (h orderingHeap) Less(i, j int) bool {
+	if !h[i].ts.Equal(h[j].ts) {
+		return h[i].ts.Before(h[j].ts)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h orderingHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *orderingHeap) Push(x interface{}) { *h = append(*h, x.(orderingItem)) }
+func (h *orderingHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// NewOrderingBuffer creates a buffer, applying defaults for zero config values
+func NewOrderingBuffer(config OrderingBufferConfig) *OrderingBuffer {
+	if config.Delay <= 0 {
+		config.Delay = 2 * time.Second
+	}
+	return &OrderingBuffer{config: config, now: time.Now}
+}
+
+// Add buffers the event and returns any events that are now ready, in
+// timestamp order
+func (b *OrderingBuffer) Add(event TelemetryEvent) []TelemetryEvent {
+	ts := eventTime(event)
+
+	b.mu.Lock()
+	if !b.lastReleased.IsZero() && ts.Before(b.lastReleased) {
+		b.late++
+		b.mu.Unlock()
+		if b.config.OnLate != nil {
+			b.config.OnLate(event)
+		}
+		return nil
+	}
+
+	b.seq++
+	heap.Push(&b.pending, orderingItem{event: event, ts: ts, arrival: b.now(), seq: b.seq})
+	if ts.After(b.maxSeen) {
+		b.maxSeen = ts
+	}
+
+	ready := b.releaseLocked(b.maxSeen.Add(-b.config.Delay))
+	b.mu.Unlock()
+
+	return ready
+}
+
+// Expire releases events that have been held for at least Delay, along with
+// any earlier-timestamped events, so a quiet stream still drains. Call it
+// periodically.
+func (b *OrderingBuffer) Expire() []TelemetryEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	deadline := b.now().Add(-b.config.Delay)
+	var cutoff time.Time
+	for _, item := range b.pending {
+		if !item.arrival.After(deadline) && item.ts.After(cutoff) {
+			cutoff = item.ts
+		}
+	}
+
+	if cutoff.IsZero() {
+		return nil
+	}
+	return b.releaseLocked(cutoff)
+}
+
+// Flush releases every buffered event in timestamp order
+func (b *OrderingBuffer) Flush() []TelemetryEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ready []TelemetryEvent
+	for b.pending.Len() > 0 {
+		item := heap.Pop(&b.pending).(orderingItem)
+		b.lastReleased = item.ts
+		ready = append(ready, item.event)
+	}
+	return ready
+}
+
+// Pending returns the number of buffered events
+func (b *OrderingBuffer) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.pending.Len()
+}
+
+// Late returns the number of events routed to the side output
+func (b *OrderingBuffer) Late() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.late
+}
+
+// releaseLocked pops all events with timestamps at or before cutoff
+func (b *OrderingBuffer) releaseLocked(cutoff time.Time) []TelemetryEvent {
+	var ready []TelemetryEvent
+	for b.pending.Len() > 0 && !b.pending[0].ts.After(cutoff) {
+		item := heap.Pop(&b.pending).(orderingItem)
+		b.lastReleased = item.ts
+		ready = append(ready, item.event)
+	}
+	return ready
+}
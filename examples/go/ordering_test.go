@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func releasedTimes(t *testing.T, events []TelemetryEvent) []time.Time {
+	t.Helper()
+	times := make([]time.Time, len(events))
+	for i, event := range events {
+		times[i] = eventTime(event)
+	}
+	return times
+}
+
+func TestOrderingBufferSortsShuffledEvents(t *testing.T) {
+	var late []TelemetryEvent
+	buffer := NewOrderingBuffer(OrderingBufferConfig{
+		Delay:  5 * time.Second,
+		OnLate: func(e TelemetryEvent) { late = append(late, e) },
+	})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	var events []TelemetryEvent
+	for i := 0; i < 200; i++ {
+		events = append(events, eventAt(fmt.Sprintf("req-%03d", i), "s", start.Add(time.Duration(i)*100*time.Millisecond)))
+	}
+
+	// Shuffle within small blocks so no event is more than ~2s out of order
+	rng := rand.New(rand.NewSource(1))
+	for blockStart := 0; blockStart < len(events); blockStart += 20 {
+		block := events[blockStart : blockStart+20]
+		rng.Shuffle(len(block), func(i, j int) { block[i], block[j] = block[j], block[i] })
+	}
+
+	var released []TelemetryEvent
+	for _, event := range events {
+		released = append(released, buffer.Add(event)...)
+	}
+	if len(released) == 0 {
+		t.Fatal("expected events to be released before flush")
+	}
+	released = append(released, buffer.Flush()...)
+
+	if len(released) != len(events) || len(late) != 0 {
+		t.Fatalf("released %d events with %d late, want %d and 0", len(released), len(late), len(events))
+	}
+
+	times := releasedTimes(t, released)
+	if !sort.SliceIsSorted(times, func(i, j int) bool { return times[i].Before(times[j]) }) {
+		t.Error("events were not released in timestamp order")
+	}
+}
+
+func TestOrderingBufferRoutesLateArrivals(t *testing.T) {
+	var late []TelemetryEvent
+	buffer := NewOrderingBuffer(OrderingBufferConfig{
+		Delay:  time.Second,
+		OnLate: func(e TelemetryEvent) { late = append(late, e) },
+	})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	buffer.Add(eventAt("req-1", "s", start))
+	if released := buffer.Add(eventAt("req-2", "s", start.Add(3*time.Second))); len(released) != 1 {
+		t.Fatalf("released %d events, want req-1", len(released))
+	}
+
+	// Older than req-1, which has already been released
+	if released := buffer.Add(eventAt("req-late", "s", start.Add(-time.Second))); len(released) != 0 {
+		t.Errorf("late event released %d events", len(released))
+	}
+
+	if len(late) != 1 || late[0].RequestID != "req-late" || buffer.Late() != 1 {
+		t.Errorf("late side output = %v (count %d), want req-late", late, buffer.Late())
+	}
+	if buffer.Pending() != 1 {
+		t.Errorf("pending = %d, want 1", buffer.Pending())
+	}
+}
+
+func TestOrderingBufferExpireDrainsQuietStream(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	buffer := NewOrderingBuffer(OrderingBufferConfig{Delay: time.Second})
+	buffer.now = func() time.Time { return now }
+
+	buffer.Add(eventAt("req-2", "s", now.Add(200*time.Millisecond)))
+	buffer.Add(eventAt("req-1", "s", now.Add(100*time.Millisecond)))
+
+	if released := buffer.Expire(); len(released) != 0 {
+		t.Errorf("released %d events before delay elapsed", len(released))
+	}
+
+	now = now.Add(2 * time.Second)
+	released := buffer.Expire()
+	if len(released) != 2 || released[0].RequestID != "req-1" || released[1].RequestID != "req-2" {
+		t.Errorf("Expire released %v, want req-1 then req-2", released)
+	}
+}
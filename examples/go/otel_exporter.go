@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+)
+
+// otelScopeName is the instrumentation scope of emitted anomaly records
+const otelScopeName = "github.com/llm-devops/llm-sentinel/examples/go"
+
+// OTelAnomalyExporter emits detector anomalies as OpenTelemetry log records
+// so they reach observability backends alongside Kafka. Attribute names
+// match the telemetry event fields, so an anomaly can be joined to its
+// event and trace spans by request_id.
+type OTelAnomalyExporter struct {
+	logger otellog.Logger
+	now    func() time.Time
+}
+
+// NewOTelAnomalyExporter creates an exporter that emits through a logger
+// from provider, such as an SDK LoggerProvider configured with an OTLP exporter
+func NewOTelAnomalyExporter(provider otellog.LoggerProvider) *OTelAnomalyExporter {
+	return &OTelAnomalyExporter{
+		logger: provider.Logger(otelScopeName),
+		now:    time.Now,
+	}
+}
+
+// Export emits one WARN log record per anomaly. ctx is passed to the
+// logger so an SDK can attach the active trace and span IDs.
+func (e *OTelAnomalyExporter) Export(ctx context.Context, anomalies ...Anomaly) {
+	for _, anomaly := range anomalies {
+		var record otellog.Record
+		record.SetTimestamp(e.now())
+		record.SetSeverity(otellog.SeverityWarn)
+		record.SetSeverityText("WARN")
+		record.SetBody(otellog.StringValue(anomaly.Description))
+		record.AddAttributes(
+			otellog.String("anomaly.type", anomaly.Type.String()),
+			otellog.Float64("anomaly.score", anomaly.Score),
+			otellog.Float64("anomaly.threshold", anomaly.Threshold),
+		)
+
+		for _, attr := range []struct{ key, value string }{
+			{"service_name", anomaly.ServiceName},
+			{"model_name", anomaly.ModelName},
+			{"user_id", anomaly.UserID},
+			{"session_id", anomaly.SessionID},
+			{"request_id", anomaly.RequestID},
+		} {
+			if attr.value != "" {
+				record.AddAttributes(otellog.String(attr.key, attr.value))
+			}
+		}
+
+		if e.logger.Enabled(ctx, record) {
+			e.logger.Emit(ctx, record)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/logtest"
+)
+
+func TestOTelAnomalyExporterAttributes(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	exporter := NewOTelAnomalyExporter(recorder)
+	now := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+	exporter.now = func() time.Time { return now }
+
+	anomaly := newAnomaly(AnomalyHighCost, testEvent("req-1"), 4.2, 3.0, "cost 4.2 standard deviations above mean")
+	exporter.Export(context.Background(), anomaly)
+
+	scopes := recorder.Result()
+	if len(scopes) != 1 || len(scopes[0].Records) != 1 {
+		t.Fatalf("got %+v, want one record", scopes)
+	}
+	if scopes[0].Name != otelScopeName {
+		t.Errorf("scope = %q, want %q", scopes[0].Name, otelScopeName)
+	}
+
+	record := scopes[0].Records[0]
+	if record.Severity() != otellog.SeverityWarn {
+		t.Errorf("severity = %v, want WARN", record.Severity())
+	}
+	if !record.Timestamp().Equal(now) {
+		t.Errorf("timestamp = %v, want %v", record.Timestamp(), now)
+	}
+	if got := record.Body().AsString(); got != anomaly.Description {
+		t.Errorf("body = %q, want %q", got, anomaly.Description)
+	}
+
+	attrs := map[string]otellog.Value{}
+	record.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+
+	wantStrings := map[string]string{
+		"anomaly.type": "high_cost",
+		"service_name": "chat-api",
+		"model_name":   "gpt-4",
+		"user_id":      "user-1",
+		"session_id":   "session-1",
+		"request_id":   "req-1",
+	}
+	for key, want := range wantStrings {
+		if got := attrs[key].AsString(); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if got := attrs["anomaly.score"].AsFloat64(); got != 4.2 {
+		t.Errorf("anomaly.score = %v, want 4.2", got)
+	}
+	if got := attrs["anomaly.threshold"].AsFloat64(); got != 3.0 {
+		t.Errorf("anomaly.threshold = %v, want 3", got)
+	}
+}
+
+func TestOTelAnomalyExporterOmitsEmptyAttributes(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	exporter := NewOTelAnomalyExporter(recorder)
+
+	exporter.Export(context.Background(),
+		Anomaly{Type: AnomalyLatencyBimodality, ModelName: "gpt-4"},
+		Anomaly{Type: AnomalyDegenerateResponse, ModelName: "claude-3"},
+	)
+
+	records := recorder.Result()[0].Records
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	records[0].WalkAttributes(func(kv otellog.KeyValue) bool {
+		if kv.Key == "request_id" || kv.Key == "user_id" {
+			t.Errorf("unexpected empty attribute %s", kv.Key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPipelineClosed is returned by Observe once Shutdown has been called
+var ErrPipelineClosed = errors.New("detector pipeline is shut down")
+
+// Flusher is implemented by aggregate detectors that hold observations
+// between evaluations. Flush evaluates them immediately and returns any
+// anomalies they trigger.
+type Flusher interface {
+	Flush() []Anomaly
+}
+
+// DetectorPipeline passes each event to every detector and collects their
+// anomalies. Shutdown drains it so anomalies pending in aggregate detectors
+// are not lost.
+type DetectorPipeline struct {
+	detectors []Detector
+
+	mu       sync.Mutex
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// NewDetectorPipeline creates a pipeline running detectors in order
+func NewDetectorPipeline(detectors ...Detector) *DetectorPipeline {
+	return &DetectorPipeline{detectors: detectors}
+}
+
+// Observe passes the event to every detector and returns their anomalies.
+// It returns ErrPipelineClosed once Shutdown has been called.
+func (p *DetectorPipeline) Observe(event TelemetryEvent) ([]Anomaly, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPipelineClosed
+	}
+	p.inFlight.Add(1)
+	p.mu.Unlock()
+	defer p.inFlight.Done()
+
+	var anomalies []Anomaly
+	for _, d := range p.detectors {
+		anomalies = append(anomalies, d.Observe(event)...)
+	}
+	return anomalies, nil
+}
+
+// Shutdown stops accepting events, waits for in-flight Observe calls to
+// return, then flushes every detector implementing Flusher and returns the
+// anomalies they report. If ctx ends first it returns ctx.Err() without
+// flushing; a later call may retry.
+func (p *DetectorPipeline) Shutdown(ctx context.Context) ([]Anomaly, error) {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-drained:
+	}
+
+	var anomalies []Anomaly
+	for _, d := range p.detectors {
+		if f, ok := d.(Flusher); ok {
+			anomalies = append(anomalies, f.Flush()...)
+		}
+	}
+	return anomalies, nil
+}
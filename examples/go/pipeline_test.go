@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDetectorPipelineShutdownFlushesAggregates(t *testing.T) {
+	// 250 events never reach the detector's evaluation interval, so only
+	// Shutdown can report the bimodal distribution
+	bimodality := NewLatencyBimodalityDetector(LatencyBimodalityConfig{EvaluateEvery: 1000})
+	pipeline := NewDetectorPipeline(bimodality, NewBurstDetector(BurstConfig{}))
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 250; i++ {
+		event := testEvent("req")
+		event.SessionID = ""
+		event.LatencyMs = 120 + rng.NormFloat64()*15
+		if i%3 == 0 {
+			event.LatencyMs = 2000 + rng.NormFloat64()*150
+		}
+		anomalies, err := pipeline.Observe(event)
+		if err != nil || len(anomalies) != 0 {
+			t.Fatalf("Observe = %v, %v, want no anomalies before shutdown", anomalies, err)
+		}
+	}
+
+	anomalies, err := pipeline.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if len(anomalies) != 1 || anomalies[0].Type != AnomalyLatencyBimodality || anomalies[0].ServiceName != "chat-api" {
+		t.Fatalf("Shutdown anomalies = %+v, want one flushed latency_bimodality for chat-api", anomalies)
+	}
+
+	if _, err := pipeline.Observe(testEvent("req-late")); !errors.Is(err, ErrPipelineClosed) {
+		t.Errorf("Observe after Shutdown = %v, want ErrPipelineClosed", err)
+	}
+}
+
+// blockingDetector blocks Observe until release is closed
+type blockingDetector struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDetector) Observe(event TelemetryEvent) []Anomaly {
+	close(d.started)
+	<-d.release
+	return nil
+}
+
+func TestDetectorPipelineShutdownRespectsDeadline(t *testing.T) {
+	d := &blockingDetector{started: make(chan struct{}), release: make(chan struct{})}
+	pipeline := NewDetectorPipeline(d)
+
+	done := make(chan struct{})
+	go func() {
+		pipeline.Observe(testEvent("req-1"))
+		close(done)
+	}()
+	<-d.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pipeline.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want deadline exceeded while Observe is in flight", err)
+	}
+
+	close(d.release)
+	<-done
+	if _, err := pipeline.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown after drain = %v, want nil", err)
+	}
+}
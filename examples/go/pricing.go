@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EndpointType identifies the kind of API endpoint an event was recorded for
+type EndpointType string
+
+const (
+	// EndpointChat is a chat or text completion, priced per prompt and completion token
+	EndpointChat EndpointType = "chat"
+	// EndpointEmbedding is an embedding request, priced per input token
+	EndpointEmbedding EndpointType = "embedding"
+	// EndpointModeration is a moderation request, priced per input token
+	EndpointModeration EndpointType = "moderation"
+	// EndpointImage is an image generation request, priced per request
+	EndpointImage EndpointType = "image"
+)
+
+// endpointOrDefault returns the endpoint type, treating an empty one as chat
+func endpointOrDefault(endpoint EndpointType) EndpointType {
+	if endpoint == "" {
+		return EndpointChat
+	}
+	return endpoint
+}
+
+// validEndpoint reports whether endpoint is empty or a known endpoint type
+func validEndpoint(endpoint EndpointType) bool {
+	switch endpoint {
+	case "", EndpointChat, EndpointEmbedding, EndpointModeration, EndpointImage:
+		return true
+	}
+	return false
+}
+
+// ModelPrice is the price of one model on one endpoint type, in USD
+type ModelPrice struct {
+	// InputPerToken is charged per prompt token
+	InputPerToken float64 `json:"input_per_token"`
+	// OutputPerToken is charged per completion token (chat endpoints only)
+	OutputPerToken float64 `json:"output_per_token"`
+	// PerRequest is charged once per request (image endpoints)
+	PerRequest float64 `json:"per_request"`
+}
+
+// PriceEntry is a model price that applies from EffectiveFrom until the
+// next entry for the same endpoint type and model. A zero EffectiveFrom
+// applies to all times before the first dated entry.
+type PriceEntry struct {
+	Endpoint      EndpointType `json:"endpoint_type"`
+	Model         string       `json:"model"`
+	EffectiveFrom time.Time    `json:"effective_from"`
+	ModelPrice
+}
+
+// UnmarshalJSON decodes a price entry. Besides the per-token prices it
+// accepts input_per_1k_tokens and output_per_1k_tokens, the unit providers
+// publish prices in.
+func (e *PriceEntry) UnmarshalJSON(data []byte) error {
+	// plain has PriceEntry's fields but not this method
+	type plain PriceEntry
+	var raw struct {
+		plain
+		InputPer1K  *float64 `json:"input_per_1k_tokens"`
+		OutputPer1K *float64 `json:"output_per_1k_tokens"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*e = PriceEntry(raw.plain)
+	if raw.InputPer1K != nil {
+		e.InputPerToken = *raw.InputPer1K / 1000
+	}
+	if raw.OutputPer1K != nil {
+		e.OutputPerToken = *raw.OutputPer1K / 1000
+	}
+	return nil
+}
+
+// ErrUnknownModel is returned by CostFor for a model the table has no price for
+var ErrUnknownModel = errors.New("no price for model")
+
+// ErrIncompletePricing is returned by CheckModels when expected models have no price
+var ErrIncompletePricing = errors.New("pricing table is incomplete")
+
+// PricingTable holds model prices per endpoint type. Models are matched by
+// the longest registered prefix of their name, so "gpt-4" also prices
+// "gpt-4-turbo"; an empty model name is the fallback for its endpoint type.
+// Each model may have several prices with different effective dates.
+type PricingTable struct {
+	mu     sync.RWMutex
+	prices map[EndpointType]map[string][]PriceEntry
+	now    func() time.Time
+	// unpriced counts costs that fell back to zero for lack of a price
+	unpriced atomic.Int64
+}
+
+// NewPricingTable creates an empty pricing table
+func NewPricingTable() *PricingTable {
+	return &PricingTable{
+		prices: make(map[EndpointType]map[string][]PriceEntry),
+		now:    time.Now,
+	}
+}
+
+// DefaultPricingTable returns the example prices used by the simulator
+func DefaultPricingTable() *PricingTable {
+	t := NewPricingTable()
+	t.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006})
+	t.Set(EndpointChat, "", ModelPrice{InputPerToken: 0.000001, OutputPerToken: 0.000002})
+	t.Set(EndpointEmbedding, "", ModelPrice{InputPerToken: 0.0000001})
+	t.Set(EndpointModeration, "", ModelPrice{})
+	t.Set(EndpointImage, "", ModelPrice{PerRequest: 0.04})
+	return t
+}
+
+// Set registers the price of a model (or model name prefix) on an endpoint
+// type, effective for all times
+func (t *PricingTable) Set(endpoint EndpointType, model string, price ModelPrice) {
+	t.SetEntry(PriceEntry{Endpoint: endpoint, Model: model, ModelPrice: price})
+}
+
+// SetEntry registers a dated price, replacing any entry for the same
+// endpoint type, model and effective date
+func (t *PricingTable) SetEntry(entry PriceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.setLocked(entry)
+}
+
+// Replace atomically replaces every price in the table with entries
+func (t *PricingTable) Replace(entries []PriceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prices = make(map[EndpointType]map[string][]PriceEntry)
+	for _, entry := range entries {
+		t.setLocked(entry)
+	}
+}
+
+// setLocked inserts entry, keeping each model's entries sorted by effective date
+func (t *PricingTable) setLocked(entry PriceEntry) {
+	entry.Endpoint = endpointOrDefault(entry.Endpoint)
+	if t.prices[entry.Endpoint] == nil {
+		t.prices[entry.Endpoint] = make(map[string][]PriceEntry)
+	}
+
+	entries := t.prices[entry.Endpoint][entry.Model]
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].EffectiveFrom.Before(entry.EffectiveFrom) })
+	if i < len(entries) && entries[i].EffectiveFrom.Equal(entry.EffectiveFrom) {
+		entries[i] = entry
+		return
+	}
+	entries = append(entries, PriceEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = entry
+	t.prices[entry.Endpoint][entry.Model] = entries
+}
+
+// Price returns the price currently in effect for the longest prefix of model on endpoint
+func (t *PricingTable) Price(endpoint EndpointType, model string) (ModelPrice, bool) {
+	return t.PriceAt(endpoint, model, t.now())
+}
+
+// PriceAt returns the price in effect at the given time for the longest
+// prefix of model on endpoint. Prefixes whose first price takes effect
+// after at are skipped.
+func (t *PricingTable) PriceAt(endpoint EndpointType, model string, at time.Time) (ModelPrice, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	best, found := "", false
+	var price ModelPrice
+	for prefix, entries := range t.prices[endpointOrDefault(endpoint)] {
+		if !strings.HasPrefix(model, prefix) || (found && len(prefix) <= len(best)) {
+			continue
+		}
+		// The last entry effective at or before at
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].EffectiveFrom.After(at) })
+		if i == 0 {
+			continue
+		}
+		best, price, found = prefix, entries[i-1].ModelPrice, true
+	}
+	return price, found
+}
+
+// CalculateCost prices the event according to its endpoint type, using the
+// price in effect at the event's Timestamp (or now, when it has none). Chat
+// events are charged for prompt and completion tokens, embedding and
+// moderation events for input tokens only, and image events per request.
+func (t *PricingTable) CalculateCost(event TelemetryEvent) (float64, error) {
+	endpoint := endpointOrDefault(event.EndpointType)
+	if !validEndpoint(endpoint) {
+		return 0, fmt.Errorf("unknown endpoint type %q", event.EndpointType)
+	}
+
+	at := t.now()
+	if ts, err := time.Parse(time.RFC3339Nano, event.Timestamp); err == nil {
+		at = ts
+	}
+
+	price, ok := t.PriceAt(endpoint, event.ModelName, at)
+	if !ok {
+		t.unpriced.Add(1)
+		return 0, fmt.Errorf("no %s price for model %q", endpoint, event.ModelName)
+	}
+
+	switch endpoint {
+	case EndpointChat:
+		return float64(event.PromptTokens)*price.InputPerToken + float64(event.CompletionTokens)*price.OutputPerToken, nil
+	case EndpointEmbedding, EndpointModeration:
+		return float64(event.PromptTokens) * price.InputPerToken, nil
+	default:
+		return price.PerRequest, nil
+	}
+}
+
+// CostFor returns the cost of a chat call to model with the given token
+// counts at the current prices, or an error wrapping ErrUnknownModel when
+// neither the model, a prefix of it nor a fallback has a chat price
+func (t *PricingTable) CostFor(model string, promptTokens, completionTokens int) (float64, error) {
+	if promptTokens < 0 || completionTokens < 0 {
+		return 0, fmt.Errorf("negative token count for model %q", model)
+	}
+
+	price, ok := t.Price(EndpointChat, model)
+	if !ok {
+		t.unpriced.Add(1)
+		return 0, fmt.Errorf("%w %q", ErrUnknownModel, model)
+	}
+	return float64(promptTokens)*price.InputPerToken + float64(completionTokens)*price.OutputPerToken, nil
+}
+
+// Unpriced returns the number of costs CalculateCost and CostFor left at
+// zero because the model had no price
+func (t *PricingTable) Unpriced() int64 {
+	return t.unpriced.Load()
+}
+
+// MissingModels returns the models without a chat price in effect now,
+// whether registered for the model itself or for a prefix of its name. The
+// fallback price for an empty model name does not count: it is a catch-all
+// that would price a missing model wrongly rather than not at all.
+func (t *PricingTable) MissingModels(models []string) []string {
+	now := t.now()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var missing []string
+	for _, model := range models {
+		priced := false
+		for prefix, entries := range t.prices[EndpointChat] {
+			if prefix != "" && strings.HasPrefix(model, prefix) && !entries[0].EffectiveFrom.After(now) {
+				priced = true
+				break
+			}
+		}
+		if !priced {
+			missing = append(missing, model)
+		}
+	}
+	return missing
+}
+
+// CheckModels returns an error wrapping ErrIncompletePricing, naming the
+// missing models, unless every model has a price. Run it at startup with
+// the models traffic is expected to use, to fail fast or warn on gaps.
+func (t *PricingTable) CheckModels(models []string) error {
+	missing := t.MissingModels(models)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: no price for %s", ErrIncompletePricing, strings.Join(missing, ", "))
+}
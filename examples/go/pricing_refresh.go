@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PricingProvider supplies the complete, current list of dated prices
+type PricingProvider interface {
+	Prices(ctx context.Context) ([]PriceEntry, error)
+}
+
+// FilePricingProvider reads prices from a JSON or YAML file holding an
+// array of PriceEntry objects. The file is re-read on every refresh, so
+// editing it updates a running producer.
+type FilePricingProvider struct {
+	Path string
+}
+
+// Prices reads and parses the file
+func (p FilePricingProvider) Prices(ctx context.Context) ([]PriceEntry, error) {
+	return readPriceFile(p.Path)
+}
+
+// LoadPricingTable creates a pricing table from a price file, read as YAML
+// when its extension is .yaml or .yml and as JSON otherwise
+func LoadPricingTable(path string) (*PricingTable, error) {
+	entries, err := readPriceFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := NewPricingTable()
+	table.Replace(entries)
+	return table, nil
+}
+
+// readPriceFile reads and parses a JSON or YAML price file
+func readPriceFile(path string) ([]PriceEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prices: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Re-encode as JSON so both formats share the JSON field names
+		var prices interface{}
+		if err := yaml.Unmarshal(data, &prices); err != nil {
+			return nil, fmt.Errorf("failed to parse prices: %w", err)
+		}
+		if data, err = json.Marshal(prices); err != nil {
+			return nil, fmt.Errorf("failed to parse prices: %w", err)
+		}
+	}
+	return parsePriceEntries(data)
+}
+
+// HTTPPricingProvider fetches prices as a JSON array of PriceEntry objects
+type HTTPPricingProvider struct {
+	URL string
+	// Client is used for requests (default: http.DefaultClient)
+	Client *http.Client
+}
+
+// Prices fetches and parses the price list
+func (p HTTPPricingProvider) Prices(ctx context.Context) ([]PriceEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch prices: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %w", err)
+	}
+	return parsePriceEntries(data)
+}
+
+// parsePriceEntries decodes and validates a JSON price list
+func parsePriceEntries(data []byte) ([]PriceEntry, error) {
+	var entries []PriceEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse prices: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("price list is empty")
+	}
+	for _, entry := range entries {
+		if !validEndpoint(entry.Endpoint) {
+			return nil, fmt.Errorf("unknown endpoint_type %q for model %q", entry.Endpoint, entry.Model)
+		}
+	}
+	return entries, nil
+}
+
+// PricingRefresher periodically replaces a pricing table's prices with
+// those from a provider, so long-running producers pick up new prices
+// without a restart. A failed refresh is logged and the previous prices
+// are kept.
+type PricingRefresher struct {
+	table    *PricingTable
+	provider PricingProvider
+	interval time.Duration
+
+	mu      sync.Mutex
+	lastErr error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewPricingRefresher loads the table from the provider once, returning
+// the error if that fails, and then refreshes it every interval (default: 5m)
+func NewPricingRefresher(ctx context.Context, table *PricingTable, provider PricingProvider, interval time.Duration) (*PricingRefresher, error) {
+	r := newPricingRefresher(table, provider, interval)
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	return r, nil
+}
+
+// newPricingRefresher creates a refresher without loading or starting its ticker
+func newPricingRefresher(table *PricingTable, provider PricingProvider, interval time.Duration) *PricingRefresher {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	return &PricingRefresher{
+		table:    table,
+		provider: provider,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Refresh replaces the table's prices with the provider's current list
+func (r *PricingRefresher) Refresh(ctx context.Context) error {
+	entries, err := r.provider.Prices(ctx)
+
+	r.mu.Lock()
+	r.lastErr = err
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	r.table.Replace(entries)
+	return nil
+}
+
+// Err returns the error of the most recent refresh, or nil if it succeeded
+func (r *PricingRefresher) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastErr
+}
+
+// Close stops the ticker
+func (r *PricingRefresher) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// run refreshes on every tick until Close
+func (r *PricingRefresher) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh prices, keeping previous prices: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculateCostPerEndpointType(t *testing.T) {
+	table := NewPricingTable()
+	table.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006})
+	table.Set(EndpointEmbedding, "text-embedding-3-small", ModelPrice{InputPerToken: 0.00000002, OutputPerToken: 1})
+	table.Set(EndpointModeration, "", ModelPrice{})
+	table.Set(EndpointImage, "dall-e-3", ModelPrice{InputPerToken: 1, PerRequest: 0.04})
+
+	tests := []struct {
+		name     string
+		endpoint EndpointType
+		model    string
+		prompt   int
+		complete int
+		want     float64
+	}{
+		{"chat", EndpointChat, "gpt-4", 1000, 500, 0.03 + 0.03},
+		{"empty endpoint is chat", "", "gpt-4", 1000, 500, 0.06},
+		{"chat prefix match", EndpointChat, "gpt-4-turbo", 1000, 0, 0.03},
+		{"embedding charges input only", EndpointEmbedding, "text-embedding-3-small", 1000000, 0, 0.02},
+		{"embedding ignores completion", EndpointEmbedding, "text-embedding-3-small", 1000000, 10, 0.02},
+		{"moderation fallback", EndpointModeration, "omni-moderation-latest", 500, 0, 0},
+		{"image per request", EndpointImage, "dall-e-3", 50, 0, 0.04},
+	}
+
+	for _, tt := range tests {
+		event := TelemetryEvent{EndpointType: tt.endpoint, ModelName: tt.model, PromptTokens: tt.prompt, CompletionTokens: tt.complete}
+		got, err := table.CalculateCost(event)
+		if err != nil {
+			t.Errorf("%s: CalculateCost: %v", tt.name, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: cost = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateCostErrors(t *testing.T) {
+	table := NewPricingTable()
+	table.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003})
+
+	if _, err := table.CalculateCost(TelemetryEvent{EndpointType: EndpointEmbedding, ModelName: "gpt-4"}); err == nil {
+		t.Error("priced an embedding with only chat prices registered")
+	}
+	if _, err := table.CalculateCost(TelemetryEvent{EndpointType: "audio", ModelName: "gpt-4"}); err == nil {
+		t.Error("priced an unknown endpoint type")
+	}
+}
+
+func TestIngestHandlerAcceptsEmbeddingWithoutCompletion(t *testing.T) {
+	handler := NewIngestHandler(gatewayProducer(&fakeWriter{}))
+
+	for body, want := range map[string]int{
+		`{"service_name":"search","model_name":"text-embedding-3-small","endpoint_type":"embedding","timestamp":"2024-01-15T10:00:00Z","prompt_tokens":512,"completion_tokens":0,"total_tokens":512}`: http.StatusAccepted,
+		`{"service_name":"search","model_name":"whisper-1","endpoint_type":"audio","timestamp":"2024-01-15T10:00:00Z"}`:                                                                               http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
+
+// scriptedPricingProvider returns the current price list, which tests change mid-run
+type scriptedPricingProvider struct {
+	entries []PriceEntry
+	err     error
+}
+
+func (p *scriptedPricingProvider) Prices(ctx context.Context) ([]PriceEntry, error) {
+	return p.entries, p.err
+}
+
+func TestPricingRefreshAppliesPricesByEffectiveDate(t *testing.T) {
+	cut := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	provider := &scriptedPricingProvider{entries: []PriceEntry{
+		{Endpoint: EndpointChat, Model: "gpt-4", ModelPrice: ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006}},
+	}}
+
+	table := NewPricingTable()
+	table.now = func() time.Time { return cut.Add(24 * time.Hour) }
+	refresher := newPricingRefresher(table, provider, time.Minute)
+	if err := refresher.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	before := TelemetryEvent{Timestamp: "2024-02-15T12:00:00Z", ModelName: "gpt-4", PromptTokens: 1000, CompletionTokens: 1000}
+	after := before
+	after.Timestamp = "2024-03-15T12:00:00Z"
+
+	cost := func(event TelemetryEvent) float64 {
+		t.Helper()
+		c, err := table.CalculateCost(event)
+		if err != nil {
+			t.Fatalf("CalculateCost: %v", err)
+		}
+		return c
+	}
+	if got := cost(after); math.Abs(got-0.09) > 1e-9 {
+		t.Fatalf("cost before the price change = %v, want 0.09", got)
+	}
+
+	// The provider publishes a price cut effective from March mid-run
+	provider.entries = append(provider.entries, PriceEntry{
+		Endpoint: EndpointChat, Model: "gpt-4", EffectiveFrom: cut,
+		ModelPrice: ModelPrice{InputPerToken: 0.00001, OutputPerToken: 0.00003},
+	})
+	if err := refresher.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if got := cost(after); math.Abs(got-0.04) > 1e-9 {
+		t.Errorf("cost after the cut = %v, want 0.04", got)
+	}
+	if got := cost(before); math.Abs(got-0.09) > 1e-9 {
+		t.Errorf("historical cost = %v, want the old price's 0.09", got)
+	}
+	if price, _ := table.Price(EndpointChat, "gpt-4"); price.InputPerToken != 0.00001 {
+		t.Errorf("current price = %+v, want the cut price", price)
+	}
+
+	// A failing provider keeps the previous prices
+	provider.err = errors.New("pricing service unavailable")
+	if err := refresher.Refresh(context.Background()); err == nil || refresher.Err() == nil {
+		t.Error("expected refresh error")
+	}
+	if got := cost(after); math.Abs(got-0.04) > 1e-9 {
+		t.Errorf("cost after failed refresh = %v, want 0.04", got)
+	}
+}
+
+func TestPriceAtBeforeFirstEntry(t *testing.T) {
+	table := NewPricingTable()
+	table.SetEntry(PriceEntry{Model: "gpt-5", EffectiveFrom: time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), ModelPrice: ModelPrice{InputPerToken: 1}})
+	table.Set(EndpointChat, "", ModelPrice{InputPerToken: 2})
+
+	price, ok := table.PriceAt(EndpointChat, "gpt-5", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC))
+	if !ok || price.InputPerToken != 2 {
+		t.Errorf("PriceAt before gpt-5 launch = %+v, %v; want the fallback price", price, ok)
+	}
+}
+
+func TestFilePricingProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	data := `[{"endpoint_type": "chat", "model": "gpt-4", "effective_from": "2024-03-01T00:00:00Z", "input_per_token": 0.00001, "output_per_token": 0.00003}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := FilePricingProvider{Path: path}.Prices(context.Background())
+	if err != nil {
+		t.Fatalf("Prices: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Model != "gpt-4" || entries[0].OutputPerToken != 0.00003 || entries[0].EffectiveFrom.Month() != time.March {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	os.WriteFile(path, []byte(`[{"endpoint_type": "video", "model": "sora"}]`), 0o644)
+	if _, err := (FilePricingProvider{Path: path}).Prices(context.Background()); err == nil {
+		t.Error("expected error for unknown endpoint type")
+	}
+}
+
+func TestHTTPPricingProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"endpoint_type": "image", "model": "dall-e-3", "per_request": 0.08}]`))
+	}))
+	defer server.Close()
+
+	table := NewPricingTable()
+	refresher, err := NewPricingRefresher(context.Background(), table, HTTPPricingProvider{URL: server.URL}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewPricingRefresher: %v", err)
+	}
+	defer refresher.Close()
+
+	if price, ok := table.Price(EndpointImage, "dall-e-3"); !ok || price.PerRequest != 0.08 {
+		t.Errorf("Price = %+v, %v; want 0.08 per request", price, ok)
+	}
+}
+
+func TestCostFor(t *testing.T) {
+	table := NewPricingTable()
+	table.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006})
+
+	cost, err := table.CostFor("gpt-4", 1000, 500)
+	if err != nil || math.Abs(cost-0.06) > 1e-12 {
+		t.Errorf("CostFor(gpt-4, 1000, 500) = %v, %v, want 0.06", cost, err)
+	}
+
+	cost, err = table.CostFor("gpt-4", 0, 0)
+	if err != nil || cost != 0 {
+		t.Errorf("CostFor(gpt-4, 0, 0) = %v, %v, want 0", cost, err)
+	}
+
+	if _, err := table.CostFor("mystery-model", 100, 100); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("CostFor(unknown model) = %v, want ErrUnknownModel", err)
+	}
+	if _, err := table.CostFor("gpt-4", -1, 100); err == nil {
+		t.Error("expected error for a negative token count")
+	}
+}
+
+func TestLoadPricingTable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"prices.yaml": "- model: gpt-4\n  input_per_1k_tokens: 0.03\n  output_per_1k_tokens: 0.06\n",
+		"prices.json": `[{"model": "gpt-4", "input_per_1k_tokens": 0.03, "output_per_token": 0.00006}]`,
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		table, err := LoadPricingTable(path)
+		if err != nil {
+			t.Fatalf("LoadPricingTable(%s): %v", name, err)
+		}
+		if cost, err := table.CostFor("gpt-4-turbo", 2000, 1000); err != nil || math.Abs(cost-0.12) > 1e-12 {
+			t.Errorf("%s: CostFor(gpt-4-turbo, 2000, 1000) = %v, %v, want 0.12", name, cost, err)
+		}
+	}
+
+	if _, err := LoadPricingTable(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestCreatePricedEvent(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	table := NewPricingTable()
+	table.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006})
+
+	event, err := producer.CreatePricedEvent(table, "chat-api", "gpt-4", 1200, 150, 300, "user-1", "session-1", nil)
+	if err != nil || math.Abs(event.CostUsd-0.0225) > 1e-12 || event.TotalTokens != 450 {
+		t.Errorf("CreatePricedEvent = %+v, %v, want cost 0.0225", event, err)
+	}
+
+	event, err = producer.CreatePricedEvent(table, "chat-api", "llama-3", 1200, 150, 300, "user-1", "session-1", nil)
+	if !errors.Is(err, ErrUnknownModel) || event.CostUsd != 0 || event.RequestID == "" {
+		t.Errorf("CreatePricedEvent(unknown model) = %+v, %v, want a zero-cost event and ErrUnknownModel", event, err)
+	}
+}
+
+func TestCheckModels(t *testing.T) {
+	table := NewPricingTable()
+	table.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006})
+	table.Set(EndpointChat, "claude-3", ModelPrice{InputPerToken: 0.000015, OutputPerToken: 0.000075})
+	table.Set(EndpointChat, "", ModelPrice{InputPerToken: 0.000001, OutputPerToken: 0.000002})
+
+	if err := table.CheckModels([]string{"gpt-4", "gpt-4-turbo", "claude-3-opus"}); err != nil {
+		t.Errorf("CheckModels(complete) = %v, want nil", err)
+	}
+
+	err := table.CheckModels([]string{"gpt-4", "gpt-3.5-turbo", "claude-3-sonnet", "llama-3"})
+	if !errors.Is(err, ErrIncompletePricing) {
+		t.Fatalf("CheckModels(gaps) = %v, want ErrIncompletePricing", err)
+	}
+	if !strings.Contains(err.Error(), "gpt-3.5-turbo, llama-3") {
+		t.Errorf("error %q does not name the models priced only by the fallback", err)
+	}
+
+	// a price that is not in effect yet does not count
+	table.SetEntry(PriceEntry{Endpoint: EndpointChat, Model: "gpt-5", EffectiveFrom: time.Now().Add(time.Hour)})
+	if missing := table.MissingModels([]string{"gpt-5"}); len(missing) != 1 {
+		t.Errorf("MissingModels(gpt-5) = %v, want gpt-5 missing until its price takes effect", missing)
+	}
+}
+
+func TestUnpricedCountsZeroCosts(t *testing.T) {
+	table := NewPricingTable()
+	table.Set(EndpointChat, "gpt-4", ModelPrice{InputPerToken: 0.00003, OutputPerToken: 0.00006})
+
+	table.CostFor("gpt-4", 100, 100)
+	table.CostFor("llama-3", 100, 100)
+	table.CalculateCost(TelemetryEvent{ModelName: "mistral-large", PromptTokens: 100})
+	table.CalculateCost(TelemetryEvent{ModelName: "gpt-4", EndpointType: "video"})
+
+	if got := table.Unpriced(); got != 2 {
+		t.Errorf("Unpriced() = %d, want 2 for the two unknown models", got)
+	}
+}
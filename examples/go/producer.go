@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -21,6 +28,7 @@ type TelemetryEvent struct {
 	Timestamp        string                 `json:"timestamp"`
 	ServiceName      string                 `json:"service_name"`
 	ModelName        string                 `json:"model_name"`
+	EndpointType     EndpointType           `json:"endpoint_type,omitempty"`
 	LatencyMs        float64                `json:"latency_ms"`
 	PromptTokens     int                    `json:"prompt_tokens"`
 	CompletionTokens int                    `json:"completion_tokens"`
@@ -29,34 +37,209 @@ type TelemetryEvent struct {
 	UserID           string                 `json:"user_id"`
 	SessionID        string                 `json:"session_id"`
 	RequestID        string                 `json:"request_id"`
+	ParentRequestID  string                 `json:"parent_request_id,omitempty"`
+	IdempotencyKey   string                 `json:"idempotency_key,omitempty"`
 	PromptText       string                 `json:"prompt_text,omitempty"`
+	PromptHash       string                 `json:"prompt_hash,omitempty"`
 	ResponseText     string                 `json:"response_text,omitempty"`
+	ErrorCode        string                 `json:"error_code,omitempty"`
+	Flags            []string               `json:"flags,omitempty"`
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// messageWriter is the subset of *kafka.Writer used by the producer
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 // TelemetryProducer sends LLM telemetry events to Kafka
 type TelemetryProducer struct {
-	writer *kafka.Writer
+	writer messageWriter
 	topic  string
+
+	// KeyFunc derives the message key for each event (default: RequestIDKey)
+	KeyFunc KeyFunc
+
+	// IDGenerator creates the RequestID of events built by CreateTelemetryEvent
+	// (default: TimestampRequestID); it must be safe for concurrent use
+	IDGenerator IDGenerator
+
+	// Tracer records per-stage timing spans for sampled events (optional)
+	Tracer *Tracer
+
+	// Breaker fails sends fast per model while that model is failing (optional)
+	Breaker *KeyedCircuitBreaker
+
+	// Sampler drops events it does not keep before they are sent (optional)
+	Sampler Sampler
+
+	// Detector is the anomaly detector whose thresholds Reconfigure updates
+	// (optional). The producer does not evaluate events with it.
+	Detector *AnomalyDetector
+
+	// CostFilter drops events below a cost threshold before they are sampled (optional)
+	CostFilter *CostFilter
+
+	// RateLimit drops events from users the action currently limits (optional)
+	RateLimit *RateLimitUserAction
+
+	// Enricher adds lookup table fields to each event's metadata (optional)
+	Enricher *LookupEnricher
+
+	// TextSampler clears the prompt and response text of the events it does
+	// not sample (default: all text is sent)
+	TextSampler *TextSampler
+
+	// Redactor scrubs prompt and response text before serialization (optional)
+	Redactor Redactor
+
+	// RedactionScan checks redacted text for PII the Redactor missed and
+	// records redaction_hits in each event's metadata (optional)
+	RedactionScan *RedactionScanner
+
+	// SchemaTag tags messages with their registered schema ID (optional)
+	SchemaTag *SchemaTag
+
+	// Serializer encodes events into message values (default: JSON)
+	Serializer Serializer
+
+	// OmitFields removes fields from every JSON-encoded event (optional)
+	OmitFields *FieldOmitter
+
+	// Sanitizer repairs metadata values JSON cannot encode instead of failing the send (optional)
+	Sanitizer *MetadataSanitizer
+
+	// DropBadMetadata retries an event that fails to serialize without the
+	// metadata keys that fail on their own (optional)
+	DropBadMetadata bool
+
+	// Retry retries transient write failures such as leader elections (default: no retries)
+	Retry RetryPolicy
+
+	// PerEventTimeout bounds each write to Kafka, failing it with an error
+	// wrapping context.DeadlineExceeded (set by WithPerEventTimeout)
+	PerEventTimeout time.Duration
+
+	// Logger receives the producer's log records (default: slog.Default())
+	Logger *slog.Logger
+
+	// ValidateBeforeSend rejects events that fail Validate (default: true)
+	ValidateBeforeSend bool
+
+	// TokenBudget rejects events over a per-model token limit (optional)
+	TokenBudget *TokenBudget
+
+	// FutureTimestamps rejects events timestamped too far ahead of now (optional)
+	FutureTimestamps *FutureTimestampCheck
+
+	// TrackLineage appends the producer stage to each event's lineage trail (optional)
+	TrackLineage bool
+
+	// TokenEfficiency adds the completion-to-prompt ratio and cost per 1000
+	// completion tokens to each event's metadata (optional)
+	TokenEfficiency bool
+
+	// Dedup skips events whose RequestID was already sent, returning
+	// ErrDuplicate (set by WithDedup)
+	Dedup *Deduper
+
+	// OnDrop is called with each event dropped on purpose and why (optional)
+	OnDrop func(event TelemetryEvent, reason DropReason)
+
+	// OnPermanentFailure is called with events that could not be delivered (optional)
+	OnPermanentFailure func(event TelemetryEvent, err error)
+
+	// DeadLetter persists events that could not be delivered (optional)
+	DeadLetter DeadLetterSink
+
+	// Transactions enables SendAtomic (optional)
+	Transactions TransactionalWriter
+	txnMu        sync.Mutex
+
+	// async buffers events for Enqueue (set by NewAsyncTelemetryProducer),
+	// drained by asyncWorkers goroutines (set by WithAsyncWorkers)
+	async        *asyncQueue
+	asyncWorkers int
+
+	// MaxBufferAge drops events that waited in the buffer for longer
+	// instead of sending them stale (default: no limit)
+	MaxBufferAge time.Duration
+
+	// valueCodec compresses message values with a registered codec (set by
+	// the option CodecRegistry.Compression returns)
+	valueCodec *valueCodec
+
+	paused   atomic.Bool
+	closing  producerClose
+	started  time.Time
+	counters sendCounters
+	metrics  *producerMetrics
+
+	// metricsRegistry and topicMetrics hold the collectors of the other
+	// topics SendAtomic writes to (see metricsFor)
+	metricsRegistry *prometheus.Registry
+	topicMetrics    sync.Map
+
+	// coalescing holds bursts of identical requests WithCoalescing (optional)
+	coalescing *producerCoalescing
+
+	// mu guards the fields swapped by Reconfigure
+	mu           sync.RWMutex
+	deniedModels map[string]struct{}
 }
 
-// NewTelemetryProducer creates a new telemetry producer
-func NewTelemetryProducer(brokers []string, topic string) *TelemetryProducer {
-	writer := &kafka.Writer{
-		Addr:         kafka.TCP(brokers...),
-		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
-		RequiredAcks: kafka.RequireAll,
-		MaxAttempts:  3,
-		WriteTimeout: 10 * time.Second,
-		ReadTimeout:  10 * time.Second,
+// NewTelemetryProducer creates a new telemetry producer; opts override the
+// defaults of its Kafka writer
+func NewTelemetryProducer(brokers []string, topic string, opts ...ProducerOption) *TelemetryProducer {
+	config := defaultWriterConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	writer := config.newWriter(brokers, topic)
+	logger := config.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var metrics *producerMetrics
+	if config.metrics != nil {
+		var err error
+		if metrics, err = newProducerMetrics(config.metrics, topic); err != nil {
+			logger.Warn("Producer metrics disabled", "topic", topic, "error", err)
+		}
 	}
 
-	log.Printf("Connected to Kafka brokers: %v", brokers)
-	return &TelemetryProducer{
-		writer: writer,
-		topic:  topic,
+	serializer := config.serializer
+	if config.schemaRegistryURL != "" {
+		serializer = NewAvroSerializer(config.schemaRegistryURL, topic+"-value")
+	}
+
+	logger.Info("Connected to Kafka brokers", "brokers", brokers, "topic", topic)
+	p := &TelemetryProducer{
+		writer:             writer,
+		topic:              topic,
+		Redactor:           config.redactor,
+		DeadLetter:         config.deadLetter,
+		Dedup:              config.deduper,
+		KeyFunc:            config.keyFunc,
+		TextSampler:        config.textSampler,
+		Logger:             logger,
+		PerEventTimeout:    config.perEventTimeout,
+		Retry:              config.retry,
+		Breaker:            config.breaker,
+		Serializer:         serializer,
+		valueCodec:         config.valueCodec,
+		ValidateBeforeSend: true,
+		started:            time.Now(),
+		metrics:            metrics,
+		metricsRegistry:    config.metrics,
+		asyncWorkers:       config.asyncWorkers,
+	}
+	if config.coalescer != nil {
+		p.startCoalescing(config.coalescer)
 	}
+	return p
 }
 
 // CreateTelemetryEvent creates a telemetry event
@@ -68,7 +251,11 @@ func (p *TelemetryProducer) CreateTelemetryEvent(
 	userID, sessionID string,
 	metadata map[string]interface{},
 ) TelemetryEvent {
-	requestID := fmt.Sprintf("req-%d-%d", time.Now().UnixMilli(), rand.Intn(10000))
+	newID := p.IDGenerator
+	if newID == nil {
+		newID = TimestampRequestID
+	}
+	requestID := newID()
 
 	return TelemetryEvent{
 		Timestamp:        time.Now().UTC().Format(time.RFC3339Nano),
@@ -82,167 +269,573 @@ func (p *TelemetryProducer) CreateTelemetryEvent(
 		UserID:           userID,
 		SessionID:        sessionID,
 		RequestID:        requestID,
+		IdempotencyKey:   NewIdempotencyKey(),
 		Metadata:         metadata,
 	}
 }
 
+// CreatePricedEvent creates a telemetry event whose cost is computed from
+// the pricing table with CostFor, so callers need not pass it. For a model
+// the table has no price for it returns the event with zero cost and the
+// error.
+func (p *TelemetryProducer) CreatePricedEvent(
+	pricing *PricingTable,
+	serviceName, modelName string,
+	latencyMs float64,
+	promptTokens, completionTokens int,
+	userID, sessionID string,
+	metadata map[string]interface{},
+) (TelemetryEvent, error) {
+	costUsd, err := pricing.CostFor(modelName, promptTokens, completionTokens)
+	event := p.CreateTelemetryEvent(serviceName, modelName, latencyMs, promptTokens, completionTokens,
+		costUsd, userID, sessionID, metadata)
+	return event, err
+}
+
 // SendEvent sends a telemetry event to Kafka
 func (p *TelemetryProducer) SendEvent(ctx context.Context, event TelemetryEvent) error {
-	value, err := json.Marshal(event)
+	return p.SendEvents(ctx, []TelemetryEvent{event})
+}
+
+// SendEventWithRetry sends a telemetry event like SendEvent, but retries
+// transient write failures with policy instead of the producer's Retry. It
+// waits between attempts unless ctx is done. Events rejected before the
+// write, e.g. because they do not marshal, are never retried.
+func (p *TelemetryProducer) SendEventWithRetry(ctx context.Context, event TelemetryEvent, policy RetryPolicy) error {
+	_, err := p.sendEvents(ctx, []TelemetryEvent{event}, policy)
+	return err
+}
+
+// pendingSend is an event that passed the producer's checks, with its
+// message and trace
+type pendingSend struct {
+	event TelemetryEvent
+	msg   kafka.Message
+	trace *eventTrace
+}
+
+// SendEvents sends events to Kafka in a single write, so kafka-go can batch
+// them over the wire. Each event goes through the same checks as with
+// SendEvent. Events that cannot be sent, e.g. because their metadata does
+// not marshal, are reported in the returned error, joined with errors.Join
+// and naming their RequestIDs; the rest are still sent.
+func (p *TelemetryProducer) SendEvents(ctx context.Context, events []TelemetryEvent) error {
+	_, err := p.sendEvents(ctx, events, p.Retry)
+	return err
+}
+
+// sendEvents implements SendEvents, retrying the write with policy. With
+// coalescing, events are first folded into their bursts and only the
+// bursts ready to go are sent. It returns the number of events sent.
+func (p *TelemetryProducer) sendEvents(ctx context.Context, events []TelemetryEvent, policy RetryPolicy) (int, error) {
+	if p.coalescing != nil {
+		events = p.coalescing.add(events)
+		if len(events) == 0 {
+			return 0, nil
+		}
+	}
+	return p.sendBatch(ctx, events, policy)
+}
+
+// sendBatch sends events in a single write, retrying it with policy, and
+// returns the number of events sent
+func (p *TelemetryProducer) sendBatch(ctx context.Context, events []TelemetryEvent, policy RetryPolicy) (int, error) {
+	sendStart := time.Now()
+	p.mu.RLock()
+	tracer, breaker, sampler := p.Tracer, p.Breaker, p.Sampler
+	deniedModels := p.deniedModels
+	p.mu.RUnlock()
+
+	var errs []error
+	pending := make([]pendingSend, 0, len(events))
+	for _, event := range events {
+		if p.paused.Load() {
+			p.counters.paused.Add(1)
+			p.dropped(event, DropPaused)
+			continue
+		}
+
+		if _, denied := deniedModels[event.ModelName]; denied {
+			p.counters.denied.Add(1)
+			p.dropped(event, DropFiltered)
+			p.logger().Info("Dropped event for denied model", "request_id", event.RequestID, "model", event.ModelName)
+			continue
+		}
+
+		trace := tracer.startTrace(event.RequestID, p.logger())
+		if p.ValidateBeforeSend {
+			endValidate := trace.span(StageValidate)
+			err := event.Validate()
+			endValidate()
+			if err != nil {
+				p.counters.invalid.Add(1)
+				p.dropped(event, DropFiltered)
+				errs = append(errs, fmt.Errorf("rejected event %s: %w", event.RequestID, err))
+				continue
+			}
+		}
+
+		if err := p.TokenBudget.Check(event); err != nil {
+			p.counters.overBudget.Add(1)
+			p.dropped(event, DropBudget)
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := p.FutureTimestamps.Check(event); err != nil {
+			p.counters.future.Add(1)
+			p.dropped(event, DropFiltered)
+			errs = append(errs, err)
+			continue
+		}
+
+		// canaries measure the pipeline, so the stages thinning out traffic
+		// must not drop them
+		canary := IsCanary(event)
+		if !canary && p.RateLimit != nil && p.RateLimit.Limited(event.UserID) {
+			p.counters.limited.Add(1)
+			p.dropped(event, DropRateLimited)
+			continue
+		}
+
+		if !canary && !p.CostFilter.Keep(event) {
+			p.counters.belowCost.Add(1)
+			p.dropped(event, DropFiltered)
+			continue
+		}
+
+		if !canary && sampler != nil && !sampler.Sample(event) {
+			p.counters.sampledOut.Add(1)
+			p.dropped(event, DropSampled)
+			continue
+		}
+
+		if !p.Dedup.Reserve(event.RequestID) {
+			p.counters.duplicate.Add(1)
+			p.dropped(event, DropDuplicate)
+			errs = append(errs, fmt.Errorf("skipped event %s: %w", event.RequestID, ErrDuplicate))
+			continue
+		}
+
+		ps, err := p.prepareSend(ctx, event, trace)
+		if err != nil {
+			p.Dedup.Release(event.RequestID)
+			p.counters.failed.Add(1)
+			p.metrics.recordFailed(1)
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := breaker.Allow(ps.event.ModelName); err != nil {
+			err = fmt.Errorf("failed to send event %s for model %s: %w", ps.event.RequestID, ps.event.ModelName, err)
+			p.Dedup.Release(ps.event.RequestID)
+			p.permanentFailure(ps.event, err)
+			errs = append(errs, err)
+			continue
+		}
+		pending = append(pending, ps)
+	}
+
+	if len(pending) == 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	msgs := make([]kafka.Message, len(pending))
+	requestIDs := make([]string, len(pending))
+	endWrites := make([]func(), len(pending))
+	for i, ps := range pending {
+		msgs[i] = ps.msg
+		requestIDs[i] = ps.event.RequestID
+		endWrites[i] = ps.trace.span(StageWrite)
+	}
+	writeStart := time.Now()
+	err := p.writeWithRetry(ctx, policy, requestIDs, msgs...)
+	p.counters.writes.Add(1)
+	p.counters.writeNanos.Add(int64(time.Since(writeStart)))
+	p.metrics.observeSend(sendStart)
+	for _, endWrite := range endWrites {
+		endWrite()
+	}
+
+	// kafka-go reports the outcome of each message of a multi-message write
+	var writeErrs kafka.WriteErrors
+	perMessage := errors.As(err, &writeErrs) && len(writeErrs) == len(pending)
+	sent := 0
+	// the breaker counts the write once per model, as failed if any of the
+	// model's messages failed, so one bad batch is one failure
+	var models []string
+	modelErrs := make(map[string]error)
+	for i, ps := range pending {
+		sendErr := err
+		if perMessage {
+			sendErr = writeErrs[i]
+		}
+
+		if modelErr, seen := modelErrs[ps.event.ModelName]; !seen || modelErr == nil {
+			if !seen {
+				models = append(models, ps.event.ModelName)
+			}
+			modelErrs[ps.event.ModelName] = sendErr
+		}
+		if sendErr != nil {
+			sendErr = fmt.Errorf("failed to send event %s: %w", ps.event.RequestID, sendErr)
+			p.Dedup.Release(ps.event.RequestID)
+			p.permanentFailure(ps.event, sendErr)
+			errs = append(errs, sendErr)
+			continue
+		}
+
+		sent++
+		p.counters.sent.Add(1)
+		p.metrics.recordSent(1)
+		p.counters.bytes.Add(int64(len(ps.msg.Value)))
+		p.logger().Debug("Sent event", "request_id", ps.event.RequestID, "topic", p.topic)
+	}
+	for _, model := range models {
+		breaker.Record(model, modelErrs[model])
+	}
+	return sent, errors.Join(errs...)
+}
+
+// prepareSend runs an event admitted for sending through the transforms of
+// the send pipeline, from enrichment to compression, and builds its
+// message. It fails only when the event cannot be serialized.
+func (p *TelemetryProducer) prepareSend(ctx context.Context, event TelemetryEvent, trace *eventTrace) (pendingSend, error) {
+	endEnrich := trace.span(StageEnrich)
+	enriched, err := p.Enricher.Enrich(ctx, event)
+	endEnrich()
+	if err != nil {
+		p.logger().Warn("Sending event without enrichment", "request_id", event.RequestID, "error", err)
+	}
+	event = enriched
+	if p.TokenEfficiency {
+		event = AddTokenEfficiency(event)
+	}
+
+	event = withIdempotencyKey(event)
+	if p.TrackLineage {
+		event = AppendLineage(event, LineageProducer, time.Now())
+	}
+
+	endRedact := trace.span(StageRedact)
+	event = p.TextSampler.Apply(event)
+	event, missed := p.RedactionScan.Scan(event, redactEvent(p.Redactor, event))
+	endRedact()
+	if len(missed) > 0 {
+		p.logger().Warn("Redaction missed PII", "request_id", event.RequestID, "patterns", missed)
+	}
+
+	endSerialize := trace.span(StageSerialize)
+	event, sanitized := p.Sanitizer.Sanitize(event)
+	if len(sanitized) > 0 {
+		p.logger().Warn("Sanitized metadata keys", "request_id", event.RequestID, "keys", sanitized)
+	}
+	value, err := p.marshalEvent(ctx, event)
+	if err != nil && p.DropBadMetadata {
+		var dropped []string
+		if event, dropped = p.dropBadMetadata(ctx, event); len(dropped) > 0 {
+			p.logger().Warn("Dropped metadata keys", "request_id", event.RequestID, "keys", dropped)
+			value, err = p.marshalEvent(ctx, event)
+		}
+	}
+	if err == nil {
+		value, err = p.valueCodec.compress(p.SchemaTag.frame(value))
+	}
+	endSerialize()
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return pendingSend{}, fmt.Errorf("failed to marshal event %s: %w", event.RequestID, err)
 	}
 
-	msg := kafka.Message{
-		Key:   []byte(event.RequestID),
-		Value: value,
-		Time:  time.Now(),
+	return pendingSend{
+		event: event,
+		msg: kafka.Message{
+			Key:     p.messageKey(event),
+			Value:   value,
+			Headers: p.messageHeaders(event),
+			Time:    time.Now(),
+		},
+		trace: trace,
+	}, nil
+}
+
+// sendRaw writes messages that are not telemetry events, such as window
+// summaries, quarantined anomalies and tombstones, under the producer's
+// write policy: the value codec, the circuit breaker keyed by topic, Retry
+// and PerEventTimeout, and the sent and failed counters and metrics. Schema
+// tags describe telemetry events, so they are not applied, and failures are
+// not dead-lettered since DeadLetter stores events.
+func (p *TelemetryProducer) sendRaw(ctx context.Context, msgs ...kafka.Message) error {
+	sendStart := time.Now()
+	p.mu.RLock()
+	breaker := p.Breaker
+	p.mu.RUnlock()
+
+	keys := make([]string, len(msgs))
+	for i := range msgs {
+		keys[i] = string(msgs[i].Key)
+		// a tombstone's value must stay nil for compaction to delete its key
+		if msgs[i].Value == nil {
+			continue
+		}
+		value, err := p.valueCodec.compress(msgs[i].Value)
+		if err != nil {
+			p.counters.failed.Add(int64(len(msgs)))
+			p.metrics.recordFailed(len(msgs))
+			return fmt.Errorf("failed to compress message: %w", err)
+		}
+		msgs[i].Value = value
+		msgs[i].Headers = append(msgs[i].Headers, p.valueCodec.headers()...)
 	}
 
-	err = p.writer.WriteMessages(ctx, msg)
+	if err := breaker.Allow(p.topic); err != nil {
+		p.counters.failed.Add(int64(len(msgs)))
+		p.metrics.recordFailed(len(msgs))
+		return err
+	}
+	writeStart := time.Now()
+	err := p.writeWithRetry(ctx, p.Retry, keys, msgs...)
+	p.counters.writes.Add(1)
+	p.counters.writeNanos.Add(int64(time.Since(writeStart)))
+	p.metrics.observeSend(sendStart)
+	breaker.Record(p.topic, err)
 	if err != nil {
-		return fmt.Errorf("failed to send event: %w", err)
+		p.counters.failed.Add(int64(len(msgs)))
+		p.metrics.recordFailed(len(msgs))
+		p.logger().Error("Failed to send messages", "topic", p.topic, "keys", keys, "error", err)
+		return err
 	}
 
-	log.Printf("Sent event %s to topic %s", event.RequestID, p.topic)
+	p.counters.sent.Add(int64(len(msgs)))
+	p.metrics.recordSent(len(msgs))
+	for _, msg := range msgs {
+		p.counters.bytes.Add(int64(len(msg.Value)))
+	}
 	return nil
 }
 
-// Close closes the producer
-func (p *TelemetryProducer) Close() error {
-	return p.writer.Close()
+// kafkaEmitter publishes records that are not telemetry events, such as
+// window summaries, to their own topic through a TelemetryProducer, so they
+// are written under its write policy with sendRaw
+type kafkaEmitter struct {
+	producer *TelemetryProducer
 }
 
-// SimulateNormalTraffic generates normal LLM traffic patterns
-func SimulateNormalTraffic(ctx context.Context, producer *TelemetryProducer, numEvents int) {
-	log.Printf("Simulating %d normal traffic events...", numEvents)
+// newKafkaEmitter creates an emitter for topic; opts configure its producer
+// as they do for NewTelemetryProducer, e.g. WithRetry, WithSASL or WithTLS
+func newKafkaEmitter(brokers []string, topic string, opts ...ProducerOption) kafkaEmitter {
+	return kafkaEmitter{producer: NewTelemetryProducer(brokers, topic, opts...)}
+}
+
+// Close closes the emitter's producer
+func (e kafkaEmitter) Close() error {
+	return e.producer.Close()
+}
+
+// submit buffers the event on an asynchronous producer and sends it otherwise
+func (p *TelemetryProducer) submit(ctx context.Context, event TelemetryEvent) error {
+	if p.async != nil {
+		return p.Enqueue(event)
+	}
+	return p.SendEvent(ctx, event)
+}
 
-	models := []string{"gpt-4", "gpt-3.5-turbo", "claude-3-opus", "claude-3-sonnet"}
-	services := []string{"chat-api", "completion-api", "assistant-api"}
-	regions := []string{"us-east-1", "us-west-2", "eu-west-1"}
+// messageHeaders returns the headers of the message carrying event
+func (p *TelemetryProducer) messageHeaders(event TelemetryEvent) []kafka.Header {
+	headers := idempotencyHeaders(event)
+	headers = append(headers, p.serializerHeaders()...)
+	headers = append(headers, p.SchemaTag.headers()...)
+	return append(headers, p.valueCodec.headers()...)
+}
+
+// logger returns the producer's Logger, or slog.Default() when it is unset
+func (p *TelemetryProducer) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.Default()
+	}
+	return p.Logger
+}
+
+// permanentFailure counts an undeliverable event, writes it to the dead
+// letter sink and passes it to the OnPermanentFailure hook
+func (p *TelemetryProducer) permanentFailure(event TelemetryEvent, err error) {
+	p.counters.failed.Add(1)
+	p.metrics.recordFailed(1)
+	if p.DeadLetter != nil {
+		if dlErr := p.DeadLetter.Write(event, err); dlErr != nil {
+			p.logger().Error("Lost event", "request_id", event.RequestID, "error", dlErr)
+		}
+	}
+	if p.OnPermanentFailure != nil {
+		p.OnPermanentFailure(event, err)
+	}
+}
+
+// SimulationResult reports the outcome of a simulation run
+type SimulationResult struct {
+	// Sent is the number of events accepted: sent, or buffered by an
+	// asynchronous producer
+	Sent int `json:"sent"`
+	// Failed is the number of events that could not be sent or buffered
+	Failed int `json:"failed"`
+	// Errors holds the error of each failed event, in order
+	Errors []error `json:"-"`
+}
+
+// record counts the outcome of one send
+func (r *SimulationResult) record(err error) {
+	if err != nil {
+		r.Failed++
+		r.Errors = append(r.Errors, err)
+		return
+	}
+	r.Sent++
+}
+
+// Pauses between simulated events, shortened by tests
+var (
+	normalTrafficInterval    = 100 * time.Millisecond
+	anomalousTrafficInterval = 500 * time.Millisecond
+)
+
+// anomalyDescriptions describes each anomaly kind in simulated event metadata
+var anomalyDescriptions = map[AnomalyKind]string{
+	AnomalyHighLatency:       "Extremely high latency",
+	AnomalyHighTokens:        "Unusually high token count",
+	AnomalyHighCost:          "Abnormally high cost",
+	AnomalySuspiciousPattern: "Suspicious usage pattern",
+}
+
+// SimulateNormalTraffic generates normal LLM traffic patterns drawn from
+// DefaultTrafficProfile. It stops early when ctx is cancelled; events not
+// generated by then are in neither count.
+func SimulateNormalTraffic(ctx context.Context, producer *TelemetryProducer, numEvents int) SimulationResult {
+	return DefaultTrafficProfile().SimulateNormalTraffic(ctx, producer, numEvents)
+}
+
+// SimulateAnomalousTraffic generates anomalous LLM traffic patterns drawn
+// from DefaultTrafficProfile. Like SimulateNormalTraffic it stops early when
+// ctx is cancelled.
+func SimulateAnomalousTraffic(ctx context.Context, producer *TelemetryProducer, numEvents int) SimulationResult {
+	return DefaultTrafficProfile().SimulateAnomalousTraffic(ctx, producer, numEvents)
+}
+
+// SimulateNormalTraffic generates normal traffic drawn from the profile's
+// Normal shape. The profile needs at least one model, service, user and
+// session.
+func (p TrafficProfile) SimulateNormalTraffic(ctx context.Context, producer *TelemetryProducer, numEvents int) SimulationResult {
+	producer.logger().Info("Simulating normal traffic", "events", numEvents)
+
+	var result SimulationResult
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	pricing := p.Pricing
+	if pricing == nil {
+		pricing = DefaultPricingTable()
+	}
 
 	for i := 0; i < numEvents; i++ {
 		select {
 		case <-ctx.Done():
-			return
+			return result
 		default:
 		}
 
-		// Normal latency: 500-3000ms
-		latencyMs := 500.0 + rand.Float64()*2500.0
+		latencyMs, promptTokens, completionTokens := p.Normal.sample(rng)
 
-		// Normal token counts
-		promptTokens := 50 + rand.Intn(450)
-		completionTokens := 100 + rand.Intn(700)
+		model := p.Models[rng.Intn(len(p.Models))]
 
-		// Calculate cost (example pricing)
-		model := models[rand.Intn(len(models))]
-		var costUsd float64
-		if strings.Contains(model, "gpt-4") {
-			costUsd = float64(promptTokens)*0.00003 + float64(completionTokens)*0.00006
-		} else {
-			costUsd = float64(promptTokens)*0.000001 + float64(completionTokens)*0.000002
+		metadata := map[string]interface{}{"api_version": "v1"}
+		if len(p.Regions) > 0 {
+			metadata["region"] = p.Regions[rng.Intn(len(p.Regions))]
 		}
 
-		event := producer.CreateTelemetryEvent(
-			services[rand.Intn(len(services))],
+		// unpriced models are sent with zero cost
+		event, _ := producer.CreatePricedEvent(
+			pricing,
+			p.Services[rng.Intn(len(p.Services))],
 			model,
 			latencyMs,
 			promptTokens,
 			completionTokens,
-			costUsd,
-			fmt.Sprintf("user-%d", rand.Intn(100)),
-			fmt.Sprintf("session-%d", rand.Intn(50)),
-			map[string]interface{}{
-				"region":      regions[rand.Intn(len(regions))],
-				"api_version": "v1",
-			},
+			fmt.Sprintf("user-%d", rng.Intn(p.Users)),
+			fmt.Sprintf("session-%d", rng.Intn(p.Sessions)),
+			metadata,
 		)
 
-		if err := producer.SendEvent(ctx, event); err != nil {
-			log.Printf("Error sending event: %v", err)
+		err := producer.submit(ctx, event)
+		if err != nil {
+			producer.logger().Error("Error sending event", "request_id", event.RequestID, "error", err)
 		}
+		result.record(err)
 
-		time.Sleep(100 * time.Millisecond)
+		if sleepContext(ctx, normalTrafficInterval) != nil {
+			return result
+		}
 	}
+	return result
 }
 
-// SimulateAnomalousTraffic generates anomalous LLM traffic patterns
-func SimulateAnomalousTraffic(ctx context.Context, producer *TelemetryProducer, numEvents int) {
-	log.Printf("Simulating %d anomalous traffic events...", numEvents)
+// SimulateAnomalousTraffic generates anomalous traffic, drawing each event
+// from the shape of a random kind in the profile's Anomalies. Anomalous
+// events come from one suspicious gpt-4 user of chat-api.
+func (p TrafficProfile) SimulateAnomalousTraffic(ctx context.Context, producer *TelemetryProducer, numEvents int) SimulationResult {
+	producer.logger().Info("Simulating anomalous traffic", "events", numEvents)
+
+	var result SimulationResult
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	pricing := p.Pricing
+	if pricing == nil {
+		pricing = DefaultPricingTable()
+	}
 
-	anomalyTypes := []struct {
-		Type        string
-		Description string
-	}{
-		{"high_latency", "Extremely high latency"},
-		{"high_tokens", "Unusually high token count"},
-		{"high_cost", "Abnormally high cost"},
-		{"suspicious_pattern", "Suspicious usage pattern"},
+	// Kinds are sorted so the draws do not depend on map iteration order
+	kinds := make([]AnomalyKind, 0, len(p.Anomalies))
+	for kind := range p.Anomalies {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	if len(kinds) == 0 {
+		return result
 	}
 
 	for i := 0; i < numEvents; i++ {
 		select {
 		case <-ctx.Done():
-			return
+			return result
 		default:
 		}
 
-		anomaly := anomalyTypes[rand.Intn(len(anomalyTypes))]
-		var latencyMs float64
-		var promptTokens, completionTokens int
-
-		switch anomaly.Type {
-		case "high_latency":
-			// Anomalous: 20-60 seconds
-			latencyMs = 20000.0 + rand.Float64()*40000.0
-			promptTokens = 100 + rand.Intn(400)
-			completionTokens = 200 + rand.Intn(600)
+		kind := kinds[rng.Intn(len(kinds))]
+		latencyMs, promptTokens, completionTokens := p.Anomalies[kind].sample(rng)
 
-		case "high_tokens":
-			// Anomalous: very high token count
-			latencyMs = 5000.0 + rand.Float64()*10000.0
-			promptTokens = 5000 + rand.Intn(10000)
-			completionTokens = 8000 + rand.Intn(12000)
-
-		case "high_cost":
-			// Anomalous: extremely high cost
-			latencyMs = 8000.0 + rand.Float64()*12000.0
-			promptTokens = 8000 + rand.Intn(7000)
-			completionTokens = 10000 + rand.Intn(15000)
-
-		default: // suspicious_pattern
-			// Multiple rapid requests from same user
-			latencyMs = 1000.0 + rand.Float64()*2000.0
-			promptTokens = 50 + rand.Intn(150)
-			completionTokens = 50 + rand.Intn(150)
-		}
-
-		costUsd := float64(promptTokens)*0.00003 + float64(completionTokens)*0.00006
-
-		event := producer.CreateTelemetryEvent(
+		event, _ := producer.CreatePricedEvent(
+			pricing,
 			"chat-api",
 			"gpt-4",
 			latencyMs,
 			promptTokens,
 			completionTokens,
-			costUsd,
 			"user-suspicious",
 			fmt.Sprintf("session-anomaly-%d", i),
 			map[string]interface{}{
-				"anomaly_type": anomaly.Type,
-				"description":  anomaly.Description,
+				"anomaly_type": kind.String(),
+				"description":  anomalyDescriptions[kind],
 				"simulated":    true,
 			},
 		)
 
-		if err := producer.SendEvent(ctx, event); err != nil {
-			log.Printf("Error sending event: %v", err)
+		err := producer.submit(ctx, event)
+		if err != nil {
+			producer.logger().Error("Error sending event", "request_id", event.RequestID, "error", err)
+		} else {
+			producer.logger().Info("Sent anomalous event", "request_id", event.RequestID, "anomaly_type", kind.String())
 		}
+		result.record(err)
 
-		log.Printf("Sent anomalous event: %s", anomaly.Type)
-		time.Sleep(500 * time.Millisecond)
+		if sleepContext(ctx, anomalousTrafficInterval) != nil {
+			return result
+		}
 	}
+	return result
 }
 
 func main() {
@@ -251,13 +844,110 @@ func main() {
 	normalEvents := flag.Int("normal-events", 20, "Number of normal events to generate")
 	anomalousEvents := flag.Int("anomalous-events", 5, "Number of anomalous events to generate")
 	continuous := flag.Bool("continuous", false, "Run continuously")
+	httpAddr := flag.String("http-addr", "", "Address to serve the HTTP ingestion gateway on (disabled when empty)")
+	pprofAddr := flag.String("pprof-addr", "", "Address to serve net/http/pprof endpoints on (disabled when empty)")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics (disabled when empty)")
+	bufferSize := flag.Int("buffer-size", 0, "Buffer up to this many simulated events and send them in the background (0 = send synchronously)")
+	traceSampleRate := flag.Float64("trace-sample-rate", 0, "Fraction of events (0.0-1.0) to log per-stage timing spans for")
+	compressionFlag := flag.String("compression", "none", "Compression codec for message batches: none, gzip, snappy, lz4 or zstd")
+	saslMechanism := flag.String("sasl-mechanism", "", "SASL mechanism: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 (password from KAFKA_SASL_PASSWORD)")
+	saslUsername := flag.String("sasl-username", "", "SASL username")
+	useTLS := flag.Bool("tls", false, "Connect to the brokers over TLS")
+	pricingFile := flag.String("pricing-file", "", "JSON or YAML price list to cost simulated events with (default: built-in example prices)")
+	expectedModels := flag.String("expected-models", "", "Comma-separated models the pricing table must price, checked at startup")
+	pricingCheck := flag.String("pricing-check", "fail", "What to do when -expected-models have no price: fail or warn")
 	flag.Parse()
 
+	// the producer logs to slog.Default() too; until it exists, main does
+	logger := slog.Default()
+
+	compression, err := ParseCompression(*compressionFlag)
+	if err != nil {
+		fatal(logger, "Invalid -compression", err)
+	}
+	opts := []ProducerOption{WithCompression(compression)}
+	if *saslMechanism != "" {
+		mechanism, err := ParseSASLMechanism(*saslMechanism, *saslUsername, os.Getenv("KAFKA_SASL_PASSWORD"))
+		if err != nil {
+			fatal(logger, "Invalid SASL configuration", err)
+		}
+		opts = append(opts, WithSASL(mechanism))
+	}
+	if *useTLS {
+		opts = append(opts, WithTLS(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+
+	profile := DefaultTrafficProfile()
+	profile.Pricing = DefaultPricingTable()
+	if *pricingFile != "" {
+		if profile.Pricing, err = LoadPricingTable(*pricingFile); err != nil {
+			fatal(logger, "Failed to load pricing table", err)
+		}
+	}
+	if *expectedModels != "" {
+		if err := profile.Pricing.CheckModels(strings.Split(*expectedModels, ",")); err != nil {
+			switch *pricingCheck {
+			case "warn":
+				logger.Warn("Pricing table is missing models", "error", err)
+			case "fail":
+				fatal(logger, "Pricing table is missing models", err)
+			default:
+				fatal(logger, "Invalid -pricing-check", fmt.Errorf("unknown -pricing-check %q, want fail or warn", *pricingCheck))
+			}
+		}
+	}
+	defer func() {
+		if n := profile.Pricing.Unpriced(); n > 0 {
+			logger.Warn("Events were costed at zero because their model had no price", "events", n)
+		}
+	}()
+
+	if *metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		opts = append(opts, WithMetrics(reg))
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+			logger.Info("Serving metrics", "addr", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				logger.Error("Metrics server error", "error", err)
+			}
+		}()
+	}
+
 	rand.Seed(time.Now().UnixNano())
 
 	brokers := strings.Split(*brokersFlag, ",")
-	producer := NewTelemetryProducer(brokers, *topicFlag)
+	if *saslMechanism != "" || *useTLS {
+		checkCtx, cancelCheck := context.WithTimeout(context.Background(), 30*time.Second)
+		err := CheckBrokers(checkCtx, brokers, opts...)
+		cancelCheck()
+		if err != nil {
+			fatal(logger, "Broker check failed", err)
+		}
+	}
+
+	var producer *TelemetryProducer
+	if *bufferSize > 0 {
+		producer = NewAsyncTelemetryProducer(brokers, *topicFlag, *bufferSize, opts...)
+	} else {
+		producer = NewTelemetryProducer(brokers, *topicFlag, opts...)
+	}
 	defer producer.Close()
+	logger = producer.logger()
+
+	if *traceSampleRate > 0 {
+		producer.Tracer = NewTracer(*traceSampleRate, nil)
+	}
+
+	if *pprofAddr != "" {
+		go func() {
+			logger.Info("Serving pprof", "addr", *pprofAddr)
+			if err := http.ListenAndServe(*pprofAddr, newPprofHandler()); err != nil {
+				logger.Error("pprof server error", "error", err)
+			}
+		}()
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -268,27 +958,52 @@ func main() {
 
 	go func() {
 		<-sigChan
-		log.Println("Received interrupt signal, shutting down...")
+		logger.Info("Received interrupt signal, shutting down")
 		cancel()
 	}()
 
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/v1/events", NewIngestHandler(producer))
+		server := &http.Server{Addr: *httpAddr, Handler: mux}
+
+		go func() {
+			logger.Info("Serving HTTP ingestion gateway", "addr", *httpAddr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("HTTP gateway error", "error", err)
+			}
+		}()
+		defer server.Shutdown(context.Background())
+	}
+
 	if *continuous {
-		log.Println("Running in continuous mode (Ctrl+C to stop)...")
+		logger.Info("Running in continuous mode (Ctrl+C to stop)")
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("Shutting down...")
+				logger.Info("Shutting down")
 				return
 			default:
-				SimulateNormalTraffic(ctx, producer, *normalEvents)
-				SimulateAnomalousTraffic(ctx, producer, *anomalousEvents)
-				log.Println("Waiting 10 seconds before next batch...")
+				logSimulation(logger, "normal", profile.SimulateNormalTraffic(ctx, producer, *normalEvents))
+				logSimulation(logger, "anomalous", profile.SimulateAnomalousTraffic(ctx, producer, *anomalousEvents))
+				logger.Info("Waiting before next batch", "delay", 10*time.Second)
 				time.Sleep(10 * time.Second)
 			}
 		}
 	} else {
-		SimulateNormalTraffic(ctx, producer, *normalEvents)
-		SimulateAnomalousTraffic(ctx, producer, *anomalousEvents)
-		log.Println("Finished generating events")
+		logSimulation(logger, "normal", profile.SimulateNormalTraffic(ctx, producer, *normalEvents))
+		logSimulation(logger, "anomalous", profile.SimulateAnomalousTraffic(ctx, producer, *anomalousEvents))
+		logger.Info("Finished generating events")
 	}
 }
+
+// logSimulation logs the counts of a simulation run
+func logSimulation(logger *slog.Logger, kind string, result SimulationResult) {
+	logger.Info("Simulated traffic", "kind", kind, "sent", result.Sent, "failed", result.Failed)
+}
+
+// fatal logs err and exits, for startup errors in main
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeWriter records written messages and optionally fails writes
+type fakeWriter struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	writes   int
+	writeErr error
+	closed   bool
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	if w.writeErr != nil {
+		return w.writeErr
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeWriter) Messages() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+func newTestProducer(w *fakeWriter) *TelemetryProducer {
+	return &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+}
+
+func testEvent(requestID string) TelemetryEvent {
+	return TelemetryEvent{
+		Timestamp:        "2024-01-15T10:30:45.123456789Z",
+		ServiceName:      "chat-api",
+		ModelName:        "gpt-4",
+		LatencyMs:        1234.5,
+		PromptTokens:     150,
+		CompletionTokens: 300,
+		TotalTokens:      450,
+		CostUsd:          0.0225,
+		UserID:           "user-1",
+		SessionID:        "session-1",
+		RequestID:        requestID,
+	}
+}
+
+var errTestBroker = errors.New("broker unavailable")
+
+// withoutSimulationPauses removes the pauses between simulated events for a test
+func withoutSimulationPauses(t *testing.T) {
+	normal, anomalous := normalTrafficInterval, anomalousTrafficInterval
+	normalTrafficInterval, anomalousTrafficInterval = 0, 0
+	t.Cleanup(func() { normalTrafficInterval, anomalousTrafficInterval = normal, anomalous })
+}
+
+// cancelAfterSink cancels a context once it has received n events
+type cancelAfterSink struct {
+	MemorySink
+	n      int
+	cancel context.CancelFunc
+}
+
+func (s *cancelAfterSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	s.MemorySink.Write(ctx, events)
+	if len(s.Events()) >= s.n {
+		s.cancel()
+	}
+	return nil
+}
+
+func TestSimulationResultCounts(t *testing.T) {
+	withoutSimulationPauses(t)
+	sink := &MemorySink{}
+	producer := NewSinkProducer(sink)
+
+	normal := SimulateNormalTraffic(context.Background(), producer, 25)
+	anomalous := SimulateAnomalousTraffic(context.Background(), producer, 5)
+
+	if normal.Sent != 25 || normal.Failed != 0 || len(normal.Errors) != 0 {
+		t.Errorf("normal result = %+v, want 25 sent", normal)
+	}
+	if anomalous.Sent != 5 || anomalous.Failed != 0 {
+		t.Errorf("anomalous result = %+v, want 5 sent", anomalous)
+	}
+	if got := len(sink.Events()); got != 30 {
+		t.Errorf("sink received %d events, want 30", got)
+	}
+}
+
+func TestSimulationResultStopsOnCancel(t *testing.T) {
+	withoutSimulationPauses(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := &cancelAfterSink{n: 7, cancel: cancel}
+	result := SimulateNormalTraffic(ctx, NewSinkProducer(sink), 20)
+
+	if result.Sent != 7 || result.Failed != 0 {
+		t.Errorf("result = %+v, want 7 sent before cancellation", result)
+	}
+	if got := len(sink.Events()); got != result.Sent {
+		t.Errorf("sink received %d events, result says %d", got, result.Sent)
+	}
+}
+
+func TestSimulationResultCountsFailures(t *testing.T) {
+	withoutSimulationPauses(t)
+	producer := newTestProducer(&fakeWriter{writeErr: errTestBroker})
+
+	result := SimulateAnomalousTraffic(context.Background(), producer, 3)
+
+	if result.Sent != 0 || result.Failed != 3 || len(result.Errors) != 3 {
+		t.Fatalf("result = %+v, want 3 failed", result)
+	}
+	if !errors.Is(result.Errors[0], errTestBroker) {
+		t.Errorf("Errors[0] = %v, want the broker error", result.Errors[0])
+	}
+}
+
+func TestSendEventsBatchesIntoOneWrite(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+
+	bad := testEvent("req-bad")
+	bad.Metadata = map[string]interface{}{"score": math.NaN()}
+	events := []TelemetryEvent{testEvent("req-1"), bad, testEvent("req-2")}
+
+	err := producer.SendEvents(context.Background(), events)
+	if err == nil || !strings.Contains(err.Error(), "req-bad") {
+		t.Fatalf("SendEvents = %v, want an error naming req-bad", err)
+	}
+	if strings.Contains(err.Error(), "req-1") || strings.Contains(err.Error(), "req-2") {
+		t.Errorf("SendEvents = %v, want only req-bad reported", err)
+	}
+
+	msgs := w.Messages()
+	if w.writes != 1 || len(msgs) != 2 {
+		t.Fatalf("got %d writes of %d messages, want 1 write of 2", w.writes, len(msgs))
+	}
+	if string(msgs[0].Key) != "req-1" || string(msgs[1].Key) != "req-2" {
+		t.Errorf("keys = %s, %s; want req-1, req-2", msgs[0].Key, msgs[1].Key)
+	}
+	if report := producer.Report(); report.Sent != 2 || report.Failed != 1 {
+		t.Errorf("report = %+v, want 2 sent and 1 failed", report)
+	}
+}
+
+func TestSendEventsReportsPerMessageWriteErrors(t *testing.T) {
+	var failed []string
+	producer := newTestProducer(&fakeWriter{writeErr: kafka.WriteErrors{nil, kafka.MessageSizeTooLarge}})
+	producer.OnPermanentFailure = func(event TelemetryEvent, err error) {
+		failed = append(failed, event.RequestID)
+	}
+
+	err := producer.SendEvents(context.Background(), []TelemetryEvent{testEvent("req-1"), testEvent("req-2")})
+	if !errors.Is(err, kafka.MessageSizeTooLarge) {
+		t.Fatalf("SendEvents = %v, want the oversized message error", err)
+	}
+	if len(failed) != 1 || failed[0] != "req-2" {
+		t.Errorf("permanent failures = %v, want only req-2", failed)
+	}
+	if report := producer.Report(); report.Sent != 1 || report.Failed != 1 {
+		t.Errorf("report = %+v, want 1 sent and 1 failed", report)
+	}
+}
+
+// recordHandler collects log records for inspection
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+// find returns the attributes of the first record with the message
+func (h *recordHandler) find(msg string) (map[string]slog.Value, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+func TestProducerLogsStructuredAttributes(t *testing.T) {
+	handler := &recordHandler{}
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm-telemetry", WithLogger(slog.New(handler)))
+	p.writer.Close()
+	p.writer = &fakeWriter{}
+	p.ValidateBeforeSend = false
+
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent returned %v", err)
+	}
+
+	attrs, ok := handler.find("Sent event")
+	if !ok {
+		t.Fatal("no Sent event record was logged")
+	}
+	if got := attrs["request_id"].String(); got != "req-1" {
+		t.Errorf("request_id = %q, want req-1", got)
+	}
+	if got := attrs["topic"].String(); got != "llm-telemetry" {
+		t.Errorf("topic = %q, want llm-telemetry", got)
+	}
+}
+
+func TestProducerLogsSentEventsAtDebug(t *testing.T) {
+	var buf strings.Builder
+	p := newTestProducer(&fakeWriter{})
+	p.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent returned %v", err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("logged at the default Info level: %s", buf.String())
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/llm-devops/llm-sentinel/examples/go telemetry.proto
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/llm-devops/llm-sentinel/examples/go/telemetrypb"
+	"google.golang.org/protobuf/proto"
+)
+
+// EventToProto converts an event to the struct generated from
+// telemetry.proto, for code moving to the generated type. Metadata values
+// are JSON-encoded, as on the wire.
+func EventToProto(event TelemetryEvent) (*telemetrypb.TelemetryEvent, error) {
+	pb := &telemetrypb.TelemetryEvent{
+		Timestamp:        event.Timestamp,
+		ServiceName:      event.ServiceName,
+		ModelName:        event.ModelName,
+		EndpointType:     string(event.EndpointType),
+		LatencyMs:        event.LatencyMs,
+		PromptTokens:     int64(event.PromptTokens),
+		CompletionTokens: int64(event.CompletionTokens),
+		TotalTokens:      int64(event.TotalTokens),
+		CostUsd:          event.CostUsd,
+		UserId:           event.UserID,
+		SessionId:        event.SessionID,
+		RequestId:        event.RequestID,
+		PromptText:       event.PromptText,
+		PromptHash:       event.PromptHash,
+		ResponseText:     event.ResponseText,
+		ErrorCode:        event.ErrorCode,
+		Flags:            event.Flags,
+		IdempotencyKey:   event.IdempotencyKey,
+		ParentRequestId:  event.ParentRequestID,
+	}
+
+	if len(event.Metadata) > 0 {
+		pb.Metadata = make(map[string]string, len(event.Metadata))
+		for key, value := range event.Metadata {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode metadata %q: %w", key, err)
+			}
+			pb.Metadata[key] = string(encoded)
+		}
+	}
+	return pb, nil
+}
+
+// EventFromProto converts the struct generated from telemetry.proto back
+// to an event, decoding its JSON-encoded metadata values
+func EventFromProto(pb *telemetrypb.TelemetryEvent) (TelemetryEvent, error) {
+	event := TelemetryEvent{
+		Timestamp:        pb.GetTimestamp(),
+		ServiceName:      pb.GetServiceName(),
+		ModelName:        pb.GetModelName(),
+		EndpointType:     EndpointType(pb.GetEndpointType()),
+		LatencyMs:        pb.GetLatencyMs(),
+		PromptTokens:     int(pb.GetPromptTokens()),
+		CompletionTokens: int(pb.GetCompletionTokens()),
+		TotalTokens:      int(pb.GetTotalTokens()),
+		CostUsd:          pb.GetCostUsd(),
+		UserID:           pb.GetUserId(),
+		SessionID:        pb.GetSessionId(),
+		RequestID:        pb.GetRequestId(),
+		PromptText:       pb.GetPromptText(),
+		PromptHash:       pb.GetPromptHash(),
+		ResponseText:     pb.GetResponseText(),
+		ErrorCode:        pb.GetErrorCode(),
+		Flags:            pb.GetFlags(),
+		IdempotencyKey:   pb.GetIdempotencyKey(),
+		ParentRequestID:  pb.GetParentRequestId(),
+	}
+
+	if len(pb.GetMetadata()) > 0 {
+		event.Metadata = make(map[string]interface{}, len(pb.GetMetadata()))
+		for key, value := range pb.GetMetadata() {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				return event, fmt.Errorf("failed to decode metadata %q: %w", key, err)
+			}
+			event.Metadata[key] = decoded
+		}
+	}
+	return event, nil
+}
+
+// unmarshalEventProto decodes an event in the telemetry.proto wire format.
+// Unknown fields are skipped so newer producers can add fields.
+func unmarshalEventProto(data []byte) (TelemetryEvent, error) {
+	var pb telemetrypb.TelemetryEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return TelemetryEvent{}, fmt.Errorf("invalid protobuf event: %w", err)
+	}
+	return EventFromProto(&pb)
+}
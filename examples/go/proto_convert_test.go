@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/llm-devops/llm-sentinel/examples/go/telemetrypb"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// protoCompatibleKind is the Go kind each proto field kind of
+// telemetry.proto is held in by TelemetryEvent
+var protoCompatibleKind = map[protoreflect.Kind]reflect.Kind{
+	protoreflect.StringKind: reflect.String,
+	protoreflect.Int64Kind:  reflect.Int,
+	protoreflect.DoubleKind: reflect.Float64,
+}
+
+func TestGeneratedEventIsFieldCompatible(t *testing.T) {
+	handWritten := make(map[string]reflect.Type)
+	eventType := reflect.TypeOf(TelemetryEvent{})
+	for i := 0; i < eventType.NumField(); i++ {
+		field := eventType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		handWritten[name] = field.Type
+	}
+
+	fields := (&telemetrypb.TelemetryEvent{}).ProtoReflect().Descriptor().Fields()
+	if fields.Len() != len(handWritten) {
+		t.Errorf("telemetry.proto has %d fields, TelemetryEvent has %d", fields.Len(), len(handWritten))
+	}
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		name := string(field.Name())
+		goType, ok := handWritten[name]
+		if !ok {
+			t.Errorf("proto field %s is missing from TelemetryEvent", name)
+			continue
+		}
+		delete(handWritten, name)
+
+		switch {
+		case field.IsMap():
+			if field.MapKey().Kind() != protoreflect.StringKind || field.MapValue().Kind() != protoreflect.StringKind ||
+				goType != reflect.TypeOf(map[string]interface{}{}) {
+				t.Errorf("%s: map<%s, %s> is held in %s, want map<string, string> of JSON values", name,
+					field.MapKey().Kind(), field.MapValue().Kind(), goType)
+			}
+		case field.IsList():
+			if goType.Kind() != reflect.Slice || goType.Elem().Kind() != protoCompatibleKind[field.Kind()] {
+				t.Errorf("%s: repeated %s is held in %s", name, field.Kind(), goType)
+			}
+		default:
+			if goType.Kind() != protoCompatibleKind[field.Kind()] {
+				t.Errorf("%s: %s is held in %s", name, field.Kind(), goType)
+			}
+		}
+	}
+	for name := range handWritten {
+		t.Errorf("TelemetryEvent field %s is missing from telemetry.proto", name)
+	}
+}
+
+// protoGolden is the telemetry.proto encoding of protoGoldenEvent, pinned
+// so a change to the schema or the encoder cannot silently change the
+// bytes consumers decode
+const protoGolden = "0a14323032342d30312d31355431303a30303a30305a1208636861742d6170691a056770742d34" +
+	"2204636861742900000000004a934030960138ac0240c20349d9cef753e3a58b3f5206757365722d31" +
+	"62057265712d318a01046265746192010c0a07617474656d70741201329201150a06726567696f6e12" +
+	"0b2275732d656173742d3122"
+
+var protoGoldenEvent = TelemetryEvent{
+	Timestamp:        "2024-01-15T10:00:00Z",
+	ServiceName:      "chat-api",
+	ModelName:        "gpt-4",
+	EndpointType:     EndpointChat,
+	LatencyMs:        1234.5,
+	PromptTokens:     150,
+	CompletionTokens: 300,
+	TotalTokens:      450,
+	CostUsd:          0.0135,
+	UserID:           "user-1",
+	RequestID:        "req-1",
+	Flags:            []string{"beta"},
+	Metadata:         map[string]interface{}{"region": "us-east-1", "attempt": float64(2)},
+}
+
+func TestProtobufSerializerMatchesGolden(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		wire, err := ProtobufSerializer{}.Marshal(protoGoldenEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(wire); got != protoGolden {
+			t.Fatalf("encoding = %s, want %s", got, protoGolden)
+		}
+	}
+
+	wire, err := hex.DecodeString(protoGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := unmarshalEventProto(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, protoGoldenEvent) {
+		t.Errorf("decoded %+v, want %+v", decoded, protoGoldenEvent)
+	}
+}
+
+func TestProtobufDecodeSkipsUnknownFields(t *testing.T) {
+	wire, err := ProtobufSerializer{}.Marshal(testEvent("req-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// field 99, a varint a newer producer might add
+	wire = append(wire, 0x98, 0x06, 0x01)
+
+	decoded, err := unmarshalEventProto(wire)
+	if err != nil {
+		t.Fatalf("unmarshalEventProto: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, testEvent("req-1")) {
+		t.Errorf("decoded %+v, want %+v", decoded, testEvent("req-1"))
+	}
+	if _, err := unmarshalEventProto([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("truncated message decoded without error")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateTrackerConfig configures a RateTracker
+type RateTrackerConfig struct {
+	// Capacity is the number of recent request times kept per user, which
+	// caps the count IsBursting can see (default: 1000)
+	Capacity int
+	// IdleTTL evicts users with no requests processed for this long (default: 10m)
+	IdleTTL time.Duration
+}
+
+// RateTracker records the request times of each user so callers can ask
+// whether a user is bursting, such as a client rapidly retrying the same
+// prompt. Each user's times are kept in a fixed-size ring buffer and users
+// idle for longer than IdleTTL are evicted, so memory stays bounded. It is
+// safe for concurrent use, so several consumers can share one tracker.
+type RateTracker struct {
+	mu        sync.Mutex
+	config    RateTrackerConfig
+	now       func() time.Time
+	users     map[string]*userRequests
+	lastSweep time.Time
+}
+
+// userRequests is a ring buffer of one user's request times
+type userRequests struct {
+	times []time.Time
+	next  int
+	// latest is the newest request time, which windows end at
+	latest time.Time
+	// touched is the processing time of the latest request, for eviction
+	touched time.Time
+}
+
+// NewRateTracker creates a tracker, applying defaults for zero config values
+func NewRateTracker(config RateTrackerConfig) *RateTracker {
+	if config.Capacity <= 0 {
+		config.Capacity = 1000
+	}
+	if config.IdleTTL <= 0 {
+		config.IdleTTL = 10 * time.Minute
+	}
+	return &RateTracker{config: config, now: time.Now, users: make(map[string]*userRequests)}
+}
+
+// Record adds the event's timestamp to its user's requests. Events without
+// a UserID are ignored.
+func (t *RateTracker) Record(event TelemetryEvent) {
+	if event.UserID == "" {
+		return
+	}
+	ts := eventTime(event)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.evictIdle(now)
+
+	user, ok := t.users[event.UserID]
+	if !ok {
+		user = &userRequests{times: make([]time.Time, 0, min(t.config.Capacity, 16))}
+		t.users[event.UserID] = user
+	}
+	user.touched = now
+	if ts.After(user.latest) {
+		user.latest = ts
+	}
+
+	if len(user.times) < t.config.Capacity {
+		user.times = append(user.times, ts)
+		return
+	}
+	user.times[user.next] = ts
+	user.next = (user.next + 1) % t.config.Capacity
+}
+
+// IsBursting reports whether the user made more than threshold requests in
+// the window ending at their latest request. Request times are taken from
+// the event timestamps, so replayed traffic is judged by when it originally
+// happened.
+func (t *RateTracker) IsBursting(userID string, window time.Duration, threshold int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	user, ok := t.users[userID]
+	if !ok {
+		return false
+	}
+
+	start := user.latest.Add(-window)
+	count := 0
+	for _, ts := range user.times {
+		if ts.After(start) {
+			count++
+		}
+	}
+	return count > threshold
+}
+
+// Users returns the number of users currently tracked
+func (t *RateTracker) Users() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.users)
+}
+
+// EvictIdle drops users with no requests processed since cutoff
+func (t *RateTracker) EvictIdle(cutoff time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	evicted := 0
+	for id, user := range t.users {
+		if user.touched.Before(cutoff) {
+			delete(t.users, id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// evictIdle drops users idle for longer than IdleTTL, at most once per IdleTTL
+func (t *RateTracker) evictIdle(now time.Time) {
+	if now.Sub(t.lastSweep) < t.config.IdleTTL {
+		return
+	}
+	t.lastSweep = now
+
+	for id, user := range t.users {
+		if now.Sub(user.touched) > t.config.IdleTTL {
+			delete(t.users, id)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func userEventAt(userID string, ts time.Time) TelemetryEvent {
+	event := eventAt(fmt.Sprintf("req-%s-%d", userID, ts.UnixNano()), "session-1", ts)
+	event.UserID = userID
+	return event
+}
+
+func TestRateTrackerDetectsBurstingUser(t *testing.T) {
+	tracker := NewRateTracker(RateTrackerConfig{})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	// several consumers share the tracker
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tracker.Record(userEventAt("user-suspicious", start.Add(time.Duration(i)*45*time.Millisecond)))
+			tracker.Record(userEventAt("user-steady", start.Add(time.Duration(i)*10*time.Second)))
+		}(i)
+	}
+	wg.Wait()
+
+	if !tracker.IsBursting("user-suspicious", time.Second, 10) {
+		t.Error("20 requests within one second were not detected as bursting")
+	}
+	if tracker.IsBursting("user-steady", time.Second, 10) {
+		t.Error("a user sending one request every 10s was detected as bursting")
+	}
+	if tracker.IsBursting("user-unknown", time.Second, 10) {
+		t.Error("an unseen user was detected as bursting")
+	}
+}
+
+func TestRateTrackerBoundsMemory(t *testing.T) {
+	tracker := NewRateTracker(RateTrackerConfig{Capacity: 5, IdleTTL: time.Minute})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 50; i++ {
+		tracker.Record(userEventAt("user-1", now))
+	}
+	if got := len(tracker.users["user-1"].times); got != 5 {
+		t.Errorf("kept %d request times, want the capacity of 5", got)
+	}
+	if !tracker.IsBursting("user-1", time.Second, 4) || tracker.IsBursting("user-1", time.Second, 5) {
+		t.Error("bursting count should saturate at the capacity")
+	}
+
+	now = now.Add(30 * time.Second)
+	if tracker.EvictIdle(now.Add(-time.Minute)) != 0 || tracker.Users() != 1 {
+		t.Fatal("user-1 was evicted before the TTL")
+	}
+
+	now = now.Add(31 * time.Second)
+	tracker.Record(userEventAt("user-2", now))
+	if tracker.Users() != 1 {
+		t.Fatalf("tracking %d users, want user-1 evicted after the TTL", tracker.Users())
+	}
+	if tracker.IsBursting("user-1", time.Second, 0) {
+		t.Error("an evicted user is still tracked")
+	}
+}
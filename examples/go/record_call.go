@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// CallResult is what an instrumented LLM call reports back to RecordCall
+type CallResult struct {
+	PromptTokens     int
+	CompletionTokens int
+	CostUsd          float64
+	// ErrorCode is recorded on the event; a failed call without one is recorded as "call_failed"
+	ErrorCode string
+}
+
+// RecordCall runs call, measuring its latency, and sends a telemetry event
+// describing it. The call's own error is returned unchanged; failing to
+// send the event is logged when the call failed and returned otherwise.
+func (p *TelemetryProducer) RecordCall(
+	ctx context.Context,
+	serviceName, modelName, userID, sessionID string,
+	call func(ctx context.Context) (CallResult, error),
+) error {
+	var result CallResult
+	var callErr error
+	latencyMs := measureLatency(p.logger(), time.Now, func() {
+		result, callErr = call(ctx)
+	})
+
+	event := p.CreateTelemetryEvent(serviceName, modelName, latencyMs,
+		result.PromptTokens, result.CompletionTokens, result.CostUsd, userID, sessionID, nil)
+	event.ErrorCode = result.ErrorCode
+	if callErr != nil && event.ErrorCode == "" {
+		event.ErrorCode = "call_failed"
+	}
+
+	sendErr := p.SendEvent(ctx, event)
+	if callErr != nil {
+		if sendErr != nil {
+			p.logger().Error("Failed to record failed call", "request_id", event.RequestID, "error", sendErr)
+		}
+		return callErr
+	}
+	return sendErr
+}
+
+// measureLatency runs fn and returns how long it took in milliseconds.
+// Times from time.Now carry a monotonic reading, so the difference is not
+// affected by wall clock steps; a negative duration can only come from
+// clocks without one and is clamped to zero, with a warning to logger.
+func measureLatency(logger *slog.Logger, now func() time.Time, fn func()) float64 {
+	start := now()
+	fn()
+	elapsed := now().Sub(start)
+
+	if elapsed < 0 {
+		logger.Warn("Negative call latency (clock stepped backwards), recording 0", "latency", elapsed)
+		return 0
+	}
+	return float64(elapsed) / float64(time.Millisecond)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeasureLatencyClampsBackwardClockStep(t *testing.T) {
+	// wall clock readings without a monotonic component, stepping back 5s
+	// between start and end as an NTP adjustment would
+	start := time.Date(2024, 1, 15, 10, 0, 5, 0, time.UTC)
+	readings := []time.Time{start, start.Add(-5 * time.Second)}
+	now := func() time.Time {
+		t := readings[0]
+		readings = readings[1:]
+		return t
+	}
+
+	var logs bytes.Buffer
+	if got := measureLatency(slog.New(slog.NewTextHandler(&logs, nil)), now, func() {}); got != 0 {
+		t.Errorf("latency = %v, want 0 after a backward step", got)
+	}
+	if !strings.Contains(logs.String(), "Negative call latency") {
+		t.Errorf("clamp was not logged to the logger: %q", logs.String())
+	}
+}
+
+func TestMeasureLatencyUsesMonotonicClock(t *testing.T) {
+	got := measureLatency(slog.Default(), time.Now, func() { time.Sleep(5 * time.Millisecond) })
+	if got < 5 {
+		t.Errorf("latency = %vms, want at least 5ms", got)
+	}
+}
+
+func TestRecordCall(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	errTimeout := errors.New("upstream timeout")
+
+	err := producer.RecordCall(context.Background(), "chat-api", "gpt-4", "user-1", "session-1",
+		func(ctx context.Context) (CallResult, error) {
+			return CallResult{PromptTokens: 150, CompletionTokens: 300, CostUsd: 0.0225}, nil
+		})
+	if err != nil {
+		t.Fatalf("RecordCall: %v", err)
+	}
+
+	err = producer.RecordCall(context.Background(), "chat-api", "gpt-4", "user-1", "session-1",
+		func(ctx context.Context) (CallResult, error) { return CallResult{PromptTokens: 150}, errTimeout })
+	if !errors.Is(err, errTimeout) {
+		t.Errorf("RecordCall = %v, want the call's error", err)
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("got %d events, want 2", len(msgs))
+	}
+
+	var ok, failed TelemetryEvent
+	json.Unmarshal(msgs[0].Value, &ok)
+	json.Unmarshal(msgs[1].Value, &failed)
+	if ok.TotalTokens != 450 || ok.LatencyMs < 0 || ok.ErrorCode != "" {
+		t.Errorf("recorded call = %+v", ok)
+	}
+	if failed.ErrorCode != "call_failed" || failed.PromptTokens != 150 {
+		t.Errorf("recorded failed call = %+v", failed)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Fields a FieldRedactor is given, by their JSON names
+const (
+	RedactFieldPrompt   = "prompt_text"
+	RedactFieldResponse = "response_text"
+)
+
+// FieldRedactor is a Redactor that can treat prompt and response text
+// differently. The producer calls RedactField with the field's JSON name
+// instead of Redact when its Redactor implements it.
+type FieldRedactor interface {
+	Redactor
+	RedactField(field, text string) string
+}
+
+// MatchRedactor is a Redactor that can keep some of its matches, so an
+// AllowlistRedactor can exempt them
+type MatchRedactor interface {
+	Redactor
+	// RedactExcept redacts text as Redact does, keeping the matches at the
+	// byte ranges keep returns true for
+	RedactExcept(text string, keep func(start, end int) bool) string
+}
+
+// AllowlistRedactor wraps a MatchRedactor, exempting known-safe tokens from
+// it, such as product names that look like IDs. The wrapped redactor still
+// sees the whole text, and only matches lying entirely inside text matched
+// by one of a field's allowlist patterns are kept. PII that merely overlaps
+// an allowed token, such as an email at an allowlisted domain, is redacted.
+type AllowlistRedactor struct {
+	redactor MatchRedactor
+	allow    map[string][]*regexp.Regexp
+}
+
+// NewAllowlistRedactor wraps redactor with allowlist regexps per field,
+// keyed by RedactFieldPrompt or RedactFieldResponse. Invalid patterns and
+// other field names are rejected, so a typo does not silently leave a
+// field without its allowlist.
+func NewAllowlistRedactor(redactor MatchRedactor, allowlists map[string][]string) (*AllowlistRedactor, error) {
+	if redactor == nil {
+		return nil, fmt.Errorf("allowlist redactor requires a redactor")
+	}
+
+	allow := make(map[string][]*regexp.Regexp, len(allowlists))
+	for field, patterns := range allowlists {
+		if field != RedactFieldPrompt && field != RedactFieldResponse {
+			return nil, fmt.Errorf("cannot allowlist field %q (want %s or %s)", field, RedactFieldPrompt, RedactFieldResponse)
+		}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s allowlist pattern %q: %w", field, pattern, err)
+			}
+			allow[field] = append(allow[field], re)
+		}
+	}
+	return &AllowlistRedactor{redactor: redactor, allow: allow}, nil
+}
+
+// Redact redacts text with the wrapped Redactor, without an allowlist
+func (r *AllowlistRedactor) Redact(text string) string {
+	return r.redactor.Redact(text)
+}
+
+// RedactField redacts the text of field, keeping the matches its allowlist
+// covers
+func (r *AllowlistRedactor) RedactField(field, text string) string {
+	allowed := allowedRanges(r.allow[field], text)
+	if len(allowed) == 0 {
+		return r.redactor.Redact(text)
+	}
+
+	return r.redactor.RedactExcept(text, func(start, end int) bool {
+		for _, span := range allowed {
+			if start >= span[0] && end <= span[1] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// allowedRanges returns the byte ranges of text matched by any of the
+// patterns, sorted and with overlapping ranges merged
+func allowedRanges(patterns []*regexp.Regexp, text string) [][]int {
+	var ranges [][]int
+	for _, re := range patterns {
+		for _, span := range re.FindAllStringIndex(text, -1) {
+			if span[1] > span[0] {
+				ranges = append(ranges, span)
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	merged := [][]int{ranges[0]}
+	for _, span := range ranges[1:] {
+		last := merged[len(merged)-1]
+		if span[0] <= last[1] {
+			last[1] = max(last[1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
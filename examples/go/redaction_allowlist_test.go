@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestAllowlistRedactorKeepsAllowlistedTokens(t *testing.T) {
+	r, err := NewAllowlistRedactor(NewPatternRedactor(), map[string][]string{
+		RedactFieldPrompt:   {`\bSKU-\d{3}-\d{2}-\d{4}\b`, `support@acme\.example`},
+		RedactFieldResponse: {`\b800-555-0\d{3}\b`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		field, in, want string
+	}{
+		{RedactFieldPrompt, "Is SKU-123-45-6789 in stock? My SSN is 987-65-4321",
+			"Is SKU-123-45-6789 in stock? My SSN is [SSN]"},
+		{RedactFieldPrompt, "Mail support@acme.example or jane@example.com",
+			"Mail support@acme.example or [EMAIL]"},
+		{RedactFieldPrompt, "Call 800-555-0100", "Call [PHONE]"},
+		{RedactFieldResponse, "Call 800-555-0100, not 415-555-1234",
+			"Call 800-555-0100, not [PHONE]"},
+		{RedactFieldResponse, "Your SKU-123-45-6789 ships today", "Your SKU-[SSN] ships today"},
+	}
+	for _, tt := range cases {
+		if got := r.RedactField(tt.field, tt.in); got != tt.want {
+			t.Errorf("RedactField(%s, %q) = %q, want %q", tt.field, tt.in, got, tt.want)
+		}
+	}
+	if got := r.Redact("SKU-123-45-6789"); got != "SKU-[SSN]" {
+		t.Errorf("Redact without a field = %q, want no allowlist applied", got)
+	}
+}
+
+func TestAllowlistRedactorRedactsPIIOverlappingAllowedText(t *testing.T) {
+	r, err := NewAllowlistRedactor(NewPatternRedactor(), map[string][]string{
+		RedactFieldPrompt: {`acme`, `\bSKU-\d{3}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"Mail john@acme.com today":       "Mail [EMAIL] today",
+		"Ask acme about SKU-123-45-6789": "Ask acme about SKU-[SSN]",
+	}
+	for in, want := range cases {
+		if got := r.RedactField(RedactFieldPrompt, in); got != want {
+			t.Errorf("RedactField(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNewAllowlistRedactorRejectsBadConfig(t *testing.T) {
+	if _, err := NewAllowlistRedactor(NewPatternRedactor(), map[string][]string{"prompt": {`SKU`}}); err == nil {
+		t.Error("accepted an allowlist for an unknown field")
+	}
+	if _, err := NewAllowlistRedactor(NewPatternRedactor(), map[string][]string{RedactFieldPrompt: {`(`}}); err == nil {
+		t.Error("accepted an invalid pattern")
+	}
+}
+
+func TestProducerAppliesAllowlistPerField(t *testing.T) {
+	r, err := NewAllowlistRedactor(NewPatternRedactor(), map[string][]string{
+		RedactFieldPrompt: {`\bSKU-\d{3}-\d{2}-\d{4}\b`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithRedactor(r))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	event := testEvent("req-1")
+	event.PromptText = "Order SKU-123-45-6789 for jane@example.com"
+	event.ResponseText = "Ordered SKU-123-45-6789"
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.PromptText != "Order SKU-123-45-6789 for [EMAIL]" || sent.ResponseText != "Ordered SKU-[SSN]" {
+		t.Errorf("sent %q / %q, want the SKU kept only in the prompt", sent.PromptText, sent.ResponseText)
+	}
+}
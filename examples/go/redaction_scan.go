@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RedactionHitsKey is the metadata key the number of PII matches removed
+// by redaction is recorded under
+const RedactionHitsKey = "redaction_hits"
+
+// RedactionScanner measures how well redaction works by running the
+// PatternRedactor's detection patterns over each event's prompt and
+// response text before and after redaction. Matches removed by redaction
+// are hits; matches still present are misses, counted per pattern. Only
+// pattern names are ever reported, never the matched text. Text an
+// AllowlistRedactor keeps on purpose counts as a miss.
+type RedactionScanner struct {
+	missed *prometheus.CounterVec
+
+	mu     sync.Mutex
+	misses map[string]int64
+}
+
+// NewRedactionScanner creates a scanner, registering its
+// redaction_misses_total counter, labeled by pattern, with reg when it is
+// not nil
+func NewRedactionScanner(reg *prometheus.Registry) (*RedactionScanner, error) {
+	s := &RedactionScanner{misses: make(map[string]int64)}
+	if reg != nil {
+		missed, err := registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "redaction_misses_total",
+			Help: "PII matches still present in prompt and response text after redaction.",
+		}, []string{"pattern"}))
+		if err != nil {
+			return nil, err
+		}
+		s.missed = missed
+	}
+	return s, nil
+}
+
+// Scan compares an event before and after redaction. It returns the
+// redacted event with RedactionHitsKey in a copy of its metadata, and the
+// names of the patterns redaction missed, sorted. A nil scanner returns
+// the redacted event unchanged.
+func (s *RedactionScanner) Scan(original, redacted TelemetryEvent) (TelemetryEvent, []string) {
+	if s == nil {
+		return redacted, nil
+	}
+
+	before := detectPII(original.PromptText, original.ResponseText)
+	after := detectPII(redacted.PromptText, redacted.ResponseText)
+
+	hits := 0
+	var missed []string
+	for name, n := range before {
+		hits += max(n-after[name], 0)
+	}
+	if len(after) > 0 {
+		s.mu.Lock()
+		for name, n := range after {
+			s.misses[name] += int64(n)
+			missed = append(missed, name)
+		}
+		s.mu.Unlock()
+		sort.Strings(missed)
+	}
+	if s.missed != nil {
+		for name, n := range after {
+			s.missed.WithLabelValues(name).Add(float64(n))
+		}
+	}
+
+	metadata := make(map[string]interface{}, len(redacted.Metadata)+1)
+	for key, value := range redacted.Metadata {
+		metadata[key] = value
+	}
+	metadata[RedactionHitsKey] = hits
+	redacted.Metadata = metadata
+	return redacted, missed
+}
+
+// Misses returns the number of misses so far by pattern name
+func (s *RedactionScanner) Misses() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	misses := make(map[string]int64, len(s.misses))
+	for name, n := range s.misses {
+		misses[name] = n
+	}
+	return misses
+}
+
+// detectPII counts the PII matches in texts by pattern name
+func detectPII(texts ...string) map[string]int {
+	counts := make(map[string]int)
+	for _, text := range texts {
+		for _, m := range findPII(text) {
+			counts[m.pattern.name]++
+		}
+	}
+	return counts
+}
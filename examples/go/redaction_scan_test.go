@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// emailOnlyRedactor masks emails and misses every other kind of PII
+type emailOnlyRedactor struct{}
+
+func (emailOnlyRedactor) Redact(text string) string {
+	return emailPattern.ReplaceAllString(text, "[EMAIL]")
+}
+
+func TestRedactionScannerCountsFullCoverage(t *testing.T) {
+	scanner, err := NewRedactionScanner(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := testEvent("req-1")
+	event.PromptText = "I'm jane@example.com, call (555) 867-5309"
+	event.ResponseText = "SSN 123-45-6789 noted"
+	scanned, missed := scanner.Scan(event, redactEvent(NewPatternRedactor(), event))
+
+	if got := scanned.Metadata[RedactionHitsKey]; got != 3 {
+		t.Errorf("%s = %v, want 3", RedactionHitsKey, got)
+	}
+	if len(missed) != 0 || len(scanner.Misses()) != 0 {
+		t.Errorf("missed %v (%v), want none", missed, scanner.Misses())
+	}
+	if _, ok := event.Metadata[RedactionHitsKey]; ok {
+		t.Error("Scan modified the caller's metadata")
+	}
+}
+
+func TestProducerRedactionScanCatchesMisses(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	scanner, err := NewRedactionScanner(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.Redactor = emailOnlyRedactor{}
+	p.RedactionScan = scanner
+	p.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	event := testEvent("req-1")
+	event.PromptText = "I'm jane@example.com, call (555) 867-5309"
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if got := sent.Metadata[RedactionHitsKey]; got != float64(1) {
+		t.Errorf("%s = %v, want 1 for the email", RedactionHitsKey, got)
+	}
+	if got := scanner.Misses(); got["phone"] != 1 || len(got) != 1 {
+		t.Errorf("Misses() = %v, want one phone", got)
+	}
+	if got := testutil.ToFloat64(scanner.missed.WithLabelValues("phone")); got != 1 {
+		t.Errorf("redaction_misses_total{pattern=phone} = %v, want 1", got)
+	}
+
+	if !strings.Contains(logs.String(), "Redaction missed PII") {
+		t.Errorf("miss was not logged: %s", logs.String())
+	}
+	if strings.Contains(logs.String(), "867") || strings.Contains(fmt.Sprint(scanner.Misses()), "867") {
+		t.Errorf("scan output includes the missed value: %s", logs.String())
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redactor scrubs sensitive content from prompt and response text
+type Redactor interface {
+	Redact(text string) string
+}
+
+// redactEvent returns the event with its prompt and response text passed
+// through r, by field if r is a FieldRedactor; a nil r leaves the event
+// unchanged
+func redactEvent(r Redactor, event TelemetryEvent) TelemetryEvent {
+	if r == nil {
+		return event
+	}
+	if fr, ok := r.(FieldRedactor); ok {
+		event.PromptText = fr.RedactField(RedactFieldPrompt, event.PromptText)
+		event.ResponseText = fr.RedactField(RedactFieldResponse, event.ResponseText)
+		return event
+	}
+	event.PromptText = r.Redact(event.PromptText)
+	event.ResponseText = r.Redact(event.ResponseText)
+	return event
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	cardPattern  = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]?\d{4}\b`)
+)
+
+// piiPattern is one kind of PII the PatternRedactor masks
+type piiPattern struct {
+	name        string
+	placeholder string
+	re          *regexp.Regexp
+	// valid filters matches, when set
+	valid func(match string) bool
+}
+
+// piiPatterns are listed by precedence: text matched by one is not matched
+// again by the patterns after it
+var piiPatterns = []piiPattern{
+	{name: "email", placeholder: "[EMAIL]", re: emailPattern},
+	{name: "card", placeholder: "[CARD]", re: cardPattern, valid: luhnValid},
+	{name: "ssn", placeholder: "[SSN]", re: ssnPattern},
+	{name: "phone", placeholder: "[PHONE]", re: phonePattern},
+}
+
+// piiMatch is the byte range of one PII match in a text
+type piiMatch struct {
+	start, end int
+	pattern    *piiPattern
+}
+
+// findPII returns the PII matches in text, sorted and non-overlapping
+func findPII(text string) []piiMatch {
+	var matches []piiMatch
+	for i := range piiPatterns {
+		pp := &piiPatterns[i]
+	next:
+		for _, span := range pp.re.FindAllStringIndex(text, -1) {
+			if pp.valid != nil && !pp.valid(text[span[0]:span[1]]) {
+				continue
+			}
+			for _, m := range matches {
+				if span[0] < m.end && m.start < span[1] {
+					continue next
+				}
+			}
+			matches = append(matches, piiMatch{start: span[0], end: span[1], pattern: pp})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	return matches
+}
+
+// PatternRedactor masks emails, credit card numbers, SSNs and phone numbers
+// with [EMAIL], [CARD], [SSN] and [PHONE]. Card numbers must pass the Luhn
+// check, so other long digit runs such as order IDs are kept.
+type PatternRedactor struct{}
+
+// NewPatternRedactor creates the default regexp-based redactor
+func NewPatternRedactor() PatternRedactor {
+	return PatternRedactor{}
+}
+
+// Redact masks the PII found in text
+func (r PatternRedactor) Redact(text string) string {
+	return r.RedactExcept(text, nil)
+}
+
+// RedactExcept masks the PII found in text, keeping the matches keep
+// returns true for; a nil keep masks every match
+func (PatternRedactor) RedactExcept(text string, keep func(start, end int) bool) string {
+	matches := findPII(text)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.start])
+		if keep != nil && keep(m.start, m.end) {
+			b.WriteString(text[m.start:m.end])
+		} else {
+			b.WriteString(m.pattern.placeholder)
+		}
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum
+func luhnValid(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
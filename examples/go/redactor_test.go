@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestPatternRedactorMasksPII(t *testing.T) {
+	r := NewPatternRedactor()
+
+	cases := map[string]string{
+		"Contact me at jane.doe+llm@example.co.uk please":   "Contact me at [EMAIL] please",
+		"My card is 4111 1111 1111 1111, exp 12/26":         "My card is [CARD], exp 12/26",
+		"Charge 5500-0000-0000-0004 today":                  "Charge [CARD] today",
+		"SSN 123-45-6789 on file":                           "SSN [SSN] on file",
+		"Call (555) 867-5309 or +1 555.867.5309":            "Call [PHONE] or [PHONE]",
+		"Order 1234567890123456 shipped":                    "Order 1234567890123456 shipped",
+		"Summarize the 2024 report in 3 bullet points":      "Summarize the 2024 report in 3 bullet points",
+		"email bob@corp.io, card 378282246310005, ssn none": "email [EMAIL], card [CARD], ssn none",
+	}
+	for in, want := range cases {
+		if got := r.Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestProducerWithRedactorScrubsTextBeforeMarshaling(t *testing.T) {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithRedactor(NewPatternRedactor()))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	event := testEvent("req-1")
+	event.PromptText = "I'm jane@example.com, card 4111111111111111"
+	event.ResponseText = "Thanks jane@example.com"
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.PromptText != "I'm [EMAIL], card [CARD]" || sent.ResponseText != "Thanks [EMAIL]" {
+		t.Errorf("sent %q / %q, want the PII masked", sent.PromptText, sent.ResponseText)
+	}
+	if event.PromptText != "I'm jane@example.com, card 4111111111111111" {
+		t.Error("SendEvent modified the caller's event")
+	}
+}
+
+func TestProducerWithoutRedactorSendsTextUnchanged(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+
+	event := testEvent("req-1")
+	event.PromptText = "I'm jane@example.com"
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.PromptText != event.PromptText {
+		t.Errorf("PromptText = %q, want it unchanged", sent.PromptText)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// RekeyConfig configures a Rekeyer
+type RekeyConfig struct {
+	// KeyFunc derives the new message key from each event (required)
+	KeyFunc KeyFunc
+	// BatchSize is the number of messages written to the destination at once (default: 500)
+	BatchSize int
+	// FlushInterval is how long a partial batch waits for more messages (default: 1s)
+	FlushInterval time.Duration
+}
+
+// Rekeyer copies events from a consumer's topic to a destination topic under
+// new message keys, for migrating a topic to a different partitioning key.
+// Values, headers and timestamps are copied unchanged. Messages are written
+// in batches, and the source offsets are committed once their batch is
+// written, so a restart re-reads at most the batch in flight.
+type Rekeyer struct {
+	consumer *TelemetryConsumer
+	writer   messageWriter
+	config   RekeyConfig
+
+	// batch holds the rekeyed messages and source their consumed originals
+	batch  []kafka.Message
+	source []kafka.Message
+
+	rekeyed atomic.Int64
+}
+
+// NewRekeyer creates a rekeyer that writes to the destination topic. The
+// destination writer partitions by key with kafka.Hash unless opts set
+// another balancer.
+func NewRekeyer(consumer *TelemetryConsumer, brokers []string, destination string, config RekeyConfig, opts ...ProducerOption) (*Rekeyer, error) {
+	if config.KeyFunc == nil {
+		return nil, errors.New("rekeyer requires a key func")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+
+	writerConfig := defaultWriterConfig()
+	writerConfig.balancer = &kafka.Hash{}
+	for _, opt := range opts {
+		opt(&writerConfig)
+	}
+
+	return &Rekeyer{
+		consumer: consumer,
+		writer:   writerConfig.newWriter(brokers, destination),
+		config:   config,
+	}, nil
+}
+
+// Run rekeys messages until ctx is cancelled. Messages that cannot be
+// decoded, such as tombstones, keep their original key. It returns an error
+// if a batch cannot be written; its messages are not committed.
+func (r *Rekeyer) Run(ctx context.Context) error {
+	return r.consumer.consume(ctx, messageLoop{
+		process: func(ctx context.Context, reader messageReader, msg kafka.Message) error {
+			r.add(msg)
+			if len(r.batch) < r.config.BatchSize {
+				return nil
+			}
+			return r.flush(ctx, reader)
+		},
+		flush:      r.flush,
+		flushAfter: r.config.FlushInterval,
+	})
+}
+
+// Rekeyed returns the number of messages written to the destination
+func (r *Rekeyer) Rekeyed() int64 {
+	return r.rekeyed.Load()
+}
+
+// Close closes the destination writer
+func (r *Rekeyer) Close() error {
+	return r.writer.Close()
+}
+
+// add appends the message to the batch under its new key
+func (r *Rekeyer) add(msg kafka.Message) {
+	key := msg.Key
+	if event, err := r.consumer.Deserializer.Deserialize(msg); err == nil {
+		key = r.config.KeyFunc(event)
+	} else {
+		log.Printf("Keeping the key of undecodable message at offset %d: %v", msg.Offset, err)
+	}
+
+	r.batch = append(r.batch, kafka.Message{
+		Key:     key,
+		Value:   msg.Value,
+		Headers: msg.Headers,
+		Time:    msg.Time,
+	})
+	r.source = append(r.source, msg)
+}
+
+// flush writes the batch to the destination and commits its source messages
+func (r *Rekeyer) flush(ctx context.Context, reader messageReader) error {
+	if len(r.batch) == 0 {
+		return nil
+	}
+
+	if err := r.writer.WriteMessages(ctx, r.batch...); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to write %d rekeyed messages: %w", len(r.batch), err)
+	}
+	r.rekeyed.Add(int64(len(r.batch)))
+
+	if err := reader.CommitMessages(ctx, r.source...); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to commit %d rekeyed messages: %v", len(r.source), err)
+	}
+	r.batch, r.source = r.batch[:0], r.source[:0]
+	return nil
+}
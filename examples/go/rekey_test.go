@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// cancelingWriter cancels the run once it has written want messages
+type cancelingWriter struct {
+	fakeWriter
+	want   int
+	cancel context.CancelFunc
+}
+
+func (w *cancelingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := w.fakeWriter.WriteMessages(ctx, msgs...); err != nil {
+		return err
+	}
+	if len(w.Messages()) >= w.want {
+		w.cancel()
+	}
+	return nil
+}
+
+func TestRekeyerAppliesNewKeyFunc(t *testing.T) {
+	group := &fakeGroup{}
+	for i, user := range []string{"user-1", "user-2", "user-1", "user-3", "user-2"} {
+		event := testEvent("req-" + user)
+		event.UserID = user
+		value, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		group.messages = append(group.messages, kafka.Message{
+			Offset:  int64(i),
+			Key:     []byte(event.RequestID),
+			Value:   value,
+			Headers: []kafka.Header{{Key: IdempotencyKeyHeader, Value: []byte{byte('a' + i)}}},
+			Time:    time.Date(2024, 1, 15, 10, 0, i, 0, time.UTC),
+		})
+	}
+	// a tombstone cannot be decoded and keeps its key
+	group.messages = append(group.messages, kafka.Message{Offset: 5, Key: []byte("user-9/session-9")})
+
+	now := time.Now()
+	var delays []time.Duration
+	consumer, _ := newTestConsumer(group, nil, &now, &delays)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancelingWriter{want: len(group.messages), cancel: cancel}
+
+	rekeyer, err := NewRekeyer(consumer, []string{"localhost:9092"}, "llm.telemetry.by-user",
+		RekeyConfig{KeyFunc: UserIDKey, BatchSize: 4, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekeyer.writer.Close()
+	rekeyer.writer = writer
+
+	if err := rekeyer.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := writer.Messages()
+	if len(msgs) != len(group.messages) {
+		t.Fatalf("wrote %d messages, want %d", len(msgs), len(group.messages))
+	}
+	for i, msg := range msgs {
+		src := group.messages[i]
+		wantKey := string(src.Key)
+		if i < 5 {
+			var event TelemetryEvent
+			if err := json.Unmarshal(src.Value, &event); err != nil {
+				t.Fatal(err)
+			}
+			wantKey = event.UserID
+		}
+		if string(msg.Key) != wantKey {
+			t.Errorf("message %d key = %q, want %q", i, msg.Key, wantKey)
+		}
+		if string(msg.Value) != string(src.Value) || !msg.Time.Equal(src.Time) {
+			t.Errorf("message %d payload or time changed", i)
+		}
+		if len(msg.Headers) != len(src.Headers) || (len(src.Headers) > 0 && string(msg.Headers[0].Value) != string(src.Headers[0].Value)) {
+			t.Errorf("message %d headers = %v, want %v", i, msg.Headers, src.Headers)
+		}
+	}
+
+	// one full batch of four, then the rest after the flush interval
+	if writer.writes != 2 {
+		t.Errorf("wrote %d batches, want 2", writer.writes)
+	}
+	if group.committed != int64(len(group.messages)) || rekeyer.Rekeyed() != int64(len(group.messages)) {
+		t.Errorf("committed offset %d, rekeyed %d; want %d", group.committed, rekeyer.Rekeyed(), len(group.messages))
+	}
+}
+
+func TestRekeyerDoesNotCommitFailedBatch(t *testing.T) {
+	group := newFakeGroup(t, "req-1", "req-2")
+	now := time.Now()
+	var delays []time.Duration
+	consumer, _ := newTestConsumer(group, nil, &now, &delays)
+
+	rekeyer, err := NewRekeyer(consumer, []string{"localhost:9092"}, "llm.telemetry.by-user",
+		RekeyConfig{KeyFunc: UserIDKey, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekeyer.writer.Close()
+	rekeyer.writer = &fakeWriter{writeErr: errTestBroker}
+
+	if err := rekeyer.Run(context.Background()); err == nil {
+		t.Fatal("Run succeeded, want the write error")
+	}
+	if group.committed != 0 {
+		t.Errorf("committed offset = %d, want 0 so the batch is re-read", group.committed)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	mathrand "math/rand"
+	"time"
+)
+
+// IDGenerator returns a new RequestID. Producers call it without holding a
+// lock, so it must be safe for concurrent use.
+type IDGenerator func() string
+
+// TimestampRequestID returns "req-<unix millis>-<random 0-9999>", the default
+// RequestID. IDs can collide when many events are created in the same
+// millisecond; use UUIDv4RequestID when they must be unique across producers.
+func TimestampRequestID() string {
+	return fmt.Sprintf("req-%d-%d", time.Now().UnixMilli(), mathrand.Intn(10000))
+}
+
+// UUIDv4RequestID returns a random RFC 4122 version 4 UUID
+func UUIDv4RequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestCustomIDGeneratorFlowsIntoKey(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.IDGenerator = func() string { return "req-custom-1" }
+
+	event := producer.CreateTelemetryEvent("chat-api", "gpt-4", 100, 10, 20, 0.001, "user-1", "session-1", nil)
+	if event.RequestID != "req-custom-1" {
+		t.Fatalf("RequestID = %q, want the generated ID", event.RequestID)
+	}
+	if err := producer.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("wrote %d messages, want 1", len(msgs))
+	}
+	if string(msgs[0].Key) != "req-custom-1" {
+		t.Errorf("message key = %q, want req-custom-1", msgs[0].Key)
+	}
+}
+
+func TestUUIDv4RequestID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := UUIDv4RequestID()
+		if !uuid.MatchString(id) {
+			t.Fatalf("%q is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+	}
+}
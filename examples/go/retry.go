@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// RetryPolicy controls application-level retries of failed writes, on top
+// of the attempts kafka-go makes internally. The zero value disables retries.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry, doubled for each retry after (default: 100ms)
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between retries (default: 5s)
+	MaxDelay time.Duration
+	// Jitter randomizes each backoff between half and all of its delay, so
+	// producers that failed together do not retry in lockstep
+	Jitter bool
+}
+
+// backoff returns the delay before the given retry (0-based)
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	delay := exponentialBackoff(r.BaseDelay, 100*time.Millisecond, r.MaxDelay, 5*time.Second, retry)
+	if r.Jitter {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	return delay
+}
+
+// exponentialBackoff returns base doubled attempt times, capped at max. Zero
+// base and max are replaced by the given defaults.
+func exponentialBackoff(base, defaultBase, max, defaultMax time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultBase
+	}
+	if max <= 0 {
+		max = defaultMax
+	}
+
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// sleepContext waits for d, returning early with the context's error if it is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// permanentKafkaErrors are broker errors that will fail again on retry, even
+// where kafka-go reports them as temporary
+var permanentKafkaErrors = map[kafka.Error]bool{
+	kafka.InvalidMessage:             true,
+	kafka.InvalidMessageSize:         true,
+	kafka.MessageSizeTooLarge:        true,
+	kafka.RecordListTooLarge:         true,
+	kafka.InvalidRecord:              true,
+	kafka.InvalidRequiredAcks:        true,
+	kafka.TopicAuthorizationFailed:   true,
+	kafka.ClusterAuthorizationFailed: true,
+	kafka.SASLAuthenticationFailed:   true,
+	kafka.UnsupportedSASLMechanism:   true,
+}
+
+// IsRetryable reports whether a send error is transient, such as a leader
+// election in progress or a dropped connection, so the same write may
+// succeed later. Authorization, oversized or malformed messages, open
+// circuit breakers and cancelled contexts are permanent. A kafka.WriteErrors
+// is retryable when every message that failed is; the producer itself
+// retries the messages of a batch one by one, by their own errors.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		retryable := false
+		for _, e := range writeErrs {
+			if e == nil {
+				continue
+			}
+			if !IsRetryable(e) {
+				return false
+			}
+			retryable = true
+		}
+		return retryable
+	}
+
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		if permanentKafkaErrors[kafkaErr] {
+			return false
+		}
+		return kafkaErr.Temporary() || kafkaErr == kafka.BrokerNotAvailable || kafkaErr == kafka.ReplicaNotAvailable
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// writeWithRetry writes msgs, retrying retryable errors with exponential
+// backoff according to policy and logging each retry with the RequestIDs of
+// the events written. When the writer reports per-message outcomes, a retry
+// rewrites only the messages that failed with a retryable error, so those
+// the broker accepted are not delivered twice, and the outcomes of all
+// attempts are returned merged as kafka.WriteErrors.
+func (p *TelemetryProducer) writeWithRetry(ctx context.Context, policy RetryPolicy, requestIDs []string, msgs ...kafka.Message) error {
+	// indexes[i] is the position in msgs of the i-th message being written
+	indexes := make([]int, len(msgs))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	var outcomes kafka.WriteErrors
+
+	for retry := 0; ; retry++ {
+		err := p.writeMessages(ctx, msgs...)
+
+		var writeErrs kafka.WriteErrors
+		perMessage := errors.As(err, &writeErrs) && len(writeErrs) == len(msgs)
+		if perMessage {
+			if outcomes == nil {
+				outcomes = make(kafka.WriteErrors, len(indexes))
+			}
+			for i, writeErr := range writeErrs {
+				outcomes[indexes[i]] = writeErr
+			}
+		} else if outcomes != nil {
+			for _, index := range indexes {
+				outcomes[index] = err
+			}
+		}
+
+		retryable := IsRetryable(err)
+		if perMessage {
+			msgs, indexes, requestIDs = retryableWrites(writeErrs, msgs, indexes, requestIDs)
+			retryable = len(msgs) > 0
+		}
+		if err == nil || retry >= policy.MaxRetries || !retryable {
+			return mergedOutcome(outcomes, err)
+		}
+
+		delay := policy.backoff(retry)
+		p.logger().Warn("Retrying write", "request_ids", requestIDs, "topic", p.topic, "delay", delay,
+			"retry", retry+1, "max_retries", policy.MaxRetries, "error", err)
+		if sleepContext(ctx, delay) != nil {
+			return mergedOutcome(outcomes, err)
+		}
+	}
+}
+
+// retryableWrites returns the messages of a write whose outcome in
+// writeErrs is a retryable error, with their positions and RequestIDs.
+// Messages that failed permanently keep their outcome and are not retried.
+func retryableWrites(writeErrs kafka.WriteErrors, msgs []kafka.Message, indexes []int, requestIDs []string) ([]kafka.Message, []int, []string) {
+	var retryMsgs []kafka.Message
+	var retryIndexes []int
+	var retryIDs []string
+	for i, writeErr := range writeErrs {
+		if !IsRetryable(writeErr) {
+			continue
+		}
+		retryMsgs = append(retryMsgs, msgs[i])
+		retryIndexes = append(retryIndexes, indexes[i])
+		if i < len(requestIDs) {
+			retryIDs = append(retryIDs, requestIDs[i])
+		}
+	}
+	return retryMsgs, retryIndexes, retryIDs
+}
+
+// mergedOutcome returns the per-message outcomes of a write, or err when
+// the writer never reported them. Outcomes without an error mean success.
+func mergedOutcome(outcomes kafka.WriteErrors, err error) error {
+	if outcomes == nil {
+		return err
+	}
+	for _, outcome := range outcomes {
+		if outcome != nil {
+			return outcomes
+		}
+	}
+	return nil
+}
+
+// writeMessages writes msgs within PerEventTimeout, when set. A write cut
+// short by that deadline returns an error wrapping context.DeadlineExceeded
+// in place of whatever the writer reported, so it can be told apart from
+// broker errors. When the writer reports per-message outcomes, only the
+// failed messages are replaced, so messages the broker accepted before the
+// deadline still count as sent. Cancelling ctx still cancels the write.
+func (p *TelemetryProducer) writeMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if p.PerEventTimeout <= 0 {
+		return p.writer.WriteMessages(ctx, msgs...)
+	}
+
+	writeCtx, cancel := context.WithTimeout(ctx, p.PerEventTimeout)
+	defer cancel()
+
+	err := p.writer.WriteMessages(writeCtx, msgs...)
+	if err == nil || ctx.Err() != nil || !errors.Is(writeCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	timeout := fmt.Errorf("write exceeded per-event timeout of %s: %w", p.PerEventTimeout, context.DeadlineExceeded)
+	var writeErrs kafka.WriteErrors
+	if !errors.As(err, &writeErrs) {
+		return timeout
+	}
+	outcomes := make(kafka.WriteErrors, len(writeErrs))
+	for i, writeErr := range writeErrs {
+		if writeErr != nil {
+			outcomes[i] = timeout
+		}
+	}
+	return outcomes
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// scriptedWriter returns errs[i] on the i-th write and succeeds afterwards
+type scriptedWriter struct {
+	fakeWriter
+	errs  []error
+	calls int
+}
+
+func (w *scriptedWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.calls++
+	if w.calls <= len(w.errs) {
+		return w.errs[w.calls-1]
+	}
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{kafka.NotLeaderForPartition, true},
+		{kafka.LeaderNotAvailable, true},
+		{kafka.RequestTimedOut, true},
+		{kafka.NotEnoughReplicas, true},
+		{kafka.BrokerNotAvailable, true},
+		{kafka.WriteErrors{kafka.NotLeaderForPartition}, true},
+		{fmt.Errorf("wrapped: %w", kafka.LeaderNotAvailable), true},
+		{io.ErrUnexpectedEOF, true},
+		{syscall.ECONNRESET, true},
+		{kafka.TopicAuthorizationFailed, false},
+		{kafka.ClusterAuthorizationFailed, false},
+		{kafka.SASLAuthenticationFailed, false},
+		{kafka.MessageSizeTooLarge, false},
+		{kafka.InvalidMessage, false},
+		{kafka.WriteErrors{kafka.NotLeaderForPartition, kafka.TopicAuthorizationFailed}, false},
+		{ErrCircuitOpen, false},
+		{context.Canceled, false},
+		{errors.New("json: unsupported value: NaN"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSendEventRetriesLeaderElection(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.NotLeaderForPartition, kafka.LeaderNotAvailable}}
+	producer := &TelemetryProducer{writer: w, Retry: RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}}
+
+	var failed []error
+	producer.OnPermanentFailure = func(event TelemetryEvent, err error) { failed = append(failed, err) }
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent = %v, want success after leader election", err)
+	}
+	if w.calls != 3 {
+		t.Errorf("write attempts = %d, want 3", w.calls)
+	}
+	if len(failed) != 0 {
+		t.Errorf("transient errors reported as permanent failures: %v", failed)
+	}
+}
+
+func TestSendEventDoesNotRetryPermanentErrors(t *testing.T) {
+	for _, permanent := range []error{kafka.TopicAuthorizationFailed, kafka.MessageSizeTooLarge} {
+		w := &scriptedWriter{errs: []error{permanent, permanent}}
+		producer := &TelemetryProducer{writer: w, Retry: RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}}
+
+		var failed []error
+		producer.OnPermanentFailure = func(event TelemetryEvent, err error) { failed = append(failed, err) }
+
+		if err := producer.SendEvent(context.Background(), testEvent("req-1")); !errors.Is(err, permanent) {
+			t.Errorf("SendEvent = %v, want %v", err, permanent)
+		}
+		if w.calls != 1 {
+			t.Errorf("%v: write attempts = %d, want 1", permanent, w.calls)
+		}
+		if len(failed) != 1 {
+			t.Errorf("%v: permanent failures reported = %d, want 1", permanent, len(failed))
+		}
+	}
+}
+
+func TestSendEventGivesUpAfterMaxRetries(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.NotLeaderForPartition, kafka.NotLeaderForPartition, kafka.NotLeaderForPartition}}
+	producer := &TelemetryProducer{writer: w, Retry: RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}}
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); !errors.Is(err, kafka.NotLeaderForPartition) {
+		t.Errorf("SendEvent = %v, want NotLeaderForPartition", err)
+	}
+	if w.calls != 3 {
+		t.Errorf("write attempts = %d, want 3", w.calls)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+
+	for retry, delay := range want {
+		if got := policy.backoff(retry); got != delay {
+			t.Errorf("backoff(%d) = %s, want %s", retry, got, delay)
+		}
+	}
+}
+
+func TestSendEventWithRetryRecoversAfterTransientFailures(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.RequestTimedOut, syscall.ECONNRESET}}
+	producer := &TelemetryProducer{writer: w}
+
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond, Jitter: true}
+	if err := producer.SendEventWithRetry(context.Background(), testEvent("req-1"), policy); err != nil {
+		t.Fatalf("SendEventWithRetry = %v, want success on the third attempt", err)
+	}
+	if w.calls != 3 || len(w.Messages()) != 1 {
+		t.Errorf("write attempts = %d with %d messages written, want 3 attempts writing 1", w.calls, len(w.Messages()))
+	}
+}
+
+func TestSendEventWithRetrySkipsMarshalErrors(t *testing.T) {
+	w := &scriptedWriter{}
+	producer := &TelemetryProducer{writer: w}
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"score": math.NaN()}
+	if err := producer.SendEventWithRetry(context.Background(), event, RetryPolicy{MaxRetries: 3}); err == nil {
+		t.Fatal("SendEventWithRetry succeeded for an event that does not marshal")
+	}
+	if w.calls != 0 {
+		t.Errorf("write attempts = %d, want none for a marshal error", w.calls)
+	}
+}
+
+func TestSendEventWithRetryStopsWhenContextIsDone(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.LeaderNotAvailable, kafka.LeaderNotAvailable}}
+	producer := &TelemetryProducer{writer: w}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := producer.SendEventWithRetry(ctx, testEvent("req-1"), RetryPolicy{MaxRetries: 3, BaseDelay: time.Hour})
+	if !errors.Is(err, kafka.LeaderNotAvailable) {
+		t.Errorf("SendEventWithRetry = %v, want the last write error", err)
+	}
+	if w.calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("write attempts = %d after %s, want 1 and an early return", w.calls, time.Since(start))
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: true}
+
+	for retry, delay := range map[int]time.Duration{0: 100 * time.Millisecond, 2: 400 * time.Millisecond, 5: time.Second} {
+		for i := 0; i < 100; i++ {
+			if got := policy.backoff(retry); got < delay/2 || got > delay {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", retry, got, delay/2, delay)
+			}
+		}
+	}
+}
+
+// slowWriter takes delay to write, giving up like kafka-go when its context
+// is done first
+type slowWriter struct {
+	fakeWriter
+	delay time.Duration
+}
+
+func (w *slowWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("kafka write: %w", ctx.Err())
+	case <-time.After(w.delay):
+		return w.fakeWriter.WriteMessages(ctx, msgs...)
+	}
+}
+
+func TestSendEventFailsFastPastPerEventTimeout(t *testing.T) {
+	w := &slowWriter{delay: time.Hour}
+	producer := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithPerEventTimeout(20*time.Millisecond))
+	producer.writer.Close()
+	producer.writer = w
+
+	start := time.Now()
+	err := producer.SendEvent(context.Background(), testEvent("req-1"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SendEvent = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SendEvent returned after %s, want the per-event timeout", elapsed)
+	}
+	if IsRetryable(err) {
+		t.Error("a per-event timeout is retryable, want it to fail fast")
+	}
+
+	w.delay = time.Millisecond
+	if err := producer.SendEvent(context.Background(), testEvent("req-2")); err != nil {
+		t.Errorf("SendEvent within the timeout = %v", err)
+	}
+}
+
+func TestPerEventTimeoutFollowsParentCancellation(t *testing.T) {
+	producer := &TelemetryProducer{writer: &slowWriter{delay: time.Hour}, PerEventTimeout: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err := producer.SendEvent(ctx, testEvent("req-1"))
+	if !errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendEvent = %v, want the parent's context.Canceled", err)
+	}
+}
+
+func TestPerEventTimeoutKeepsBrokerErrors(t *testing.T) {
+	w := &scriptedWriter{errs: []error{kafka.TopicAuthorizationFailed}}
+	producer := &TelemetryProducer{writer: w, PerEventTimeout: time.Second}
+
+	err := producer.SendEvent(context.Background(), testEvent("req-1"))
+	if !errors.Is(err, kafka.TopicAuthorizationFailed) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendEvent = %v, want the broker error", err)
+	}
+}
+
+// partialWriter accepts the first message of a write at once and waits for
+// the context on the rest, reporting per-message outcomes like kafka-go
+type partialWriter struct {
+	fakeWriter
+}
+
+func (w *partialWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.fakeWriter.WriteMessages(ctx, msgs[0])
+	if len(msgs) == 1 {
+		return nil
+	}
+	<-ctx.Done()
+	writeErrs := make(kafka.WriteErrors, len(msgs))
+	for i := 1; i < len(msgs); i++ {
+		writeErrs[i] = ctx.Err()
+	}
+	return writeErrs
+}
+
+func TestPerEventTimeoutKeepsMessagesWrittenInTime(t *testing.T) {
+	w := &partialWriter{}
+	var failed []string
+	producer := &TelemetryProducer{
+		writer:          w,
+		PerEventTimeout: 20 * time.Millisecond,
+		Dedup:           NewDeduper(0, 0),
+		OnPermanentFailure: func(event TelemetryEvent, err error) {
+			failed = append(failed, event.RequestID)
+		},
+	}
+
+	err := producer.SendEvents(context.Background(), []TelemetryEvent{testEvent("req-1"), testEvent("req-2")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SendEvents = %v, want context.DeadlineExceeded", err)
+	}
+	if len(failed) != 1 || failed[0] != "req-2" {
+		t.Errorf("permanent failures = %v, want only req-2", failed)
+	}
+	if report := producer.Report(); report.Sent != 1 || report.Failed != 1 {
+		t.Errorf("Report() = %+v, want 1 sent and 1 failed", report)
+	}
+	if producer.Dedup.Reserve("req-1") {
+		t.Error("req-1 was released although the broker accepted it")
+	}
+	if !producer.Dedup.Reserve("req-2") {
+		t.Error("req-2 is still reserved although its write timed out")
+	}
+}
+
+// leaderMoveWriter fails the last message of its first failures writes
+// with a leader election, accepting the rest, and accepts every later write
+type leaderMoveWriter struct {
+	fakeWriter
+	failures int
+	calls    int
+}
+
+func (w *leaderMoveWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.calls++
+	if w.calls > w.failures {
+		return w.fakeWriter.WriteMessages(ctx, msgs...)
+	}
+	last := len(msgs) - 1
+	w.fakeWriter.WriteMessages(ctx, msgs[:last]...)
+	writeErrs := make(kafka.WriteErrors, len(msgs))
+	writeErrs[last] = kafka.LeaderNotAvailable
+	return writeErrs
+}
+
+func TestRetryRewritesOnlyFailedMessages(t *testing.T) {
+	w := &leaderMoveWriter{failures: 1}
+	producer := &TelemetryProducer{writer: w, Retry: RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}}
+
+	events := []TelemetryEvent{testEvent("req-1"), testEvent("req-2"), testEvent("req-3")}
+	if err := producer.SendEvents(context.Background(), events); err != nil {
+		t.Fatalf("SendEvents = %v, want the failed message retried", err)
+	}
+	if keys := messageKeys(w.Messages()); len(keys) != 3 || keys[0] != "req-1" || keys[1] != "req-2" || keys[2] != "req-3" {
+		t.Errorf("written keys = %v, want each event once", keys)
+	}
+	if report := producer.Report(); report.Sent != 3 || report.Failed != 0 {
+		t.Errorf("Report() = %+v, want 3 sent", report)
+	}
+}
+
+func TestRetryMergesOutcomesOfPartialFailures(t *testing.T) {
+	w := &leaderMoveWriter{failures: 3}
+	var failed []string
+	producer := &TelemetryProducer{
+		writer: w,
+		Retry:  RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond},
+		OnPermanentFailure: func(event TelemetryEvent, err error) {
+			failed = append(failed, event.RequestID)
+		},
+	}
+
+	events := []TelemetryEvent{testEvent("req-1"), testEvent("req-2"), testEvent("req-3")}
+	err := producer.SendEvents(context.Background(), events)
+	if !errors.Is(err, kafka.LeaderNotAvailable) {
+		t.Fatalf("SendEvents = %v, want the leader election once retries ran out", err)
+	}
+	// req-1 is accepted by the first write and req-2 by the first retry
+	if keys := messageKeys(w.Messages()); len(keys) != 2 || keys[0] != "req-1" || keys[1] != "req-2" {
+		t.Errorf("written keys = %v, want req-1 and req-2 once each", keys)
+	}
+	if len(failed) != 1 || failed[0] != "req-3" {
+		t.Errorf("permanent failures = %v, want only req-3", failed)
+	}
+	if report := producer.Report(); report.Sent != 2 || report.Failed != 1 {
+		t.Errorf("Report() = %+v, want 2 sent and 1 failed", report)
+	}
+}
+
+// mixedErrorWriter accepts the first message of its first write, rejects the
+// second as too large and fails the rest with a leader election; it accepts
+// every later write
+type mixedErrorWriter struct {
+	fakeWriter
+	calls int
+}
+
+func (w *mixedErrorWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.calls++
+	if w.calls > 1 {
+		return w.fakeWriter.WriteMessages(ctx, msgs...)
+	}
+	w.fakeWriter.WriteMessages(ctx, msgs[0])
+	writeErrs := make(kafka.WriteErrors, len(msgs))
+	writeErrs[1] = kafka.MessageSizeTooLarge
+	for i := 2; i < len(msgs); i++ {
+		writeErrs[i] = kafka.LeaderNotAvailable
+	}
+	return writeErrs
+}
+
+func TestRetrySkipsPermanentlyFailedMessages(t *testing.T) {
+	w := &mixedErrorWriter{}
+	var failed []string
+	producer := &TelemetryProducer{
+		writer: w,
+		Retry:  RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		OnPermanentFailure: func(event TelemetryEvent, err error) {
+			failed = append(failed, event.RequestID)
+		},
+	}
+
+	events := []TelemetryEvent{testEvent("req-1"), testEvent("req-2"), testEvent("req-3")}
+	err := producer.SendEvents(context.Background(), events)
+	if !errors.Is(err, kafka.MessageSizeTooLarge) || errors.Is(err, kafka.LeaderNotAvailable) {
+		t.Fatalf("SendEvents = %v, want only the oversized message to fail", err)
+	}
+	if keys := messageKeys(w.Messages()); len(keys) != 2 || keys[0] != "req-1" || keys[1] != "req-3" {
+		t.Errorf("written keys = %v, want req-1 once and req-3 after its retry", keys)
+	}
+	if len(failed) != 1 || failed[0] != "req-2" {
+		t.Errorf("permanent failures = %v, want only req-2", failed)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RuntimeConfig holds the producer settings that can change without a
+// restart. Every field is optional: Reconfigure changes only the settings
+// that are set and keeps the others, so a partial update cannot reset an
+// unrelated setting.
+type RuntimeConfig struct {
+	// TraceSampleRate is the fraction of events (0.0-1.0) traced per stage
+	TraceSampleRate *float64 `json:"trace_sample_rate,omitempty"`
+	// SampleRate is the fraction of events (0.0-1.0) kept by a HashSampler
+	// before sending
+	SampleRate *float64 `json:"sample_rate,omitempty"`
+	// DeniedModels lists models whose events are dropped before sending. Nil
+	// keeps the current list; an empty list clears it.
+	DeniedModels []string `json:"denied_models"`
+	// BreakerFailureThreshold is the consecutive failures that open a model's breaker (0 disables breaking)
+	BreakerFailureThreshold *int `json:"breaker_failure_threshold,omitempty"`
+	// BreakerCooldown is how long an open breaker fails fast before a trial send
+	BreakerCooldown *time.Duration `json:"breaker_cooldown,omitempty"`
+	// AnomalyThreshold is the z-score above which the producer's Detector
+	// flags a value (0 restores the default of 3)
+	AnomalyThreshold *float64 `json:"anomaly_threshold,omitempty"`
+	// AnomalyLimits are the Detector's hard limits
+	AnomalyLimits *ThresholdConfig `json:"anomaly_limits,omitempty"`
+}
+
+// Validate checks the fields that are set
+func (c RuntimeConfig) Validate() error {
+	if c.TraceSampleRate != nil && (*c.TraceSampleRate < 0 || *c.TraceSampleRate > 1) {
+		return fmt.Errorf("trace_sample_rate must be between 0 and 1, got %v", *c.TraceSampleRate)
+	}
+	if c.SampleRate != nil && (*c.SampleRate < 0 || *c.SampleRate > 1) {
+		return fmt.Errorf("sample_rate must be between 0 and 1, got %v", *c.SampleRate)
+	}
+	if c.BreakerFailureThreshold != nil && *c.BreakerFailureThreshold < 0 {
+		return fmt.Errorf("breaker_failure_threshold must be non-negative, got %d", *c.BreakerFailureThreshold)
+	}
+	if c.BreakerCooldown != nil && *c.BreakerCooldown <= 0 {
+		return errors.New("breaker_cooldown must be positive")
+	}
+	for _, model := range c.DeniedModels {
+		if model == "" {
+			return errors.New("denied_models must not contain empty names")
+		}
+	}
+	if c.AnomalyThreshold != nil && *c.AnomalyThreshold < 0 {
+		return fmt.Errorf("anomaly_threshold must be non-negative, got %v", *c.AnomalyThreshold)
+	}
+	if c.AnomalyLimits != nil {
+		return c.AnomalyLimits.Validate()
+	}
+	return nil
+}
+
+// Reconfigure validates cfg and atomically applies the settings it sets,
+// keeping the others. Invalid configurations are rejected and leave the
+// current one untouched. Sends already in flight finish with the
+// configuration they started with; existing breaker state, the tracer's
+// span hook and the sampler's key function are preserved. Detector
+// settings apply only when the producer has a Detector.
+func (p *TelemetryProducer) Reconfigure(cfg RuntimeConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid runtime config: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the breaker limits are checked together, as they will be in effect
+	var threshold int
+	var cooldown time.Duration
+	if p.Breaker != nil {
+		threshold, cooldown = p.Breaker.limits()
+	}
+	if cfg.BreakerFailureThreshold != nil {
+		threshold = *cfg.BreakerFailureThreshold
+	}
+	if cfg.BreakerCooldown != nil {
+		cooldown = *cfg.BreakerCooldown
+	}
+	if threshold > 0 && cooldown <= 0 {
+		return errors.New("invalid runtime config: breaker_cooldown must be positive when the breaker is enabled")
+	}
+
+	if rate := cfg.TraceSampleRate; rate != nil {
+		if p.Tracer != nil {
+			p.Tracer = &Tracer{sampleRate: *rate, onSpan: p.Tracer.onSpan}
+		} else if *rate > 0 {
+			p.Tracer = NewTracer(*rate, nil)
+		}
+	}
+
+	if cfg.SampleRate != nil {
+		var key func(TelemetryEvent) string
+		if sampler, ok := p.Sampler.(*HashSampler); ok {
+			key = sampler.key
+		}
+		p.Sampler = NewHashSampler(*cfg.SampleRate, key)
+	}
+
+	if cfg.BreakerFailureThreshold != nil || cfg.BreakerCooldown != nil {
+		if threshold == 0 {
+			p.Breaker = nil
+		} else if p.Breaker != nil {
+			p.Breaker.setLimits(threshold, cooldown)
+		} else {
+			p.Breaker = NewKeyedCircuitBreaker(threshold, cooldown)
+		}
+	}
+
+	if cfg.DeniedModels != nil {
+		p.deniedModels = make(map[string]struct{}, len(cfg.DeniedModels))
+		for _, model := range cfg.DeniedModels {
+			p.deniedModels[model] = struct{}{}
+		}
+	}
+
+	if p.Detector != nil && (cfg.AnomalyThreshold != nil || cfg.AnomalyLimits != nil) {
+		anomalyThreshold, limits := p.Detector.thresholds()
+		if cfg.AnomalyThreshold != nil {
+			anomalyThreshold = *cfg.AnomalyThreshold
+		}
+		if cfg.AnomalyLimits != nil {
+			limits = *cfg.AnomalyLimits
+		}
+		p.Detector.setThresholds(anomalyThreshold, limits)
+	}
+
+	return nil
+}
+
+// Config returns the producer's current effective runtime configuration,
+// with every setting the producer has set. SampleRate is nil unless the
+// Sampler is a HashSampler, and the anomaly settings are nil without a
+// Detector.
+func (p *TelemetryProducer) Config() RuntimeConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var traceRate float64
+	if p.Tracer != nil {
+		traceRate = p.Tracer.sampleRate
+	}
+	var threshold int
+	var cooldown time.Duration
+	if p.Breaker != nil {
+		threshold, cooldown = p.Breaker.limits()
+	}
+	cfg := RuntimeConfig{
+		TraceSampleRate:         &traceRate,
+		DeniedModels:            make([]string, 0, len(p.deniedModels)),
+		BreakerFailureThreshold: &threshold,
+		BreakerCooldown:         &cooldown,
+	}
+	if sampler, ok := p.Sampler.(*HashSampler); ok {
+		rate := sampler.rate
+		cfg.SampleRate = &rate
+	}
+	for model := range p.deniedModels {
+		cfg.DeniedModels = append(cfg.DeniedModels, model)
+	}
+	sort.Strings(cfg.DeniedModels)
+	if p.Detector != nil {
+		anomalyThreshold, limits := p.Detector.thresholds()
+		cfg.AnomalyThreshold, cfg.AnomalyLimits = &anomalyThreshold, &limits
+	}
+
+	return cfg
+}
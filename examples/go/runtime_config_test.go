@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ptr returns a pointer to v, for the optional fields of RuntimeConfig
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestReconfigureAppliesValidConfig(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+
+	cfg := RuntimeConfig{
+		TraceSampleRate:         ptr(0.25),
+		DeniedModels:            []string{"gpt-4"},
+		BreakerFailureThreshold: ptr(3),
+		BreakerCooldown:         ptr(time.Minute),
+	}
+	if err := producer.Reconfigure(cfg); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	if got := producer.Config(); !reflect.DeepEqual(got, cfg) {
+		t.Errorf("Config() = %+v, want %+v", got, cfg)
+	}
+
+	ctx := context.Background()
+	if err := producer.SendEvent(ctx, testEvent("req-denied")); err != nil {
+		t.Fatalf("SendEvent for denied model: %v", err)
+	}
+	allowed := testEvent("req-allowed")
+	allowed.ModelName = "claude-3-opus"
+	if err := producer.SendEvent(ctx, allowed); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if keys := messageKeys(w.Messages()); !reflect.DeepEqual(keys, []string{"req-allowed"}) {
+		t.Errorf("sent keys = %v, want only req-allowed", keys)
+	}
+}
+
+func TestReconfigureRejectsInvalidConfig(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+
+	valid := RuntimeConfig{
+		TraceSampleRate:         ptr(0.1),
+		DeniedModels:            []string{},
+		BreakerFailureThreshold: ptr(5),
+		BreakerCooldown:         ptr(time.Second),
+	}
+	if err := producer.Reconfigure(valid); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	invalid := []RuntimeConfig{
+		{TraceSampleRate: ptr(1.5)},
+		{BreakerFailureThreshold: ptr(-1)},
+		{BreakerCooldown: ptr(time.Duration(0))},
+		{DeniedModels: []string{""}},
+	}
+	for _, cfg := range invalid {
+		if err := producer.Reconfigure(cfg); err == nil {
+			t.Errorf("Reconfigure(%+v) succeeded, want error", cfg)
+		}
+	}
+
+	if got := producer.Config(); !reflect.DeepEqual(got, valid) {
+		t.Errorf("Config() after rejected updates = %+v, want %+v", got, valid)
+	}
+}
+
+func TestReconfigurePreservesBreakerState(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	producer.Breaker = NewKeyedCircuitBreaker(1, time.Minute)
+	producer.Breaker.Record("gpt-4", errTestBroker)
+
+	if err := producer.Reconfigure(RuntimeConfig{BreakerFailureThreshold: ptr(2), BreakerCooldown: ptr(time.Hour)}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	if state := producer.Stats().Breakers["gpt-4"]; state != BreakerOpen {
+		t.Errorf("gpt-4 breaker after reconfigure = %s, want open", state)
+	}
+}
+
+func TestReconfigureConcurrentWithSends(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				producer.SendEvent(ctx, testEvent("req"))
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		producer.Reconfigure(RuntimeConfig{
+			TraceSampleRate:         ptr(float64(i%2) * 0.5),
+			BreakerFailureThreshold: ptr(i % 3),
+			BreakerCooldown:         ptr(time.Second),
+		})
+	}
+	wg.Wait()
+}
+
+func TestReconfigureSamplerAndDetector(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	producer.Sampler = NewHashSampler(1, SampleByUserID)
+	producer.Detector = NewAnomalyDetector(AnomalyDetectorConfig{})
+
+	cfg := RuntimeConfig{
+		TraceSampleRate:         ptr(0.0),
+		SampleRate:              ptr(0.5),
+		DeniedModels:            []string{},
+		BreakerFailureThreshold: ptr(0),
+		BreakerCooldown:         ptr(time.Duration(0)),
+		AnomalyThreshold:        ptr(4.0),
+		AnomalyLimits:           &ThresholdConfig{MaxCostUsd: ptr(2.0)},
+	}
+	if err := producer.Reconfigure(RuntimeConfig{SampleRate: cfg.SampleRate, AnomalyThreshold: cfg.AnomalyThreshold, AnomalyLimits: cfg.AnomalyLimits}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	if got := producer.Config(); !reflect.DeepEqual(got, cfg) {
+		t.Errorf("Config() = %+v, want %+v", got, cfg)
+	}
+	sampler := producer.Sampler.(*HashSampler)
+	if sampler.rate != 0.5 || sampler.key(testEvent("req-1")) != testEvent("req-1").UserID {
+		t.Errorf("sampler = rate %v, want 0.5 keeping the UserID key", sampler.rate)
+	}
+
+	event := testEvent("req-1")
+	event.CostUsd = 3
+	if anomalies := producer.Detector.Evaluate(event); len(anomalies) != 1 || anomalies[0].Limit != LimitMaxCostUsd {
+		t.Errorf("Evaluate = %+v, want the new cost limit flagged", anomalies)
+	}
+
+	for _, bad := range []RuntimeConfig{{SampleRate: ptr(-1.0)}, {AnomalyThreshold: ptr(-1.0)}, {AnomalyLimits: &ThresholdConfig{MaxCostUsd: ptr(-1.0)}}} {
+		if err := producer.Reconfigure(bad); err == nil {
+			t.Errorf("Reconfigure(%+v) succeeded, want error", bad)
+		}
+	}
+	if got := producer.Config(); !reflect.DeepEqual(got, cfg) {
+		t.Errorf("Config() after rejected updates = %+v, want %+v", got, cfg)
+	}
+}
+
+func TestReconfigureKeepsSpanHook(t *testing.T) {
+	var spans []Span
+	producer := newTestProducer(&fakeWriter{})
+	producer.Tracer = NewTracer(1, func(s Span) { spans = append(spans, s) })
+
+	if err := producer.Reconfigure(RuntimeConfig{TraceSampleRate: ptr(0.0)}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	if err := producer.SendEvent(context.Background(), testEvent("req-off")); err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 0 {
+		t.Fatalf("recorded %d spans with tracing off, want 0", len(spans))
+	}
+
+	if err := producer.Reconfigure(RuntimeConfig{TraceSampleRate: ptr(1.0)}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	if err := producer.SendEvent(context.Background(), testEvent("req-on")); err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) == 0 {
+		t.Error("span hook was lost when tracing was turned off and on again")
+	}
+}
+
+func TestReconfigureKeepsUnsetFields(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	if err := producer.Reconfigure(RuntimeConfig{
+		DeniedModels:            []string{"gpt-4-32k"},
+		BreakerFailureThreshold: ptr(5),
+		BreakerCooldown:         ptr(time.Minute),
+	}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	breaker := producer.Breaker
+
+	if err := producer.Reconfigure(RuntimeConfig{TraceSampleRate: ptr(0.5)}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	cfg := producer.Config()
+	if !reflect.DeepEqual(cfg.DeniedModels, []string{"gpt-4-32k"}) {
+		t.Errorf("DeniedModels = %v after an unrelated update, want it kept", cfg.DeniedModels)
+	}
+	if producer.Breaker != breaker || *cfg.BreakerFailureThreshold != 5 || *cfg.BreakerCooldown != time.Minute {
+		t.Errorf("breaker = %d/%s after an unrelated update, want it kept", *cfg.BreakerFailureThreshold, *cfg.BreakerCooldown)
+	}
+
+	// an empty list clears the deny list, and a zero threshold disables breaking
+	if err := producer.Reconfigure(RuntimeConfig{DeniedModels: []string{}, BreakerFailureThreshold: ptr(0)}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	if cfg := producer.Config(); len(cfg.DeniedModels) != 0 || producer.Breaker != nil {
+		t.Errorf("Config() = %+v, want the deny list cleared and the breaker off", cfg)
+	}
+
+	// a threshold without a cooldown is checked against the breaker in effect
+	if err := producer.Reconfigure(RuntimeConfig{BreakerFailureThreshold: ptr(3)}); err == nil {
+		t.Error("enabled the breaker without a cooldown")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeySaltConfig configures a KeySalter
+type KeySaltConfig struct {
+	// Base derives the unsalted key (default: UserIDKey)
+	Base KeyFunc
+	// TopN configures the heavy-hitter tracker. Its Dimension should match
+	// the field Base keys by (default: user, ranked by event count).
+	TopN TopNConfig
+	// SaltRange is the number of salts a heavy hitter's key is spread over (default: 4)
+	SaltRange int
+	// MinShare is the share of the tracked total a top-N key needs to be
+	// salted (default: 0.05)
+	MinShare float64
+	// RefreshEvery is the number of events between heavy-hitter refreshes (default: 100)
+	RefreshEvery int
+}
+
+// KeySalter spreads the events of heavy-hitter keys across partitions. Keys
+// ranked in the tracker's top N with at least MinShare of the total get a
+// "#<salt>" suffix that cycles round-robin through SaltRange values; all
+// other keys are left unchanged, so their events stay on one partition.
+// Ordering across a heavy hitter's salted keys is not preserved.
+type KeySalter struct {
+	config  KeySaltConfig
+	tracker *TopNTracker
+
+	mu          sync.Mutex
+	total       float64
+	observed    int
+	windowStart time.Time
+	heavy       map[string]bool
+	next        map[string]int
+}
+
+// NewKeySalter creates a salter, applying defaults for zero config values
+func NewKeySalter(config KeySaltConfig) (*KeySalter, error) {
+	if config.Base == nil {
+		config.Base = UserIDKey
+	}
+	if config.SaltRange <= 0 {
+		config.SaltRange = 4
+	}
+	if config.MinShare <= 0 {
+		config.MinShare = 0.05
+	}
+	if config.RefreshEvery <= 0 {
+		config.RefreshEvery = 100
+	}
+
+	tracker, err := NewTopNTracker(config.TopN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySalter{
+		config:  config,
+		tracker: tracker,
+		heavy:   make(map[string]bool),
+		next:    make(map[string]int),
+	}, nil
+}
+
+// Key observes the event and returns its possibly salted key. Use it as a
+// producer's KeyFunc.
+func (s *KeySalter) Key(event TelemetryEvent) []byte {
+	s.tracker.Observe(event)
+	key := s.config.Base(event)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The tracker resets its counters with each window, so the total must too
+	if start := s.tracker.WindowStart(); !start.Equal(s.windowStart) {
+		s.windowStart = start
+		s.total = 0
+	}
+	s.total += s.tracker.weight(event)
+
+	s.observed++
+	if s.observed%s.config.RefreshEvery == 0 {
+		s.refresh()
+	}
+
+	hitter := s.tracker.key(event)
+	if !s.heavy[hitter] {
+		return key
+	}
+
+	salt := s.next[hitter]
+	s.next[hitter] = (salt + 1) % s.config.SaltRange
+	return strconv.AppendInt(append(key, '#'), int64(salt), 10)
+}
+
+// HeavyHitters returns the keys currently being salted
+func (s *KeySalter) HeavyHitters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for _, entry := range s.tracker.TopN() {
+		if s.heavy[entry.Key] {
+			keys = append(keys, entry.Key)
+		}
+	}
+	return keys
+}
+
+// refresh recomputes the heavy hitters from the tracker. Callers hold s.mu.
+func (s *KeySalter) refresh() {
+	heavy := make(map[string]bool)
+	for _, entry := range s.tracker.TopN() {
+		if entry.Value >= s.config.MinShare*s.total {
+			heavy[entry.Key] = true
+		}
+	}
+
+	for key := range s.next {
+		if !heavy[key] {
+			delete(s.next, key)
+		}
+	}
+	s.heavy = heavy
+}
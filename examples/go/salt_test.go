@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeySalterSpreadsHeavyHitters(t *testing.T) {
+	salter, err := NewKeySalter(KeySaltConfig{SaltRange: 4, RefreshEvery: 20})
+	if err != nil {
+		t.Fatalf("NewKeySalter: %v", err)
+	}
+
+	event := func(user string) TelemetryEvent {
+		e := testEvent("req")
+		e.UserID = user
+		return e
+	}
+
+	heavyKeys := make(map[string]int)
+	lightKeys := make(map[string]map[string]bool)
+	for i := 0; i < 400; i++ {
+		var e TelemetryEvent
+		if i%4 == 3 {
+			e = event(fmt.Sprintf("light-%d", (i/4)%20))
+		} else {
+			e = event("heavy")
+		}
+
+		key := string(salter.Key(e))
+		if i < 100 {
+			// Let the tracker warm up before checking keys
+			continue
+		}
+		if e.UserID == "heavy" {
+			heavyKeys[key]++
+			continue
+		}
+		if lightKeys[e.UserID] == nil {
+			lightKeys[e.UserID] = make(map[string]bool)
+		}
+		lightKeys[e.UserID][key] = true
+	}
+
+	if len(heavyKeys) != 4 {
+		t.Errorf("heavy user keys = %v, want 4 salts", heavyKeys)
+	}
+	for salt := 0; salt < 4; salt++ {
+		if key := fmt.Sprintf("heavy#%d", salt); heavyKeys[key] == 0 {
+			t.Errorf("no events keyed %s", key)
+		}
+	}
+	for user, keys := range lightKeys {
+		if len(keys) != 1 || !keys[user] {
+			t.Errorf("%s keys = %v, want only the unsalted key", user, keys)
+		}
+	}
+
+	if got := salter.HeavyHitters(); len(got) != 1 || got[0] != "heavy" {
+		t.Errorf("HeavyHitters() = %v, want [heavy]", got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// Sampler decides whether an event is kept
+type Sampler interface {
+	// Sample returns true if the event should be kept
+	Sample(event TelemetryEvent) bool
+}
+
+// RateSampler keeps a random fraction of events. The same event may be kept
+// by one stage and dropped by another; use HashSampler when decisions must
+// agree across stages.
+type RateSampler struct {
+	// Rate is the fraction of events to keep (0.0-1.0)
+	Rate float64
+}
+
+// Sample keeps the event with probability Rate
+func (s RateSampler) Sample(event TelemetryEvent) bool {
+	return rand.Float64() < s.Rate
+}
+
+// SampleByRequestID returns the event's RequestID as the sampling key
+func SampleByRequestID(event TelemetryEvent) string {
+	return event.RequestID
+}
+
+// SampleByUserID returns the event's UserID as the sampling key, keeping or
+// dropping all of a user's events together
+func SampleByUserID(event TelemetryEvent) string {
+	return event.UserID
+}
+
+// HashSampler keeps a fraction of events chosen deterministically from a
+// hash of a stable key. The same key is always kept or always dropped, so
+// producers and consumers sampling at the same rate agree on every event.
+type HashSampler struct {
+	rate float64
+	key  func(TelemetryEvent) string
+}
+
+// NewHashSampler creates a sampler keeping rate (0.0-1.0) of keys. A nil key
+// function samples by RequestID.
+func NewHashSampler(rate float64, key func(TelemetryEvent) string) *HashSampler {
+	if key == nil {
+		key = SampleByRequestID
+	}
+	return &HashSampler{rate: rate, key: key}
+}
+
+// Sample keeps the event if its key hashes below the rate
+func (s *HashSampler) Sample(event TelemetryEvent) bool {
+	return hashFraction(s.key(event)) < s.rate
+}
+
+// hashFraction maps a key uniformly onto [0, 1)
+func hashFraction(key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
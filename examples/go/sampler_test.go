@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHashSamplerIsDeterministic(t *testing.T) {
+	first := NewHashSampler(0.3, nil)
+	second := NewHashSampler(0.3, nil)
+
+	for i := 0; i < 1000; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		want := first.Sample(event)
+		for j := 0; j < 5; j++ {
+			if first.Sample(event) != want || second.Sample(event) != want {
+				t.Fatalf("inconsistent decision for %s", event.RequestID)
+			}
+		}
+	}
+}
+
+func TestHashSamplerKeepsConfiguredFraction(t *testing.T) {
+	sampler := NewHashSampler(0.25, nil)
+
+	const n = 20000
+	kept := 0
+	for i := 0; i < n; i++ {
+		if sampler.Sample(testEvent(fmt.Sprintf("req-%d", i))) {
+			kept++
+		}
+	}
+
+	if fraction := float64(kept) / n; math.Abs(fraction-0.25) > 0.02 {
+		t.Errorf("kept fraction = %.3f, want ~0.25", fraction)
+	}
+}
+
+func TestHashSamplerByUserID(t *testing.T) {
+	sampler := NewHashSampler(0.5, SampleByUserID)
+
+	for u := 0; u < 50; u++ {
+		var decisions []bool
+		for i := 0; i < 10; i++ {
+			event := testEvent(fmt.Sprintf("req-%d-%d", u, i))
+			event.UserID = fmt.Sprintf("user-%d", u)
+			decisions = append(decisions, sampler.Sample(event))
+		}
+		for _, d := range decisions[1:] {
+			if d != decisions[0] {
+				t.Fatalf("user-%d sampled inconsistently: %v", u, decisions)
+			}
+		}
+	}
+}
+
+func TestHashSamplerBounds(t *testing.T) {
+	none, all := NewHashSampler(0, nil), NewHashSampler(1, nil)
+	for i := 0; i < 100; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		if none.Sample(event) {
+			t.Fatal("rate 0 kept an event")
+		}
+		if !all.Sample(event) {
+			t.Fatal("rate 1 dropped an event")
+		}
+	}
+}
+
+func TestProducerDropsUnsampledEvents(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.Sampler = NewHashSampler(0.5, nil)
+
+	want := 0
+	for i := 0; i < 100; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		if producer.Sampler.Sample(event) {
+			want++
+		}
+		if err := producer.SendEvent(context.Background(), event); err != nil {
+			t.Fatalf("SendEvent: %v", err)
+		}
+	}
+
+	if got := len(w.Messages()); got != want {
+		t.Errorf("sent %d events, want %d sampled", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// DroppedKeysKey is the metadata key listing the keys a producer with
+// DropBadMetadata removed from an event
+const DroppedKeysKey = "_dropped_keys"
+
+// SanitizeMode is what a MetadataSanitizer does with a value JSON cannot encode
+type SanitizeMode int
+
+const (
+	// SanitizeStringify replaces the value with a string describing it
+	SanitizeStringify SanitizeMode = iota
+	// SanitizeDrop removes the key from the metadata
+	SanitizeDrop
+)
+
+// MetadataSanitizer repairs metadata values that would make json.Marshal
+// fail and lose the whole event: functions, channels, complex numbers,
+// NaN and ±Inf floats, and anything nesting them.
+type MetadataSanitizer struct {
+	// Mode is applied to every offending value (default: SanitizeStringify)
+	Mode SanitizeMode
+}
+
+// Sanitize returns the event with its offending metadata values stringified
+// or dropped, and the sanitized keys in sorted order. The event's metadata
+// map is copied before it is changed. A nil sanitizer returns the event
+// unchanged.
+func (s *MetadataSanitizer) Sanitize(event TelemetryEvent) (TelemetryEvent, []string) {
+	if s == nil {
+		return event, nil
+	}
+
+	var keys []string
+	for key, value := range event.Metadata {
+		if _, err := json.Marshal(value); err != nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return event, nil
+	}
+	sort.Strings(keys)
+
+	metadata := make(map[string]interface{}, len(event.Metadata))
+	for key, value := range event.Metadata {
+		metadata[key] = value
+	}
+	for _, key := range keys {
+		if s.Mode == SanitizeDrop {
+			delete(metadata, key)
+		} else {
+			metadata[key] = stringifyValue(metadata[key])
+		}
+	}
+
+	event.Metadata = metadata
+	return event, keys
+}
+
+// stringifyValue describes a value JSON cannot encode. Floats keep their
+// value ("NaN", "+Inf"); functions and channels, whose printed form is only
+// an address, are described by their type.
+func stringifyValue(value interface{}) string {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("%T", value)
+	}
+	return fmt.Sprint(value)
+}
+
+// dropBadMetadata returns the event without the metadata keys that fail to
+// serialize on their own, recorded in sorted order under DroppedKeysKey,
+// and the dropped keys. It serializes with the producer's Serializer, so it
+// also catches values only that serializer rejects. The event's metadata
+// map is copied before it is changed.
+func (p *TelemetryProducer) dropBadMetadata(ctx context.Context, event TelemetryEvent) (TelemetryEvent, []string) {
+	bare := event
+	bare.Metadata = nil
+	if _, err := p.marshalEvent(ctx, bare); err != nil {
+		// the failure is not in the metadata
+		return event, nil
+	}
+
+	var dropped []string
+	for key, value := range event.Metadata {
+		probe := event
+		probe.Metadata = map[string]interface{}{key: value}
+		if _, err := p.marshalEvent(ctx, probe); err != nil {
+			dropped = append(dropped, key)
+		}
+	}
+	if len(dropped) == 0 {
+		return event, nil
+	}
+	sort.Strings(dropped)
+
+	metadata := make(map[string]interface{}, len(event.Metadata))
+	for key, value := range event.Metadata {
+		metadata[key] = value
+	}
+	for _, key := range dropped {
+		delete(metadata, key)
+	}
+	metadata[DroppedKeysKey] = dropped
+
+	event.Metadata = metadata
+	return event, dropped
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataSanitizerStringify(t *testing.T) {
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{
+		"region":    "us-east-1",
+		"callback":  func() {},
+		"done":      make(chan struct{}),
+		"nan":       math.NaN(),
+		"pos_inf":   math.Inf(1),
+		"neg_inf":   float32(math.Inf(-1)),
+		"complex":   complex(1, 2),
+		"nested":    map[string]interface{}{"score": math.NaN()},
+		"retries":   2,
+		"threshold": 0.5,
+	}
+	original := event.Metadata
+
+	sanitized, keys := (&MetadataSanitizer{}).Sanitize(event)
+
+	wantKeys := []string{"callback", "complex", "done", "nan", "neg_inf", "nested", "pos_inf"}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("sanitized keys = %v, want %v", keys, wantKeys)
+	}
+
+	want := map[string]interface{}{
+		"callback": "func()",
+		"done":     "chan struct {}",
+		"nan":      "NaN",
+		"pos_inf":  "+Inf",
+		"neg_inf":  "-Inf",
+		"complex":  "(1+2i)",
+		"nested":   "map[score:NaN]",
+	}
+	for key, value := range want {
+		if sanitized.Metadata[key] != value {
+			t.Errorf("%s = %#v, want %#v", key, sanitized.Metadata[key], value)
+		}
+	}
+	if sanitized.Metadata["region"] != "us-east-1" || sanitized.Metadata["retries"] != 2 {
+		t.Errorf("safe values changed: %v", sanitized.Metadata)
+	}
+
+	if _, err := json.Marshal(sanitized); err != nil {
+		t.Errorf("sanitized event still fails to marshal: %v", err)
+	}
+	if _, ok := original["nan"].(float64); !ok {
+		t.Error("Sanitize modified the caller's metadata map")
+	}
+}
+
+func TestMetadataSanitizerDrop(t *testing.T) {
+	for name, value := range map[string]interface{}{
+		"func":    func() {},
+		"chan":    make(chan int),
+		"nan":     math.NaN(),
+		"inf":     math.Inf(1),
+		"complex": complex64(1),
+		"nested":  []interface{}{1.0, math.Inf(-1)},
+	} {
+		event := testEvent("req-1")
+		event.Metadata = map[string]interface{}{"bad": value, "region": "us-east-1"}
+
+		sanitized, keys := (&MetadataSanitizer{Mode: SanitizeDrop}).Sanitize(event)
+
+		if !reflect.DeepEqual(keys, []string{"bad"}) {
+			t.Errorf("%s: sanitized keys = %v, want [bad]", name, keys)
+		}
+		if _, ok := sanitized.Metadata["bad"]; ok || sanitized.Metadata["region"] != "us-east-1" {
+			t.Errorf("%s: metadata = %v, want only region", name, sanitized.Metadata)
+		}
+	}
+}
+
+func TestSendEventSanitizesMetadata(t *testing.T) {
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"score": math.NaN()}
+
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	if err := producer.SendEvent(context.Background(), event); err == nil {
+		t.Fatal("expected NaN metadata to fail without a sanitizer")
+	}
+
+	producer.Sanitizer = &MetadataSanitizer{}
+	if err := producer.SendEvent(context.Background(), event); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Metadata["score"] != "NaN" {
+		t.Errorf("score = %#v, want \"NaN\"", sent.Metadata["score"])
+	}
+}
+
+func TestNilMetadataSanitizer(t *testing.T) {
+	var s *MetadataSanitizer
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"nan": math.NaN()}
+
+	got, keys := s.Sanitize(event)
+	if keys != nil || !math.IsNaN(got.Metadata["nan"].(float64)) {
+		t.Errorf("nil sanitizer changed the event: %v, %v", got.Metadata, keys)
+	}
+}
+
+func TestDropBadMetadataShipsTheRestOfTheEvent(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.DropBadMetadata = true
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{
+		"region":   "us-east-1",
+		"retries":  float64(2),
+		"tags":     []interface{}{"beta"},
+		"callback": func() {},
+		"score":    math.NaN(),
+	}
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"region":       "us-east-1",
+		"retries":      float64(2),
+		"tags":         []interface{}{"beta"},
+		DroppedKeysKey: []interface{}{"callback", "score"},
+	}
+	if !reflect.DeepEqual(sent.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", sent.Metadata, want)
+	}
+	if len(event.Metadata) != 5 {
+		t.Error("the caller's metadata map was modified")
+	}
+}
+
+func TestBadMetadataFailsTheEventByDefault(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+
+	event := testEvent("req-1")
+	event.Metadata = map[string]interface{}{"region": "us-east-1", "score": math.NaN()}
+	if err := p.SendEvent(context.Background(), event); err == nil {
+		t.Error("SendEvent succeeded without DropBadMetadata")
+	}
+	if len(w.Messages()) != 0 {
+		t.Error("the event was sent")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestProducerFramesConfluentWireFormat(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.SchemaTag = &SchemaTag{ID: 258, WireFormat: true}
+
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatal(err)
+	}
+	msg := w.Messages()[0]
+
+	wantPrefix := []byte{0x00, 0x00, 0x00, 0x01, 0x02}
+	if !bytes.HasPrefix(msg.Value, wantPrefix) {
+		t.Fatalf("value starts % x, want magic byte and schema ID % x", msg.Value[:5], wantPrefix)
+	}
+	var event TelemetryEvent
+	if err := json.Unmarshal(msg.Value[5:], &event); err != nil || event.RequestID != "req-1" {
+		t.Errorf("payload after the framing is not the event: %v", err)
+	}
+	if id, ok := messageHeader(msg, SchemaIDHeader); !ok || id != "258" {
+		t.Errorf("schema-id header = %q, want 258", id)
+	}
+
+	decoded, err := NewDeserializer().Deserialize(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.RequestID != "req-1" {
+		t.Errorf("decoded RequestID = %q, want req-1", decoded.RequestID)
+	}
+}
+
+func TestProducerSchemaHeaderWithoutFraming(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.SchemaTag = &SchemaTag{ID: 7}
+
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatal(err)
+	}
+	msg := w.Messages()[0]
+
+	if msg.Value[0] != '{' {
+		t.Errorf("value starts with %q, want plain JSON", msg.Value[0])
+	}
+	if id, _ := messageHeader(msg, SchemaIDHeader); id != "7" {
+		t.Errorf("schema-id header = %q, want 7", id)
+	}
+}
+
+func TestUnframeConfluent(t *testing.T) {
+	id, payload, err := UnframeConfluent(FrameConfluent(1<<20, []byte(`{}`)))
+	if err != nil || id != 1<<20 || string(payload) != "{}" {
+		t.Errorf("UnframeConfluent = %d, %q, %v", id, payload, err)
+	}
+
+	for _, value := range [][]byte{[]byte(`{"a":1}`), {0x00, 0x01}, {0x01, 0, 0, 0, 1, '{'}} {
+		if _, _, err := UnframeConfluent(value); !errors.Is(err, ErrNotFramed) {
+			t.Errorf("UnframeConfluent(% x) = %v, want ErrNotFramed", value, err)
+		}
+	}
+}
+
+func TestDeserializerRejectsMismatchedSchemaID(t *testing.T) {
+	value, err := json.Marshal(testEvent("req-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := kafka.Message{
+		Value:   FrameConfluent(5, value),
+		Headers: []kafka.Header{{Key: SchemaIDHeader, Value: []byte("6")}},
+	}
+
+	if _, err := NewDeserializer().Deserialize(msg); err == nil {
+		t.Error("Deserialize succeeded with a mismatched schema ID, want an error")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRegistryContentType is the media type of Confluent Schema Registry requests
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// SchemaRegistryClient registers schemas with a Confluent Schema Registry.
+// It caches the ID registered for each subject and registers again only
+// when the subject's schema changes, so an evolved schema gets its new ID.
+type SchemaRegistryClient struct {
+	url  string
+	http *http.Client
+
+	mu  sync.Mutex
+	ids map[string]registeredSchema
+}
+
+// registeredSchema is the schema last registered for a subject
+type registeredSchema struct {
+	schema string
+	id     int32
+}
+
+// NewSchemaRegistryClient creates a client for the registry at baseURL
+func NewSchemaRegistryClient(baseURL string) *SchemaRegistryClient {
+	return &SchemaRegistryClient{
+		url:  strings.TrimRight(baseURL, "/"),
+		http: &http.Client{Timeout: 10 * time.Second},
+		ids:  make(map[string]registeredSchema),
+	}
+}
+
+// Register registers the Avro schema under subject, or looks up its ID if
+// it is already registered there, and returns the schema ID. The request
+// is made without holding the cache lock, so a slow registry does not block
+// lookups of other subjects; concurrent first registrations of a schema
+// each ask the registry, which returns the same ID.
+func (c *SchemaRegistryClient) Register(ctx context.Context, subject, schema string) (int32, error) {
+	c.mu.Lock()
+	registered, ok := c.ids[subject]
+	c.mu.Unlock()
+	if ok && registered.schema == schema {
+		return registered.id, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	endpoint := fmt.Sprintf("%s/subjects/%s/versions", c.url, url.PathEscape(subject))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	req.Header.Set("Accept", schemaRegistryContentType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register schema for %s: %w", subject, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("failed to register schema for %s: %s: %s", subject, resp.Status, bytes.TrimSpace(msg))
+	}
+	var response struct {
+		ID int32 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("invalid schema registry response for %s: %w", subject, err)
+	}
+
+	c.mu.Lock()
+	c.ids[subject] = registeredSchema{schema: schema, id: response.ID}
+	c.mu.Unlock()
+	return response.ID, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestProtobufSerializerRoundTrip(t *testing.T) {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithSerializer(ProtobufSerializer{}))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	event := testEvent("req-1")
+	event.IdempotencyKey = NewIdempotencyKey()
+	event.Flags = []string{"beta"}
+	event.Metadata = map[string]interface{}{
+		"region":  "us-east-1",
+		"retries": float64(2),
+		"labels":  map[string]interface{}{"team": "search"},
+	}
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := w.Messages()[0]
+	if contentType, _ := messageHeader(msg, ContentTypeHeader); contentType != ContentTypeProtobuf {
+		t.Errorf("content-type = %q, want %s", contentType, ContentTypeProtobuf)
+	}
+	jsonValue, err := JSONSerializer{}.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Value) >= len(jsonValue) {
+		t.Errorf("protobuf value is %d bytes, want less than the %d of JSON", len(msg.Value), len(jsonValue))
+	}
+
+	got, err := NewDeserializer().Deserialize(msg)
+	if err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if !reflect.DeepEqual(got, event) {
+		t.Errorf("round trip = %+v, want %+v", got, event)
+	}
+}
+
+func TestDefaultSerializerIsJSON(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := w.Messages()[0]
+	if _, ok := messageHeader(msg, ContentTypeHeader); ok {
+		t.Error("default JSON messages carry a content-type header")
+	}
+	if got, err := NewDeserializer().Deserialize(msg); err != nil || got.RequestID != "req-1" {
+		t.Errorf("Deserialize = %+v, %v, want req-1", got, err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sendCounters counts send outcomes for the shutdown report
+type sendCounters struct {
+	sent       atomic.Int64
+	failed     atomic.Int64
+	denied     atomic.Int64
+	invalid    atomic.Int64
+	overBudget atomic.Int64
+	future     atomic.Int64
+	belowCost  atomic.Int64
+	sampledOut atomic.Int64
+	stale      atomic.Int64
+	limited    atomic.Int64
+	paused     atomic.Int64
+	duplicate  atomic.Int64
+
+	// flushedOnDrain counts buffered events sent after Close began; they
+	// are counted as sent too
+	flushedOnDrain atomic.Int64
+
+	// byReason counts the drops above by DropReason
+	byReason [numDropReasons]atomic.Int64
+
+	// bytes is the size of sent message values; writes and writeNanos
+	// time the writes to Kafka
+	bytes      atomic.Int64
+	writes     atomic.Int64
+	writeNanos atomic.Int64
+}
+
+// DropCounts breaks down events the producer dropped on purpose
+type DropCounts struct {
+	// Denied events were for a model on the deny list
+	Denied int64 `json:"denied"`
+	// Invalid events failed Validate
+	Invalid int64 `json:"invalid"`
+	// OverBudget events exceeded their model's token budget
+	OverBudget int64 `json:"over_budget"`
+	// Future events were timestamped too far ahead of the local clock
+	Future int64 `json:"future"`
+	// BelowCost events cost less than the cost filter's threshold
+	BelowCost int64 `json:"below_cost"`
+	// Sampled events were not kept by the sampler
+	Sampled int64 `json:"sampled"`
+	// Stale events waited in the buffer longer than their maximum age
+	Stale int64 `json:"stale"`
+	// RateLimited events were from a rate limited user
+	RateLimited int64 `json:"rate_limited"`
+	// Paused events were sent while the producer was paused
+	Paused int64 `json:"paused"`
+	// Duplicate events had a RequestID the producer had already sent
+	Duplicate int64 `json:"duplicate"`
+}
+
+// ShutdownReport summarizes a producer's lifetime for operators and
+// orchestration tooling
+type ShutdownReport struct {
+	Sent   int64 `json:"sent"`
+	Failed int64 `json:"failed"`
+	// FlushedOnDrain is how many of the sent events were still buffered
+	// when Close began
+	FlushedOnDrain int64      `json:"flushed_on_drain"`
+	Dropped        DropCounts `json:"dropped"`
+	UptimeSeconds  float64    `json:"uptime_seconds"`
+}
+
+// Report returns the producer's counts so far
+func (p *TelemetryProducer) Report() ShutdownReport {
+	report := ShutdownReport{
+		Sent:           p.counters.sent.Load(),
+		Failed:         p.counters.failed.Load(),
+		FlushedOnDrain: p.counters.flushedOnDrain.Load(),
+		Dropped: DropCounts{
+			Denied:      p.counters.denied.Load(),
+			Invalid:     p.counters.invalid.Load(),
+			OverBudget:  p.counters.overBudget.Load(),
+			Future:      p.counters.future.Load(),
+			BelowCost:   p.counters.belowCost.Load(),
+			Sampled:     p.counters.sampledOut.Load(),
+			Stale:       p.counters.stale.Load(),
+			RateLimited: p.counters.limited.Load(),
+			Paused:      p.counters.paused.Load(),
+			Duplicate:   p.counters.duplicate.Load(),
+		},
+	}
+	if !p.started.IsZero() {
+		report.UptimeSeconds = time.Since(p.started).Seconds()
+	}
+	return report
+}
+
+// TopicMetrics is a snapshot of a producer's send metrics, labeled with the
+// topic it writes to
+type TopicMetrics struct {
+	Topic  string `json:"topic"`
+	Sent   int64  `json:"sent"`
+	Failed int64  `json:"failed"`
+	// Bytes is the total size of the sent message values
+	Bytes int64 `json:"bytes"`
+	// AvgWriteLatencyMs is the mean duration of a write, including retries
+	AvgWriteLatencyMs float64 `json:"avg_write_latency_ms"`
+}
+
+// Metrics returns the producer's send metrics labeled with its topic.
+// Events sent with SendAtomic are counted here too, whichever topics they
+// name; the Prometheus metrics label them with their destination topic.
+func (p *TelemetryProducer) Metrics() TopicMetrics {
+	metrics := TopicMetrics{
+		Topic:  p.topic,
+		Sent:   p.counters.sent.Load(),
+		Failed: p.counters.failed.Load(),
+		Bytes:  p.counters.bytes.Load(),
+	}
+	if writes := p.counters.writes.Load(); writes > 0 {
+		metrics.AvgWriteLatencyMs = float64(p.counters.writeNanos.Load()) / float64(writes) / float64(time.Millisecond)
+	}
+	return metrics
+}
+
+// DefaultCloseTimeout bounds how long Close waits for buffered events to
+// be sent and the writer to close
+const DefaultCloseTimeout = 15 * time.Second
+
+// producerClose is the progress of closing a producer, which happens once
+type producerClose struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// startClose starts closing the producer in the background, unless an
+// earlier call did. It returns a channel closed once the buffered events
+// have been sent and the writer closed, and whether this call started it.
+func (p *TelemetryProducer) startClose() (<-chan struct{}, bool) {
+	started := false
+	p.closing.once.Do(func() {
+		started = true
+		p.closing.done = make(chan struct{})
+		go func() {
+			defer close(p.closing.done)
+			p.closeAsync()
+			p.stopCoalescing()
+			p.closing.err = p.writer.Close()
+		}()
+	})
+	return p.closing.done, started
+}
+
+// Shutdown closes the producer and returns its final report. An
+// asynchronous producer first sends the events still buffered. Shutdown
+// waits for as long as that takes; CloseWithTimeout bounds the wait.
+func (p *TelemetryProducer) Shutdown() (ShutdownReport, error) {
+	done, _ := p.startClose()
+	<-done
+	return p.Report(), p.closing.err
+}
+
+// CloseWithTimeout closes the producer like Close, but returns ctx's error,
+// e.g. context.DeadlineExceeded, if the buffered events cannot be sent and
+// the writer closed before ctx is done; closing then continues in the
+// background. Closing a closed producer is a no-op.
+func (p *TelemetryProducer) CloseWithTimeout(ctx context.Context) error {
+	done, started := p.startClose()
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		p.logger().Warn("Producer not closed in time", "topic", p.topic, "buffered", p.buffered(), "error", ctx.Err())
+		return ctx.Err()
+	case <-done:
+	}
+
+	if data, err := json.Marshal(p.Report()); err == nil {
+		p.logger().Info("Shutdown report", "topic", p.topic, "report", json.RawMessage(data))
+	}
+	return p.closing.err
+}
+
+// Close closes the producer within DefaultCloseTimeout, logging its final
+// report as JSON. Closing a closed producer is a no-op.
+func (p *TelemetryProducer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCloseTimeout)
+	defer cancel()
+	return p.CloseWithTimeout(ctx)
+}
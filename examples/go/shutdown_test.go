@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// modelSampler drops events for one model
+type modelSampler string
+
+func (s modelSampler) Sample(event TelemetryEvent) bool {
+	return event.ModelName != string(s)
+}
+
+func TestShutdownReportCounts(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.started = time.Now().Add(-time.Minute)
+	producer.TokenBudget = &TokenBudget{Default: 1000}
+	producer.Sampler = modelSampler("claude-3-haiku")
+	if err := producer.Reconfigure(RuntimeConfig{DeniedModels: []string{"gpt-4-32k"}}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	send := func(model string, tokens int) error {
+		event := testEvent("req")
+		event.ModelName = model
+		event.TotalTokens = tokens
+		return producer.SendEvent(context.Background(), event)
+	}
+
+	send("gpt-4", 450)
+	send("gpt-4", 450)
+	send("gpt-4-32k", 450)
+	send("gpt-4", 5000)
+	send("claude-3-haiku", 450)
+	send("claude-3-haiku", 450)
+	w.writeErr = errors.New("broker unavailable")
+	send("gpt-4", 450)
+
+	report, err := producer.Shutdown()
+	if err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	want := ShutdownReport{Sent: 2, Failed: 1, Dropped: DropCounts{Denied: 1, OverBudget: 1, Sampled: 2}}
+	if report.Sent != want.Sent || report.Failed != want.Failed || report.FlushedOnDrain != 0 || report.Dropped != want.Dropped {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+	if report.UptimeSeconds < 60 {
+		t.Errorf("UptimeSeconds = %v, want at least 60", report.UptimeSeconds)
+	}
+	if !w.closed {
+		t.Error("writer not closed")
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded ShutdownReport
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Dropped != want.Dropped {
+		t.Errorf("round trip = %+v, %v from %s", decoded, err, data)
+	}
+}
+
+func TestShutdownReportCountsFlushedOnDrain(t *testing.T) {
+	w := &gatedWriter{started: make(chan struct{}, 10), open: make(chan struct{})}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+	producer.startAsync(10)
+
+	// the first event is being written when Close begins; the rest are
+	// still buffered and go out in the final drain
+	if err := producer.Enqueue(testEvent("req-0")); err != nil {
+		t.Fatal(err)
+	}
+	<-w.started
+	for i := 1; i <= 4; i++ {
+		if err := producer.Enqueue(testEvent(fmt.Sprintf("req-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports := make(chan ShutdownReport)
+	go func() {
+		report, _ := producer.Shutdown()
+		reports <- report
+	}()
+	for !producer.async.isClosed() {
+		time.Sleep(time.Millisecond)
+	}
+	close(w.open)
+
+	report := <-reports
+	if report.Sent != 5 || report.FlushedOnDrain != 4 {
+		t.Errorf("report = %+v, want 5 sent of which 4 flushed on drain", report)
+	}
+}
+
+func TestCloseWithTimeoutGivesUpOnBlockedFlush(t *testing.T) {
+	w := &gatedWriter{started: make(chan struct{}, 10), open: make(chan struct{})}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry"}
+	producer.startAsync(10)
+	if err := producer.Enqueue(testEvent("req-1")); err != nil {
+		t.Fatal(err)
+	}
+	<-w.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if err := producer.CloseWithTimeout(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CloseWithTimeout with an expired context = %v, want context.DeadlineExceeded", err)
+	}
+	if err := producer.Close(); err != nil {
+		t.Errorf("second Close = %v, want a no-op", err)
+	}
+
+	// the flush continues in the background once the broker answers
+	close(w.open)
+	if _, err := producer.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if len(w.Messages()) != 1 || !w.closed {
+		t.Errorf("wrote %d messages, writer closed = %v, want the buffered event sent and the writer closed",
+			len(w.Messages()), w.closed)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	w := &fakeWriter{}
+	producer := NewAsyncTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", 10)
+	producer.writer.Close()
+	producer.writer = w
+
+	for i := 0; i < 2; i++ {
+		if err := producer.Close(); err != nil {
+			t.Fatalf("Close %d: %v", i+1, err)
+		}
+	}
+}
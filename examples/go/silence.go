@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SilenceConfig configures a SilenceDetector
+type SilenceConfig struct {
+	// Timeout is how long a service and model may send no events before an
+	// alert (default: 5m)
+	Timeout time.Duration
+	// Timeouts overrides Timeout per "service/model" key or per service
+	// name, for services that are busy or quiet by nature (optional)
+	Timeouts map[string]time.Duration
+	// MinSamples is the number of events a key needs before its silence
+	// raises an alert, so a key seen once is not expected to keep sending
+	// (default: 10)
+	MinSamples int
+}
+
+// SilenceDetector alerts when a normally busy service and model stops
+// sending events, which is an incident even though no event is anomalous.
+// Observe records when each key was last seen; Check, called periodically,
+// raises one no_traffic anomaly per key that has been silent for longer
+// than its timeout. The next event from the key clears the alert.
+type SilenceDetector struct {
+	warmupGate
+
+	mu     sync.Mutex
+	config SilenceConfig
+	now    func() time.Time
+	keys   map[string]*silenceState
+}
+
+// silenceState is the activity of one service and model
+type silenceState struct {
+	service  string
+	model    string
+	lastSeen time.Time
+	alerted  bool
+}
+
+// NewSilenceDetector creates a detector, applying defaults for zero config values
+func NewSilenceDetector(config SilenceConfig) *SilenceDetector {
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Minute
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = 10
+	}
+
+	return &SilenceDetector{
+		warmupGate: warmupGate{minSamples: config.MinSamples},
+		config:     config,
+		now:        time.Now,
+		keys:       make(map[string]*silenceState),
+	}
+}
+
+// silenceKey returns the key an event's activity is tracked under
+func silenceKey(service, model string) string {
+	return service + "/" + model
+}
+
+// Observe records the event's arrival, resetting its key's silence. It
+// never flags the event itself.
+func (d *SilenceDetector) Observe(event TelemetryEvent) []Anomaly {
+	key := silenceKey(event.ServiceName, event.ModelName)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.keys[key]
+	if !ok {
+		state = &silenceState{service: event.ServiceName, model: event.ModelName}
+		d.keys[key] = state
+	}
+	state.lastSeen = d.now()
+	state.alerted = false
+	d.observe(key)
+	return nil
+}
+
+// Check returns a no_traffic anomaly for each key with at least MinSamples
+// events that has now been silent for longer than its timeout and has not
+// been alerted on since its last event. The score is the silence in
+// seconds and the threshold the timeout. Anomalies are sorted by key.
+func (d *SilenceDetector) Check() []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	var anomalies []Anomaly
+	for key, state := range d.keys {
+		timeout := d.timeout(key, state.service)
+		silence := now.Sub(state.lastSeen)
+		if state.alerted || silence <= timeout || d.WarmingUp(key) {
+			continue
+		}
+		state.alerted = true
+
+		event := TelemetryEvent{ServiceName: state.service, ModelName: state.model}
+		anomalies = append(anomalies, newAnomaly(AnomalyNoTraffic, event, silence.Seconds(), timeout.Seconds(),
+			fmt.Sprintf("no events from %s for %s (timeout %s)", key, silence.Round(time.Second), timeout)))
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		a, b := anomalies[i], anomalies[j]
+		return silenceKey(a.ServiceName, a.ModelName) < silenceKey(b.ServiceName, b.ModelName)
+	})
+	return anomalies
+}
+
+// Silent returns the keys currently alerted on
+func (d *SilenceDetector) Silent() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var silent []string
+	for key, state := range d.keys {
+		if state.alerted {
+			silent = append(silent, key)
+		}
+	}
+	sort.Strings(silent)
+	return silent
+}
+
+// Forget stops tracking a service and model, e.g. one that was retired
+func (d *SilenceDetector) Forget(service, model string) {
+	key := silenceKey(service, model)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.keys, key)
+	d.forget(key)
+}
+
+// timeout returns the timeout of key, preferring a per-key override, then
+// one for its service
+func (d *SilenceDetector) timeout(key, service string) time.Duration {
+	if timeout, ok := d.config.Timeouts[key]; ok {
+		return timeout
+	}
+	if timeout, ok := d.config.Timeouts[service]; ok {
+		return timeout
+	}
+	return d.config.Timeout
+}
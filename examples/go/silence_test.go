@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func serviceEvent(service, model string) TelemetryEvent {
+	event := testEvent("req-1")
+	event.ServiceName = service
+	event.ModelName = model
+	return event
+}
+
+func TestSilenceDetectorAlertsWhenServiceGoesSilent(t *testing.T) {
+	detector := NewSilenceDetector(SilenceConfig{
+		Timeout:    5 * time.Minute,
+		Timeouts:   map[string]time.Duration{"batch-api": time.Hour},
+		MinSamples: 3,
+	})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	detector.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		detector.Observe(serviceEvent("chat-api", "gpt-4"))
+		detector.Observe(serviceEvent("chat-api", "claude-3-opus"))
+		detector.Observe(serviceEvent("batch-api", "gpt-4"))
+	}
+
+	// claude-3-opus keeps sending; gpt-4 on chat-api goes silent
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Minute)
+		detector.Observe(serviceEvent("chat-api", "claude-3-opus"))
+		if anomalies := detector.Check(); len(anomalies) != 0 {
+			t.Fatalf("alerted %v before the timeout", anomalies)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	detector.Observe(serviceEvent("chat-api", "claude-3-opus"))
+	anomalies := detector.Check()
+	if len(anomalies) != 1 {
+		t.Fatalf("anomalies = %v, want one for chat-api/gpt-4", anomalies)
+	}
+	anomaly := anomalies[0]
+	if anomaly.Type != AnomalyNoTraffic || anomaly.ServiceName != "chat-api" || anomaly.ModelName != "gpt-4" {
+		t.Errorf("anomaly = %+v, want no_traffic for chat-api/gpt-4", anomaly)
+	}
+	if anomaly.Score != 360 || anomaly.Threshold != 300 {
+		t.Errorf("score = %v, threshold = %v, want 360s of silence over a 300s timeout", anomaly.Score, anomaly.Threshold)
+	}
+
+	// the alert fires once per silence, and the next event clears it
+	now = now.Add(time.Minute)
+	if anomalies := detector.Check(); len(anomalies) != 0 {
+		t.Errorf("alerted again on a continuing silence: %v", anomalies)
+	}
+	if silent := detector.Silent(); len(silent) != 1 || silent[0] != "chat-api/gpt-4" {
+		t.Errorf("Silent() = %v, want chat-api/gpt-4", silent)
+	}
+	detector.Observe(serviceEvent("chat-api", "gpt-4"))
+	if silent := detector.Silent(); len(silent) != 0 {
+		t.Errorf("Silent() = %v after the service resumed, want none", silent)
+	}
+	now = now.Add(6 * time.Minute)
+	if anomalies := detector.Check(); len(anomalies) != 2 || anomalies[0].ModelName != "claude-3-opus" || anomalies[1].ModelName != "gpt-4" {
+		t.Errorf("anomalies = %v, want a new alert for both chat-api models", anomalies)
+	}
+}
+
+func TestSilenceDetectorIgnoresNewKeys(t *testing.T) {
+	detector := NewSilenceDetector(SilenceConfig{Timeout: time.Minute, MinSamples: 5})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	detector.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		detector.Observe(serviceEvent("trial-api", "gpt-4"))
+	}
+	now = now.Add(time.Hour)
+	if anomalies := detector.Check(); len(anomalies) != 0 {
+		t.Errorf("alerted %v for a key with fewer than MinSamples events", anomalies)
+	}
+
+	detector.Observe(serviceEvent("trial-api", "gpt-4"))
+	detector.Forget("trial-api", "gpt-4")
+	now = now.Add(time.Hour)
+	if anomalies := detector.Check(); len(anomalies) != 0 {
+		t.Errorf("alerted %v for a forgotten key", anomalies)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Sink receives batches of telemetry events, for example from a consumer
+// exporting the stream to another system
+type Sink interface {
+	// Write delivers a batch of events
+	Write(ctx context.Context, events []TelemetryEvent) error
+	// Close flushes any buffered events and releases resources
+	Close() error
+}
+
+// MemorySink keeps written events in memory, for tests and dry runs
+type MemorySink struct {
+	mu     sync.Mutex
+	events []TelemetryEvent
+}
+
+// Write appends the batch
+func (s *MemorySink) Write(ctx context.Context, events []TelemetryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// Events returns a copy of the events written so far
+func (s *MemorySink) Events() []TelemetryEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]TelemetryEvent(nil), s.events...)
+}
+
+// Close does nothing
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// NewSinkProducer creates a producer that delivers events to sink instead
+// of Kafka, e.g. to run the simulators without a broker
+func NewSinkProducer(sink Sink) *TelemetryProducer {
+	return &TelemetryProducer{
+		writer:  sinkWriter{sink: sink},
+		topic:   fmt.Sprintf("%T", sink),
+		started: time.Now(),
+	}
+}
+
+// sinkWriter adapts a Sink to the producer's messageWriter
+type sinkWriter struct {
+	sink Sink
+}
+
+// WriteMessages decodes the messages and writes them to the sink as one batch
+func (w sinkWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	events := make([]TelemetryEvent, len(msgs))
+	for i, msg := range msgs {
+		if err := json.Unmarshal(msg.Value, &events[i]); err != nil {
+			return fmt.Errorf("failed to decode message for sink: %w", err)
+		}
+	}
+	return w.sink.Write(ctx, events)
+}
+
+// Close closes the sink
+func (w sinkWriter) Close() error {
+	return w.sink.Close()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SLOConfig configures an SLOTracker
+type SLOConfig struct {
+	// LatencyThreshold is the latency a request must stay within to count as good (default: 2s)
+	LatencyThreshold time.Duration
+	// Objective is the fraction of requests that must be good (default: 0.99)
+	Objective float64
+	// FastWindow is the short burn rate window, which reacts quickly (default: 5m)
+	FastWindow time.Duration
+	// SlowWindow is the long burn rate window, which confirms a breach is sustained (default: 1h)
+	SlowWindow time.Duration
+	// BurnRate is the rate both windows must exceed to alert; 1 spends
+	// exactly the error budget over the SLO period (default: 14.4)
+	BurnRate float64
+	// BucketSize is the granularity requests are counted at; the windows
+	// move forward a bucket at a time (default: 1m, or FastWindow/5 if
+	// shorter)
+	BucketSize time.Duration
+}
+
+// SLOTracker tracks each model's latency SLO and alerts when the model
+// burns its error budget too fast. The burn rate is the fraction of slow
+// requests divided by the fraction the objective allows. An alert needs
+// both the fast and the slow window over BurnRate: a brief blip raises
+// only the fast window, and a breach that has already recovered is still
+// high only in the slow one.
+type SLOTracker struct {
+	mu     sync.Mutex
+	config SLOConfig
+	models map[string]*modelSLO
+}
+
+// modelSLO holds one model's request counts within the slow window
+type modelSLO struct {
+	// buckets are in time order; total and bad sum them
+	buckets  []sloBucket
+	total    int
+	bad      int
+	lastSeen time.Time
+	// alerting is set while both windows exceed the burn rate
+	alerting bool
+}
+
+// sloBucket counts the requests of one BucketSize interval, and those that
+// breached the latency threshold
+type sloBucket struct {
+	start time.Time
+	total int
+	bad   int
+}
+
+// NewSLOTracker creates a tracker, applying defaults for zero config values
+func NewSLOTracker(config SLOConfig) *SLOTracker {
+	if config.LatencyThreshold <= 0 {
+		config.LatencyThreshold = 2 * time.Second
+	}
+	if config.Objective <= 0 || config.Objective >= 1 {
+		config.Objective = 0.99
+	}
+	if config.FastWindow <= 0 {
+		config.FastWindow = 5 * time.Minute
+	}
+	if config.SlowWindow <= 0 {
+		config.SlowWindow = time.Hour
+	}
+	if config.BurnRate <= 0 {
+		config.BurnRate = 14.4
+	}
+	if config.BucketSize <= 0 {
+		config.BucketSize = min(time.Minute, config.FastWindow/5)
+	}
+
+	return &SLOTracker{
+		config: config,
+		models: make(map[string]*modelSLO),
+	}
+}
+
+// Observe records the request against its model's SLO. It alerts once when
+// both windows start exceeding the burn rate, and again only after either
+// has fallen back below it. The anomaly score is the lower of the two burn
+// rates, and the description names both.
+func (t *SLOTracker) Observe(event TelemetryEvent) []Anomaly {
+	if event.ModelName == "" {
+		return nil
+	}
+
+	now := eventTime(event)
+	latency := time.Duration(event.LatencyMs * float64(time.Millisecond))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	model, ok := t.models[event.ModelName]
+	if !ok {
+		model = &modelSLO{}
+		t.models[event.ModelName] = model
+	}
+	if now.After(model.lastSeen) {
+		model.lastSeen = now
+	}
+	model.add(now.Truncate(t.config.BucketSize), latency > t.config.LatencyThreshold)
+	model.trim(t.windowStart(model, t.config.SlowWindow))
+
+	fast, slow := t.burnRates(model)
+	burning := fast > t.config.BurnRate && slow > t.config.BurnRate
+	if !burning || model.alerting {
+		model.alerting = burning
+		return nil
+	}
+	model.alerting = true
+
+	return []Anomaly{newAnomaly(AnomalySLOBurn, event, min(fast, slow), t.config.BurnRate,
+		fmt.Sprintf("model %s is burning its %.2f%% latency SLO (%s) at %.1fx over %s and %.1fx over %s",
+			event.ModelName, t.config.Objective*100, t.config.LatencyThreshold,
+			fast, t.config.FastWindow, slow, t.config.SlowWindow))}
+}
+
+// BurnRates returns the model's current burn rates over the fast and slow windows
+func (t *SLOTracker) BurnRates(modelName string) (fast, slow float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	model, ok := t.models[modelName]
+	if !ok {
+		return 0, 0
+	}
+	return t.burnRates(model)
+}
+
+// burnRates computes the model's burn rates over the buckets of each
+// window, ending with the bucket of its latest request
+func (t *SLOTracker) burnRates(model *modelSLO) (fast, slow float64) {
+	budget := 1 - t.config.Objective
+	fastStart := t.windowStart(model, t.config.FastWindow)
+
+	var fastTotal, fastBad int
+	for i := len(model.buckets) - 1; i >= 0 && !model.buckets[i].start.Before(fastStart); i-- {
+		fastTotal += model.buckets[i].total
+		fastBad += model.buckets[i].bad
+	}
+
+	if fastTotal > 0 {
+		fast = float64(fastBad) / float64(fastTotal) / budget
+	}
+	if model.total > 0 {
+		slow = float64(model.bad) / float64(model.total) / budget
+	}
+	return fast, slow
+}
+
+// windowStart returns the start of the first bucket of a window ending with
+// the bucket of the model's latest request
+func (t *SLOTracker) windowStart(model *modelSLO, window time.Duration) time.Time {
+	return model.lastSeen.Truncate(t.config.BucketSize).Add(t.config.BucketSize - window)
+}
+
+// add counts a request in the bucket starting at start. Requests arrive
+// roughly in time order, so the search starts from the newest bucket.
+func (m *modelSLO) add(start time.Time, bad bool) {
+	i := len(m.buckets)
+	for i > 0 && m.buckets[i-1].start.After(start) {
+		i--
+	}
+	if i == 0 || !m.buckets[i-1].start.Equal(start) {
+		m.buckets = append(m.buckets, sloBucket{})
+		copy(m.buckets[i+1:], m.buckets[i:])
+		m.buckets[i] = sloBucket{start: start}
+		i++
+	}
+
+	m.buckets[i-1].total++
+	m.total++
+	if bad {
+		m.buckets[i-1].bad++
+		m.bad++
+	}
+}
+
+// trim drops the buckets starting before cutoff
+func (m *modelSLO) trim(cutoff time.Time) {
+	i := 0
+	for i < len(m.buckets) && m.buckets[i].start.Before(cutoff) {
+		m.total -= m.buckets[i].total
+		m.bad -= m.buckets[i].bad
+		i++
+	}
+	m.buckets = m.buckets[i:]
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// feedSLO sends one gpt-4 request every 10s from start for the duration,
+// each with the given latency, and returns the anomalies raised
+func feedSLO(tracker *SLOTracker, start time.Time, duration time.Duration, latencyMs float64) []Anomaly {
+	var anomalies []Anomaly
+	for at := start; at.Before(start.Add(duration)); at = at.Add(10 * time.Second) {
+		event := testEvent("req")
+		event.Timestamp = at.Format(time.RFC3339Nano)
+		event.LatencyMs = latencyMs
+		anomalies = append(anomalies, tracker.Observe(event)...)
+	}
+	return anomalies
+}
+
+func TestSLOTrackerIgnoresBriefBlip(t *testing.T) {
+	tracker := NewSLOTracker(SLOConfig{})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	feedSLO(tracker, start, time.Hour, 500)
+	if anomalies := feedSLO(tracker, start.Add(time.Hour), time.Minute, 5000); len(anomalies) != 0 {
+		t.Fatalf("a one-minute blip raised %v", anomalies)
+	}
+
+	fast, slow := tracker.BurnRates("gpt-4")
+	if fast <= 14.4 || slow >= 14.4 {
+		t.Errorf("burn rates = %.1f fast, %.1f slow; want only the fast window over 14.4", fast, slow)
+	}
+}
+
+func TestSLOTrackerAlertsOnSustainedBreach(t *testing.T) {
+	tracker := NewSLOTracker(SLOConfig{})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	feedSLO(tracker, start, time.Hour, 500)
+	anomalies := feedSLO(tracker, start.Add(time.Hour), 30*time.Minute, 5000)
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want one alert for the sustained breach", len(anomalies))
+	}
+
+	alert := anomalies[0]
+	if alert.Type != AnomalySLOBurn || alert.ModelName != "gpt-4" || alert.Threshold != 14.4 {
+		t.Errorf("alert = %+v", alert)
+	}
+	if alert.Score <= 14.4 {
+		t.Errorf("alert score = %.1f, want both burn rates over 14.4", alert.Score)
+	}
+
+	// the alert re-arms once the model recovers
+	feedSLO(tracker, start.Add(90*time.Minute), 2*time.Hour, 500)
+	if anomalies := feedSLO(tracker, start.Add(210*time.Minute), 30*time.Minute, 5000); len(anomalies) != 1 {
+		t.Errorf("got %d anomalies for a second breach, want 1", len(anomalies))
+	}
+}
+
+func TestSLOTrackerConfigurableWindows(t *testing.T) {
+	tracker := NewSLOTracker(SLOConfig{
+		LatencyThreshold: time.Second,
+		Objective:        0.9,
+		FastWindow:       time.Minute,
+		SlowWindow:       10 * time.Minute,
+		BurnRate:         2,
+	})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	feedSLO(tracker, start, 10*time.Minute, 500)
+	if anomalies := feedSLO(tracker, start.Add(10*time.Minute), 3*time.Minute, 1500); len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1", len(anomalies))
+	}
+}
+
+func TestSLOTrackerKeepsBucketedCounts(t *testing.T) {
+	tracker := NewSLOTracker(SLOConfig{})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	feedSLO(tracker, start, 3*time.Hour, 500)
+	model := tracker.models["gpt-4"]
+	if len(model.buckets) != 60 || model.total != 360 {
+		t.Fatalf("kept %d buckets of %d requests, want the slow window's 60 of 360", len(model.buckets), model.total)
+	}
+
+	// a late request is counted in its own bucket, inside the fast window
+	late := testEvent("req-late")
+	late.Timestamp = start.Add(3*time.Hour - 4*time.Minute).Format(time.RFC3339Nano)
+	late.LatencyMs = 5000
+	tracker.Observe(late)
+
+	fast, slow := tracker.BurnRates("gpt-4")
+	if want := 1.0 / 31 / 0.01; fast < want-1e-9 || fast > want+1e-9 {
+		t.Errorf("fast burn rate = %v, want %v", fast, want)
+	}
+	if want := 1.0 / 361 / 0.01; slow < want-1e-9 || slow > want+1e-9 {
+		t.Errorf("slow burn rate = %v, want %v", slow, want)
+	}
+	if len(model.buckets) != 60 {
+		t.Errorf("late request added a bucket: %d, want 60", len(model.buckets))
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+)
+
+// SpilloverConfig configures a SpilloverBuffer
+type SpilloverConfig struct {
+	// Path is the disk queue file
+	Path string
+	// MemoryEvents is the number of events held in memory before spilling to disk (default: 10000)
+	MemoryEvents int
+	// MaxDiskBytes bounds the disk queue; events that do not fit are dropped (default: 100 MiB)
+	MaxDiskBytes int64
+	// Logger receives lost and discarded events (default: slog.Default())
+	Logger *slog.Logger
+}
+
+// SpilloverBuffer holds events that could not be sent during a broker
+// outage. The first MemoryEvents events are kept in memory and later ones
+// are appended to a disk queue, so a long outage cannot exhaust memory.
+// Replay sends them in the order they were added once the brokers recover.
+type SpilloverBuffer struct {
+	config SpilloverConfig
+
+	mu         sync.Mutex
+	memory     []TelemetryEvent
+	file       *os.File
+	diskBytes  int64
+	diskEvents int
+	dropped    int64
+	discarded  int64
+	// replayingKey is the idempotency key of the event Replay is sending
+	replayingKey string
+
+	// replayMu serializes Replay, which owns the reader of the disk queue
+	replayMu   sync.Mutex
+	reader     *bufio.Reader
+	readFile   *os.File
+	readOffset int64
+}
+
+// NewSpilloverBuffer creates the disk queue file, discarding any previous contents
+func NewSpilloverBuffer(config SpilloverConfig) (*SpilloverBuffer, error) {
+	if config.Path == "" {
+		return nil, errors.New("spillover buffer requires a path")
+	}
+	if config.MemoryEvents <= 0 {
+		config.MemoryEvents = 10000
+	}
+	if config.MaxDiskBytes <= 0 {
+		config.MaxDiskBytes = 100 << 20
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spillover file: %w", err)
+	}
+	return &SpilloverBuffer{config: config, file: file}, nil
+}
+
+// Add buffers the event. It stays in memory while there is room and nothing
+// has spilled, and otherwise goes to disk; events that do not fit on disk
+// are dropped and counted.
+func (b *SpilloverBuffer) Add(event TelemetryEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file == nil {
+		return errors.New("spillover buffer is closed")
+	}
+
+	// once events have spilled, later ones follow them to disk to keep their order
+	if b.diskEvents == 0 && len(b.memory) < b.config.MemoryEvents {
+		b.memory = append(b.memory, event)
+		return nil
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spilled event: %w", err)
+	}
+	line = append(line, '\n')
+
+	if b.diskBytes+int64(len(line)) > b.config.MaxDiskBytes {
+		b.dropped++
+		return fmt.Errorf("spillover queue is full, dropped event %s", event.RequestID)
+	}
+
+	n, err := b.file.Write(line)
+	b.diskBytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to spill event: %w", err)
+	}
+	b.diskEvents++
+	return nil
+}
+
+// OnPermanentFailure buffers the event, logging if it is dropped. It can be
+// assigned directly to TelemetryProducer.OnPermanentFailure; failures of the
+// event Replay is sending are ignored, since it stays at the head of the buffer.
+func (b *SpilloverBuffer) OnPermanentFailure(event TelemetryEvent, cause error) {
+	b.mu.Lock()
+	replaying := event.IdempotencyKey != "" && event.IdempotencyKey == b.replayingKey
+	b.mu.Unlock()
+	if replaying {
+		return
+	}
+
+	if err := b.Add(event); err != nil {
+		b.config.Logger.Error("Lost event", "request_id", event.RequestID, "error", err)
+	}
+}
+
+// Len returns the number of events buffered in memory and on disk
+func (b *SpilloverBuffer) Len() (memory, disk int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.memory), b.diskEvents
+}
+
+// Dropped returns the number of events dropped because the disk queue was full
+func (b *SpilloverBuffer) Dropped() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dropped
+}
+
+// Discarded returns the number of events Replay removed because sending
+// them failed permanently
+func (b *SpilloverBuffer) Discarded() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.discarded
+}
+
+// Replay sends the buffered events in order, memory first, then disk, and
+// returns how many were sent. An event that fails permanently, such as an
+// invalid event or one that cannot be serialized, would fail on every
+// Replay, so it is discarded and counted; the producer has already passed
+// failed writes to its DeadLetter. Replay stops at the first transient
+// failure, leaving that event and the ones after it buffered for the next
+// Replay. The disk queue is truncated once it is fully drained.
+func (b *SpilloverBuffer) Replay(ctx context.Context, producer *TelemetryProducer) (int, error) {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+	defer b.setReplaying("")
+
+	sent := 0
+	for {
+		b.mu.Lock()
+		if len(b.memory) == 0 {
+			b.mu.Unlock()
+			break
+		}
+		event := b.memory[0]
+		b.replayingKey = event.IdempotencyKey
+		b.mu.Unlock()
+
+		if err := producer.SendEvent(ctx, event); err != nil {
+			if !permanentReplayError(ctx, err) {
+				return sent, err
+			}
+			b.discard(event, err)
+		} else {
+			sent++
+		}
+
+		b.mu.Lock()
+		b.memory = b.memory[1:]
+		b.mu.Unlock()
+	}
+
+	for {
+		event, size, err := b.nextSpilled()
+		if err == io.EOF {
+			return sent, b.truncate()
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		b.setReplaying(event.IdempotencyKey)
+		if err := producer.SendEvent(ctx, event); err != nil {
+			if !permanentReplayError(ctx, err) {
+				// read the same event again on the next Replay
+				b.closeReader()
+				return sent, err
+			}
+			b.discard(event, err)
+		} else {
+			sent++
+		}
+
+		b.readOffset += int64(size)
+		b.mu.Lock()
+		b.diskEvents--
+		b.mu.Unlock()
+	}
+}
+
+// permanentReplayError reports whether a replayed event failed in a way
+// retrying cannot fix. Cancellation, open circuit breakers and network
+// errors mean the brokers are still unavailable, so they are transient.
+func permanentReplayError(ctx context.Context, err error) bool {
+	var netErr net.Error
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) || errors.As(err, &netErr) {
+		return false
+	}
+	return !IsRetryable(err)
+}
+
+// discard counts and logs an event Replay gave up on
+func (b *SpilloverBuffer) discard(event TelemetryEvent, err error) {
+	b.mu.Lock()
+	b.discarded++
+	b.mu.Unlock()
+	b.config.Logger.Warn("Discarded buffered event", "request_id", event.RequestID, "error", err)
+}
+
+// setReplaying records the idempotency key of the event being replayed
+func (b *SpilloverBuffer) setReplaying(key string) {
+	b.mu.Lock()
+	b.replayingKey = key
+	b.mu.Unlock()
+}
+
+// nextSpilled reads the next event in the disk queue and returns it with
+// its size on disk. It returns io.EOF when every spilled event was replayed.
+func (b *SpilloverBuffer) nextSpilled() (TelemetryEvent, int, error) {
+	var event TelemetryEvent
+
+	b.mu.Lock()
+	pending := b.diskEvents
+	b.mu.Unlock()
+	if pending == 0 {
+		return event, 0, io.EOF
+	}
+
+	if b.reader == nil {
+		file, err := os.Open(b.config.Path)
+		if err != nil {
+			return event, 0, fmt.Errorf("failed to open spillover file: %w", err)
+		}
+		if _, err := file.Seek(b.readOffset, io.SeekStart); err != nil {
+			file.Close()
+			return event, 0, fmt.Errorf("failed to read spillover file: %w", err)
+		}
+		b.readFile = file
+		b.reader = bufio.NewReader(file)
+	}
+
+	line, err := b.reader.ReadBytes('\n')
+	if err != nil {
+		b.closeReader()
+		return event, 0, fmt.Errorf("failed to read spillover file: %w", err)
+	}
+	if err := json.Unmarshal(line, &event); err != nil {
+		b.closeReader()
+		return event, 0, fmt.Errorf("failed to decode spilled event: %w", err)
+	}
+	return event, len(line), nil
+}
+
+// closeReader closes the disk queue reader; the next read reopens it at readOffset
+func (b *SpilloverBuffer) closeReader() {
+	if b.readFile != nil {
+		b.readFile.Close()
+		b.readFile, b.reader = nil, nil
+	}
+}
+
+// truncate empties the drained disk queue
+func (b *SpilloverBuffer) truncate() error {
+	b.closeReader()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.diskEvents > 0 || b.file == nil {
+		return nil
+	}
+	if err := b.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate spillover file: %w", err)
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to truncate spillover file: %w", err)
+	}
+	b.diskBytes, b.readOffset = 0, 0
+	return nil
+}
+
+// Close closes the disk queue. Events still buffered are lost.
+func (b *SpilloverBuffer) Close() error {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	b.closeReader()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
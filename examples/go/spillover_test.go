@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// errTestOutage is the retryable error of a broker outage
+var errTestOutage = fmt.Errorf("%w: %w", errTestBroker, kafka.BrokerNotAvailable)
+
+// outageWriter fails every write while down, and the first write of failKey
+type outageWriter struct {
+	fakeWriter
+	down    bool
+	failKey string
+}
+
+func (w *outageWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.down {
+		return errTestOutage
+	}
+	for _, msg := range msgs {
+		if string(msg.Key) == w.failKey {
+			w.failKey = ""
+			return errTestOutage
+		}
+	}
+	return w.fakeWriter.WriteMessages(ctx, msgs...)
+}
+
+func TestSpilloverBufferSurvivesOutageAndDrainsInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spillover.ndjson")
+	buffer, err := NewSpilloverBuffer(SpilloverConfig{Path: path, MemoryEvents: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	w := &outageWriter{down: true}
+	producer := &TelemetryProducer{writer: w, topic: "llm.telemetry", OnPermanentFailure: buffer.OnPermanentFailure}
+
+	for i := 0; i < 10; i++ {
+		if err := producer.SendEvent(context.Background(), testEvent(fmt.Sprintf("req-%d", i))); err == nil {
+			t.Fatal("SendEvent succeeded during the outage")
+		}
+	}
+	if memory, disk := buffer.Len(); memory != 3 || disk != 7 {
+		t.Fatalf("Len = %d in memory, %d on disk; want 3 and 7", memory, disk)
+	}
+
+	// a replay while the brokers are still down keeps everything buffered once
+	if sent, err := buffer.Replay(context.Background(), producer); sent != 0 || !errors.Is(err, errTestBroker) {
+		t.Fatalf("Replay during outage = %d, %v; want 0 sent and the broker error", sent, err)
+	}
+	if memory, disk := buffer.Len(); memory != 3 || disk != 7 {
+		t.Fatalf("Len after failed replay = %d/%d, want 3/7", memory, disk)
+	}
+
+	// the recovery fails once part way through the disk queue
+	w.down, w.failKey = false, "req-6"
+	if sent, err := buffer.Replay(context.Background(), producer); sent != 6 || err == nil {
+		t.Fatalf("Replay = %d, %v; want 6 sent before the failure", sent, err)
+	}
+	if memory, disk := buffer.Len(); memory != 0 || disk != 4 {
+		t.Fatalf("Len after partial replay = %d/%d, want 0/4", memory, disk)
+	}
+	if sent, err := buffer.Replay(context.Background(), producer); sent != 4 || err != nil {
+		t.Fatalf("Replay = %d, %v; want the remaining 4 sent", sent, err)
+	}
+
+	msgs := w.Messages()
+	if len(msgs) != 10 {
+		t.Fatalf("wrote %d messages, want 10", len(msgs))
+	}
+	for i, msg := range msgs {
+		var event TelemetryEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("req-%d", i); event.RequestID != want {
+			t.Errorf("message %d is %s, want %s", i, event.RequestID, want)
+		}
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("disk queue not truncated after draining: %v", err)
+	}
+}
+
+func TestSpilloverBufferDropsWhenDiskIsFull(t *testing.T) {
+	line, _ := json.Marshal(testEvent("req-0"))
+	buffer, err := NewSpilloverBuffer(SpilloverConfig{
+		Path:         filepath.Join(t.TempDir(), "spillover.ndjson"),
+		MemoryEvents: 1,
+		MaxDiskBytes: int64(2*len(line) + 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	var errs int
+	for i := 0; i < 5; i++ {
+		if buffer.Add(testEvent(fmt.Sprintf("req-%d", i))) != nil {
+			errs++
+		}
+	}
+
+	if memory, disk := buffer.Len(); memory != 1 || disk != 2 {
+		t.Errorf("Len = %d/%d, want 1 in memory and 2 on disk", memory, disk)
+	}
+	if buffer.Dropped() != 2 || errs != 2 {
+		t.Errorf("Dropped = %d with %d errors, want 2", buffer.Dropped(), errs)
+	}
+}
+
+func TestSpilloverBufferDiscardsPermanentFailures(t *testing.T) {
+	buffer, err := NewSpilloverBuffer(SpilloverConfig{Path: filepath.Join(t.TempDir(), "spillover.ndjson"), MemoryEvents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Close()
+
+	// one invalid event at the head of memory and one on disk
+	for _, id := range []string{"bad-1", "req-1", "bad-2", "req-2"} {
+		event := testEvent(id)
+		if id[:3] == "bad" {
+			event.TotalTokens = -1
+		}
+		if err := buffer.Add(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.ValidateBeforeSend = true
+	sent, err := buffer.Replay(context.Background(), producer)
+	if sent != 2 || err != nil {
+		t.Fatalf("Replay = %d, %v; want the 2 valid events sent", sent, err)
+	}
+	if memory, disk := buffer.Len(); memory != 0 || disk != 0 {
+		t.Errorf("Len = %d/%d, want the buffer drained", memory, disk)
+	}
+	if buffer.Discarded() != 2 {
+		t.Errorf("Discarded = %d, want 2", buffer.Discarded())
+	}
+	if got := messageKeys(w.Messages()); len(got) != 2 || got[0] != "req-1" || got[1] != "req-2" {
+		t.Errorf("sent %v, want req-1 and req-2", got)
+	}
+}
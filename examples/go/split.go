@@ -0,0 +1,181 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// SplitFinalKey is the metadata key marking the last part of a split call
+const SplitFinalKey = "split_final"
+
+// SplitPartsKey and SplitPartialKey are the metadata keys a merged event
+// records its part count under, and whether it was released incomplete
+const (
+	SplitPartsKey   = "split_parts"
+	SplitPartialKey = "split_partial"
+)
+
+// SplitMergerConfig configures a SplitMerger
+type SplitMergerConfig struct {
+	// Timeout is how long a split call waits for its next part before it is
+	// released incomplete (default: 30s)
+	Timeout time.Duration
+	// IsFinal reports whether an event is the last part of its call
+	// (default: FinalSplitPart)
+	IsFinal func(event TelemetryEvent) bool
+}
+
+// FinalSplitPart reports whether the event's metadata sets SplitFinalKey to true
+func FinalSplitPart(event TelemetryEvent) bool {
+	final, _ := event.Metadata[SplitFinalKey].(bool)
+	return final
+}
+
+// SplitMerger merges calls that an integration split into several events,
+// such as a long generation reported in chunks. Parts share a
+// ParentRequestID and are held until the final part arrives, then released
+// as one event with their tokens and cost summed and the longest latency.
+// Events without a ParentRequestID pass straight through.
+type SplitMerger struct {
+	mu      sync.Mutex
+	config  SplitMergerConfig
+	now     func() time.Time
+	pending map[string]*splitGroup
+	partial int
+}
+
+// splitGroup is the parts of one call received so far
+type splitGroup struct {
+	parts    []TelemetryEvent
+	lastSeen time.Time
+}
+
+// NewSplitMerger creates a merger, applying defaults for zero config values
+func NewSplitMerger(config SplitMergerConfig) *SplitMerger {
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.IsFinal == nil {
+		config.IsFinal = FinalSplitPart
+	}
+	return &SplitMerger{config: config, now: time.Now, pending: make(map[string]*splitGroup)}
+}
+
+// Add buffers a part and returns the events that are now ready: the event
+// itself if it is not split, or the merged call once its final part arrives
+func (m *SplitMerger) Add(event TelemetryEvent) []TelemetryEvent {
+	if event.ParentRequestID == "" {
+		return []TelemetryEvent{event}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, ok := m.pending[event.ParentRequestID]
+	if !ok {
+		group = &splitGroup{}
+		m.pending[event.ParentRequestID] = group
+	}
+	group.parts = append(group.parts, event)
+	group.lastSeen = m.now()
+
+	if !m.config.IsFinal(event) {
+		return nil
+	}
+	delete(m.pending, event.ParentRequestID)
+	return []TelemetryEvent{mergeSplit(event.ParentRequestID, group.parts, false)}
+}
+
+// Expire releases calls that have waited Timeout since their last part,
+// merged from the parts received and marked partial. Call it periodically.
+func (m *SplitMerger) Expire() []TelemetryEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deadline := m.now().Add(-m.config.Timeout)
+	var ready []TelemetryEvent
+	for parent, group := range m.pending {
+		if group.lastSeen.After(deadline) {
+			continue
+		}
+		delete(m.pending, parent)
+		m.partial++
+		ready = append(ready, mergeSplit(parent, group.parts, true))
+	}
+	return ready
+}
+
+// Flush releases every buffered call, marked partial
+func (m *SplitMerger) Flush() []TelemetryEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ready []TelemetryEvent
+	for parent, group := range m.pending {
+		delete(m.pending, parent)
+		m.partial++
+		ready = append(ready, mergeSplit(parent, group.parts, true))
+	}
+	return ready
+}
+
+// Pending returns the number of calls waiting for more parts
+func (m *SplitMerger) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.pending)
+}
+
+// Partial returns the number of calls released without their final part
+func (m *SplitMerger) Partial() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.partial
+}
+
+// mergeSplit combines the parts of a call, in arrival order, into one event
+// identified by the parent request id. Counts and cost are summed, latency is
+// the longest part's, the timestamp is the earliest and the response texts
+// are concatenated.
+func mergeSplit(parent string, parts []TelemetryEvent, partial bool) TelemetryEvent {
+	merged := parts[0]
+	merged.RequestID = parent
+	merged.ParentRequestID = ""
+	merged.IdempotencyKey = ""
+	merged.Metadata = make(map[string]interface{}, len(parts[0].Metadata)+2)
+	earliest := eventTime(parts[0])
+
+	for i, part := range parts {
+		for k, v := range part.Metadata {
+			merged.Metadata[k] = v
+		}
+		if part.ErrorCode != "" {
+			merged.ErrorCode = part.ErrorCode
+		}
+		if merged.PromptText == "" {
+			merged.PromptText = part.PromptText
+		}
+		if ts := eventTime(part); ts.Before(earliest) {
+			earliest = ts
+			merged.Timestamp = part.Timestamp
+		}
+		if i == 0 {
+			continue
+		}
+		merged.PromptTokens += part.PromptTokens
+		merged.CompletionTokens += part.CompletionTokens
+		merged.TotalTokens += part.TotalTokens
+		merged.CostUsd += part.CostUsd
+		merged.LatencyMs = max(merged.LatencyMs, part.LatencyMs)
+		merged.ResponseText += part.ResponseText
+	}
+
+	delete(merged.Metadata, SplitFinalKey)
+	merged.Metadata[SplitPartsKey] = len(parts)
+	if partial {
+		merged.Metadata[SplitPartialKey] = true
+	}
+	return merged
+}
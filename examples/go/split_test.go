@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func splitPart(parent, id string, ts time.Time, completionTokens int, latency float64, text string) TelemetryEvent {
+	event := testEvent(id)
+	event.ParentRequestID = parent
+	event.Timestamp = ts.Format(time.RFC3339Nano)
+	event.PromptTokens = 100
+	event.CompletionTokens = completionTokens
+	event.TotalTokens = 100 + completionTokens
+	event.CostUsd = 0.01
+	event.LatencyMs = latency
+	event.ResponseText = text
+	event.Metadata = map[string]interface{}{"region": "us-east-1"}
+	return event
+}
+
+func TestSplitMergerMergesCompletedCall(t *testing.T) {
+	merger := NewSplitMerger(SplitMergerConfig{})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	first := splitPart("req-1", "req-1.1", start.Add(time.Second), 200, 800, "Hello, ")
+	second := splitPart("req-1", "req-1.2", start, 300, 1500, "world")
+	final := splitPart("req-1", "req-1.3", start.Add(2*time.Second), 50, 400, "!")
+	final.Metadata[SplitFinalKey] = true
+
+	if released := merger.Add(first); len(released) != 0 {
+		t.Fatalf("released %d events before the final part", len(released))
+	}
+	merger.Add(second)
+	if merger.Pending() != 1 {
+		t.Fatalf("Pending() = %d, want 1", merger.Pending())
+	}
+
+	released := merger.Add(final)
+	if len(released) != 1 {
+		t.Fatalf("released %d events, want 1", len(released))
+	}
+	merged := released[0]
+
+	if merged.RequestID != "req-1" || merged.ParentRequestID != "" {
+		t.Errorf("merged ids = %q/%q, want req-1 with no parent", merged.RequestID, merged.ParentRequestID)
+	}
+	if merged.PromptTokens != 300 || merged.CompletionTokens != 550 || merged.TotalTokens != 850 {
+		t.Errorf("merged tokens = %d/%d/%d, want 300/550/850", merged.PromptTokens, merged.CompletionTokens, merged.TotalTokens)
+	}
+	if math.Abs(merged.CostUsd-0.03) > 1e-9 {
+		t.Errorf("merged cost = %v, want 0.03", merged.CostUsd)
+	}
+	if merged.LatencyMs != 1500 {
+		t.Errorf("merged latency = %v, want the longest part's 1500", merged.LatencyMs)
+	}
+	if !eventTime(merged).Equal(start) {
+		t.Errorf("merged timestamp = %s, want the earliest part's", merged.Timestamp)
+	}
+	if merged.ResponseText != "Hello, world!" {
+		t.Errorf("merged response = %q", merged.ResponseText)
+	}
+	if merged.Metadata[SplitPartsKey] != 3 || merged.Metadata[SplitPartialKey] != nil {
+		t.Errorf("merged metadata = %v, want 3 parts and not partial", merged.Metadata)
+	}
+	if _, ok := merged.Metadata[SplitFinalKey]; ok {
+		t.Error("merged event kept the final part marker")
+	}
+	if merger.Pending() != 0 || merger.Partial() != 0 {
+		t.Errorf("Pending() = %d, Partial() = %d, want 0 and 0", merger.Pending(), merger.Partial())
+	}
+}
+
+func TestSplitMergerExpiresPartialCall(t *testing.T) {
+	merger := NewSplitMerger(SplitMergerConfig{Timeout: 10 * time.Second})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	merger.now = func() time.Time { return now }
+
+	merger.Add(splitPart("req-1", "req-1.1", now, 200, 800, "Hello"))
+	now = now.Add(5 * time.Second)
+	merger.Add(splitPart("req-1", "req-1.2", now, 300, 1200, ", wor"))
+	merger.Add(splitPart("req-2", "req-2.1", now, 100, 300, "Hi"))
+
+	now = now.Add(9 * time.Second)
+	if expired := merger.Expire(); len(expired) != 0 {
+		t.Fatalf("expired %d calls before their timeout", len(expired))
+	}
+
+	now = now.Add(time.Second)
+	expired := merger.Expire()
+	if len(expired) != 2 {
+		t.Fatalf("expired %d calls, want 2", len(expired))
+	}
+	for _, merged := range expired {
+		if merged.Metadata[SplitPartialKey] != true {
+			t.Errorf("call %s was not marked partial", merged.RequestID)
+		}
+		if merged.RequestID == "req-1" && (merged.CompletionTokens != 500 || merged.Metadata[SplitPartsKey] != 2) {
+			t.Errorf("partial req-1 = %d completion tokens from %v parts, want 500 from 2",
+				merged.CompletionTokens, merged.Metadata[SplitPartsKey])
+		}
+	}
+	if merger.Pending() != 0 || merger.Partial() != 2 {
+		t.Errorf("Pending() = %d, Partial() = %d, want 0 and 2", merger.Pending(), merger.Partial())
+	}
+}
+
+func TestSplitMergerPassesUnsplitEvents(t *testing.T) {
+	merger := NewSplitMerger(SplitMergerConfig{})
+
+	event := testEvent("req-1")
+	released := merger.Add(event)
+	if len(released) != 1 || released[0].RequestID != "req-1" || released[0].Metadata[SplitPartsKey] != nil {
+		t.Fatalf("released %v, want the event unchanged", released)
+	}
+	if merger.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", merger.Pending())
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// SpoolerConfig configures a FailedEventSpooler
+type SpoolerConfig struct {
+	// Path is the active spool file; rotated files get .1, .2, ... suffixes
+	Path string
+	// MaxBytes is the size at which the active file is rotated (default: 10 MiB)
+	MaxBytes int64
+	// MaxFiles is the number of rotated files kept (default: 3)
+	MaxFiles int
+}
+
+// spooledEvent is one spool line: the event's own fields plus why it failed,
+// so spool files can be fed straight back into Backfill
+type spooledEvent struct {
+	TelemetryEvent
+	FailureCause string `json:"failure_cause"`
+	FailedAt     string `json:"failed_at"`
+}
+
+// FailedEventSpooler appends events that could not be sent to a local NDJSON
+// file for inspection and manual backfill. Disk usage is bounded by rotating
+// the file at MaxBytes and keeping at most MaxFiles rotated files.
+type FailedEventSpooler struct {
+	mu     sync.Mutex
+	config SpoolerConfig
+	file   *os.File
+	size   int64
+}
+
+// NewFailedEventSpooler opens (or creates) the spool file for appending
+func NewFailedEventSpooler(config SpoolerConfig) (*FailedEventSpooler, error) {
+	if config.Path == "" {
+		return nil, errors.New("spooler requires a path")
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 10 << 20
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = 3
+	}
+
+	s := &FailedEventSpooler{config: config}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Spool appends the event and the cause of its failure
+func (s *FailedEventSpooler) Spool(event TelemetryEvent, cause error) error {
+	record := spooledEvent{
+		TelemetryEvent: event,
+		FailedAt:       time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if cause != nil {
+		record.FailureCause = cause.Error()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spooled event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("spooler is closed")
+	}
+
+	if s.size > 0 && s.size+int64(len(line)) > s.config.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to spool event: %w", err)
+	}
+	return nil
+}
+
+// Write spools the event, making the spooler a DeadLetterSink
+func (s *FailedEventSpooler) Write(event TelemetryEvent, cause error) error {
+	return s.Spool(event, cause)
+}
+
+// OnPermanentFailure spools the event, logging if that fails too. It can be
+// assigned directly to TelemetryProducer.OnPermanentFailure.
+func (s *FailedEventSpooler) OnPermanentFailure(event TelemetryEvent, cause error) {
+	if err := s.Spool(event, cause); err != nil {
+		log.Printf("Lost event %s: %v", event.RequestID, err)
+	}
+}
+
+// Close closes the active spool file
+func (s *FailedEventSpooler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// open opens the active spool file for appending
+func (s *FailedEventSpooler) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat spool file: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts path -> path.1 -> path.2 ..., dropping the oldest file
+func (s *FailedEventSpooler) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close spool file: %w", err)
+	}
+	s.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", s.config.Path, s.config.MaxFiles))
+	for i := s.config.MaxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.config.Path, i), fmt.Sprintf("%s.%d", s.config.Path, i+1))
+	}
+	if err := os.Rename(s.config.Path, s.config.Path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate spool file: %w", err)
+	}
+
+	return s.open()
+}
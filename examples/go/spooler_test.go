@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readSpool(t *testing.T, path string) []spooledEvent {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []spooledEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record spooledEvent
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid spool line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestPermanentFailureIsSpooled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.ndjson")
+	spooler, err := NewFailedEventSpooler(SpoolerConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spooler.Close()
+
+	producer := newTestProducer(&fakeWriter{writeErr: errTestBroker})
+	producer.OnPermanentFailure = spooler.OnPermanentFailure
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-lost")); !errors.Is(err, errTestBroker) {
+		t.Fatalf("SendEvent = %v, want broker error", err)
+	}
+
+	records := readSpool(t, path)
+	if len(records) != 1 {
+		t.Fatalf("spooled %d events, want 1", len(records))
+	}
+	if records[0].RequestID != "req-lost" {
+		t.Errorf("spooled request_id = %q, want req-lost", records[0].RequestID)
+	}
+	if records[0].FailureCause == "" || records[0].FailedAt == "" {
+		t.Errorf("spooled record missing failure details: %+v", records[0])
+	}
+}
+
+func TestSpoolFileCanBeBackfilled(t *testing.T) {
+	dir := t.TempDir()
+	spooler, err := NewFailedEventSpooler(SpoolerConfig{Path: filepath.Join(dir, "failed.ndjson")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := spooler.Spool(testEvent(fmt.Sprintf("req-%d", i)), errTestBroker); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spooler.Close()
+
+	w := &fakeWriter{}
+	result, err := Backfill(context.Background(), DirSource{Dir: dir}, newTestProducer(w), BackfillOptions{})
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	if result.Sent != 3 || fmt.Sprint(messageKeys(w.Messages())) != "[req-0 req-1 req-2]" {
+		t.Errorf("backfilled %+v with keys %v", result, messageKeys(w.Messages()))
+	}
+}
+
+func TestSpoolerRotatesAndStaysBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.ndjson")
+	spooler, err := NewFailedEventSpooler(SpoolerConfig{Path: path, MaxBytes: 1024, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spooler.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := spooler.Spool(testEvent(fmt.Sprintf("req-%d", i)), errTestBroker); err != nil {
+			t.Fatalf("Spool: %v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", filepath.Base(name), err)
+		}
+		if info.Size() > 1024 {
+			t.Errorf("%s is %d bytes, want <= 1024", filepath.Base(name), info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third rotated file, got %v", err)
+	}
+
+	records := readSpool(t, path)
+	if last := records[len(records)-1].RequestID; last != "req-49" {
+		t.Errorf("newest spooled event = %s, want req-49", last)
+	}
+}
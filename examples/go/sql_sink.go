@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sqlIdentifier matches table names that are safe to interpolate into SQL
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// sqlSinkColumns are the columns written for each event, in insert order
+var sqlSinkColumns = []string{
+	"timestamp", "service_name", "model_name", "latency_ms",
+	"prompt_tokens", "completion_tokens", "total_tokens", "cost_usd",
+	"user_id", "session_id", "request_id", "error_code",
+	"prompt_text", "response_text", "metadata",
+}
+
+// SQLSinkConfig configures a SQLSink
+type SQLSinkConfig struct {
+	// Driver is the database/sql driver name, e.g. "postgres" or "sqlite3"
+	Driver string
+	// DSN is the driver-specific data source name
+	DSN string
+	// Table is the destination table (default: telemetry_events)
+	Table string
+	// CreateTable creates the table on startup if it does not exist
+	CreateTable bool
+	// NumberedPlaceholders uses $1, $2, ... instead of ? (required for PostgreSQL)
+	NumberedPlaceholders bool
+	// BatchSize is the number of buffered events that triggers a flush (default: 100)
+	BatchSize int
+	// FlushInterval flushes buffered events periodically (default: 1s)
+	FlushInterval time.Duration
+	// MaxBuffered bounds the events held while the database is unavailable;
+	// the oldest are dropped beyond it (default: 10000)
+	MaxBuffered int
+	// Logger receives dropped events and flush failures (default: slog.Default())
+	Logger *slog.Logger
+}
+
+// SQLSink batches events into a SQL table for ad-hoc querying. Metadata is
+// stored as a JSON text column. While the database is unreachable events
+// stay buffered (up to MaxBuffered) and the connection is re-established
+// on the next flush.
+type SQLSink struct {
+	config SQLSinkConfig
+	insert string
+
+	mu          sync.Mutex
+	db          *sql.DB
+	buffer      []TelemetryEvent
+	dropped     int
+	badMetadata int
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewSQLSink opens the database and starts the periodic flusher
+func NewSQLSink(config SQLSinkConfig) (*SQLSink, error) {
+	if config.Driver == "" || config.DSN == "" {
+		return nil, errors.New("sql sink requires a driver and DSN")
+	}
+	if config.Table == "" {
+		config.Table = "telemetry_events"
+	}
+	if !sqlIdentifier.MatchString(config.Table) {
+		return nil, fmt.Errorf("invalid table name %q", config.Table)
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.MaxBuffered <= 0 {
+		config.MaxBuffered = 10000
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	db, err := sql.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if config.CreateTable {
+		if _, err := db.Exec(createTableSQL(config.Table)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create table: %w", err)
+		}
+	}
+
+	s := &SQLSink{
+		config: config,
+		insert: insertSQL(config.Table, config.NumberedPlaceholders),
+		db:     db,
+		done:   make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.flushLoop()
+
+	return s, nil
+}
+
+// Write buffers the events and flushes once a full batch is buffered. A
+// failed flush keeps the events buffered for the next attempt.
+func (s *SQLSink) Write(ctx context.Context, events []TelemetryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buffer = append(s.buffer, events...)
+	if overflow := len(s.buffer) - s.config.MaxBuffered; overflow > 0 {
+		s.buffer = s.buffer[overflow:]
+		s.dropped += overflow
+		s.config.Logger.Warn("SQL sink buffer full, dropped oldest events", "dropped", overflow)
+	}
+
+	if len(s.buffer) < s.config.BatchSize {
+		return nil
+	}
+	return s.flushLocked(ctx)
+}
+
+// Flush writes all buffered events
+func (s *SQLSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flushLocked(ctx)
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (s *SQLSink) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// BadMetadata returns the number of events whose metadata could not be
+// encoded as JSON and was sanitized before insertion
+func (s *SQLSink) BadMetadata() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.badMetadata
+}
+
+// Close stops the flusher, writes any buffered events and closes the
+// database. Closing a closed sink is a no-op.
+func (s *SQLSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		err = s.flushLocked(context.Background())
+		if closeErr := s.db.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// flushLoop flushes buffered events every FlushInterval
+func (s *SQLSink) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Flush(context.Background()); err != nil {
+				s.config.Logger.Error("SQL sink flush failed", "error", err)
+			}
+		}
+	}
+}
+
+// flushLocked inserts the buffered events in batches, one transaction per batch
+func (s *SQLSink) flushLocked(ctx context.Context) error {
+	for len(s.buffer) > 0 {
+		n := len(s.buffer)
+		if n > s.config.BatchSize {
+			n = s.config.BatchSize
+		}
+
+		if err := s.insertBatch(ctx, s.buffer[:n]); err != nil {
+			s.reconnect(ctx)
+			return err
+		}
+		s.buffer = s.buffer[n:]
+	}
+
+	s.buffer = nil
+	return nil
+}
+
+// insertBatch inserts events in a single transaction using a prepared statement
+func (s *SQLSink) insertBatch(ctx context.Context, events []TelemetryEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, s.insert)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i := range events {
+		metadata := s.encodeMetadata(&events[i])
+		event := events[i]
+
+		if _, err := stmt.ExecContext(ctx,
+			event.Timestamp, event.ServiceName, event.ModelName, event.LatencyMs,
+			event.PromptTokens, event.CompletionTokens, event.TotalTokens, event.CostUsd,
+			event.UserID, event.SessionID, event.RequestID, event.ErrorCode,
+			event.PromptText, event.ResponseText, string(metadata),
+		); err != nil {
+			return fmt.Errorf("failed to insert event %s: %w", event.RequestID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return nil
+}
+
+// encodeMetadata encodes the event's metadata as JSON. Values JSON cannot
+// encode are stringified in the buffered event, as by a MetadataSanitizer,
+// and counted once, so one bad event does not fail its batch on every flush.
+func (s *SQLSink) encodeMetadata(event *TelemetryEvent) []byte {
+	if event.Metadata == nil {
+		return nil
+	}
+	metadata, err := json.Marshal(event.Metadata)
+	if err == nil {
+		return metadata
+	}
+
+	s.badMetadata++
+	var keys []string
+	*event, keys = (&MetadataSanitizer{}).Sanitize(*event)
+	s.config.Logger.Warn("SQL sink sanitized metadata keys", "request_id", event.RequestID, "keys", keys)
+	if metadata, err = json.Marshal(event.Metadata); err != nil {
+		event.Metadata = nil
+		return nil
+	}
+	return metadata
+}
+
+// reconnect replaces the connection pool if the database is unreachable
+func (s *SQLSink) reconnect(ctx context.Context) {
+	if err := s.db.PingContext(ctx); err == nil {
+		return
+	}
+
+	db, err := sql.Open(s.config.Driver, s.config.DSN)
+	if err != nil {
+		s.config.Logger.Error("SQL sink reconnect failed", "error", err)
+		return
+	}
+
+	s.db.Close()
+	s.db = db
+}
+
+// createTableSQL returns portable DDL for the sink table
+func createTableSQL(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	timestamp TEXT,
+	service_name TEXT,
+	model_name TEXT,
+	latency_ms REAL,
+	prompt_tokens INTEGER,
+	completion_tokens INTEGER,
+	total_tokens INTEGER,
+	cost_usd REAL,
+	user_id TEXT,
+	session_id TEXT,
+	request_id TEXT,
+	error_code TEXT,
+	prompt_text TEXT,
+	response_text TEXT,
+	metadata TEXT
+)`, table)
+}
+
+// insertSQL returns the parameterized insert statement for the sink table
+func insertSQL(table string, numbered bool) string {
+	placeholders := make([]string, len(sqlSinkColumns))
+	for i := range placeholders {
+		if numbered {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		} else {
+			placeholders[i] = "?"
+		}
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(sqlSinkColumns, ", "), strings.Join(placeholders, ", "))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestSQLSink(t *testing.T, batchSize int) (*SQLSink, *sql.DB) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+
+	// Keep one connection open so the shared in-memory database outlives the sink
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewSQLSink(SQLSinkConfig{
+		Driver:        "sqlite3",
+		DSN:           dsn,
+		CreateTable:   true,
+		BatchSize:     batchSize,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLSink: %v", err)
+	}
+	return sink, db
+}
+
+func TestSQLSinkRowsMatchEvents(t *testing.T) {
+	sink, db := newTestSQLSink(t, 2)
+	ctx := context.Background()
+
+	var sent []TelemetryEvent
+	for i := 0; i < 5; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		event.Metadata = map[string]interface{}{"region": "us-east-1", "attempt": float64(i)}
+		sent = append(sent, event)
+	}
+
+	if err := sink.Write(ctx, sent[:3]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := sink.Write(ctx, sent[3:]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT timestamp, service_name, model_name, latency_ms, prompt_tokens,
+		completion_tokens, total_tokens, cost_usd, user_id, session_id, request_id, metadata
+		FROM telemetry_events ORDER BY request_id`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+
+	var got []TelemetryEvent
+	for rows.Next() {
+		var event TelemetryEvent
+		var metadata string
+		if err := rows.Scan(&event.Timestamp, &event.ServiceName, &event.ModelName, &event.LatencyMs,
+			&event.PromptTokens, &event.CompletionTokens, &event.TotalTokens, &event.CostUsd,
+			&event.UserID, &event.SessionID, &event.RequestID, &metadata); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			t.Fatalf("metadata column is not JSON: %v", err)
+		}
+		got = append(got, event)
+	}
+
+	if !reflect.DeepEqual(got, sent) {
+		t.Errorf("rows = %+v\nwant %+v", got, sent)
+	}
+}
+
+func TestSQLSinkBuffersUntilBatchFull(t *testing.T) {
+	sink, db := newTestSQLSink(t, 10)
+	defer sink.Close()
+
+	if err := sink.Write(context.Background(), []TelemetryEvent{testEvent("req-1")}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM telemetry_events").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("rows before flush = %d, want 0", count)
+	}
+
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM telemetry_events").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("rows after flush = %d, want 1", count)
+	}
+}
+
+func TestSQLSinkKeepsEventsWhenInsertFails(t *testing.T) {
+	sink, db := newTestSQLSink(t, 1)
+	defer sink.Close()
+
+	if _, err := db.Exec("DROP TABLE telemetry_events"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), []TelemetryEvent{testEvent("req-1")}); err == nil {
+		t.Fatal("expected insert into missing table to fail")
+	}
+
+	if _, err := db.Exec(createTableSQL("telemetry_events")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush after recovery: %v", err)
+	}
+
+	var requestID string
+	if err := db.QueryRow("SELECT request_id FROM telemetry_events").Scan(&requestID); err != nil {
+		t.Fatal(err)
+	}
+	if requestID != "req-1" {
+		t.Errorf("request_id = %q, want req-1", requestID)
+	}
+}
+
+func TestNewSQLSinkRejectsInvalidTable(t *testing.T) {
+	if _, err := NewSQLSink(SQLSinkConfig{Driver: "sqlite3", DSN: ":memory:", Table: "events; DROP TABLE x"}); err == nil {
+		t.Error("expected invalid table name to be rejected")
+	}
+}
+
+func TestSQLSinkSanitizesUnencodableMetadata(t *testing.T) {
+	sink, db := newTestSQLSink(t, 3)
+
+	bad := testEvent("req-2")
+	bad.Metadata = map[string]interface{}{"region": "us-east-1", "callback": func() {}}
+	events := []TelemetryEvent{testEvent("req-1"), bad, testEvent("req-3")}
+	if err := sink.Write(context.Background(), events); err != nil {
+		t.Fatalf("Write = %v, want the batch inserted", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM telemetry_events").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("inserted %d rows, want 3", count)
+	}
+	var metadata string
+	if err := db.QueryRow("SELECT metadata FROM telemetry_events WHERE request_id = 'req-2'").Scan(&metadata); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(metadata), &decoded); err != nil || decoded["region"] != "us-east-1" {
+		t.Errorf("metadata = %s, want the encodable keys kept", metadata)
+	}
+	if sink.BadMetadata() != 1 {
+		t.Errorf("BadMetadata() = %d, want 1", sink.BadMetadata())
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("second Close = %v, want a no-op", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// IdleEvicter is implemented by detectors that keep state per key (model,
+// session, ...). EvictIdle drops keys not observed since cutoff and returns
+// how many were dropped.
+type IdleEvicter interface {
+	EvictIdle(cutoff time.Time) int
+}
+
+// SweeperConfig configures a Sweeper
+type SweeperConfig struct {
+	// TTL is how long a key may go unobserved before its state is evicted (default: 30m)
+	TTL time.Duration
+	// Interval is how often detectors are swept (default: TTL / 4)
+	Interval time.Duration
+}
+
+// Sweeper caps detector memory by periodically evicting state for keys
+// that have been idle for longer than the TTL. Idleness is measured in
+// processing time, so it also bounds memory while replaying old events.
+type Sweeper struct {
+	config    SweeperConfig
+	detectors []IdleEvicter
+	now       func() time.Time
+
+	mu      sync.Mutex
+	evicted int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSweeper creates a sweeper for the detectors and starts its ticker
+func NewSweeper(config SweeperConfig, detectors ...IdleEvicter) *Sweeper {
+	s := newSweeper(config, time.Now, detectors...)
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// newSweeper creates a sweeper without starting its ticker
+func newSweeper(config SweeperConfig, now func() time.Time, detectors ...IdleEvicter) *Sweeper {
+	if config.TTL <= 0 {
+		config.TTL = 30 * time.Minute
+	}
+	if config.Interval <= 0 {
+		config.Interval = config.TTL / 4
+	}
+
+	return &Sweeper{
+		config:    config,
+		detectors: detectors,
+		now:       now,
+		done:      make(chan struct{}),
+	}
+}
+
+// Sweep evicts keys idle for longer than the TTL from every detector and
+// returns the number evicted
+func (s *Sweeper) Sweep() int {
+	cutoff := s.now().Add(-s.config.TTL)
+
+	evicted := 0
+	for _, d := range s.detectors {
+		evicted += d.EvictIdle(cutoff)
+	}
+
+	s.mu.Lock()
+	s.evicted += evicted
+	s.mu.Unlock()
+
+	return evicted
+}
+
+// Evicted returns the total number of keys evicted so far
+func (s *Sweeper) Evicted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.evicted
+}
+
+// Close stops the ticker
+func (s *Sweeper) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// run sweeps on every tick until Close
+func (s *Sweeper) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
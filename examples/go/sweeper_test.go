@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSweeperEvictsIdleKeys(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	degenerate := NewDegenerateResponseDetector(DegenerateResponseConfig{})
+	degenerate.now = clock
+	burst := NewBurstDetector(BurstConfig{})
+	burst.now = clock
+	sweeper := newSweeper(SweeperConfig{TTL: 30 * time.Minute}, clock, degenerate, burst)
+
+	idle := testEvent("req-1")
+	idle.ModelName = "gpt-3.5-turbo"
+	idle.SessionID = "session-idle"
+	degenerate.Observe(idle)
+	burst.Observe(idle)
+
+	now = now.Add(20 * time.Minute)
+	degenerate.Observe(testEvent("req-2"))
+	burst.Observe(testEvent("req-2"))
+
+	now = now.Add(15 * time.Minute)
+	if evicted := sweeper.Sweep(); evicted != 2 {
+		t.Errorf("Sweep evicted %d keys, want 2", evicted)
+	}
+
+	if _, ok := degenerate.Debug().Keys["gpt-3.5-turbo"]; ok {
+		t.Error("idle model still tracked")
+	}
+	if _, ok := degenerate.Debug().Keys["gpt-4"]; !ok {
+		t.Error("active model evicted")
+	}
+	if burst.Sessions() != 1 {
+		t.Errorf("burst tracks %d sessions, want 1", burst.Sessions())
+	}
+
+	now = now.Add(time.Hour)
+	sweeper.Sweep()
+	if sweeper.Evicted() != 4 {
+		t.Errorf("Evicted = %d, want 4", sweeper.Evicted())
+	}
+}
+
+func TestSweeperConcurrentWithObserve(t *testing.T) {
+	detector := NewLatencyBimodalityDetector(LatencyBimodalityConfig{})
+	sweeper := newSweeper(SweeperConfig{TTL: time.Nanosecond}, time.Now, detector)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				event := testEvent("req")
+				event.ModelName = fmt.Sprintf("model-%d", i%10)
+				detector.Observe(event)
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		sweeper.Sweep()
+	}
+	wg.Wait()
+}
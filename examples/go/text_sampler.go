@@ -0,0 +1,73 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// TextSampler keeps the prompt and response text of a fraction of events
+// and clears it from the rest, which are still sent with their token counts
+// and cost. This bounds the payload size and the amount of user text stored.
+type TextSampler struct {
+	rate   float64
+	seed   uint64
+	seeded bool
+}
+
+// NewTextSampler creates a sampler keeping the text of rate (0.0-1.0) of
+// events, chosen at random on each send
+func NewTextSampler(rate float64) *TextSampler {
+	return &TextSampler{rate: rate}
+}
+
+// NewSeededTextSampler creates a sampler keeping the text of rate (0.0-1.0)
+// of events, chosen from a hash of the seed and the event's RequestID. The
+// same event is sampled the same way on every send, e.g. when replayed.
+func NewSeededTextSampler(rate float64, seed uint64) *TextSampler {
+	return &TextSampler{rate: rate, seed: seed, seeded: true}
+}
+
+// WithTextSampleRate keeps the prompt and response text of rate (0.0-1.0)
+// of events, chosen at random (default: the text of every event is kept).
+// Set the producer's TextSampler to a NewSeededTextSampler for decisions
+// that hold on replay.
+func WithTextSampleRate(rate float64) ProducerOption {
+	return func(c *writerConfig) {
+		c.textSampler = NewTextSampler(rate)
+	}
+}
+
+// Keep reports whether the event's text is kept. A nil sampler keeps all
+// text.
+func (s *TextSampler) Keep(event TelemetryEvent) bool {
+	if s == nil {
+		return true
+	}
+	if s.seeded {
+		h := fnv.New64a()
+		h.Write([]byte(event.RequestID))
+		return float64(mix64(h.Sum64()^s.seed)>>11)/(1<<53) < s.rate
+	}
+	return rand.Float64() < s.rate
+}
+
+// Apply returns the event with its PromptText and ResponseText cleared
+// unless the sampler keeps its text. PromptHash is kept either way.
+func (s *TextSampler) Apply(event TelemetryEvent) TelemetryEvent {
+	if !s.Keep(event) {
+		event.PromptText = ""
+		event.ResponseText = ""
+	}
+	return event
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone leaves the high bits of
+// RequestIDs that differ only in their last characters correlated.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestTextSamplerKeepsRateOfEvents(t *testing.T) {
+	const n, rate = 10000, 0.2
+	for _, sampler := range []*TextSampler{NewTextSampler(rate), NewSeededTextSampler(rate, 42)} {
+		kept := 0
+		for i := 0; i < n; i++ {
+			event := testEvent(fmt.Sprintf("req-%d", i))
+			event.PromptText, event.ResponseText = "prompt", "response"
+			if sampled := sampler.Apply(event); sampled.PromptText != "" {
+				kept++
+			} else if sampled.ResponseText != "" || sampled.TotalTokens != 450 || sampled.CostUsd != event.CostUsd {
+				t.Fatalf("sampled out %+v, want only the text cleared", sampled)
+			}
+		}
+		if got := float64(kept) / n; got < rate-0.02 || got > rate+0.02 {
+			t.Errorf("seeded=%v kept the text of %.3f of events, want about %.2f", sampler.seeded, got, rate)
+		}
+	}
+}
+
+func TestSeededTextSamplerIsDeterministic(t *testing.T) {
+	first, replay, other := NewSeededTextSampler(0.5, 7), NewSeededTextSampler(0.5, 7), NewSeededTextSampler(0.5, 8)
+	differs := false
+	for i := 0; i < 100; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		if first.Keep(event) != replay.Keep(event) {
+			t.Fatalf("%s was sampled differently on replay", event.RequestID)
+		}
+		differs = differs || first.Keep(event) != other.Keep(event)
+	}
+	if !differs {
+		t.Error("different seeds sampled every event the same way")
+	}
+}
+
+func TestWithTextSampleRateClearsText(t *testing.T) {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithTextSampleRate(0))
+	p.writer.Close()
+	w := &fakeWriter{}
+	p.writer = w
+
+	event := testEvent("req-1")
+	event.PromptText, event.ResponseText, event.PromptHash = "prompt", "response", "abc123"
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent TelemetryEvent
+	if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.PromptText != "" || sent.ResponseText != "" {
+		t.Errorf("sent text %q / %q, want it cleared", sent.PromptText, sent.ResponseText)
+	}
+	if sent.PromptHash != "abc123" || sent.TotalTokens != 450 {
+		t.Errorf("sent %+v, want the hash and token counts kept", sent)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ThresholdConfig sets hard limits an AnomalyDetector flags regardless of
+// the statistics, for boundaries that are known up front. A nil field is
+// unbounded.
+type ThresholdConfig struct {
+	MaxLatencyMs   *float64 `json:"max_latency_ms,omitempty"`
+	MaxTotalTokens *int     `json:"max_total_tokens,omitempty"`
+	MaxCostUsd     *float64 `json:"max_cost_usd,omitempty"`
+}
+
+// Threshold names, set as Anomaly.Limit on hard-threshold breaches
+const (
+	LimitMaxLatencyMs   = "max_latency_ms"
+	LimitMaxTotalTokens = "max_total_tokens"
+	LimitMaxCostUsd     = "max_cost_usd"
+)
+
+// LoadThresholds reads a ThresholdConfig from a file, parsed as YAML when
+// its extension is .yaml or .yml and as JSON otherwise. Fields left out of
+// the file are unbounded. Unknown fields and negative limits are errors.
+func LoadThresholds(path string) (ThresholdConfig, error) {
+	var config ThresholdConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read thresholds: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Re-encode as JSON so both formats share the JSON field names
+		var thresholds interface{}
+		if err := yaml.Unmarshal(data, &thresholds); err != nil {
+			return config, fmt.Errorf("failed to parse thresholds: %w", err)
+		}
+		if data, err = json.Marshal(thresholds); err != nil {
+			return config, fmt.Errorf("failed to parse thresholds: %w", err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("failed to parse thresholds: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// Validate checks that no limit is negative
+func (c ThresholdConfig) Validate() error {
+	var errs []error
+	if c.MaxLatencyMs != nil && *c.MaxLatencyMs < 0 {
+		errs = append(errs, fmt.Errorf("%s is negative", LimitMaxLatencyMs))
+	}
+	if c.MaxTotalTokens != nil && *c.MaxTotalTokens < 0 {
+		errs = append(errs, fmt.Errorf("%s is negative", LimitMaxTotalTokens))
+	}
+	if c.MaxCostUsd != nil && *c.MaxCostUsd < 0 {
+		errs = append(errs, fmt.Errorf("%s is negative", LimitMaxCostUsd))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid thresholds: %w", err)
+	}
+	return nil
+}
+
+// limit returns the hard limit on the metric of kind, its name, and false
+// when the metric is unbounded
+func (c ThresholdConfig) limit(kind AnomalyKind) (float64, string, bool) {
+	switch {
+	case kind == AnomalyHighLatency && c.MaxLatencyMs != nil:
+		return *c.MaxLatencyMs, LimitMaxLatencyMs, true
+	case kind == AnomalyHighTokens && c.MaxTotalTokens != nil:
+		return float64(*c.MaxTotalTokens), LimitMaxTotalTokens, true
+	case kind == AnomalyHighCost && c.MaxCostUsd != nil:
+		return *c.MaxCostUsd, LimitMaxCostUsd, true
+	}
+	return 0, "", false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeThresholds(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadThresholdsLeavesMissingFieldsUnbounded(t *testing.T) {
+	for name, data := range map[string]string{
+		"thresholds.json": `{"max_cost_usd": 0.5}`,
+		"thresholds.yaml": "max_cost_usd: 0.5\n",
+	} {
+		config, err := LoadThresholds(writeThresholds(t, name, data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if config.MaxCostUsd == nil || *config.MaxCostUsd != 0.5 {
+			t.Errorf("%s: MaxCostUsd = %v, want 0.5", name, config.MaxCostUsd)
+		}
+		if config.MaxLatencyMs != nil || config.MaxTotalTokens != nil {
+			t.Errorf("%s: unset limits = %v, %v, want unbounded", name, config.MaxLatencyMs, config.MaxTotalTokens)
+		}
+	}
+}
+
+func TestLoadThresholdsRejectsBadFiles(t *testing.T) {
+	for name, data := range map[string]string{
+		"typo.json":     `{"max_latency": 20000}`,
+		"negative.yaml": "max_total_tokens: -1\n",
+	} {
+		if _, err := LoadThresholds(writeThresholds(t, name, data)); err == nil {
+			t.Errorf("%s: loaded without an error", name)
+		}
+	}
+}
+
+func TestAnomalyDetectorFlagsHardThresholds(t *testing.T) {
+	config, err := LoadThresholds(writeThresholds(t, "thresholds.json", `{"max_cost_usd": 0.5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector := NewAnomalyDetector(AnomalyDetectorConfig{Thresholds: config})
+
+	slow := testEvent("req-slow")
+	slow.LatencyMs = 60000
+	slow.TotalTokens = 100000
+	if anomalies := detector.Evaluate(slow); len(anomalies) != 0 {
+		t.Errorf("unbounded latency and tokens were flagged: %v", anomalies)
+	}
+
+	pricey := testEvent("req-pricey")
+	pricey.CostUsd = 0.75
+	anomalies := detector.Evaluate(pricey)
+	if len(anomalies) != 1 {
+		t.Fatalf("anomalies = %v, want one for the cost during warm-up", anomalies)
+	}
+	anomaly := anomalies[0]
+	if anomaly.Type != AnomalyHighCost || anomaly.Limit != LimitMaxCostUsd || anomaly.Score != 0.75 || anomaly.Threshold != 0.5 {
+		t.Errorf("anomaly = %+v, want high_cost over max_cost_usd 0.5", anomaly)
+	}
+}
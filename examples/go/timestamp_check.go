@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFutureTimestamp is returned for events timestamped too far ahead of the local clock
+var ErrFutureTimestamp = errors.New("event timestamp is in the future")
+
+// FutureTimestampCheck rejects events whose Timestamp is more than MaxSkew
+// ahead of the local clock, which indicates a client bug or a spoofed
+// timestamp. The event is rejected rather than clamped to now. Events
+// without a parseable timestamp pass.
+type FutureTimestampCheck struct {
+	// MaxSkew is how far ahead of now a timestamp may be
+	MaxSkew time.Duration
+
+	now func() time.Time
+}
+
+// NewFutureTimestampCheck creates a check allowing timestamps up to maxSkew ahead of now
+func NewFutureTimestampCheck(maxSkew time.Duration) *FutureTimestampCheck {
+	return &FutureTimestampCheck{MaxSkew: maxSkew, now: time.Now}
+}
+
+// Check returns an error wrapping ErrFutureTimestamp if the event is too far in the future
+func (c *FutureTimestampCheck) Check(event TelemetryEvent) error {
+	if c == nil {
+		return nil
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, event.Timestamp)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	if ahead := ts.Sub(now()); ahead > c.MaxSkew {
+		return fmt.Errorf("%w: event %s is %s ahead, at most %s allowed",
+			ErrFutureTimestamp, event.RequestID, ahead.Round(time.Millisecond), c.MaxSkew)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFutureTimestampCheck(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	check := NewFutureTimestampCheck(time.Minute)
+	check.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		timestamp string
+		reject    bool
+	}{
+		{"past", now.Add(-time.Hour).Format(time.RFC3339Nano), false},
+		{"just within", now.Add(time.Minute - time.Millisecond).Format(time.RFC3339Nano), false},
+		{"at the limit", now.Add(time.Minute).Format(time.RFC3339Nano), false},
+		{"just beyond", now.Add(time.Minute + time.Millisecond).Format(time.RFC3339Nano), true},
+		{"far future", now.Add(24 * time.Hour).Format(time.RFC3339Nano), true},
+		{"malformed", "tomorrow", false},
+	}
+
+	for _, tt := range tests {
+		event := testEvent("req-1")
+		event.Timestamp = tt.timestamp
+		err := check.Check(event)
+		if got := errors.Is(err, ErrFutureTimestamp); got != tt.reject {
+			t.Errorf("%s: Check = %v, want rejected %v", tt.name, err, tt.reject)
+		}
+	}
+}
+
+func TestProducerRejectsFutureTimestamps(t *testing.T) {
+	w := &fakeWriter{}
+	producer := newTestProducer(w)
+	producer.FutureTimestamps = NewFutureTimestampCheck(5 * time.Second)
+
+	event := testEvent("req-1")
+	event.Timestamp = time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	if err := producer.SendEvent(context.Background(), event); !errors.Is(err, ErrFutureTimestamp) {
+		t.Fatalf("SendEvent = %v, want ErrFutureTimestamp", err)
+	}
+	if err := producer.SendEvent(context.Background(), testEvent("req-2")); err != nil {
+		t.Fatalf("SendEvent for a past event: %v", err)
+	}
+
+	if got := len(w.Messages()); got != 1 {
+		t.Errorf("wrote %d messages, want 1", got)
+	}
+	if report := producer.Report(); report.Dropped.Future != 1 {
+		t.Errorf("Dropped.Future = %d, want 1", report.Dropped.Future)
+	}
+}
+
+func TestIngestHandlerRejectsFutureTimestamp(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	producer.FutureTimestamps = NewFutureTimestampCheck(5 * time.Second)
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	body := `{"service_name":"chat-api","model_name":"gpt-4","timestamp":"` + future + `"}`
+	rec := httptest.NewRecorder()
+	NewIngestHandler(producer).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
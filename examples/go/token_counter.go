@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// TokenCounter counts the tokens a model's tokenizer splits text into
+type TokenCounter interface {
+	Count(model, text string) (int, error)
+}
+
+// WhitespaceCounter approximates token counts from whitespace-separated
+// words, at 4 tokens per 3 words, the usual ratio for English text. It is
+// the fallback for models without a known tokenizer.
+type WhitespaceCounter struct{}
+
+// Count returns the approximate number of tokens in text
+func (WhitespaceCounter) Count(model, text string) (int, error) {
+	words := len(strings.Fields(text))
+	return (words*4 + 2) / 3, nil
+}
+
+// TiktokenCounter counts tokens with the BPE encodings of OpenAI models,
+// matching tiktoken. Encodings are loaded on first use: the default loader
+// downloads the vocabulary once and caches it in TIKTOKEN_CACHE_DIR. Other
+// models are counted by Fallback. It is safe for concurrent use.
+type TiktokenCounter struct {
+	// Fallback counts tokens for models without a known encoding (default: WhitespaceCounter)
+	Fallback TokenCounter
+
+	mu        sync.Mutex
+	encodings map[string]*tiktoken.Tiktoken
+}
+
+// NewTiktokenCounter creates a counter falling back to a WhitespaceCounter
+func NewTiktokenCounter() *TiktokenCounter {
+	return &TiktokenCounter{Fallback: WhitespaceCounter{}}
+}
+
+// Count returns the number of tokens in text for the model. Special tokens
+// such as <|endoftext|> are counted as plain text.
+func (c *TiktokenCounter) Count(model, text string) (int, error) {
+	name, ok := tiktokenEncodingName(model)
+	if !ok {
+		fallback := c.Fallback
+		if fallback == nil {
+			fallback = WhitespaceCounter{}
+		}
+		return fallback.Count(model, text)
+	}
+
+	encoding, err := c.encoding(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load %s encoding for model %s: %w", name, model, err)
+	}
+	return len(encoding.EncodeOrdinary(text)), nil
+}
+
+// encoding returns the named encoding, loading it on first use
+func (c *TiktokenCounter) encoding(name string) (*tiktoken.Tiktoken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if encoding, ok := c.encodings[name]; ok {
+		return encoding, nil
+	}
+	encoding, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	if c.encodings == nil {
+		c.encodings = make(map[string]*tiktoken.Tiktoken)
+	}
+	c.encodings[name] = encoding
+	return encoding, nil
+}
+
+// tiktokenEncodingName returns the encoding tiktoken uses for the model,
+// matching its name exactly or, for dated snapshots, by prefix
+func tiktokenEncodingName(model string) (string, bool) {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name, true
+	}
+	return longestPrefixMatch(tiktoken.MODEL_PREFIX_TO_ENCODING, model)
+}
+
+// longestPrefixMatch returns the value of the longest key in prefixes that s
+// starts with. Map iteration order is random, so taking the first match would
+// pick between overlapping prefixes such as "gpt-4-" and "gpt-4-32k-" at random.
+func longestPrefixMatch(prefixes map[string]string, s string) (string, bool) {
+	var best, value string
+	found := false
+	for prefix, v := range prefixes {
+		if strings.HasPrefix(s, prefix) && (!found || len(prefix) > len(best)) {
+			best, value, found = prefix, v, true
+		}
+	}
+	return value, found
+}
+
+// CreateTelemetryEventFromText creates a telemetry event whose token counts
+// are computed from the prompt and response with counter, instead of being
+// trusted from the caller. The text itself is not attached; set PromptText
+// and ResponseText to send it.
+func (p *TelemetryProducer) CreateTelemetryEventFromText(
+	serviceName, modelName string,
+	prompt, response string,
+	counter TokenCounter,
+) (TelemetryEvent, error) {
+	promptTokens, err := counter.Count(modelName, prompt)
+	if err != nil {
+		return TelemetryEvent{}, fmt.Errorf("failed to count prompt tokens: %w", err)
+	}
+	completionTokens, err := counter.Count(modelName, response)
+	if err != nil {
+		return TelemetryEvent{}, fmt.Errorf("failed to count completion tokens: %w", err)
+	}
+
+	return p.CreateTelemetryEvent(serviceName, modelName, 0, promptTokens, completionTokens, 0, "", "", nil), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// useOfflineBpeLoader points tiktoken at the embedded vocabularies for the
+// test. tiktoken has no getter for the current loader, so cleanup restores
+// its default.
+func useOfflineBpeLoader(t *testing.T) {
+	t.Helper()
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	t.Cleanup(func() { tiktoken.SetBpeLoader(tiktoken.NewDefaultBpeLoader()) })
+}
+
+func TestTiktokenCounterMatchesReferenceCounts(t *testing.T) {
+	// the vocabularies are embedded in the loader, so the test needs no
+	// network access
+	useOfflineBpeLoader(t)
+	counter := NewTiktokenCounter()
+
+	// reference counts from OpenAI's tiktoken for cl100k_base
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Hello, world!", 4},
+		{"tiktoken is great!", 6},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := counter.Count("gpt-4", tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Count(gpt-4, %q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTiktokenCounterFallsBackForUnknownModels(t *testing.T) {
+	counter := NewTiktokenCounter()
+	got, err := counter.Count("claude-3-opus", "one two three four five six")
+	if err != nil || got != 8 {
+		t.Errorf("Count(claude-3-opus) = %d, %v, want the whitespace approximation 8", got, err)
+	}
+
+	if name, ok := tiktokenEncodingName("gpt-4-0613"); !ok || name != "cl100k_base" {
+		t.Errorf("encoding of gpt-4-0613 = %q, want cl100k_base by prefix", name)
+	}
+}
+
+// fixedCounter counts every text as its length in bytes
+type fixedCounter struct{ err error }
+
+func (c fixedCounter) Count(model, text string) (int, error) {
+	return len(text), c.err
+}
+
+func TestCreateTelemetryEventFromText(t *testing.T) {
+	p := newTestProducer(&fakeWriter{})
+	event, err := p.CreateTelemetryEventFromText("chat-api", "gpt-4", "prompt", "a response", fixedCounter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.PromptTokens != 6 || event.CompletionTokens != 10 || event.TotalTokens != 16 {
+		t.Errorf("tokens = %d + %d = %d, want 6 + 10 = 16", event.PromptTokens, event.CompletionTokens, event.TotalTokens)
+	}
+	if event.PromptText != "" || event.ResponseText != "" {
+		t.Error("the text was attached to the event")
+	}
+
+	if _, err := p.CreateTelemetryEventFromText("chat-api", "gpt-4", "p", "r", fixedCounter{err: errTestBroker}); !errors.Is(err, errTestBroker) {
+		t.Errorf("counter error = %v, want it wrapped", err)
+	}
+}
+
+func TestLongestPrefixMatchPrefersMostSpecificPrefix(t *testing.T) {
+	prefixes := map[string]string{
+		"gpt-4-":     "cl100k_base",
+		"gpt-4-32k-": "other",
+		"gpt-4o-":    "o200k_base",
+	}
+	tests := []struct {
+		model string
+		want  string
+		ok    bool
+	}{
+		{"gpt-4-0613", "cl100k_base", true},
+		{"gpt-4-32k-0613", "other", true},
+		{"gpt-4o-2024-05-13", "o200k_base", true},
+		{"claude-3-opus", "", false},
+	}
+	for _, tt := range tests {
+		// repeat to exercise different map iteration orders
+		for i := 0; i < 20; i++ {
+			got, ok := longestPrefixMatch(prefixes, tt.model)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("longestPrefixMatch(%q) = %q, %v, want %q, %v", tt.model, got, ok, tt.want, tt.ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+// Metadata keys of the derived token efficiency metrics
+const (
+	// CompletionPromptRatioKey holds completion tokens per prompt token
+	CompletionPromptRatioKey = "completion_prompt_ratio"
+	// CostPer1kCompletionTokensKey holds the event's cost per 1000 completion tokens
+	CostPer1kCompletionTokensKey = "cost_per_1k_completion_tokens"
+)
+
+// AddTokenEfficiency returns the event with its completion-to-prompt ratio
+// and cost per 1000 completion tokens in its metadata. A long prompt that
+// yields little completion, or an expensive completion, points at
+// inefficient prompting. The ratio is left out when the event has no
+// prompt tokens, and the cost when it has no completion tokens, rather than
+// dividing by zero. The metadata map is copied, so the caller's event is
+// not modified.
+func AddTokenEfficiency(event TelemetryEvent) TelemetryEvent {
+	if event.PromptTokens <= 0 && event.CompletionTokens <= 0 {
+		return event
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata)+2)
+	for key, value := range event.Metadata {
+		metadata[key] = value
+	}
+	if event.PromptTokens > 0 {
+		metadata[CompletionPromptRatioKey] = float64(event.CompletionTokens) / float64(event.PromptTokens)
+	}
+	if event.CompletionTokens > 0 {
+		metadata[CostPer1kCompletionTokensKey] = event.CostUsd / float64(event.CompletionTokens) * 1000
+	}
+	event.Metadata = metadata
+	return event
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestAddTokenEfficiency(t *testing.T) {
+	tests := []struct {
+		name               string
+		prompt, completion int
+		cost               float64
+		ratio, costPer1k   interface{}
+	}{
+		{"chat", 150, 300, 0.0225, 2.0, 0.075},
+		{"long prompt", 4000, 100, 0.126, 0.025, 1.26},
+		{"zero prompt", 0, 200, 0.012, nil, 0.06},
+		{"zero completion", 500, 0, 0.015, 0.0, nil},
+	}
+
+	for _, tt := range tests {
+		event := testEvent("req-1")
+		event.PromptTokens, event.CompletionTokens = tt.prompt, tt.completion
+		event.TotalTokens = tt.prompt + tt.completion
+		event.CostUsd = tt.cost
+		event.Metadata = map[string]interface{}{"region": "us-east-1"}
+
+		got := AddTokenEfficiency(event)
+		for key, want := range map[string]interface{}{CompletionPromptRatioKey: tt.ratio, CostPer1kCompletionTokensKey: tt.costPer1k} {
+			value, ok := got.Metadata[key]
+			if want == nil {
+				if ok {
+					t.Errorf("%s: %s = %v, want it left out", tt.name, key, value)
+				}
+				continue
+			}
+			if f, _ := value.(float64); !ok || math.Abs(f-want.(float64)) > 1e-9 {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, value, want)
+			}
+		}
+		if got.Metadata["region"] != "us-east-1" || len(event.Metadata) != 1 {
+			t.Errorf("%s: metadata = %v, caller's = %v, want the copy extended", tt.name, got.Metadata, event.Metadata)
+		}
+	}
+}
+
+func TestProducerAddsTokenEfficiencyWhenEnabled(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		w := &fakeWriter{}
+		p := newTestProducer(w)
+		p.TokenEfficiency = enabled
+		if err := p.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+			t.Fatal(err)
+		}
+
+		var sent TelemetryEvent
+		if err := json.Unmarshal(w.Messages()[0].Value, &sent); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := sent.Metadata[CompletionPromptRatioKey]; ok != enabled {
+			t.Errorf("TokenEfficiency = %v: sent metadata %v", enabled, sent.Metadata)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RouteFunc picks the topic an event is sent to
+type RouteFunc func(event TelemetryEvent) string
+
+// TopicRouter sends each event through the producer of the topic its
+// RouteFunc picks, for example to keep anomalous or high-cost traffic on a
+// separate topic. Each topic has its own producer, so its metrics are
+// reported separately. The topics are fixed when the router is created,
+// which bounds the number of metric labels.
+type TopicRouter struct {
+	route     RouteFunc
+	fallback  string
+	producers map[string]*TelemetryProducer
+}
+
+// NewTopicRouter creates a router over producers, one per topic. Events
+// routed to a topic without a producer go to the fallback topic's producer.
+func NewTopicRouter(route RouteFunc, fallback string, producers ...*TelemetryProducer) (*TopicRouter, error) {
+	r := &TopicRouter{
+		route:     route,
+		fallback:  fallback,
+		producers: make(map[string]*TelemetryProducer, len(producers)),
+	}
+	for _, p := range producers {
+		if _, ok := r.producers[p.topic]; ok {
+			return nil, fmt.Errorf("duplicate producer for topic %s", p.topic)
+		}
+		r.producers[p.topic] = p
+	}
+	if _, ok := r.producers[fallback]; !ok {
+		return nil, fmt.Errorf("no producer for fallback topic %s", fallback)
+	}
+	return r, nil
+}
+
+// producerFor returns the producer of the event's topic
+func (r *TopicRouter) producerFor(event TelemetryEvent) *TelemetryProducer {
+	if p, ok := r.producers[r.route(event)]; ok {
+		return p
+	}
+	return r.producers[r.fallback]
+}
+
+// SendEvent sends the event to its topic
+func (r *TopicRouter) SendEvent(ctx context.Context, event TelemetryEvent) error {
+	return r.producerFor(event).SendEvent(ctx, event)
+}
+
+// SendEvents sends each topic's events as one batch, keeping their order
+// within the topic, and joins the errors of every batch
+func (r *TopicRouter) SendEvents(ctx context.Context, events []TelemetryEvent) error {
+	batches := make(map[*TelemetryProducer][]TelemetryEvent)
+	var order []*TelemetryProducer
+	for _, event := range events {
+		p := r.producerFor(event)
+		if _, ok := batches[p]; !ok {
+			order = append(order, p)
+		}
+		batches[p] = append(batches[p], event)
+	}
+
+	var errs []error
+	for _, p := range order {
+		if err := p.SendEvents(ctx, batches[p]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Metrics returns each topic's metrics, sorted by topic
+func (r *TopicRouter) Metrics() []TopicMetrics {
+	metrics := make([]TopicMetrics, 0, len(r.producers))
+	for _, p := range r.producers {
+		metrics = append(metrics, p.Metrics())
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Topic < metrics[j].Topic })
+	return metrics
+}
+
+// Close closes every producer
+func (r *TopicRouter) Close() error {
+	var errs []error
+	for _, p := range r.producers {
+		if err := p.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
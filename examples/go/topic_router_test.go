@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTopicRouterSeparatesMetricsPerTopic(t *testing.T) {
+	telemetry, premium := &fakeWriter{}, &fakeWriter{writeErr: errTestBroker}
+	telemetryProducer := newTestProducer(telemetry)
+	premiumProducer := &TelemetryProducer{writer: premium, topic: "llm.premium"}
+
+	// unknown topics fall back, so they cannot add metric labels
+	route := func(event TelemetryEvent) string {
+		if event.ModelName == "gpt-4" {
+			return "llm.premium"
+		}
+		return "llm.unknown." + event.RequestID
+	}
+	router, err := NewTopicRouter(route, "llm.telemetry", telemetryProducer, premiumProducer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []TelemetryEvent
+	for i := 0; i < 5; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		if i >= 2 {
+			event.ModelName = "claude-3-opus"
+		}
+		events = append(events, event)
+	}
+	if err := router.SendEvents(context.Background(), events); !errors.Is(err, errTestBroker) {
+		t.Fatalf("SendEvents = %v, want the premium topic's broker error", err)
+	}
+
+	metrics := router.Metrics()
+	if len(metrics) != 2 {
+		t.Fatalf("got metrics for %d topics, want 2: %+v", len(metrics), metrics)
+	}
+	premiumMetrics, telemetryMetrics := metrics[0], metrics[1]
+	if premiumMetrics.Topic != "llm.premium" || premiumMetrics.Sent != 0 || premiumMetrics.Failed != 2 || premiumMetrics.Bytes != 0 {
+		t.Errorf("premium metrics = %+v, want 2 failed", premiumMetrics)
+	}
+	if telemetryMetrics.Topic != "llm.telemetry" || telemetryMetrics.Sent != 3 || telemetryMetrics.Failed != 0 {
+		t.Errorf("telemetry metrics = %+v, want 3 sent", telemetryMetrics)
+	}
+
+	var bytes int64
+	for _, msg := range telemetry.Messages() {
+		bytes += int64(len(msg.Value))
+	}
+	if telemetryMetrics.Bytes != bytes || bytes == 0 {
+		t.Errorf("telemetry bytes = %d, want %d", telemetryMetrics.Bytes, bytes)
+	}
+	if telemetry.writes != 1 || premium.writes != 1 {
+		t.Errorf("writes = %d/%d, want one batch per topic", telemetry.writes, premium.writes)
+	}
+}
+
+func TestTopicRouterRequiresFallbackProducer(t *testing.T) {
+	_, err := NewTopicRouter(func(TelemetryEvent) string { return "" }, "llm.missing", newTestProducer(&fakeWriter{}))
+	if err == nil {
+		t.Error("NewTopicRouter succeeded without a producer for the fallback topic")
+	}
+}
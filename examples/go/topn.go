@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TopNDimension is the event field heavy hitters are grouped by
+type TopNDimension string
+
+const (
+	DimensionUser    TopNDimension = "user"
+	DimensionSession TopNDimension = "session"
+	DimensionModel   TopNDimension = "model"
+)
+
+// TopNMetric is the quantity heavy hitters are ranked by
+type TopNMetric string
+
+const (
+	MetricCost   TopNMetric = "cost"
+	MetricTokens TopNMetric = "tokens"
+	MetricCount  TopNMetric = "count"
+)
+
+// TopNConfig configures a TopNTracker
+type TopNConfig struct {
+	// N is the number of entries returned by TopN (default: 10)
+	N int
+	// Capacity is the number of counters kept; more counters give more
+	// accurate rankings (default: 10 * N)
+	Capacity int
+	// Window is the tumbling window the ranking covers; zero ranks over all time
+	Window time.Duration
+	// Dimension is the field to group by (default: user)
+	Dimension TopNDimension
+	// Metric is the quantity to rank by (default: count)
+	Metric TopNMetric
+}
+
+// TopNEntry is one ranked key. Value may overestimate the true total by at
+// most Error, which is non-zero only for keys that replaced an evicted counter.
+type TopNEntry struct {
+	Key   string  `json:"key"`
+	Value float64 `json:"value"`
+	Error float64 `json:"error"`
+}
+
+// TopNTracker maintains approximate heavy hitters (e.g. "top 10 users by
+// cost this hour") in bounded memory using the space-saving algorithm.
+// Windows are aligned to multiples of Window and follow event timestamps.
+type TopNTracker struct {
+	mu          sync.Mutex
+	config      TopNConfig
+	counters    map[string]*TopNEntry
+	windowStart time.Time
+}
+
+// NewTopNTracker creates a tracker, applying defaults for zero config values
+func NewTopNTracker(config TopNConfig) (*TopNTracker, error) {
+	if config.N <= 0 {
+		config.N = 10
+	}
+	if config.Capacity < config.N {
+		config.Capacity = 10 * config.N
+	}
+	if config.Dimension == "" {
+		config.Dimension = DimensionUser
+	}
+	if config.Metric == "" {
+		config.Metric = MetricCount
+	}
+
+	switch config.Dimension {
+	case DimensionUser, DimensionSession, DimensionModel:
+	default:
+		return nil, fmt.Errorf("unknown top-N dimension %q", config.Dimension)
+	}
+	switch config.Metric {
+	case MetricCost, MetricTokens, MetricCount:
+	default:
+		return nil, fmt.Errorf("unknown top-N metric %q", config.Metric)
+	}
+
+	return &TopNTracker{
+		config:   config,
+		counters: make(map[string]*TopNEntry, config.Capacity),
+	}, nil
+}
+
+// Observe adds the event's metric to its key, starting a new window when
+// the event falls past the current one
+func (t *TopNTracker) Observe(event TelemetryEvent) {
+	key := t.key(event)
+	if key == "" {
+		return
+	}
+	weight := t.weight(event)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.config.Window > 0 {
+		start := eventTime(event).Truncate(t.config.Window)
+		if start.After(t.windowStart) {
+			t.windowStart = start
+			t.counters = make(map[string]*TopNEntry, t.config.Capacity)
+		} else if start.Before(t.windowStart) {
+			// The event belongs to a window that has already been replaced
+			return
+		}
+	}
+
+	if entry, ok := t.counters[key]; ok {
+		entry.Value += weight
+		return
+	}
+
+	if len(t.counters) < t.config.Capacity {
+		t.counters[key] = &TopNEntry{Key: key, Value: weight}
+		return
+	}
+
+	// Replace the smallest counter; the new key inherits its count as error
+	var min *TopNEntry
+	for _, entry := range t.counters {
+		if min == nil || entry.Value < min.Value || (entry.Value == min.Value && entry.Key > min.Key) {
+			min = entry
+		}
+	}
+	delete(t.counters, min.Key)
+	t.counters[key] = &TopNEntry{Key: key, Value: min.Value + weight, Error: min.Value}
+}
+
+// TopN returns up to N keys ranked by value, ties broken by key
+func (t *TopNTracker) TopN() []TopNEntry {
+	t.mu.Lock()
+	entries := make([]TopNEntry, 0, len(t.counters))
+	for _, entry := range t.counters {
+		entries = append(entries, *entry)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Key < entries[j].Key
+	})
+
+	if len(entries) > t.config.N {
+		entries = entries[:t.config.N]
+	}
+	return entries
+}
+
+// WindowStart returns the start of the current window
+func (t *TopNTracker) WindowStart() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.windowStart
+}
+
+// key returns the event's value for the configured dimension
+func (t *TopNTracker) key(event TelemetryEvent) string {
+	switch t.config.Dimension {
+	case DimensionSession:
+		return event.SessionID
+	case DimensionModel:
+		return event.ModelName
+	default:
+		return event.UserID
+	}
+}
+
+// weight returns the event's value for the configured metric
+func (t *TopNTracker) weight(event TelemetryEvent) float64 {
+	switch t.config.Metric {
+	case MetricCost:
+		return event.CostUsd
+	case MetricTokens:
+		return float64(event.TotalTokens)
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestTopNTrackerSurfacesHeavyHitters(t *testing.T) {
+	tracker, err := NewTopNTracker(TopNConfig{N: 3, Capacity: 20, Metric: MetricCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	heavy := map[string]float64{"user-whale": 5.0, "user-big": 3.0, "user-medium": 2.0}
+
+	for i := 0; i < 5000; i++ {
+		event := testEvent(fmt.Sprintf("req-%d", i))
+		// A long tail of light users far larger than the tracker's capacity
+		event.UserID = fmt.Sprintf("user-%d", rng.Intn(1000))
+		event.CostUsd = 0.01
+		tracker.Observe(event)
+
+		if i%10 == 0 {
+			for user, cost := range heavy {
+				event.UserID = user
+				event.CostUsd = cost / 100
+				tracker.Observe(event)
+			}
+		}
+	}
+
+	top := tracker.TopN()
+	want := []string{"user-whale", "user-big", "user-medium"}
+	if len(top) != len(want) {
+		t.Fatalf("TopN returned %d entries, want %d", len(top), len(want))
+	}
+	for i, user := range want {
+		if top[i].Key != user {
+			t.Errorf("rank %d = %s, want %s (%+v)", i+1, top[i].Key, user, top)
+		}
+		if top[i].Value-top[i].Error > heavy[user]*5+1e-9 {
+			t.Errorf("%s lower bound %.2f exceeds true total %.2f", user, top[i].Value-top[i].Error, heavy[user]*5)
+		}
+	}
+}
+
+func TestTopNTrackerResetsPerWindow(t *testing.T) {
+	tracker, err := NewTopNTracker(TopNConfig{N: 2, Window: time.Hour, Dimension: DimensionModel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		tracker.Observe(eventAt(fmt.Sprintf("gpt-%d", i), "s", start.Add(time.Duration(i)*time.Minute)))
+	}
+
+	next := eventAt("claude-1", "s", start.Add(time.Hour))
+	next.ModelName = "claude-3-opus"
+	tracker.Observe(next)
+
+	top := tracker.TopN()
+	if len(top) != 1 || top[0].Key != "claude-3-opus" || top[0].Value != 1 {
+		t.Errorf("TopN after window change = %+v, want only claude-3-opus", top)
+	}
+	if !tracker.WindowStart().Equal(start.Add(time.Hour)) {
+		t.Errorf("WindowStart = %s, want %s", tracker.WindowStart(), start.Add(time.Hour))
+	}
+}
+
+func TestNewTopNTrackerRejectsUnknownDimension(t *testing.T) {
+	if _, err := NewTopNTracker(TopNConfig{Dimension: "region"}); err == nil {
+		t.Error("expected error for unknown dimension")
+	}
+	if _, err := NewTopNTracker(TopNConfig{Metric: "latency"}); err == nil {
+		t.Error("expected error for unknown metric")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// Span stage names recorded while sending an event
+const (
+	StageValidate  = "validate"
+	StageEnrich    = "enrich"
+	StageRedact    = "redact"
+	StageSerialize = "serialize"
+	StageWrite     = "write"
+)
+
+// Span records how long one stage of sending an event took
+type Span struct {
+	RequestID string
+	Stage     string
+	Start     time.Time
+	Duration  time.Duration
+}
+
+// Tracer records per-stage timing spans for a sampled fraction of events.
+// Unsampled events pay only for a single random draw.
+type Tracer struct {
+	sampleRate float64
+	onSpan     func(Span)
+}
+
+// NewTracer creates a tracer sampling sampleRate (0.0-1.0) of events.
+// Each finished span is passed to onSpan; a nil onSpan logs the span with
+// the producer's Logger.
+func NewTracer(sampleRate float64, onSpan func(Span)) *Tracer {
+	return &Tracer{sampleRate: sampleRate, onSpan: onSpan}
+}
+
+// eventTrace collects spans for one sampled event. A nil *eventTrace is a
+// valid no-op trace for unsampled events.
+type eventTrace struct {
+	tracer    *Tracer
+	requestID string
+	logger    *slog.Logger
+}
+
+// startTrace returns a trace for the event, or nil when it is not sampled.
+// Spans without an onSpan hook are logged to logger.
+func (t *Tracer) startTrace(requestID string, logger *slog.Logger) *eventTrace {
+	if t == nil || t.sampleRate <= 0 || rand.Float64() >= t.sampleRate {
+		return nil
+	}
+	return &eventTrace{tracer: t, requestID: requestID, logger: logger}
+}
+
+// span starts timing a stage and returns a function that ends it
+func (tr *eventTrace) span(stage string) func() {
+	if tr == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		s := Span{
+			RequestID: tr.requestID,
+			Stage:     stage,
+			Start:     start,
+			Duration:  time.Since(start),
+		}
+		if tr.tracer.onSpan == nil {
+			tr.logger.Info("Trace span", "request_id", s.RequestID, "stage", s.Stage, "duration", s.Duration)
+			return
+		}
+		tr.tracer.onSpan(s)
+	}
+}
+
+// newPprofHandler returns a handler serving the net/http/pprof endpoints
+func newPprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracerRecordsSpansForSampledEvent(t *testing.T) {
+	var spans []Span
+	producer := newTestProducer(&fakeWriter{})
+	producer.Tracer = NewTracer(1.0, func(s Span) { spans = append(spans, s) })
+	producer.ValidateBeforeSend = true
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	wantStages := []string{StageValidate, StageEnrich, StageRedact, StageSerialize, StageWrite}
+	if len(spans) != len(wantStages) {
+		t.Fatalf("got %d spans, want %d: %+v", len(spans), len(wantStages), spans)
+	}
+	for i, stage := range wantStages {
+		if spans[i].Stage != stage {
+			t.Errorf("spans[%d].Stage = %q, want %q", i, spans[i].Stage, stage)
+		}
+		if spans[i].RequestID != "req-1" {
+			t.Errorf("spans[%d].RequestID = %q, want req-1", i, spans[i].RequestID)
+		}
+		if spans[i].Duration < 0 {
+			t.Errorf("spans[%d].Duration = %s, want non-negative", i, spans[i].Duration)
+		}
+	}
+}
+
+func TestTracerSkipsUnsampledEvents(t *testing.T) {
+	var spans []Span
+	producer := newTestProducer(&fakeWriter{})
+	producer.Tracer = NewTracer(0, func(s Span) { spans = append(spans, s) })
+
+	for i := 0; i < 10; i++ {
+		if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+			t.Fatalf("SendEvent: %v", err)
+		}
+	}
+
+	if len(spans) != 0 {
+		t.Errorf("got %d spans with sample rate 0, want none", len(spans))
+	}
+}
+
+func TestTracerLogsSpansToProducerLogger(t *testing.T) {
+	var logs bytes.Buffer
+	producer := newTestProducer(&fakeWriter{})
+	producer.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	producer.Tracer = NewTracer(1.0, nil)
+
+	if err := producer.SendEvent(context.Background(), testEvent("req-1")); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	for _, stage := range []string{StageEnrich, StageRedact, StageSerialize, StageWrite} {
+		if !strings.Contains(logs.String(), "stage="+stage) {
+			t.Errorf("no %s span in the producer's log: %s", stage, logs.String())
+		}
+	}
+}
+
+func TestPprofHandlerServesIndex(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newPprofHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrTransactionsUnsupported is returned by SendAtomic when the producer has no transactional writer
+var ErrTransactionsUnsupported = errors.New("producer has no transactional writer")
+
+// TransactionalWriter writes messages to several topics in one Kafka
+// transaction. kafka-go does not implement the transactional producer
+// protocol, so this is provided by an adapter over a client that does,
+// configured with a transactional.id.
+type TransactionalWriter interface {
+	BeginTxn(ctx context.Context) error
+	// WriteMessages writes messages within the open transaction; each message names its Topic
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	CommitTxn(ctx context.Context) error
+	AbortTxn(ctx context.Context) error
+}
+
+// TopicEvent is one event of an atomic multi-topic send
+type TopicEvent struct {
+	Topic string
+	Event TelemetryEvent
+}
+
+// SendAtomic sends events to their topics in a single transaction, so that
+// consumers reading with isolation.level=read_committed see either all of
+// them or none. It is meant for request and response events logged to
+// different topics. Events are validated, deduplicated and prepared as by
+// SendEvent, and an invalid or duplicate event rejects the whole group. The
+// deny list, token budget and samplers are not applied, so an atomic group
+// is never partially dropped.
+func (p *TelemetryProducer) SendAtomic(ctx context.Context, events []TopicEvent) error {
+	if p.Transactions == nil {
+		return ErrTransactionsUnsupported
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, te := range events {
+		if te.Topic == "" {
+			return fmt.Errorf("event %s has no topic", te.Event.RequestID)
+		}
+		if p.ValidateBeforeSend {
+			if err := te.Event.Validate(); err != nil {
+				p.counters.invalid.Add(1)
+				p.dropped(te.Event, DropFiltered)
+				return fmt.Errorf("rejected atomic events: event %s: %w", te.Event.RequestID, err)
+			}
+		}
+	}
+
+	reserved, err := p.reserveAtomic(events)
+	if err != nil {
+		return err
+	}
+	release := func() {
+		for _, id := range reserved {
+			p.Dedup.Release(id)
+		}
+	}
+
+	msgs := make([]kafka.Message, len(events))
+	for i, te := range events {
+		ps, err := p.prepareSend(ctx, te.Event, nil)
+		if err != nil {
+			release()
+			return err
+		}
+		msgs[i] = ps.msg
+		msgs[i].Topic = te.Topic
+	}
+
+	// a transactional producer runs one transaction at a time
+	p.txnMu.Lock()
+	defer p.txnMu.Unlock()
+
+	if err := p.Transactions.BeginTxn(ctx); err != nil {
+		p.recordAtomic(msgs, false)
+		release()
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := p.Transactions.WriteMessages(ctx, msgs...); err != nil {
+		p.abortTxn(ctx, msgs)
+		p.recordAtomic(msgs, false)
+		release()
+		return fmt.Errorf("failed to send atomic events: %w", err)
+	}
+
+	if err := p.Transactions.CommitTxn(ctx); err != nil {
+		p.abortTxn(ctx, msgs)
+		p.recordAtomic(msgs, false)
+		release()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	p.recordAtomic(msgs, true)
+	p.logger().Debug("Sent events atomically", "topics", atomicTopics(msgs), "count", len(msgs))
+	return nil
+}
+
+// recordAtomic counts the outcome of an atomic send. The producer's counters
+// take the whole group; the metrics are recorded under each message's
+// destination topic.
+func (p *TelemetryProducer) recordAtomic(msgs []kafka.Message, sent bool) {
+	if sent {
+		p.counters.sent.Add(int64(len(msgs)))
+	} else {
+		p.counters.failed.Add(int64(len(msgs)))
+	}
+	for _, msg := range msgs {
+		m := p.metricsFor(msg.Topic)
+		if sent {
+			m.recordSent(1)
+		} else {
+			m.recordFailed(1)
+		}
+	}
+}
+
+// atomicTopics returns the destination topics of msgs, in order of first
+// appearance
+func atomicTopics(msgs []kafka.Message) []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, msg := range msgs {
+		if !seen[msg.Topic] {
+			seen[msg.Topic] = true
+			topics = append(topics, msg.Topic)
+		}
+	}
+	return topics
+}
+
+// reserveAtomic reserves the RequestIDs of an atomic group with Dedup,
+// once each since request and response events may share one. If any was
+// already sent, the IDs reserved so far are released and ErrDuplicate is
+// returned.
+func (p *TelemetryProducer) reserveAtomic(events []TopicEvent) ([]string, error) {
+	if p.Dedup == nil {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool, len(events))
+	var reserved []string
+	for _, te := range events {
+		id := te.Event.RequestID
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !p.Dedup.Reserve(id) {
+			for _, r := range reserved {
+				p.Dedup.Release(r)
+			}
+			p.counters.duplicate.Add(1)
+			p.dropped(te.Event, DropDuplicate)
+			return nil, fmt.Errorf("skipped atomic events: event %s: %w", id, ErrDuplicate)
+		}
+		reserved = append(reserved, id)
+	}
+	return reserved, nil
+}
+
+// abortTxn aborts the open transaction writing msgs, logging failures since
+// the original error is the one reported to the caller
+func (p *TelemetryProducer) abortTxn(ctx context.Context, msgs []kafka.Message) {
+	if err := p.Transactions.AbortTxn(ctx); err != nil {
+		p.logger().Error("Failed to abort transaction", "topics", atomicTopics(msgs), "error", err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeTxnWriter stages messages in an open transaction and only makes them
+// visible on commit
+type fakeTxnWriter struct {
+	mu        sync.Mutex
+	staged    []kafka.Message
+	committed []kafka.Message
+	open      bool
+	aborts    int
+
+	writeErr  error
+	commitErr error
+}
+
+func (w *fakeTxnWriter) BeginTxn(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.open {
+		return errors.New("transaction already open")
+	}
+	w.open = true
+	return nil
+}
+
+func (w *fakeTxnWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.open {
+		return errors.New("no open transaction")
+	}
+	// the first message lands before the failure, as with a partial batch
+	w.staged = append(w.staged, msgs[0])
+	if w.writeErr != nil {
+		return w.writeErr
+	}
+	w.staged = append(w.staged, msgs[1:]...)
+	return nil
+}
+
+func (w *fakeTxnWriter) CommitTxn(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.commitErr != nil {
+		return w.commitErr
+	}
+	w.committed = append(w.committed, w.staged...)
+	w.staged, w.open = nil, false
+	return nil
+}
+
+func (w *fakeTxnWriter) AbortTxn(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.aborts++
+	w.staged, w.open = nil, false
+	return nil
+}
+
+func requestResponsePair() []TopicEvent {
+	request := testEvent("req-1")
+	response := testEvent("req-1")
+	response.ResponseText = "Hello!"
+	return []TopicEvent{
+		{Topic: "llm.requests", Event: request},
+		{Topic: "llm.responses", Event: response},
+	}
+}
+
+func TestSendAtomicCommitsBoth(t *testing.T) {
+	txn := &fakeTxnWriter{}
+	producer := newTestProducer(&fakeWriter{})
+	producer.Transactions = txn
+
+	if err := producer.SendAtomic(context.Background(), requestResponsePair()); err != nil {
+		t.Fatalf("SendAtomic: %v", err)
+	}
+
+	if len(txn.committed) != 2 {
+		t.Fatalf("committed %d messages, want 2", len(txn.committed))
+	}
+	if txn.committed[0].Topic != "llm.requests" || txn.committed[1].Topic != "llm.responses" {
+		t.Errorf("topics = %s, %s", txn.committed[0].Topic, txn.committed[1].Topic)
+	}
+	if string(txn.committed[0].Key) != "req-1" {
+		t.Errorf("key = %q, want req-1", txn.committed[0].Key)
+	}
+}
+
+func TestSendAtomicRecordsMetricsPerDestinationTopic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	producer := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry", WithMetrics(reg))
+	producer.writer.Close()
+	producer.writer = &fakeWriter{}
+	txn := &fakeTxnWriter{}
+	producer.Transactions = txn
+
+	if err := producer.SendAtomic(context.Background(), requestResponsePair()); err != nil {
+		t.Fatalf("SendAtomic: %v", err)
+	}
+	txn.commitErr = errTestBroker
+	group := requestResponsePair()
+	group[0].Event.RequestID, group[1].Event.RequestID = "req-2", "req-2"
+	if err := producer.SendAtomic(context.Background(), group); err == nil {
+		t.Fatal("expected the failed commit to return an error")
+	}
+
+	expected := `
+# HELP events_failed_total Telemetry events that could not be marshaled or written.
+# TYPE events_failed_total counter
+events_failed_total{topic="llm.requests"} 1
+events_failed_total{topic="llm.responses"} 1
+events_failed_total{topic="llm.telemetry"} 0
+# HELP events_sent_total Telemetry events written to Kafka.
+# TYPE events_sent_total counter
+events_sent_total{topic="llm.requests"} 1
+events_sent_total{topic="llm.responses"} 1
+events_sent_total{topic="llm.telemetry"} 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "events_sent_total", "events_failed_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSendAtomicAbortsOnFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		writer *fakeTxnWriter
+	}{
+		{"write fails", &fakeTxnWriter{writeErr: kafka.NotLeaderForPartition}},
+		{"commit fails", &fakeTxnWriter{commitErr: kafka.ConcurrentTransactions}},
+	}
+
+	for _, tt := range tests {
+		producer := newTestProducer(&fakeWriter{})
+		producer.Transactions = tt.writer
+
+		if err := producer.SendAtomic(context.Background(), requestResponsePair()); err == nil {
+			t.Errorf("%s: SendAtomic succeeded", tt.name)
+		}
+		if len(tt.writer.committed) != 0 {
+			t.Errorf("%s: %d messages visible, want neither", tt.name, len(tt.writer.committed))
+		}
+		if tt.writer.aborts != 1 || tt.writer.open {
+			t.Errorf("%s: aborts = %d, open = %v, want one abort", tt.name, tt.writer.aborts, tt.writer.open)
+		}
+
+		// the producer can start a new transaction afterwards
+		tt.writer.writeErr, tt.writer.commitErr = nil, nil
+		if err := producer.SendAtomic(context.Background(), requestResponsePair()); err != nil || len(tt.writer.committed) != 2 {
+			t.Errorf("%s: retry = %v with %d committed", tt.name, err, len(tt.writer.committed))
+		}
+	}
+}
+
+func TestSendAtomicRequiresTransactionalWriter(t *testing.T) {
+	producer := newTestProducer(&fakeWriter{})
+	if err := producer.SendAtomic(context.Background(), requestResponsePair()); !errors.Is(err, ErrTransactionsUnsupported) {
+		t.Errorf("SendAtomic = %v, want ErrTransactionsUnsupported", err)
+	}
+}
+
+func TestSendAtomicPreparesEventsLikeSendEvent(t *testing.T) {
+	txn := &fakeTxnWriter{}
+	producer := newTestProducer(&fakeWriter{})
+	producer.Transactions = txn
+	producer.Redactor = NewPatternRedactor()
+
+	events := requestResponsePair()
+	events[0].Event.PromptText = "I'm jane@example.com"
+	events[1].Event.ResponseText = "Call me at (555) 867-5309"
+	if err := producer.SendAtomic(context.Background(), events); err != nil {
+		t.Fatalf("SendAtomic: %v", err)
+	}
+
+	for _, msg := range txn.committed {
+		if strings.Contains(string(msg.Value), "jane@example.com") || strings.Contains(string(msg.Value), "867-5309") {
+			t.Errorf("%s message was not redacted: %s", msg.Topic, msg.Value)
+		}
+		var event TelemetryEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.IdempotencyKey == "" {
+			t.Errorf("%s message has no idempotency key", msg.Topic)
+		}
+	}
+}
+
+func TestSendAtomicRejectsInvalidGroup(t *testing.T) {
+	txn := &fakeTxnWriter{}
+	producer := newTestProducer(&fakeWriter{})
+	producer.Transactions = txn
+	producer.ValidateBeforeSend = true
+
+	events := requestResponsePair()
+	events[1].Event.TotalTokens = -1
+	if err := producer.SendAtomic(context.Background(), events); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("SendAtomic = %v, want ErrInvalidEvent", err)
+	}
+	if len(txn.committed) != 0 || txn.open {
+		t.Errorf("%d messages committed, want the group rejected before the transaction", len(txn.committed))
+	}
+}
+
+func TestSendAtomicDeduplicatesGroups(t *testing.T) {
+	txn := &fakeTxnWriter{}
+	producer := newTestProducer(&fakeWriter{})
+	producer.Transactions = txn
+	producer.Dedup = NewDeduper(0, 0)
+
+	if err := producer.SendAtomic(context.Background(), requestResponsePair()); err != nil {
+		t.Fatalf("SendAtomic: %v", err)
+	}
+	if err := producer.SendAtomic(context.Background(), requestResponsePair()); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("resending the group = %v, want ErrDuplicate", err)
+	}
+	if len(txn.committed) != 2 {
+		t.Errorf("committed %d messages, want the first group only", len(txn.committed))
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UserState is what a UserStateTable knows about one user
+type UserState struct {
+	UserID string `json:"user_id"`
+	// LastSeen is the timestamp of the user's latest event
+	LastSeen     time.Time `json:"last_seen"`
+	TotalCostUsd float64   `json:"total_cost_usd"`
+	RequestCount int64     `json:"request_count"`
+	// Models are the models the user called, sorted
+	Models []string `json:"models"`
+}
+
+// UserStateConfig configures a UserStateTable
+type UserStateConfig struct {
+	// IdleTimeout is how long users are kept after the table last processed
+	// an event of theirs (default: 24h)
+	IdleTimeout time.Duration
+	// EvictInterval also evicts idle users this often in the background (optional)
+	EvictInterval time.Duration
+	// SnapshotPath is a file the table is restored from when created and
+	// saved to by Snapshot and Close, for warm restarts (optional)
+	SnapshotPath string
+	// Logger receives background evictions (default: slog.Default())
+	Logger *slog.Logger
+}
+
+// UserStateTable materializes per-user state from the telemetry stream for
+// real-time user dashboards. It is a Sink, and its Handle method is an
+// EventHandler for TelemetryConsumer.Run. Reads are safe concurrently with
+// updates.
+type UserStateTable struct {
+	mu     sync.RWMutex
+	config UserStateConfig
+	now    func() time.Time
+	users  map[string]*userState
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// userState is the mutable state of one user; models is a set
+type userState struct {
+	lastSeen     time.Time
+	totalCostUsd float64
+	requestCount int64
+	models       map[string]struct{}
+	// touched is the processing time of the latest event, for EvictIdle
+	touched time.Time
+}
+
+// NewUserStateTable creates a table, applying defaults for zero config
+// values, restores it from SnapshotPath if the file exists, and starts
+// evicting idle users when EvictInterval is set
+func NewUserStateTable(config UserStateConfig) (*UserStateTable, error) {
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 24 * time.Hour
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	t := &UserStateTable{
+		config: config,
+		now:    time.Now,
+		users:  make(map[string]*userState),
+		done:   make(chan struct{}),
+	}
+	if err := t.restore(); err != nil {
+		return nil, err
+	}
+	if config.EvictInterval > 0 {
+		t.wg.Add(1)
+		go t.run()
+	}
+	return t, nil
+}
+
+// Observe updates the state of the event's user. Events without a UserID
+// are ignored.
+func (t *UserStateTable) Observe(event TelemetryEvent) {
+	if event.UserID == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.users[event.UserID]
+	if !ok {
+		state = &userState{models: make(map[string]struct{})}
+		t.users[event.UserID] = state
+	}
+	if seen := eventTime(event); seen.After(state.lastSeen) {
+		state.lastSeen = seen
+	}
+	state.touched = t.now()
+	state.totalCostUsd += event.CostUsd
+	state.requestCount++
+	if event.ModelName != "" {
+		state.models[event.ModelName] = struct{}{}
+	}
+}
+
+// Handle observes the event; it is an EventHandler
+func (t *UserStateTable) Handle(ctx context.Context, event TelemetryEvent) error {
+	t.Observe(event)
+	return nil
+}
+
+// Write observes each event of the batch
+func (t *UserStateTable) Write(ctx context.Context, events []TelemetryEvent) error {
+	t.mu.RLock()
+	closed := t.closed
+	t.mu.RUnlock()
+	if closed {
+		return ErrSinkClosed
+	}
+
+	for _, event := range events {
+		t.Observe(event)
+	}
+	return nil
+}
+
+// GetUserState returns the state of a user, and false if the table has no
+// events from them
+func (t *UserStateTable) GetUserState(userID string) (UserState, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	state, ok := t.users[userID]
+	if !ok {
+		return UserState{}, false
+	}
+	return state.export(userID), true
+}
+
+// Len returns the number of users in the table
+func (t *UserStateTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.users)
+}
+
+// EvictIdle removes the users the table has processed no event of for
+// IdleTimeout and returns how many were removed. Idleness is measured in
+// processing time, so replaying old events does not evict their users.
+func (t *UserStateTable) EvictIdle() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := t.now().Add(-t.config.IdleTimeout)
+	evicted := 0
+	for userID, state := range t.users {
+		if state.touched.Before(cutoff) {
+			delete(t.users, userID)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Snapshot atomically writes the table to SnapshotPath. It does nothing
+// without a SnapshotPath.
+func (t *UserStateTable) Snapshot() error {
+	if t.config.SnapshotPath == "" {
+		return nil
+	}
+
+	t.mu.RLock()
+	states := make([]UserState, 0, len(t.users))
+	for userID, state := range t.users {
+		states = append(states, state.export(userID))
+	}
+	t.mu.RUnlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].UserID < states[j].UserID })
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+
+	tmp := t.config.SnapshotPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write user state snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, t.config.SnapshotPath); err != nil {
+		return fmt.Errorf("failed to write user state snapshot: %w", err)
+	}
+	return nil
+}
+
+// Close stops background eviction and saves a final snapshot
+func (t *UserStateTable) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mu.Unlock()
+
+	close(t.done)
+	t.wg.Wait()
+	return t.Snapshot()
+}
+
+// run evicts idle users every EvictInterval until Close
+func (t *UserStateTable) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.config.EvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if evicted := t.EvictIdle(); evicted > 0 {
+				t.config.Logger.Info("Evicted idle users from the user state table", "evicted", evicted)
+			}
+		}
+	}
+}
+
+// restore loads the table from SnapshotPath, if there is one
+func (t *UserStateTable) restore() error {
+	if t.config.SnapshotPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.config.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read user state snapshot: %w", err)
+	}
+
+	var states []UserState
+	if err := json.Unmarshal(data, &states); err != nil {
+		return fmt.Errorf("failed to parse user state snapshot: %w", err)
+	}
+	// restored users get a full IdleTimeout from the restart
+	now := t.now()
+	for _, s := range states {
+		state := &userState{
+			lastSeen:     s.LastSeen,
+			totalCostUsd: s.TotalCostUsd,
+			requestCount: s.RequestCount,
+			models:       make(map[string]struct{}, len(s.Models)),
+			touched:      now,
+		}
+		for _, model := range s.Models {
+			state.models[model] = struct{}{}
+		}
+		t.users[s.UserID] = state
+	}
+	return nil
+}
+
+// export copies the state for callers
+func (s *userState) export(userID string) UserState {
+	models := make([]string, 0, len(s.models))
+	for model := range s.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	return UserState{
+		UserID:       userID,
+		LastSeen:     s.lastSeen,
+		TotalCostUsd: s.totalCostUsd,
+		RequestCount: s.requestCount,
+		Models:       models,
+	}
+}
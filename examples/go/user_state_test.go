@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUserStateTableUpdatesPerUser(t *testing.T) {
+	table, err := NewUserStateTable(UserStateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	first := spendAt("user-1", 0.5, start.Add(time.Minute))
+	second := spendAt("user-1", 0.25, start)
+	second.ModelName = "claude-3-opus"
+	if err := table.Write(context.Background(), []TelemetryEvent{first, second, spendAt("user-2", 1, start)}); err != nil {
+		t.Fatal(err)
+	}
+	table.Handle(context.Background(), spendAt("", 1, start))
+
+	state, ok := table.GetUserState("user-1")
+	if !ok {
+		t.Fatal("no state for user-1")
+	}
+	want := UserState{
+		UserID:       "user-1",
+		LastSeen:     start.Add(time.Minute),
+		TotalCostUsd: 0.75,
+		RequestCount: 2,
+		Models:       []string{"claude-3-opus", "gpt-4"},
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("GetUserState(user-1) = %+v, want %+v", state, want)
+	}
+	if table.Len() != 2 {
+		t.Errorf("Len() = %d, want 2 users, ignoring the event without a user", table.Len())
+	}
+	if _, ok := table.GetUserState("user-3"); ok {
+		t.Error("GetUserState returned state for an unknown user")
+	}
+}
+
+func TestUserStateTableEvictsIdleUsers(t *testing.T) {
+	table, err := NewUserStateTable(UserStateConfig{IdleTimeout: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	table.now = func() time.Time { return now }
+
+	table.Observe(spendAt("user-idle", 1, now))
+	now = now.Add(2 * time.Hour)
+	// a replayed event from long ago still counts as activity
+	table.Observe(spendAt("user-active", 1, now.Add(-48*time.Hour)))
+
+	if evicted := table.EvictIdle(); evicted != 1 {
+		t.Errorf("EvictIdle() = %d, want 1", evicted)
+	}
+	if _, ok := table.GetUserState("user-idle"); ok {
+		t.Error("idle user was not evicted")
+	}
+	if _, ok := table.GetUserState("user-active"); !ok {
+		t.Error("active user was evicted")
+	}
+}
+
+func TestUserStateTableRestoresSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	table, err := NewUserStateTable(UserStateConfig{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Observe(spendAt("user-1", 0.5, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)))
+	want, _ := table.GetUserState("user-1")
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Write(context.Background(), nil); err != ErrSinkClosed {
+		t.Errorf("Write after Close returned %v, want ErrSinkClosed", err)
+	}
+
+	restored, err := NewUserStateTable(UserStateConfig{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if got, ok := restored.GetUserState("user-1"); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("restored state = %+v, want %+v", got, want)
+	}
+}
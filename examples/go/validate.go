@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidEvent is wrapped by the errors Validate returns
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Validate checks the fields downstream anomaly detection relies on and
+// returns an error naming the first offending field
+func (e TelemetryEvent) Validate() error {
+	switch {
+	case e.ServiceName == "":
+		return fmt.Errorf("%w: service_name is required", ErrInvalidEvent)
+	case e.ModelName == "":
+		return fmt.Errorf("%w: model_name is required", ErrInvalidEvent)
+	case e.PromptTokens < 0 || e.CompletionTokens < 0:
+		return fmt.Errorf("%w: prompt_tokens and completion_tokens must be non-negative", ErrInvalidEvent)
+	case e.TotalTokens != e.PromptTokens+e.CompletionTokens:
+		return fmt.Errorf("%w: total_tokens is %d, want prompt_tokens + completion_tokens = %d",
+			ErrInvalidEvent, e.TotalTokens, e.PromptTokens+e.CompletionTokens)
+	case e.CostUsd < 0:
+		return fmt.Errorf("%w: cost_usd is negative (%g)", ErrInvalidEvent, e.CostUsd)
+	case !validEndpoint(e.EndpointType):
+		return fmt.Errorf("%w: unknown endpoint_type %q", ErrInvalidEvent, e.EndpointType)
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, e.Timestamp); err != nil {
+		return fmt.Errorf("%w: timestamp %q is not RFC 3339", ErrInvalidEvent, e.Timestamp)
+	}
+	return nil
+}
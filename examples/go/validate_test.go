@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateAcceptsValidEvent(t *testing.T) {
+	if err := testEvent("req-1").Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(*TelemetryEvent)
+		field  string
+	}{
+		{"missing service", func(e *TelemetryEvent) { e.ServiceName = "" }, "service_name"},
+		{"missing model", func(e *TelemetryEvent) { e.ModelName = "" }, "model_name"},
+		{"token mismatch", func(e *TelemetryEvent) { e.TotalTokens = 400 }, "total_tokens"},
+		{"negative tokens", func(e *TelemetryEvent) { e.PromptTokens, e.TotalTokens = -1, 299 }, "prompt_tokens"},
+		{"negative cost", func(e *TelemetryEvent) { e.CostUsd = -0.01 }, "cost_usd"},
+		{"unknown endpoint", func(e *TelemetryEvent) { e.EndpointType = "audio" }, "endpoint_type"},
+		{"missing timestamp", func(e *TelemetryEvent) { e.Timestamp = "" }, "timestamp"},
+		{"malformed timestamp", func(e *TelemetryEvent) { e.Timestamp = "2024-01-15 10:30:45" }, "timestamp"},
+	}
+
+	for _, tc := range cases {
+		event := testEvent("req-1")
+		tc.modify(&event)
+
+		err := event.Validate()
+		if !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("%s: Validate() = %v, want ErrInvalidEvent", tc.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.field) {
+			t.Errorf("%s: error %q does not name %s", tc.name, err, tc.field)
+		}
+	}
+}
+
+func TestProducerRejectsInvalidEvents(t *testing.T) {
+	w := &fakeWriter{}
+	p := newTestProducer(w)
+	p.ValidateBeforeSend = true
+
+	invalid := testEvent("req-1")
+	invalid.ServiceName = ""
+	err := p.SendEvents(context.Background(), []TelemetryEvent{invalid, testEvent("req-2")})
+	if !errors.Is(err, ErrInvalidEvent) || !strings.Contains(err.Error(), "req-1") {
+		t.Errorf("SendEvents() = %v, want ErrInvalidEvent naming req-1", err)
+	}
+	if msgs := w.Messages(); len(msgs) != 1 {
+		t.Errorf("sent %d messages, want only the valid event", len(msgs))
+	}
+	if got := p.Report().Dropped.Invalid; got != 1 {
+		t.Errorf("Dropped.Invalid = %d, want 1", got)
+	}
+
+	// with validation off the event is sent as is
+	p.ValidateBeforeSend = false
+	if err := p.SendEvent(context.Background(), invalid); err != nil {
+		t.Errorf("SendEvent() without validation = %v, want nil", err)
+	}
+}
+
+func TestNewTelemetryProducerValidatesByDefault(t *testing.T) {
+	p := NewTelemetryProducer([]string{"localhost:9092"}, "llm.telemetry")
+	defer p.writer.Close()
+
+	if !p.ValidateBeforeSend {
+		t.Error("ValidateBeforeSend = false, want true by default")
+	}
+}
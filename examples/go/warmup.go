@@ -0,0 +1,65 @@
+package main
+
+import "sync"
+
+// DetectorDebug reports a detector's warm-up state for each key it has seen
+type DetectorDebug struct {
+	MinSamples int                  `json:"min_samples"`
+	Keys       map[string]KeyWarmup `json:"keys"`
+}
+
+// KeyWarmup is the warm-up state of one key (a model, session, ...)
+type KeyWarmup struct {
+	Samples   int  `json:"samples"`
+	WarmingUp bool `json:"warming_up"`
+}
+
+// warmupGate suppresses flagging for a key until it has been observed
+// minSamples times, avoiding cold-start false positives before a baseline
+// exists. Detectors embed it and consult observe before flagging; its
+// Debug method is promoted onto the detector.
+type warmupGate struct {
+	gateMu     sync.Mutex
+	minSamples int
+	samples    map[string]int
+}
+
+// observe counts an observation of key and reports whether the key is warm
+func (g *warmupGate) observe(key string) bool {
+	g.gateMu.Lock()
+	defer g.gateMu.Unlock()
+
+	if g.samples == nil {
+		g.samples = make(map[string]int)
+	}
+	g.samples[key]++
+	return g.samples[key] >= g.minSamples
+}
+
+// forget drops a key's count, for detectors that evict idle keys
+func (g *warmupGate) forget(key string) {
+	g.gateMu.Lock()
+	defer g.gateMu.Unlock()
+
+	delete(g.samples, key)
+}
+
+// WarmingUp reports whether key has fewer than MinSamples observations
+func (g *warmupGate) WarmingUp(key string) bool {
+	g.gateMu.Lock()
+	defer g.gateMu.Unlock()
+
+	return g.samples[key] < g.minSamples
+}
+
+// Debug returns the warm-up state of every key seen so far
+func (g *warmupGate) Debug() DetectorDebug {
+	g.gateMu.Lock()
+	defer g.gateMu.Unlock()
+
+	debug := DetectorDebug{MinSamples: g.minSamples, Keys: make(map[string]KeyWarmup, len(g.samples))}
+	for key, samples := range g.samples {
+		debug.Keys[key] = KeyWarmup{Samples: samples, WarmingUp: samples < g.minSamples}
+	}
+	return debug
+}
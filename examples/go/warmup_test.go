@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWarmupGateSuppressesUntilMinSamples(t *testing.T) {
+	d := NewDegenerateResponseDetector(DegenerateResponseConfig{MinSamples: 5})
+
+	degenerate := testEvent("req")
+	degenerate.CompletionTokens = 0
+	for i := 1; i < 5; i++ {
+		if anomalies := d.Observe(degenerate); len(anomalies) != 0 {
+			t.Fatalf("observation %d flagged while warming up", i)
+		}
+	}
+
+	debug := d.Debug()
+	if key := debug.Keys["gpt-4"]; !key.WarmingUp || key.Samples != 4 || debug.MinSamples != 5 {
+		t.Errorf("Debug = %+v, want gpt-4 warming up with 4 of 5 samples", debug)
+	}
+
+	if anomalies := d.Observe(degenerate); len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies at MinSamples, want 1", len(anomalies))
+	}
+	if d.WarmingUp("gpt-4") {
+		t.Error("gpt-4 still warming up after MinSamples observations")
+	}
+}
+
+func TestWarmupGateIsPerKey(t *testing.T) {
+	d := NewDegenerateResponseDetector(DegenerateResponseConfig{MinSamples: 3})
+
+	for i := 0; i < 3; i++ {
+		d.Observe(testEvent("req"))
+	}
+
+	other := testEvent("req")
+	other.ModelName = "claude-3"
+	other.CompletionTokens = 0
+	if anomalies := d.Observe(other); len(anomalies) != 0 {
+		t.Error("a new model was flagged on its first observation")
+	}
+	if !d.WarmingUp("claude-3") || d.WarmingUp("gpt-4") {
+		t.Errorf("Debug = %+v, want only claude-3 warming up", d.Debug())
+	}
+}
+
+func TestBurstDetectorMinSamples(t *testing.T) {
+	d := NewBurstDetector(BurstConfig{Window: time.Minute, MaxRequests: 2, MinSamples: 5})
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	var flagged []int
+	for i := 1; i <= 6; i++ {
+		if len(d.Observe(eventAt("req", "session-1", start.Add(time.Duration(i)*time.Second)))) > 0 {
+			flagged = append(flagged, i)
+		}
+	}
+
+	if len(flagged) != 2 || flagged[0] != 5 {
+		t.Errorf("flagged requests %v, want [5 6]", flagged)
+	}
+}